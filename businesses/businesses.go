@@ -0,0 +1,277 @@
+// Package businesses keeps the directory of businesses and their branches
+// that registrants belong to, with photo metadata from the maps API.
+package businesses
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"project/db"
+	"project/models"
+)
+
+// MapsIDPattern accepts maps business ids such as
+// 0x47e66e2964e34e2d:0x8ddca9ee380ef7e0 and place ids such as ChIJ...
+var MapsIDPattern = regexp.MustCompile(`^[A-Za-z0-9:_-]{4,256}$`)
+
+// ErrHasBranches is returned when deleting a business that still has branches.
+var ErrHasBranches = errors.New("business has branches; delete or move them first")
+
+// ErrMapsIDTaken is returned when another business has the same maps id.
+var ErrMapsIDTaken = errors.New("maps_business_id is already used by another business")
+
+// businessColumns is the select list scanBusiness expects.
+const businessColumns = "id, name, parent_id, maps_business_id, address, phone, website, photos_fetched_at, created_by, created_at, updated_at"
+
+// scanBusiness reads one businesses row.
+func scanBusiness(row interface{ Scan(...interface{}) error }) (*models.Business, error) {
+	var b models.Business
+	var parentID sql.NullInt64
+	var mapsID sql.NullString
+	var fetchedAt sql.NullTime
+	if err := row.Scan(&b.ID, &b.Name, &parentID, &mapsID, &b.Address, &b.Phone, &b.Website, &fetchedAt, &b.CreatedBy, &b.CreatedAt, &b.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if parentID.Valid {
+		b.ParentID = &parentID.Int64
+	}
+	b.MapsBusinessID = mapsID.String
+	if fetchedAt.Valid {
+		b.PhotosFetchedAt = &fetchedAt.Time
+	}
+	return &b, nil
+}
+
+// Get returns a business, or nil if it does not exist.
+func Get(id int64) (*models.Business, error) {
+	b, err := scanBusiness(db.DB.QueryRow("SELECT "+businessColumns+" FROM businesses WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return b, err
+}
+
+// Exists reports whether the business or branch exists.
+func Exists(id int64) (bool, error) {
+	var count int
+	err := db.DB.QueryRow("SELECT COUNT(*) FROM businesses WHERE id = ?", id).Scan(&count)
+	return count > 0, err
+}
+
+// Filter selects businesses for List.
+type Filter struct {
+	Query    string // part of the name
+	ParentID int64  // only branches of this business
+	TopLevel bool   // only businesses that are not branches
+	Limit    int
+}
+
+// List returns the matching businesses ordered by name.
+func List(f Filter) ([]models.Business, error) {
+	var conditions []string
+	var args []interface{}
+	if f.Query != "" {
+		conditions = append(conditions, "name LIKE ?")
+		args = append(args, "%"+db.EscapeLike(f.Query)+"%")
+	}
+	if f.ParentID != 0 {
+		conditions = append(conditions, "parent_id = ?")
+		args = append(args, f.ParentID)
+	}
+	if f.TopLevel {
+		conditions = append(conditions, "parent_id IS NULL")
+	}
+	query := "SELECT " + businessColumns + " FROM businesses"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY name, id LIMIT ?"
+	args = append(args, f.Limit)
+
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.Business{}
+	for rows.Next() {
+		b, err := scanBusiness(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *b)
+	}
+	return list, rows.Err()
+}
+
+// Validate checks and trims the fields of b. A parent must exist and must
+// not itself be a branch, and a business with branches cannot become one.
+func Validate(b *models.Business) error {
+	b.Name = strings.TrimSpace(b.Name)
+	b.MapsBusinessID = strings.TrimSpace(b.MapsBusinessID)
+	b.Address = strings.TrimSpace(b.Address)
+	b.Phone = strings.TrimSpace(b.Phone)
+	b.Website = strings.TrimSpace(b.Website)
+
+	switch {
+	case b.Name == "":
+		return fmt.Errorf("name is required")
+	case len(b.Name) > 255:
+		return fmt.Errorf("name must be at most 255 characters")
+	case b.MapsBusinessID != "" && !MapsIDPattern.MatchString(b.MapsBusinessID):
+		return fmt.Errorf("maps_business_id is not a valid maps business id")
+	case len(b.Address) > 500:
+		return fmt.Errorf("address must be at most 500 characters")
+	case len(b.Phone) > 50:
+		return fmt.Errorf("phone must be at most 50 characters")
+	case len(b.Website) > 500:
+		return fmt.Errorf("website must be at most 500 characters")
+	}
+	if b.Website != "" {
+		if u, err := url.Parse(b.Website); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return fmt.Errorf("website must be an absolute http or https URL")
+		}
+	}
+
+	if b.ParentID == nil {
+		return nil
+	}
+	if *b.ParentID == b.ID {
+		return fmt.Errorf("a business cannot be its own branch")
+	}
+	parent, err := Get(*b.ParentID)
+	if err != nil {
+		return err
+	}
+	if parent == nil {
+		return fmt.Errorf("parent_id does not exist")
+	}
+	if parent.ParentID != nil {
+		return fmt.Errorf("parent_id is a branch; branches cannot have branches")
+	}
+	if b.ID != 0 {
+		var branches int
+		if err := db.DB.QueryRow("SELECT COUNT(*) FROM businesses WHERE parent_id = ?", b.ID).Scan(&branches); err != nil {
+			return err
+		}
+		if branches > 0 {
+			return fmt.Errorf("a business with branches cannot become a branch")
+		}
+	}
+	return nil
+}
+
+// Create inserts a validated business, setting its id and timestamps.
+func Create(b *models.Business) error {
+	if err := checkMapsID(b); err != nil {
+		return err
+	}
+	now := time.Now()
+	res, err := db.DB.Exec(`INSERT INTO businesses (name, parent_id, maps_business_id, address, phone, website, created_by, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		b.Name, b.ParentID, nullString(b.MapsBusinessID), b.Address, b.Phone, b.Website, b.CreatedBy, now, now)
+	if err != nil {
+		return err
+	}
+	b.ID, err = res.LastInsertId()
+	b.CreatedAt, b.UpdatedAt = now, now
+	return err
+}
+
+// Update saves a validated business. Changing its maps id drops the photos
+// fetched for the old one.
+func Update(b *models.Business, previousMapsID string) error {
+	if err := checkMapsID(b); err != nil {
+		return err
+	}
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	_, err = tx.Exec(`UPDATE businesses SET name = ?, parent_id = ?, maps_business_id = ?, address = ?, phone = ?, website = ?, updated_at = ?
+		WHERE id = ?`,
+		b.Name, b.ParentID, nullString(b.MapsBusinessID), b.Address, b.Phone, b.Website, now, b.ID)
+	if err != nil {
+		return err
+	}
+	if b.MapsBusinessID != previousMapsID {
+		if _, err := tx.Exec("DELETE FROM business_photos WHERE business_id = ?", b.ID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("UPDATE businesses SET photos_fetched_at = NULL WHERE id = ?", b.ID); err != nil {
+			return err
+		}
+		b.PhotosFetchedAt = nil
+	}
+	b.UpdatedAt = now
+	return tx.Commit()
+}
+
+// Delete removes a business without branches and its photos. Its registrants
+// are kept, including rows still waiting in temp, and no longer belong to a
+// business. It reports false if there was no such business.
+func Delete(id int64) (bool, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var branches int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM businesses WHERE parent_id = ?", id).Scan(&branches); err != nil {
+		return false, err
+	}
+	if branches > 0 {
+		return false, ErrHasBranches
+	}
+	res, err := tx.Exec("DELETE FROM businesses WHERE id = ?", id)
+	if err != nil {
+		return false, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return false, nil
+	}
+	if _, err := tx.Exec("UPDATE users SET business_id = NULL WHERE business_id = ?", id); err != nil {
+		return false, err
+	}
+	if _, err := tx.Exec("UPDATE temp SET business_id = NULL WHERE business_id = ?", id); err != nil {
+		return false, err
+	}
+	if _, err := tx.Exec("DELETE FROM business_photos WHERE business_id = ?", id); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// checkMapsID reports ErrMapsIDTaken before the unique key would.
+func checkMapsID(b *models.Business) error {
+	if b.MapsBusinessID == "" {
+		return nil
+	}
+	var count int
+	err := db.DB.QueryRow("SELECT COUNT(*) FROM businesses WHERE maps_business_id = ? AND id <> ?", b.MapsBusinessID, b.ID).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrMapsIDTaken
+	}
+	return nil
+}
+
+// nullString stores an empty string as NULL, so unset maps ids do not collide.
+func nullString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
@@ -0,0 +1,165 @@
+package businesses
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"project/config"
+	"project/db"
+	"project/models"
+	"project/rapidapi"
+)
+
+// ListPhotos returns the stored photo metadata of a business.
+func ListPhotos(businessID int64) ([]models.BusinessPhoto, error) {
+	rows, err := db.DB.Query(`SELECT id, business_id, photo_id, url, large_url, taken_at, metadata
+		FROM business_photos WHERE business_id = ? ORDER BY id`, businessID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	photos := []models.BusinessPhoto{}
+	for rows.Next() {
+		var p models.BusinessPhoto
+		var largeURL sql.NullString
+		var takenAt sql.NullTime
+		var metadata string
+		if err := rows.Scan(&p.ID, &p.BusinessID, &p.PhotoID, &p.URL, &largeURL, &takenAt, &metadata); err != nil {
+			return nil, err
+		}
+		p.LargeURL = largeURL.String
+		if takenAt.Valid {
+			p.TakenAt = &takenAt.Time
+		}
+		p.Metadata = json.RawMessage(metadata)
+		photos = append(photos, p)
+	}
+	return photos, rows.Err()
+}
+
+// RefreshPhotos fetches the photos of a business from the maps API and
+// replaces its stored metadata, keeping at most BUSINESS_PHOTOS_MAX (default
+// 100). The business must have a maps id.
+func RefreshPhotos(ctx context.Context, b *models.Business, lang, country string) ([]models.BusinessPhoto, error) {
+	res, err := rapidapi.BusinessPhotos(ctx, b.MapsBusinessID, lang, country)
+	if err != nil {
+		return nil, err
+	}
+	photos, err := ParsePhotos(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if max := config.GetEnvInt("BUSINESS_PHOTOS_MAX", 100); len(photos) > max {
+		photos = photos[:max]
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM business_photos WHERE business_id = ?", b.ID); err != nil {
+		return nil, err
+	}
+	for i := range photos {
+		p := &photos[i]
+		p.BusinessID = b.ID
+		result, err := tx.Exec(`INSERT INTO business_photos (business_id, photo_id, url, large_url, taken_at, metadata)
+			VALUES (?, ?, ?, ?, ?, ?)`, b.ID, p.PhotoID, p.URL, nullString(p.LargeURL), p.TakenAt, string(p.Metadata))
+		if err != nil {
+			return nil, err
+		}
+		if p.ID, err = result.LastInsertId(); err != nil {
+			return nil, err
+		}
+	}
+	now := time.Now()
+	if _, err := tx.Exec("UPDATE businesses SET photos_fetched_at = ? WHERE id = ?", now, b.ID); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	b.PhotosFetchedAt = &now
+	return photos, nil
+}
+
+// ParsePhotos reads the photo list from a maps photos answer. The list may be
+// "data", "data.photos" or "photos"; each photo needs a photo_url or url and
+// may have photo_id, photo_url_large and photo_datetime_utc or
+// photo_timestamp. Photos without a URL are skipped.
+func ParsePhotos(body []byte) ([]models.BusinessPhoto, error) {
+	var root struct {
+		Data   json.RawMessage   `json:"data"`
+		Photos []json.RawMessage `json:"photos"`
+	}
+	if err := json.Unmarshal(body, &root); err != nil {
+		return nil, fmt.Errorf("invalid photos response: %v", err)
+	}
+	items := root.Photos
+	if len(root.Data) > 0 {
+		if err := json.Unmarshal(root.Data, &items); err != nil {
+			var nested struct {
+				Photos []json.RawMessage `json:"photos"`
+			}
+			if err := json.Unmarshal(root.Data, &nested); err != nil {
+				return nil, fmt.Errorf("invalid photos response: %v", err)
+			}
+			items = nested.Photos
+		}
+	}
+
+	photos := []models.BusinessPhoto{}
+	for _, item := range items {
+		var fields struct {
+			PhotoID       string      `json:"photo_id"`
+			ID            string      `json:"id"`
+			PhotoURL      string      `json:"photo_url"`
+			URL           string      `json:"url"`
+			PhotoURLLarge string      `json:"photo_url_large"`
+			DatetimeUTC   string      `json:"photo_datetime_utc"`
+			Timestamp     json.Number `json:"photo_timestamp"`
+		}
+		if err := json.Unmarshal(item, &fields); err != nil {
+			continue
+		}
+		p := models.BusinessPhoto{PhotoID: first(fields.PhotoID, fields.ID), URL: first(fields.PhotoURL, fields.URL), LargeURL: fields.PhotoURLLarge, Metadata: item}
+		if p.URL == "" {
+			continue
+		}
+		if t, ok := photoTime(fields.DatetimeUTC, fields.Timestamp); ok {
+			p.TakenAt = &t
+		}
+		photos = append(photos, p)
+	}
+	return photos, nil
+}
+
+// photoTime reads the date a photo was taken.
+func photoTime(datetime string, timestamp json.Number) (time.Time, bool) {
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02T15:04:05"} {
+		if t, err := time.Parse(layout, datetime); err == nil {
+			return t.UTC(), true
+		}
+	}
+	if seconds, err := strconv.ParseInt(timestamp.String(), 10, 64); err == nil && seconds > 0 {
+		return time.Unix(seconds, 0).UTC(), true
+	}
+	return time.Time{}, false
+}
+
+// first returns the first non-empty value.
+func first(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
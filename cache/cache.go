@@ -0,0 +1,54 @@
+// Package cache keeps short-lived copies of upstream responses, in memory or
+// in a Redis-compatible server shared by every instance.
+package cache
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"project/config"
+)
+
+// Cache stores values under keys until their TTL passes.
+type Cache interface {
+	// Get returns the value and true, or false if the key is missing or expired.
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	// Set stores the value for ttl.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+}
+
+// FromEnv builds the cache selected by CACHE_BACKEND ("memory" or "redis").
+// The Redis backend connects to REDIS_URL, such as redis://:password@host:6379/0;
+// if that URL is invalid the memory cache is used instead.
+func FromEnv() Cache {
+	switch strings.ToLower(config.GetEnv("CACHE_BACKEND", "memory")) {
+	case "redis":
+		c, err := NewRedis(config.GetEnv("REDIS_URL", "redis://localhost:6379/0"))
+		if err == nil {
+			c.Prefix = config.GetEnv("CACHE_KEY_PREFIX", "registrations:")
+			return c
+		}
+		log.Printf("❌ Error configuring the Redis cache, using memory: %v", err)
+		fallthrough
+	default:
+		return NewMemory(config.GetEnvInt("CACHE_MAX_ENTRIES", 10000))
+	}
+}
+
+// Key joins parts into a cache key, escaping the separator so distinct parts
+// cannot produce the same key.
+func Key(parts ...string) string {
+	escaped := make([]string, len(parts))
+	for i, p := range parts {
+		escaped[i] = strings.NewReplacer(`\`, `\\`, `:`, `\:`).Replace(p)
+	}
+	return strings.Join(escaped, ":")
+}
+
+// errorf wraps backend errors so callers can tell cache failures apart.
+func errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("cache: "+format, args...)
+}
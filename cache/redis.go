@@ -0,0 +1,225 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RedisCache stores entries in a Redis-compatible server (Redis, Valkey,
+// KeyDB, ...) speaking RESP. Only GET and SET with an expiry are used.
+type RedisCache struct {
+	Addr     string
+	Username string
+	Password string
+	DB       int
+	TLS      bool
+	Prefix   string        // prepended to every key
+	Timeout  time.Duration // per command, including connecting
+
+	idle chan *redisConn
+}
+
+// redisConn is a connection that finished its handshake.
+type redisConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// maxIdleRedisConns bounds the connections kept open between commands.
+const maxIdleRedisConns = 8
+
+// NewRedis parses a redis:// or rediss:// (TLS) URL:
+// redis://[[user]:password@]host[:port][/db].
+func NewRedis(rawURL string) (*RedisCache, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "redis" && u.Scheme != "rediss") || u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid Redis URL, expected redis://host:port/db")
+	}
+	c := &RedisCache{Addr: u.Host, TLS: u.Scheme == "rediss", Timeout: 2 * time.Second, idle: make(chan *redisConn, maxIdleRedisConns)}
+	if u.Port() == "" {
+		c.Addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		c.Username = u.User.Username()
+		c.Password, _ = u.User.Password()
+	}
+	if db := strings.TrimPrefix(u.Path, "/"); db != "" {
+		if c.DB, err = strconv.Atoi(db); err != nil {
+			return nil, fmt.Errorf("invalid Redis database %q", db)
+		}
+	}
+	return c, nil
+}
+
+// Get reads the key; a missing key is not an error.
+func (c *RedisCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	reply, err := c.do(ctx, "GET", c.Prefix+key)
+	if err != nil {
+		return nil, false, err
+	}
+	if reply == nil {
+		return nil, false, nil
+	}
+	value, ok := reply.([]byte)
+	if !ok {
+		return nil, false, errorf("unexpected reply to GET")
+	}
+	return value, true, nil
+}
+
+// Set writes the key with a millisecond expiry.
+func (c *RedisCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	ms := ttl.Milliseconds()
+	if ms < 1 {
+		ms = 1
+	}
+	_, err := c.do(ctx, "SET", c.Prefix+key, string(value), "PX", strconv.FormatInt(ms, 10))
+	return err
+}
+
+// do runs one command on a pooled connection. A connection that failed is
+// closed rather than returned to the pool.
+func (c *RedisCache) do(ctx context.Context, args ...string) (interface{}, error) {
+	conn, err := c.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	reply, err := conn.command(c.deadline(ctx), args...)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	select {
+	case c.idle <- conn:
+	default:
+		conn.Close()
+	}
+	if replyErr, ok := reply.(redisError); ok {
+		return nil, replyErr
+	}
+	return reply, nil
+}
+
+// deadline is the earlier of the context deadline and Timeout from now.
+func (c *RedisCache) deadline(ctx context.Context) time.Time {
+	deadline := time.Now().Add(c.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		return d
+	}
+	return deadline
+}
+
+// conn takes an idle connection or opens and authenticates a new one.
+func (c *RedisCache) conn(ctx context.Context) (*redisConn, error) {
+	select {
+	case conn := <-c.idle:
+		return conn, nil
+	default:
+	}
+
+	dialer := &net.Dialer{Deadline: c.deadline(ctx)}
+	var raw net.Conn
+	var err error
+	if c.TLS {
+		host, _, _ := net.SplitHostPort(c.Addr)
+		raw, err = tls.DialWithDialer(dialer, "tcp", c.Addr, &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12})
+	} else {
+		raw, err = dialer.DialContext(ctx, "tcp", c.Addr)
+	}
+	if err != nil {
+		return nil, errorf("error connecting to %s: %v", c.Addr, err)
+	}
+	conn := &redisConn{Conn: raw, r: bufio.NewReader(raw)}
+
+	var setup [][]string
+	if c.Password != "" {
+		if c.Username != "" {
+			setup = append(setup, []string{"AUTH", c.Username, c.Password})
+		} else {
+			setup = append(setup, []string{"AUTH", c.Password})
+		}
+	}
+	if c.DB != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(c.DB)})
+	}
+	for _, args := range setup {
+		reply, err := conn.command(c.deadline(ctx), args...)
+		if err == nil {
+			if replyErr, ok := reply.(redisError); ok {
+				err = replyErr
+			}
+		}
+		if err != nil {
+			conn.Close()
+			return nil, errorf("error running %s: %v", args[0], err)
+		}
+	}
+	return conn, nil
+}
+
+// redisError is an error reply from the server.
+type redisError string
+
+// Error returns the server's message.
+func (e redisError) Error() string { return "cache: redis: " + string(e) }
+
+// command writes a RESP array of bulk strings and reads the reply.
+func (conn *redisConn) command(deadline time.Time, args ...string) (interface{}, error) {
+	if err := conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(a), a)
+	}
+	if _, err := io.WriteString(conn, b.String()); err != nil {
+		return nil, errorf("error writing command: %v", err)
+	}
+	return conn.readReply()
+}
+
+// readReply parses one RESP reply: simple strings, errors, integers and bulk
+// strings, which is all GET, SET, AUTH and SELECT return. A nil bulk string
+// is returned as nil.
+func (conn *redisConn) readReply() (interface{}, error) {
+	line, err := conn.r.ReadString('\n')
+	if err != nil {
+		return nil, errorf("error reading reply: %v", err)
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errorf("empty reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return redisError(line[1:]), nil
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, errorf("invalid bulk length %q", line[1:])
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(conn.r, buf); err != nil {
+			return nil, errorf("error reading reply: %v", err)
+		}
+		return buf[:n], nil
+	default:
+		return nil, errorf("unsupported reply type %q", line[0])
+	}
+}
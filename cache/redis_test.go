@@ -0,0 +1,350 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func replyFrom(s string) *redisConn {
+	return &redisConn{r: bufio.NewReader(strings.NewReader(s))}
+}
+
+func TestReadReply(t *testing.T) {
+	tests := []struct {
+		in   string
+		want interface{}
+	}{
+		{"+OK\r\n", "OK"},
+		{":42\r\n", int64(42)},
+		{"$5\r\nhello\r\n", []byte("hello")},
+		{"$0\r\n\r\n", []byte{}},
+		{"$7\r\nab\r\ncd\n\r\n", []byte("ab\r\ncd\n")},
+		{"$-1\r\n", nil},
+		{"-ERR wrong\r\n", redisError("ERR wrong")},
+	}
+	for _, tt := range tests {
+		got, err := replyFrom(tt.in).readReply()
+		if err != nil {
+			t.Errorf("readReply(%q) error: %v", tt.in, err)
+			continue
+		}
+		if b, ok := tt.want.([]byte); ok {
+			if gb, ok := got.([]byte); !ok || string(gb) != string(b) {
+				t.Errorf("readReply(%q) = %#v, want %q", tt.in, got, b)
+			}
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("readReply(%q) = %#v, want %#v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestReadReplyErrors(t *testing.T) {
+	for _, in := range []string{
+		"",            // connection closed
+		"\r\n",        // empty reply
+		"*1\r\n",      // arrays are not used
+		"$x\r\n",      // invalid bulk length
+		"$5\r\nhel",   // truncated bulk string
+		":nope\r\n",   // invalid integer
+		"+OK no crlf", // truncated line
+	} {
+		if got, err := replyFrom(in).readReply(); err == nil {
+			t.Errorf("readReply(%q) = %#v, want an error", in, got)
+		}
+	}
+}
+
+// fakeRedis answers each command with the reply returned by handle, or
+// closes the connection when handle returns "". It counts connections.
+type fakeRedis struct {
+	ln     net.Listener
+	handle func(args []string) string
+
+	mu    sync.Mutex
+	conns int
+}
+
+func newFakeRedis(t *testing.T, handle func(args []string) string) *fakeRedis {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeRedis{ln: ln, handle: handle}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			f.mu.Lock()
+			f.conns++
+			f.mu.Unlock()
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		reply := f.handle(args)
+		if reply == "" {
+			return
+		}
+		if _, err := conn.Write([]byte(reply)); err != nil {
+			return
+		}
+	}
+}
+
+func (f *fakeRedis) connections() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.conns
+}
+
+// readCommand reads a RESP array of bulk strings as written by command.
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(line[1:], "\r\n"))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		if line, err = r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSuffix(line[1:], "\r\n"))
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func newTestRedis(t *testing.T, addr string) *RedisCache {
+	t.Helper()
+	c, err := NewRedis("redis://" + addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Timeout = time.Second
+	return c
+}
+
+func TestRedisReusesConnections(t *testing.T) {
+	store := map[string]string{}
+	f := newFakeRedis(t, func(args []string) string {
+		switch args[0] {
+		case "SET":
+			store[args[1]] = args[2]
+			return "+OK\r\n"
+		case "GET":
+			v, ok := store[args[1]]
+			if !ok {
+				return "$-1\r\n"
+			}
+			return "$" + strconv.Itoa(len(v)) + "\r\n" + v + "\r\n"
+		}
+		return "-ERR unknown command\r\n"
+	})
+	c := newTestRedis(t, f.ln.Addr().String())
+	c.Prefix = "p:"
+	ctx := context.Background()
+
+	if _, ok, err := c.Get(ctx, "k"); err != nil || ok {
+		t.Fatalf("Get of a missing key = %v, %v", ok, err)
+	}
+	if err := c.Set(ctx, "k", []byte("v\r\n1"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	value, ok, err := c.Get(ctx, "k")
+	if err != nil || !ok || string(value) != "v\r\n1" {
+		t.Fatalf("Get = %q, %v, %v", value, ok, err)
+	}
+	if _, ok := store["p:k"]; !ok {
+		t.Errorf("key was not prefixed: %v", store)
+	}
+	if n := f.connections(); n != 1 {
+		t.Errorf("opened %d connections, want 1", n)
+	}
+}
+
+func TestRedisErrorReplyKeepsConnection(t *testing.T) {
+	f := newFakeRedis(t, func(args []string) string {
+		return "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"
+	})
+	c := newTestRedis(t, f.ln.Addr().String())
+
+	for i := 0; i < 2; i++ {
+		_, _, err := c.Get(context.Background(), "k")
+		var replyErr redisError
+		if !errors.As(err, &replyErr) || !strings.HasPrefix(string(replyErr), "WRONGTYPE") {
+			t.Fatalf("Get error = %v, want the WRONGTYPE reply", err)
+		}
+	}
+	if n := f.connections(); n != 1 {
+		t.Errorf("opened %d connections, want 1: an error reply leaves the connection usable", n)
+	}
+}
+
+func TestRedisDropsBrokenConnections(t *testing.T) {
+	var calls atomic.Int32
+	f := newFakeRedis(t, func(args []string) string {
+		if calls.Add(1) == 1 {
+			return "" // hang up instead of replying
+		}
+		return "+OK\r\n"
+	})
+	c := newTestRedis(t, f.ln.Addr().String())
+	ctx := context.Background()
+
+	if err := c.Set(ctx, "k", []byte("v"), time.Minute); err == nil {
+		t.Fatal("Set succeeded on a closed connection")
+	}
+	if len(c.idle) != 0 {
+		t.Fatalf("a failed connection was returned to the pool")
+	}
+	if err := c.Set(ctx, "k", []byte("v"), time.Minute); err != nil {
+		t.Fatalf("Set on a new connection: %v", err)
+	}
+	if n := f.connections(); n != 2 {
+		t.Errorf("opened %d connections, want 2", n)
+	}
+}
+
+func TestRedisHandshake(t *testing.T) {
+	var mu sync.Mutex
+	var seen []string
+	f := newFakeRedis(t, func(args []string) string {
+		mu.Lock()
+		seen = append(seen, strings.Join(args, " "))
+		mu.Unlock()
+		switch args[0] {
+		case "AUTH":
+			if args[len(args)-1] != "secret" {
+				return "-WRONGPASS invalid username-password pair\r\n"
+			}
+			return "+OK\r\n"
+		case "SELECT":
+			return "+OK\r\n"
+		}
+		return "$-1\r\n"
+	})
+
+	c, err := NewRedis("redis://app:secret@" + f.ln.Addr().String() + "/3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := c.Get(context.Background(), "k"); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	got := strings.Join(seen, "; ")
+	mu.Unlock()
+	if got != "AUTH app secret; SELECT 3; GET k" {
+		t.Errorf("commands = %q", got)
+	}
+
+	c.Password = "wrong"
+	c.idle = make(chan *redisConn, maxIdleRedisConns)
+	_, _, err = c.Get(context.Background(), "k")
+	if err == nil || !strings.Contains(err.Error(), "error running AUTH") || !strings.Contains(err.Error(), "WRONGPASS") {
+		t.Errorf("Get with a wrong password = %v", err)
+	}
+	if len(c.idle) != 0 {
+		t.Errorf("a connection that failed AUTH was pooled")
+	}
+}
+
+func TestRedisConnectError(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	c := newTestRedis(t, addr)
+	_, _, err = c.Get(context.Background(), "k")
+	if err == nil || !strings.Contains(err.Error(), "error connecting to "+addr) {
+		t.Errorf("Get with no server = %v", err)
+	}
+}
+
+func TestRedisPoolIsBounded(t *testing.T) {
+	release := make(chan struct{})
+	f := newFakeRedis(t, func(args []string) string {
+		<-release
+		return "+OK\r\n"
+	})
+	c := newTestRedis(t, f.ln.Addr().String())
+
+	const n = maxIdleRedisConns + 4
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- c.Set(context.Background(), "k", []byte("v"), time.Minute)
+		}()
+	}
+	for f.connections() < n {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(c.idle) != maxIdleRedisConns {
+		t.Errorf("pooled %d connections, want %d", len(c.idle), maxIdleRedisConns)
+	}
+}
+
+func TestNewRedis(t *testing.T) {
+	c, err := NewRedis("rediss://:pw@cache.example.com/2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Addr != "cache.example.com:6379" || !c.TLS || c.Password != "pw" || c.Username != "" || c.DB != 2 {
+		t.Errorf("NewRedis = %+v", c)
+	}
+	for _, bad := range []string{"http://localhost:6379", "redis://", "redis://localhost/db"} {
+		if _, err := NewRedis(bad); err == nil {
+			t.Errorf("NewRedis(%q) succeeded", bad)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+// Package chatbot answers staff questions through a pluggable provider and
+// keeps each user's conversations in the database. The default provider is
+// the custom chatbot API on RapidAPI; a local fake can stand in for it.
+package chatbot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"project/config"
+	"project/models"
+)
+
+// Provider names, as set in CHAT_PROVIDER.
+const (
+	ProviderRapidAPI = "rapidapi"
+	ProviderFake     = "fake"
+)
+
+// Message is one turn of the conversation sent to a provider.
+type Message struct {
+	Role    string `json:"role"` // one of the models.ChatRole* values
+	Content string `json:"content"`
+}
+
+// Provider produces the assistant's reply to the conversation, whose last
+// message is the user's new one, possibly followed by a models.ChatRoleTool
+// message holding the JSON results of the tools run for it. Providers that
+// stream call emit with each piece of the reply as it arrives; others call it
+// once with the whole reply. emit may be nil. The returned reply is the
+// complete text.
+type Provider interface {
+	Name() string
+	Reply(ctx context.Context, conversation []Message, emit func(chunk string) error) (string, error)
+}
+
+var (
+	providerMu sync.Mutex
+	provider   Provider
+)
+
+// SetProvider replaces the provider, such as with a fake in tests.
+func SetProvider(p Provider) {
+	providerMu.Lock()
+	defer providerMu.Unlock()
+	provider = p
+}
+
+// CurrentProvider returns the provider, creating it from CHAT_PROVIDER
+// (default rapidapi) on first use.
+func CurrentProvider() (Provider, error) {
+	providerMu.Lock()
+	defer providerMu.Unlock()
+	if provider != nil {
+		return provider, nil
+	}
+	switch name := strings.ToLower(config.GetEnv("CHAT_PROVIDER", ProviderRapidAPI)); name {
+	case ProviderRapidAPI:
+		provider = NewRapidAPIProvider()
+	case ProviderFake:
+		provider = FakeProvider{}
+	default:
+		return nil, fmt.Errorf("unknown CHAT_PROVIDER %q", name)
+	}
+	return provider, nil
+}
+
+// conversationMessages turns stored history into provider messages.
+func conversationMessages(history []models.ChatMessage) []Message {
+	messages := make([]Message, len(history))
+	for i, m := range history {
+		messages[i] = Message{Role: m.Role, Content: m.Content}
+	}
+	return messages
+}
+
+// Ask sends message to the provider after the last CHAT_HISTORY_MESSAGES
+// (default 20) messages of the conversation and returns the reply. When the
+// provider plans tools, up to CHAT_MAX_TOOL_CALLS (default 3) of the tools the
+// caller may use are run first and their results given to the provider, and
+// returned so the answer can be shown with the rows it used.
+func Ask(ctx context.Context, p Provider, caller Caller, history []models.ChatMessage, message string, emit func(chunk string) error) (string, []ToolResult, error) {
+	if limit := config.GetEnvInt("CHAT_HISTORY_MESSAGES", 20); limit >= 0 && len(history) > limit {
+		history = history[len(history)-limit:]
+	}
+	conversation := append(conversationMessages(history), Message{Role: models.ChatRoleUser, Content: message})
+
+	var results []ToolResult
+	if planner, ok := p.(ToolPlanner); ok {
+		if available := ToolsFor(caller); len(available) > 0 {
+			calls, err := planner.PlanTools(ctx, conversation, available)
+			if err != nil {
+				return "", nil, err
+			}
+			if max := config.GetEnvInt("CHAT_MAX_TOOL_CALLS", 3); len(calls) > max {
+				calls = calls[:max]
+			}
+			for _, call := range calls {
+				results = append(results, RunTool(ctx, caller, call))
+			}
+		}
+	}
+	if len(results) > 0 {
+		m, err := toolMessage(results)
+		if err != nil {
+			return "", nil, err
+		}
+		conversation = append(conversation, m)
+	}
+
+	reply, err := p.Reply(ctx, conversation, emit)
+	if err != nil {
+		return "", nil, err
+	}
+	if strings.TrimSpace(reply) == "" {
+		return "", nil, fmt.Errorf("chatbot %s returned an empty reply", p.Name())
+	}
+	return reply, results, nil
+}
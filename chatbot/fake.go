@@ -0,0 +1,140 @@
+package chatbot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"project/models"
+)
+
+// FakeProvider answers locally so the endpoint, streaming and tools can be
+// exercised without the API. It plans tools from keywords ("how many",
+// "last week", "from gmail.com", "registration no ...") and answers with the
+// tools' summaries, or else echoes the user, one word at a time.
+type FakeProvider struct{}
+
+// Name identifies the provider on stored messages.
+func (FakeProvider) Name() string { return ProviderFake }
+
+// Reply states the tool results, or echoes the last message and says how many
+// came before it.
+func (FakeProvider) Reply(ctx context.Context, conversation []Message, emit func(chunk string) error) (string, error) {
+	last := conversation[len(conversation)-1]
+	reply := fmt.Sprintf("You said: %s (%d earlier messages)", last.Content, len(conversation)-1)
+	if last.Role == models.ChatRoleTool {
+		var results []ToolResult
+		if err := json.Unmarshal([]byte(last.Content), &results); err != nil {
+			return "", err
+		}
+		var sentences []string
+		for _, r := range results {
+			if r.Error != "" {
+				sentences = append(sentences, fmt.Sprintf("I could not run %s: %s.", r.Tool, r.Error))
+			} else {
+				sentences = append(sentences, r.Summary)
+			}
+		}
+		reply = strings.Join(sentences, " ")
+	}
+
+	if emit != nil {
+		for _, word := range strings.SplitAfter(reply, " ") {
+			if err := ctx.Err(); err != nil {
+				return "", err
+			}
+			if err := emit(word); err != nil {
+				return "", err
+			}
+		}
+	}
+	return reply, nil
+}
+
+var (
+	fakeRegistrationNo = regexp.MustCompile(`(?i)registration\s*(?:no\.?|number|#)\s*[:#]?\s*([A-Za-z0-9/_-]+)`)
+	fakeEmailDomain    = regexp.MustCompile(`(?i)(?:from\s+@?|@)([a-z0-9-]+(?:\.[a-z0-9-]+)*\.[a-z]{2,})`)
+	fakeLastDays       = regexp.MustCompile(`(?i)last\s+(\d{1,3})\s+days`)
+	fakeDateSpan       = regexp.MustCompile(`(\d{4}-\d{2}-\d{2})\s*(?:to|and|-|until)\s*(\d{4}-\d{2}-\d{2})`)
+	fakeDate           = regexp.MustCompile(`\d{4}-\d{2}-\d{2}`)
+)
+
+// PlanTools picks at most one tool from keywords in the last message.
+func (FakeProvider) PlanTools(ctx context.Context, conversation []Message, tools []Tool) ([]ToolCall, error) {
+	text := conversation[len(conversation)-1].Content
+	lower := strings.ToLower(text)
+	available := map[string]bool{}
+	for _, t := range tools {
+		available[t.Name] = true
+	}
+
+	if m := fakeRegistrationNo.FindStringSubmatch(text); m != nil && available["find_registration"] {
+		return []ToolCall{{Tool: "find_registration", Arguments: map[string]string{"registration_no": m[1]}}}, nil
+	}
+
+	args := map[string]string{}
+	if from, to, ok := fakeDateRange(lower, time.Now()); ok {
+		args["from"], args["to"] = from, to
+	}
+	if m := fakeEmailDomain.FindStringSubmatch(lower); m != nil {
+		args["email_domain"] = m[1]
+	}
+	switch {
+	case containsAny(lower, "how many", "count", "number of") && available["count_registrations"]:
+		return []ToolCall{{Tool: "count_registrations", Arguments: args}}, nil
+	case containsAny(lower, "list", "show", "who ") && available["list_registrations"]:
+		return []ToolCall{{Tool: "list_registrations", Arguments: args}}, nil
+	}
+	return nil, nil
+}
+
+// fakeDateRange reads a relative or explicit date range as YYYY-MM-DD.
+func fakeDateRange(text string, now time.Time) (string, string, bool) {
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	// Weeks start on Monday.
+	monday := day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	format := func(from, to time.Time) (string, string, bool) {
+		return from.Format("2006-01-02"), to.Format("2006-01-02"), true
+	}
+
+	if m := fakeDateSpan.FindStringSubmatch(text); m != nil {
+		return m[1], m[2], true
+	}
+	if m := fakeLastDays.FindStringSubmatch(text); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		return format(day.AddDate(0, 0, -n+1), day)
+	}
+	switch {
+	case strings.Contains(text, "yesterday"):
+		return format(day.AddDate(0, 0, -1), day.AddDate(0, 0, -1))
+	case strings.Contains(text, "today"):
+		return format(day, day)
+	case strings.Contains(text, "last week"):
+		return format(monday.AddDate(0, 0, -7), monday.AddDate(0, 0, -1))
+	case strings.Contains(text, "this week"):
+		return format(monday, day)
+	case strings.Contains(text, "last month"):
+		first := time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, day.Location())
+		return format(first.AddDate(0, -1, 0), first.AddDate(0, 0, -1))
+	case strings.Contains(text, "this month"):
+		return format(time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, day.Location()), day)
+	}
+	if d := fakeDate.FindString(text); d != "" {
+		return d, d, true
+	}
+	return "", "", false
+}
+
+// containsAny reports whether s contains any of the substrings.
+func containsAny(s string, substrings ...string) bool {
+	for _, sub := range substrings {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
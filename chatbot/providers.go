@@ -0,0 +1,121 @@
+package chatbot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"project/config"
+	"project/models"
+	"project/rapidapi"
+)
+
+// RapidAPIProvider asks the custom chatbot API (rapidapi.Chatbot). It posts
+// {"message", "history"} to CHAT_RAPIDAPI_PATH (default /chat) and does not
+// stream, so emit receives the whole reply at once.
+type RapidAPIProvider struct {
+	Client *rapidapi.Client
+	Path   string
+}
+
+// NewRapidAPIProvider uses the shared chatbot client.
+func NewRapidAPIProvider() *RapidAPIProvider {
+	return &RapidAPIProvider{Client: rapidapi.Chatbot(), Path: config.GetEnv("CHAT_RAPIDAPI_PATH", "/chat")}
+}
+
+// Name identifies the provider on stored messages.
+func (p *RapidAPIProvider) Name() string { return ProviderRapidAPI }
+
+// rapidAPIChatRequest is the body sent to the chatbot API.
+type rapidAPIChatRequest struct {
+	Message string    `json:"message"`
+	History []Message `json:"history"`
+}
+
+// rapidAPIChatResponse accepts the field names chatbot APIs commonly use for
+// the reply text.
+type rapidAPIChatResponse struct {
+	Reply    string `json:"reply"`
+	Response string `json:"response"`
+	Answer   string `json:"answer"`
+	Message  string `json:"message"`
+	Result   string `json:"result"`
+}
+
+// Reply sends the conversation and returns the API's answer. Tool results are
+// sent with the question they answer, since the API only takes user and
+// assistant turns.
+func (p *RapidAPIProvider) Reply(ctx context.Context, conversation []Message, emit func(chunk string) error) (string, error) {
+	last := conversation[len(conversation)-1]
+	request := rapidAPIChatRequest{Message: last.Content, History: conversation[:len(conversation)-1]}
+	if last.Role == models.ChatRoleTool && len(conversation) > 1 {
+		question := conversation[len(conversation)-2]
+		request.Message = question.Content + "\n\nAnswer using only these query results, and say so if they do not answer the question:\n" + last.Content
+		request.History = conversation[:len(conversation)-2]
+	}
+	reply, err := p.ask(ctx, request)
+	if err != nil {
+		return "", err
+	}
+	if emit != nil {
+		if err := emit(reply); err != nil {
+			return "", err
+		}
+	}
+	return reply, nil
+}
+
+// planningPrompt asks the API to pick tools, answering with JSON only.
+const planningPrompt = `You can answer questions about registrations by running these tools:
+%s
+Today is %s. Dates are YYYY-MM-DD. Reply with JSON only, in the form
+{"tool_calls": [{"tool": "<name>", "arguments": {"<parameter>": "<value>"}}]}
+listing the tools needed to answer the question below, or {"tool_calls": []} if none are.
+
+Question: %s`
+
+// PlanTools asks the API which tools answer the latest message. An answer
+// that is not the requested JSON means no tools.
+func (p *RapidAPIProvider) PlanTools(ctx context.Context, conversation []Message, tools []Tool) ([]ToolCall, error) {
+	spec, err := json.Marshal(tools)
+	if err != nil {
+		return nil, err
+	}
+	last := conversation[len(conversation)-1]
+	request := rapidAPIChatRequest{
+		Message: fmt.Sprintf(planningPrompt, spec, time.Now().Format("2006-01-02"), last.Content),
+		History: conversation[:len(conversation)-1],
+	}
+	reply, err := p.ask(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	start, end := strings.Index(reply, "{"), strings.LastIndex(reply, "}")
+	if start < 0 || end < start {
+		return nil, nil
+	}
+	var plan struct {
+		ToolCalls []ToolCall `json:"tool_calls"`
+	}
+	if err := json.Unmarshal([]byte(reply[start:end+1]), &plan); err != nil {
+		return nil, nil
+	}
+	return plan.ToolCalls, nil
+}
+
+// ask posts one request and extracts the reply text.
+func (p *RapidAPIProvider) ask(ctx context.Context, request rapidAPIChatRequest) (string, error) {
+	var response rapidAPIChatResponse
+	if err := p.Client.PostJSON(ctx, p.Path, nil, request, &response); err != nil {
+		return "", err
+	}
+	for _, candidate := range []string{response.Reply, response.Response, response.Answer, response.Message, response.Result} {
+		if strings.TrimSpace(candidate) != "" {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("chatbot API answered without a reply")
+}
@@ -0,0 +1,160 @@
+package chatbot
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"project/db"
+	"project/models"
+)
+
+// maxTitleRunes bounds the title taken from a conversation's first message.
+const maxTitleRunes = 80
+
+// GetConversation returns the user's conversation, or nil if it does not
+// exist or belongs to someone else.
+func GetConversation(id int64, username string) (*models.ChatConversation, error) {
+	var conv models.ChatConversation
+	err := db.DB.QueryRow(`SELECT id, username, title, created_at, updated_at
+		FROM chat_conversations WHERE id = ? AND username = ?`, id, username).
+		Scan(&conv.ID, &conv.Username, &conv.Title, &conv.CreatedAt, &conv.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &conv, nil
+}
+
+// ListConversations returns the user's conversations, most recent first.
+func ListConversations(username string, limit int) ([]models.ChatConversation, error) {
+	rows, err := db.DB.Query(`SELECT id, username, title, created_at, updated_at
+		FROM chat_conversations WHERE username = ? ORDER BY updated_at DESC, id DESC LIMIT ?`, username, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	conversations := []models.ChatConversation{}
+	for rows.Next() {
+		var conv models.ChatConversation
+		if err := rows.Scan(&conv.ID, &conv.Username, &conv.Title, &conv.CreatedAt, &conv.UpdatedAt); err != nil {
+			return nil, err
+		}
+		conversations = append(conversations, conv)
+	}
+	return conversations, rows.Err()
+}
+
+// ListMessages returns a conversation's messages, oldest first.
+func ListMessages(conversationID int64) ([]models.ChatMessage, error) {
+	rows, err := db.DB.Query(`SELECT id, conversation_id, role, content, provider, tool_calls, created_at
+		FROM chat_messages WHERE conversation_id = ? ORDER BY id`, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := []models.ChatMessage{}
+	for rows.Next() {
+		var m models.ChatMessage
+		var toolCalls sql.NullString
+		if err := rows.Scan(&m.ID, &m.ConversationID, &m.Role, &m.Content, &m.Provider, &toolCalls, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		if toolCalls.Valid && toolCalls.String != "" {
+			if err := json.Unmarshal([]byte(toolCalls.String), &m.ToolCalls); err != nil {
+				return nil, fmt.Errorf("invalid tool calls on chat message %d: %v", m.ID, err)
+			}
+		}
+		messages = append(messages, m)
+	}
+	return messages, rows.Err()
+}
+
+// SaveExchange stores the user's message and the reply together, with the
+// tool calls the reply was based on, creating the conversation first when
+// conv.ID is 0. Nothing is stored for a question the provider failed to answer.
+func SaveExchange(conv *models.ChatConversation, question, reply, provider string, toolCalls []models.ChatToolCall) (*models.ChatMessage, error) {
+	var toolCallsJSON interface{}
+	if len(toolCalls) > 0 {
+		data, err := json.Marshal(toolCalls)
+		if err != nil {
+			return nil, err
+		}
+		toolCallsJSON = string(data)
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	if conv.ID == 0 {
+		conv.Title = conversationTitle(question)
+		conv.CreatedAt = now
+		res, err := tx.Exec("INSERT INTO chat_conversations (username, title, created_at, updated_at) VALUES (?, ?, ?, ?)",
+			conv.Username, conv.Title, now, now)
+		if err != nil {
+			return nil, err
+		}
+		if conv.ID, err = res.LastInsertId(); err != nil {
+			return nil, err
+		}
+	} else if _, err := tx.Exec("UPDATE chat_conversations SET updated_at = ? WHERE id = ?", now, conv.ID); err != nil {
+		return nil, err
+	}
+	conv.UpdatedAt = now
+
+	insert := "INSERT INTO chat_messages (conversation_id, username, role, content, provider, tool_calls, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)"
+	if _, err := tx.Exec(insert, conv.ID, conv.Username, models.ChatRoleUser, question, "", nil, now); err != nil {
+		return nil, err
+	}
+	res, err := tx.Exec(insert, conv.ID, conv.Username, models.ChatRoleAssistant, reply, provider, toolCallsJSON, now)
+	if err != nil {
+		return nil, err
+	}
+	answer := &models.ChatMessage{ConversationID: conv.ID, Role: models.ChatRoleAssistant, Content: reply, Provider: provider, ToolCalls: toolCalls, CreatedAt: now}
+	if answer.ID, err = res.LastInsertId(); err != nil {
+		return nil, err
+	}
+	return answer, tx.Commit()
+}
+
+// DeleteConversation removes the user's conversation and its messages,
+// reporting false if there was none.
+func DeleteConversation(id int64, username string) (bool, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("DELETE FROM chat_conversations WHERE id = ? AND username = ?", id, username)
+	if err != nil {
+		return false, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return false, nil
+	}
+	if _, err := tx.Exec("DELETE FROM chat_messages WHERE conversation_id = ?", id); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// conversationTitle is the first line of the message, shortened.
+func conversationTitle(message string) string {
+	title := strings.TrimSpace(strings.SplitN(strings.TrimSpace(message), "\n", 2)[0])
+	if utf8.RuneCountInString(title) > maxTitleRunes {
+		title = string([]rune(title)[:maxTitleRunes-1]) + "…"
+	}
+	return title
+}
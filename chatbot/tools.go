@@ -0,0 +1,174 @@
+package chatbot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+
+	"project/config"
+	"project/masking"
+	"project/models"
+)
+
+// Caller is the user the assistant answers. Tools run with their permissions
+// and return rows masked by their policy.
+type Caller struct {
+	Username string
+	Can      func(permission string) bool
+	Policy   masking.Policy
+}
+
+// ToolParameter is a named string argument of a tool.
+type ToolParameter struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Required    bool   `json:"required,omitempty"`
+}
+
+// Tool is a fixed, parameterized query the assistant may run. Providers only
+// choose the tool and its arguments; they never see or write SQL.
+type Tool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Parameters  []ToolParameter `json:"parameters"`
+	Permission  string          `json:"-"` // the caller must hold it
+	Run         ToolFunc        `json:"-"`
+}
+
+// ToolFunc runs a tool with checked arguments. An ArgumentError is reported
+// to the provider; other errors are logged and reported as a failed query.
+type ToolFunc func(ctx context.Context, caller Caller, args map[string]string) (*ToolResult, error)
+
+// ToolCall is a provider's request to run a tool.
+type ToolCall struct {
+	Tool      string            `json:"tool"`
+	Arguments map[string]string `json:"arguments"`
+}
+
+// ToolResult is what a tool found. Summary states the facts in a sentence so
+// the answer can be grounded on them; Rows are the registrations used.
+type ToolResult struct {
+	Tool      string                   `json:"tool"`
+	Arguments map[string]string        `json:"arguments,omitempty"`
+	Summary   string                   `json:"summary,omitempty"`
+	Count     int                      `json:"count"`
+	Rows      []map[string]interface{} `json:"rows,omitempty"`
+	Error     string                   `json:"error,omitempty"`
+}
+
+// ArgumentError is a tool error caused by its arguments; the message is shown
+// to the provider and the user.
+type ArgumentError string
+
+// Error returns the message.
+func (e ArgumentError) Error() string { return string(e) }
+
+// ToolPlanner is implemented by providers that can choose tools for the
+// latest message. Providers without it answer from the conversation alone.
+type ToolPlanner interface {
+	PlanTools(ctx context.Context, conversation []Message, tools []Tool) ([]ToolCall, error)
+}
+
+var (
+	toolsMu sync.Mutex
+	tools   = map[string]Tool{}
+)
+
+// RegisterTool adds or replaces a tool.
+func RegisterTool(t Tool) {
+	toolsMu.Lock()
+	defer toolsMu.Unlock()
+	tools[t.Name] = t
+}
+
+// ToolsFor returns the tools the caller may use, sorted by name.
+func ToolsFor(caller Caller) []Tool {
+	toolsMu.Lock()
+	defer toolsMu.Unlock()
+	var allowed []Tool
+	for _, t := range tools {
+		if t.Permission == "" || caller.Can(t.Permission) {
+			allowed = append(allowed, t)
+		}
+	}
+	sort.Slice(allowed, func(i, j int) bool { return allowed[i].Name < allowed[j].Name })
+	return allowed
+}
+
+// RunTool runs one call for the caller, checking the tool exists, the caller
+// may use it and the arguments are known. Failures are reported in the result.
+func RunTool(ctx context.Context, caller Caller, call ToolCall) ToolResult {
+	result := ToolResult{Tool: call.Tool, Arguments: call.Arguments}
+	toolsMu.Lock()
+	t, ok := tools[call.Tool]
+	toolsMu.Unlock()
+	if !ok {
+		result.Error = fmt.Sprintf("unknown tool %q", call.Tool)
+		return result
+	}
+	if t.Permission != "" && !caller.Can(t.Permission) {
+		result.Error = "you do not have permission to run this query"
+		return result
+	}
+
+	known := map[string]bool{}
+	for _, p := range t.Parameters {
+		known[p.Name] = true
+		if p.Required && call.Arguments[p.Name] == "" {
+			result.Error = fmt.Sprintf("%s is required", p.Name)
+			return result
+		}
+	}
+	for name := range call.Arguments {
+		if !known[name] {
+			result.Error = fmt.Sprintf("unknown argument %q", name)
+			return result
+		}
+	}
+	args := call.Arguments
+	if args == nil {
+		args = map[string]string{}
+	}
+
+	found, err := t.Run(ctx, caller, args)
+	if argErr, ok := err.(ArgumentError); ok {
+		result.Error = argErr.Error()
+		return result
+	} else if err != nil {
+		log.Printf("❌ Error running assistant tool %s for %s: %v", t.Name, caller.Username, err)
+		result.Error = "the query failed"
+		return result
+	}
+	found.Tool, found.Arguments = result.Tool, result.Arguments
+	return *found
+}
+
+// toolMessage gives the results to the provider. Rows are only included with
+// CHAT_SHARE_ROWS_WITH_PROVIDER=true, since the provider may be a third party;
+// otherwise it sees the summaries and counts.
+func toolMessage(results []ToolResult) (Message, error) {
+	shared := make([]ToolResult, len(results))
+	copy(shared, results)
+	if !config.GetEnvBool("CHAT_SHARE_ROWS_WITH_PROVIDER", false) {
+		for i := range shared {
+			shared[i].Rows = nil
+		}
+	}
+	data, err := json.Marshal(shared)
+	if err != nil {
+		return Message{}, err
+	}
+	return Message{Role: models.ChatRoleTool, Content: string(data)}, nil
+}
+
+// ToolCallRecords keeps what is stored with the answer: no rows.
+func ToolCallRecords(results []ToolResult) []models.ChatToolCall {
+	var records []models.ChatToolCall
+	for _, r := range results {
+		records = append(records, models.ChatToolCall{Tool: r.Tool, Arguments: r.Arguments, Count: r.Count, Error: r.Error})
+	}
+	return records
+}
@@ -0,0 +1,9 @@
+package db
+
+import "strings"
+
+// EscapeLike escapes the LIKE wildcards of s, so it matches literally inside
+// a pattern such as "%" + EscapeLike(s) + "%".
+func EscapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,390 @@
+package db
+
+import (
+	"fmt"
+	"log"
+)
+
+// schemaTables lists the tables the application needs. Each statement is
+// idempotent so Migrate can run on every start-up.
+var schemaTables = []string{
+	`CREATE TABLE IF NOT EXISTS users (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		email VARCHAR(255) NOT NULL,
+		registration_no VARCHAR(100) NOT NULL,
+		phone_no VARCHAR(50) NOT NULL,
+		date VARCHAR(20) NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS temp (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		email VARCHAR(255) NOT NULL,
+		registration_no VARCHAR(100) NOT NULL,
+		phone_no VARCHAR(50) NOT NULL,
+		date VARCHAR(20) NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS signupusers (
+		username VARCHAR(255) PRIMARY KEY,
+		password VARCHAR(255) NOT NULL,
+		dob VARCHAR(20) NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS email_verifications (
+		id BIGINT AUTO_INCREMENT PRIMARY KEY,
+		username VARCHAR(255) NOT NULL,
+		token_hash CHAR(64) NOT NULL,
+		code_hash CHAR(64) NOT NULL,
+		attempts INT NOT NULL DEFAULT 0,
+		expires_at DATETIME NOT NULL,
+		used_at DATETIME NULL,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE KEY uq_email_verifications_token (token_hash),
+		KEY idx_email_verifications_username (username, created_at)
+	)`,
+	`CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+		id BIGINT AUTO_INCREMENT PRIMARY KEY,
+		username VARCHAR(255) NOT NULL,
+		code_hash CHAR(64) NOT NULL,
+		used_at DATETIME NULL,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		KEY idx_mfa_recovery_codes_username (username)
+	)`,
+	`CREATE TABLE IF NOT EXISTS app_settings (
+		name VARCHAR(100) PRIMARY KEY,
+		value TEXT NOT NULL,
+		updated_by VARCHAR(255) NOT NULL,
+		updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`,
+	`CREATE TABLE IF NOT EXISTS oauth_states (
+		state_hash CHAR(64) PRIMARY KEY,
+		provider VARCHAR(50) NOT NULL,
+		nonce VARCHAR(64) NOT NULL,
+		code_verifier VARCHAR(128) NOT NULL,
+		expires_at DATETIME NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS user_identities (
+		provider VARCHAR(50) NOT NULL,
+		subject VARCHAR(255) NOT NULL,
+		username VARCHAR(255) NOT NULL,
+		email VARCHAR(255) NOT NULL,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (provider, subject),
+		KEY idx_user_identities_username (username)
+	)`,
+	`CREATE TABLE IF NOT EXISTS api_keys (
+		id BIGINT AUTO_INCREMENT PRIMARY KEY,
+		name VARCHAR(100) NOT NULL,
+		prefix VARCHAR(32) NOT NULL,
+		key_hash CHAR(64) NOT NULL,
+		scopes VARCHAR(255) NOT NULL,
+		created_by VARCHAR(255) NOT NULL,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		expires_at DATETIME NULL,
+		last_used_at DATETIME NULL,
+		revoked_at DATETIME NULL,
+		UNIQUE KEY uq_api_keys_prefix (prefix)
+	)`,
+	`CREATE TABLE IF NOT EXISTS user_profiles (
+		username VARCHAR(255) PRIMARY KEY,
+		display_name VARCHAR(100) NOT NULL DEFAULT '',
+		dob DATE NULL,
+		preferences TEXT NULL,
+		updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`,
+	`CREATE TABLE IF NOT EXISTS export_jobs (
+		id CHAR(32) PRIMARY KEY,
+		status VARCHAR(20) NOT NULL,
+		format VARCHAR(20) NOT NULL,
+		params TEXT NOT NULL,
+		total_rows INT NOT NULL DEFAULT 0,
+		processed_rows INT NOT NULL DEFAULT 0,
+		file_name VARCHAR(255) NOT NULL DEFAULT '',
+		storage_key VARCHAR(255) NOT NULL DEFAULT '',
+		error TEXT NULL,
+		requested_by VARCHAR(255) NOT NULL,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		started_at DATETIME NULL,
+		finished_at DATETIME NULL,
+		expires_at DATETIME NULL,
+		KEY idx_export_jobs_status (status, expires_at)
+	)`,
+	`CREATE TABLE IF NOT EXISTS report_subscriptions (
+		id BIGINT AUTO_INCREMENT PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		cron_expr VARCHAR(100) NOT NULL,
+		format VARCHAR(16) NOT NULL,
+		window_spec VARCHAR(64) NOT NULL,
+		columns VARCHAR(255) NOT NULL DEFAULT '',
+		sort VARCHAR(255) NOT NULL DEFAULT '',
+		recipients TEXT NOT NULL,
+		enabled TINYINT(1) NOT NULL DEFAULT 1,
+		created_by VARCHAR(255) NOT NULL,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+		last_run_at DATETIME NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS report_deliveries (
+		id BIGINT AUTO_INCREMENT PRIMARY KEY,
+		subscription_id BIGINT NOT NULL,
+		` + "`trigger`" + ` VARCHAR(16) NOT NULL,
+		status VARCHAR(16) NOT NULL,
+		window_start DATE NOT NULL,
+		window_end DATE NOT NULL,
+		row_count INT NOT NULL DEFAULT 0,
+		recipients TEXT NOT NULL,
+		file_name VARCHAR(255) NOT NULL DEFAULT '',
+		error TEXT NULL,
+		started_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		finished_at DATETIME NULL,
+		KEY idx_report_deliveries_subscription (subscription_id, started_at)
+	)`,
+	`CREATE TABLE IF NOT EXISTS imports (
+		id CHAR(32) PRIMARY KEY,
+		file_name VARCHAR(255) NOT NULL,
+		status VARCHAR(16) NOT NULL,
+		dry_run TINYINT(1) NOT NULL,
+		total_rows INT NOT NULL DEFAULT 0,
+		valid_rows INT NOT NULL DEFAULT 0,
+		error_rows INT NOT NULL DEFAULT 0,
+		imported_rows INT NOT NULL DEFAULT 0,
+		error_report_key VARCHAR(255) NOT NULL DEFAULT '',
+		created_by VARCHAR(255) NOT NULL,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`,
+	`CREATE TABLE IF NOT EXISTS export_templates (
+		id BIGINT AUTO_INCREMENT PRIMARY KEY,
+		name VARCHAR(64) NOT NULL UNIQUE,
+		title VARCHAR(255) NOT NULL,
+		columns VARCHAR(255) NOT NULL DEFAULT '',
+		labels TEXT NOT NULL,
+		sort VARCHAR(255) NOT NULL DEFAULT '',
+		header_text VARCHAR(255) NOT NULL DEFAULT '',
+		footer_text VARCHAR(255) NOT NULL DEFAULT '',
+		orientation CHAR(1) NOT NULL DEFAULT 'L',
+		font VARCHAR(16) NOT NULL DEFAULT '',
+		font_size DOUBLE NOT NULL DEFAULT 0,
+		logo MEDIUMBLOB NULL,
+		logo_type VARCHAR(8) NOT NULL DEFAULT '',
+		updated_by VARCHAR(255) NOT NULL,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+	)`,
+	`CREATE TABLE IF NOT EXISTS audit_events (
+		id BIGINT AUTO_INCREMENT PRIMARY KEY,
+		actor VARCHAR(255) NOT NULL,
+		action VARCHAR(64) NOT NULL,
+		resource VARCHAR(255) NOT NULL,
+		details TEXT NOT NULL,
+		ip VARCHAR(64) NOT NULL DEFAULT '',
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		INDEX idx_audit_events_actor (actor),
+		INDEX idx_audit_events_action (action)
+	)`,
+	`CREATE TABLE IF NOT EXISTS erasure_tombstones (
+		id BIGINT AUTO_INCREMENT PRIMARY KEY,
+		email_hash CHAR(64) NOT NULL DEFAULT '',
+		phone_hash CHAR(64) NOT NULL DEFAULT '',
+		mode VARCHAR(16) NOT NULL,
+		counts TEXT NOT NULL,
+		reason VARCHAR(255) NOT NULL DEFAULT '',
+		requested_by VARCHAR(255) NOT NULL,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		KEY idx_erasure_tombstones_email (email_hash),
+		KEY idx_erasure_tombstones_phone (phone_hash)
+	)`,
+	`CREATE TABLE IF NOT EXISTS gmail_accounts (
+		account VARCHAR(255) PRIMARY KEY,
+		token TEXT NOT NULL,
+		scopes VARCHAR(512) NOT NULL DEFAULT '',
+		connected_by VARCHAR(255) NOT NULL DEFAULT '',
+		token_expiry DATETIME NULL,
+		last_refreshed_at DATETIME NULL,
+		last_error TEXT NULL,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+	)`,
+	`CREATE TABLE IF NOT EXISTS gmail_sync_state (
+		account VARCHAR(255) PRIMARY KEY,
+		label VARCHAR(255) NOT NULL,
+		label_id VARCHAR(255) NOT NULL,
+		history_id BIGINT UNSIGNED NOT NULL DEFAULT 0,
+		last_synced_at DATETIME NULL,
+		last_error TEXT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS gmail_messages (
+		account VARCHAR(255) NOT NULL,
+		id VARCHAR(64) NOT NULL,
+		message_id VARCHAR(255) NOT NULL DEFAULT '',
+		status VARCHAR(16) NOT NULL,
+		source VARCHAR(255) NOT NULL DEFAULT '',
+		imported_rows INT NOT NULL DEFAULT 0,
+		error_rows INT NOT NULL DEFAULT 0,
+		error TEXT NULL,
+		processed_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (account, id),
+		KEY idx_gmail_messages_message_id (account, message_id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS notification_outbox (
+		id BIGINT AUTO_INCREMENT PRIMARY KEY,
+		event VARCHAR(64) NOT NULL,
+		channel VARCHAR(20) NOT NULL,
+		recipient VARCHAR(2048) NOT NULL,
+		subject_email VARCHAR(255) NULL,
+		subject VARCHAR(1000) NOT NULL DEFAULT '',
+		body_text TEXT NULL,
+		body_html MEDIUMTEXT NULL,
+		payload MEDIUMTEXT NULL,
+		status VARCHAR(16) NOT NULL,
+		attempts INT NOT NULL DEFAULT 0,
+		next_attempt_at DATETIME NOT NULL,
+		last_error TEXT NULL,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		sent_at DATETIME NULL,
+		KEY idx_notification_outbox_due (status, next_attempt_at),
+		KEY idx_notification_outbox_subject (subject_email)
+	)`,
+	`CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+		id BIGINT AUTO_INCREMENT PRIMARY KEY,
+		url VARCHAR(2048) NOT NULL,
+		events VARCHAR(255) NOT NULL,
+		description VARCHAR(255) NOT NULL DEFAULT '',
+		secret TEXT NOT NULL,
+		enabled TINYINT(1) NOT NULL DEFAULT 1,
+		created_by VARCHAR(255) NOT NULL,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`,
+	`CREATE TABLE IF NOT EXISTS webhook_events (
+		id BIGINT AUTO_INCREMENT PRIMARY KEY,
+		type VARCHAR(64) NOT NULL,
+		data MEDIUMTEXT NOT NULL,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`,
+	`CREATE TABLE IF NOT EXISTS webhook_deliveries (
+		id BIGINT AUTO_INCREMENT PRIMARY KEY,
+		subscription_id BIGINT NOT NULL,
+		event_id BIGINT NOT NULL,
+		status VARCHAR(16) NOT NULL,
+		attempts INT NOT NULL DEFAULT 0,
+		next_attempt_at DATETIME NOT NULL,
+		last_status_code INT NOT NULL DEFAULT 0,
+		last_error TEXT NULL,
+		replay_of BIGINT NULL,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		delivered_at DATETIME NULL,
+		KEY idx_webhook_deliveries_due (status, next_attempt_at),
+		KEY idx_webhook_deliveries_subscription (subscription_id, id),
+		KEY idx_webhook_deliveries_event (event_id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS webhook_attempts (
+		id BIGINT AUTO_INCREMENT PRIMARY KEY,
+		delivery_id BIGINT NOT NULL,
+		attempt INT NOT NULL,
+		status_code INT NOT NULL DEFAULT 0,
+		error TEXT NULL,
+		response_body TEXT NULL,
+		duration_ms BIGINT NOT NULL DEFAULT 0,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		KEY idx_webhook_attempts_delivery (delivery_id, attempt)
+	)`,
+	`CREATE TABLE IF NOT EXISTS chat_conversations (
+		id BIGINT AUTO_INCREMENT PRIMARY KEY,
+		username VARCHAR(255) NOT NULL,
+		title VARCHAR(255) NOT NULL DEFAULT '',
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		KEY idx_chat_conversations_user (username, updated_at)
+	)`,
+	`CREATE TABLE IF NOT EXISTS chat_messages (
+		id BIGINT AUTO_INCREMENT PRIMARY KEY,
+		conversation_id BIGINT NOT NULL,
+		username VARCHAR(255) NOT NULL,
+		role VARCHAR(16) NOT NULL,
+		content MEDIUMTEXT NOT NULL,
+		provider VARCHAR(64) NOT NULL DEFAULT '',
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		KEY idx_chat_messages_conversation (conversation_id, id),
+		KEY idx_chat_messages_user (username)
+	)`,
+	`CREATE TABLE IF NOT EXISTS businesses (
+		id BIGINT AUTO_INCREMENT PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		parent_id BIGINT NULL,
+		maps_business_id VARCHAR(255) NULL,
+		address VARCHAR(500) NOT NULL DEFAULT '',
+		phone VARCHAR(50) NOT NULL DEFAULT '',
+		website VARCHAR(500) NOT NULL DEFAULT '',
+		photos_fetched_at DATETIME NULL,
+		created_by VARCHAR(255) NOT NULL,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+		UNIQUE KEY uq_businesses_maps_id (maps_business_id),
+		KEY idx_businesses_parent (parent_id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS business_photos (
+		id BIGINT AUTO_INCREMENT PRIMARY KEY,
+		business_id BIGINT NOT NULL,
+		photo_id VARCHAR(255) NOT NULL DEFAULT '',
+		url TEXT NOT NULL,
+		large_url TEXT NULL,
+		taken_at DATETIME NULL,
+		metadata TEXT NOT NULL,
+		KEY idx_business_photos_business (business_id, id)
+	)`,
+}
+
+// schemaColumns lists columns added to tables that predate Migrate.
+var schemaColumns = []struct {
+	Table      string
+	Column     string
+	Definition string
+}{
+	{"signupusers", "email_verified", "TINYINT(1) NOT NULL DEFAULT 0"},
+	{"signupusers", "email_verified_at", "DATETIME NULL"},
+	{"signupusers", "role", "VARCHAR(32) NOT NULL DEFAULT 'viewer'"},
+	{"signupusers", "totp_secret", "VARCHAR(255) NULL"},
+	{"signupusers", "totp_enabled", "TINYINT(1) NOT NULL DEFAULT 0"},
+	{"signupusers", "totp_last_step", "BIGINT NOT NULL DEFAULT 0"},
+	{"signupusers", "totp_failed_attempts", "INT NOT NULL DEFAULT 0"},
+	{"signupusers", "totp_locked_until", "DATETIME NULL"},
+	{"signupusers", "deletion_scheduled_at", "DATETIME NULL"},
+	{"oauth_states", "username", "VARCHAR(255) NOT NULL DEFAULT ''"},
+	{"chat_messages", "tool_calls", "TEXT NULL"},
+	{"users", "business_id", "BIGINT NULL"},
+	{"temp", "business_id", "BIGINT NULL"},
+	{"imports", "error_report_expires_at", "DATETIME NULL"},
+	{"notification_outbox", "subject_email", "VARCHAR(255) NULL"},
+}
+
+// Migrate creates missing tables and columns. It must be called after InitDB.
+func Migrate() {
+	for _, statement := range schemaTables {
+		if _, err := DB.Exec(statement); err != nil {
+			log.Fatalf("Error applying schema: %v", err)
+		}
+	}
+
+	for _, col := range schemaColumns {
+		if err := addColumnIfMissing(col.Table, col.Column, col.Definition); err != nil {
+			log.Fatalf("Error adding column %s.%s: %v", col.Table, col.Column, err)
+		}
+	}
+
+	fmt.Println("Database schema is up to date!")
+}
+
+// addColumnIfMissing adds a column unless information_schema already reports it.
+func addColumnIfMissing(table, column, definition string) error {
+	var count int
+	query := `SELECT COUNT(*) FROM information_schema.COLUMNS
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = ?`
+	if err := DB.QueryRow(query, table, column).Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	_, err := DB.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
@@ -0,0 +1,40 @@
+package export
+
+// Branding customises the look of PDF reports and the print layout of Excel
+// workbooks. The zero value is the default layout.
+type Branding struct {
+	Orientation string  // "L" (default) or "P"
+	Logo        []byte  // PNG or JPEG image shown at the top right of PDF reports
+	LogoType    string  // "PNG" or "JPG"
+	HeaderText  string  // printed at the top of every page
+	FooterText  string  // printed at the bottom of every page
+	Font        string  // "helvetica", "times" or "courier"; ignored when PDF_FONT_PATH is set
+	FontSize    float64 // table font size in points, default 9
+}
+
+// coreFonts maps template font names to the PDF core fonts.
+var coreFonts = map[string]string{
+	"":          "Helvetica",
+	"helvetica": "Helvetica",
+	"times":     "Times",
+	"courier":   "Courier",
+}
+
+// IsCoreFont reports whether name is a font Branding.Font accepts.
+func IsCoreFont(name string) bool {
+	_, ok := coreFonts[name]
+	return ok
+}
+
+// WithLabels returns a copy of the columns with headers replaced by the
+// labels keyed by column key.
+func WithLabels(columns []Column, labels map[string]string) []Column {
+	labeled := make([]Column, len(columns))
+	for i, col := range columns {
+		if label, ok := labels[col.Key]; ok && label != "" {
+			col.Header = label
+		}
+		labeled[i] = col
+	}
+	return labeled
+}
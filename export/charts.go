@@ -0,0 +1,159 @@
+package export
+
+import (
+	"fmt"
+	"math"
+
+	"project/models"
+)
+
+// Chart layout constants, in millimetres.
+const (
+	chartHeight     = 75.0
+	chartAxisWidth  = 12.0
+	chartMaxLabels  = 24
+	breakdownLabel  = 45.0
+	breakdownCount  = 18.0
+	breakdownRowGap = 5.0
+	breakdownRows   = 11 // top ten and "other"
+)
+
+// charts draws the analytics page: registrations per bucket as bars with the
+// cumulative total as a line, then the email domain and registration prefix
+// breakdowns side by side.
+func (r *pdfRenderer) charts(a *models.RegistrationAnalytics) {
+	pdf := r.pdf
+	pageWidth, _ := pdf.GetPageSize()
+	usable := pageWidth - 2*pdfMargin
+
+	pdf.SetFont(r.family, "B", 11)
+	pdf.CellFormat(0, 6, r.translate(fmt.Sprintf("Registrations per %s", a.Interval)), "", 1, "L", false, 0, "")
+	pdf.SetFont(r.family, "", r.fontSize)
+	summary := fmt.Sprintf("%d registrations in the range, %d before it, %d in total", a.Total, a.Baseline, a.Baseline+a.Total)
+	pdf.CellFormat(0, r.lineHeight, r.translate(summary), "", 1, "L", false, 0, "")
+	pdf.Ln(4)
+
+	r.barChart(a.Buckets, pdfMargin+chartAxisWidth, pdf.GetY(), usable-2*chartAxisWidth, chartHeight)
+	pdf.SetXY(pdfMargin, pdf.GetY()+chartHeight+12)
+
+	y := pdf.GetY()
+	half := usable / 2
+	r.breakdown("Top email domains", a.EmailDomains, pdfMargin, y, half-5)
+	r.breakdown("Top registration prefixes", a.RegistrationPrefixes, pdfMargin+half+5, y, half-5)
+	pdf.SetFont(r.family, "", r.fontSize)
+}
+
+// barChart draws counts as bars against the left axis and the cumulative
+// total as a line against the right axis.
+func (r *pdfRenderer) barChart(buckets []models.AnalyticsBucket, x, y, width, height float64) {
+	pdf := r.pdf
+	maxCount, maxCumulative := 1, 1
+	for _, b := range buckets {
+		maxCount = max(maxCount, b.Count)
+		maxCumulative = max(maxCumulative, b.Cumulative)
+	}
+	countTop := niceCeiling(maxCount)
+	cumulativeTop := niceCeiling(maxCumulative)
+
+	// Grid lines and axis labels.
+	pdf.SetFont(r.family, "", 7)
+	pdf.SetDrawColor(220, 220, 220)
+	for i := 0; i <= 4; i++ {
+		lineY := y + height - height*float64(i)/4
+		pdf.Line(x, lineY, x+width, lineY)
+		pdf.SetXY(x-chartAxisWidth, lineY-2)
+		pdf.CellFormat(chartAxisWidth-1, 4, fmt.Sprint(countTop*i/4), "", 0, "R", false, 0, "")
+		pdf.SetXY(x+width+1, lineY-2)
+		pdf.CellFormat(chartAxisWidth-1, 4, fmt.Sprint(cumulativeTop*i/4), "", 0, "L", false, 0, "")
+	}
+	pdf.SetDrawColor(0, 0, 0)
+	pdf.Line(x, y, x, y+height)
+	pdf.Line(x, y+height, x+width, y+height)
+	if len(buckets) == 0 {
+		return
+	}
+
+	slot := width / float64(len(buckets))
+	labelEvery := int(math.Ceil(float64(len(buckets)) / chartMaxLabels))
+	pdf.SetFillColor(70, 130, 180)
+	for i, b := range buckets {
+		barHeight := height * float64(b.Count) / float64(countTop)
+		barX := x + float64(i)*slot + slot*0.15
+		if barHeight > 0 {
+			pdf.Rect(barX, y+height-barHeight, slot*0.7, barHeight, "F")
+		}
+		if i%labelEvery == 0 {
+			pdf.SetXY(x+float64(i)*slot-5, y+height+1)
+			pdf.CellFormat(slot+10, 4, r.translate(b.Label), "", 0, "C", false, 0, "")
+		}
+	}
+
+	// Cumulative line.
+	pdf.SetDrawColor(220, 90, 40)
+	pdf.SetLineWidth(0.5)
+	for i := 1; i < len(buckets); i++ {
+		x1 := x + (float64(i)-0.5)*slot
+		x2 := x + (float64(i)+0.5)*slot
+		y1 := y + height - height*float64(buckets[i-1].Cumulative)/float64(cumulativeTop)
+		y2 := y + height - height*float64(buckets[i].Cumulative)/float64(cumulativeTop)
+		pdf.Line(x1, y1, x2, y2)
+	}
+	pdf.SetLineWidth(0.2)
+	pdf.SetDrawColor(0, 0, 0)
+
+	// Legend.
+	pdf.SetXY(x, y+height+5)
+	pdf.SetFillColor(70, 130, 180)
+	pdf.Rect(x, y+height+6, 3, 3, "F")
+	pdf.SetXY(x+4, y+height+5.5)
+	pdf.CellFormat(40, 4, r.translate("Registrations (left axis)"), "", 0, "L", false, 0, "")
+	pdf.SetFillColor(220, 90, 40)
+	pdf.Rect(x+50, y+height+6, 3, 3, "F")
+	pdf.SetXY(x+54, y+height+5.5)
+	pdf.CellFormat(40, 4, r.translate("Cumulative total (right axis)"), "", 0, "L", false, 0, "")
+}
+
+// breakdown draws a titled list of horizontal bars.
+func (r *pdfRenderer) breakdown(title string, counts []models.AnalyticsCount, x, y, width float64) {
+	pdf := r.pdf
+	counts = counts[:min(len(counts), breakdownRows)]
+	pdf.SetXY(x, y)
+	pdf.SetFont(r.family, "B", 10)
+	pdf.CellFormat(width, 6, r.translate(title), "", 0, "L", false, 0, "")
+
+	maxCount := 1
+	for _, c := range counts {
+		maxCount = max(maxCount, c.Count)
+	}
+	barWidth := width - breakdownLabel - breakdownCount
+
+	pdf.SetFont(r.family, "", 8)
+	pdf.SetFillColor(70, 130, 180)
+	for i, c := range counts {
+		rowY := y + 7 + float64(i)*breakdownRowGap
+		label := r.wrap(c.Key, breakdownLabel-2)[0]
+		pdf.SetXY(x, rowY)
+		pdf.CellFormat(breakdownLabel, 4, label, "", 0, "L", false, 0, "")
+		if w := barWidth * float64(c.Count) / float64(maxCount); w > 0 {
+			pdf.Rect(x+breakdownLabel, rowY+0.5, w, 3, "F")
+		}
+		pdf.SetXY(x+breakdownLabel+barWidth, rowY)
+		pdf.CellFormat(breakdownCount, 4, fmt.Sprint(c.Count), "", 0, "R", false, 0, "")
+	}
+}
+
+// niceCeiling rounds n up to four times a 1, 2 or 5 multiple of a power of
+// ten, so the four axis steps are round numbers.
+func niceCeiling(n int) int {
+	step := int(math.Ceil(float64(n) / 4))
+	if step < 1 {
+		return 4
+	}
+	magnitude := int(math.Pow(10, math.Floor(math.Log10(float64(step)))))
+	for _, multiple := range []int{1, 2, 5, 10} {
+		if multiple*magnitude >= step {
+			return 4 * multiple * magnitude
+		}
+	}
+	return 40 * magnitude
+}
@@ -0,0 +1,46 @@
+package export
+
+import (
+	"encoding/csv"
+	"io"
+	"time"
+)
+
+// flushEvery bounds how many rows the text writers buffer before flushing to the client.
+const flushEvery = 500
+
+// WriteCSV streams the rows as CSV with a header line of column keys. Dates use ISO 8601.
+func WriteCSV(w io.Writer, src RowSource, columns []Column) error {
+	cw := csv.NewWriter(w)
+
+	record := make([]string, len(columns))
+	for i, col := range columns {
+		record[i] = col.Key
+	}
+	if err := cw.Write(record); err != nil {
+		return err
+	}
+
+	for n := 1; src.Next(); n++ {
+		user := src.User()
+		for i, col := range columns {
+			if t, ok := Value(user, col.Key).(time.Time); ok {
+				record[i] = t.Format(ISODateLayout)
+			} else {
+				record[i] = Text(user, col.Key)
+			}
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+		if n%flushEvery == 0 {
+			cw.Flush()
+		}
+	}
+	if err := src.Err(); err != nil {
+		return err
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
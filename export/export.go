@@ -0,0 +1,119 @@
+package export
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"project/models"
+)
+
+// RowSource is a forward-only cursor of users, such as handlers.UserRows.
+type RowSource interface {
+	Next() bool
+	User() models.User
+	Err() error
+}
+
+// Column describes one exported field.
+type Column struct {
+	Key    string
+	Header string
+	Width  float64 // spreadsheet column width in characters
+}
+
+// UserColumns are the exported fields of models.User in their default order.
+var UserColumns = []Column{
+	{Key: "id", Header: "ID", Width: 8},
+	{Key: "name", Header: "Name", Width: 28},
+	{Key: "email", Header: "Email", Width: 36},
+	{Key: "registration_no", Header: "Registration No", Width: 20},
+	{Key: "phone_no", Header: "Phone No", Width: 18},
+	{Key: "date", Header: "Date", Width: 12},
+}
+
+// DateLayout is how dates are shown in reports, matching the dd/mm/yy storage format.
+const DateLayout = "02/01/06"
+
+// ISODateLayout is used by the machine-readable formats (CSV, JSON Lines).
+const ISODateLayout = "2006-01-02"
+
+// SelectColumns resolves a comma-separated list such as "email,name,id" to
+// columns in the requested order. An empty list selects every column.
+func SelectColumns(list string) ([]Column, error) {
+	if strings.TrimSpace(list) == "" {
+		return UserColumns, nil
+	}
+
+	var columns []Column
+	seen := map[string]bool{}
+	for _, key := range strings.Split(list, ",") {
+		key = strings.TrimSpace(key)
+		col, ok := columnByKey(key)
+		if !ok {
+			return nil, fmt.Errorf("unknown column %q", key)
+		}
+		if seen[key] {
+			return nil, fmt.Errorf("column %q selected twice", key)
+		}
+		seen[key] = true
+		columns = append(columns, col)
+	}
+	return columns, nil
+}
+
+func columnByKey(key string) (Column, bool) {
+	for _, col := range UserColumns {
+		if col.Key == key {
+			return col, true
+		}
+	}
+	return Column{}, false
+}
+
+// Value returns the typed value of a column for a user: ID as an int and date as a time.Time.
+func Value(u models.User, key string) interface{} {
+	switch key {
+	case "id":
+		return u.ID
+	case "name":
+		return u.Name
+	case "email":
+		return u.Email
+	case "registration_no":
+		return u.RegistrationNo
+	case "phone_no":
+		return u.PhoneNo
+	case "date":
+		return u.Date
+	}
+	return nil
+}
+
+// Text returns the column value formatted for text-based outputs.
+func Text(u models.User, key string) string {
+	switch v := Value(u, key).(type) {
+	case time.Time:
+		return v.Format(DateLayout)
+	case int:
+		return strconv.Itoa(v)
+	case string:
+		return v
+	}
+	return ""
+}
+
+// Record is the JSON representation of a user shared by the API responses,
+// with the date in the dd/mm/yy storage format.
+func Record(u models.User) map[string]interface{} {
+	record := make(map[string]interface{}, len(UserColumns))
+	for _, col := range UserColumns {
+		if col.Key == "id" {
+			record[col.Key] = u.ID
+			continue
+		}
+		record[col.Key] = Text(u, col.Key)
+	}
+	return record
+}
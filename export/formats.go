@@ -0,0 +1,73 @@
+package export
+
+import (
+	"fmt"
+	"io"
+
+	"project/models"
+)
+
+// Format describes an output format of the users export.
+type Format struct {
+	Name        string
+	ContentType string
+	Extension   string
+}
+
+// Formats lists the supported export formats by name.
+var Formats = map[string]Format{
+	"csv":     {Name: "csv", ContentType: "text/csv; charset=utf-8", Extension: "csv"},
+	"jsonl":   {Name: "jsonl", ContentType: "application/x-ndjson", Extension: "jsonl"},
+	"xlsx":    {Name: "xlsx", ContentType: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", Extension: "xlsx"},
+	"pdf":     {Name: "pdf", ContentType: "application/pdf", Extension: "pdf"},
+	"parquet": {Name: "parquet", ContentType: "application/vnd.apache.parquet", Extension: "parquet"},
+}
+
+// Options configures a rendered export.
+type Options struct {
+	Columns  []Column
+	Title    string   // PDF only
+	Subtitle []string // PDF only
+
+	Analytics *models.RegistrationAnalytics // PDF only, adds a chart page
+	Branding  Branding                      // PDF, and the print layout of XLSX
+}
+
+// Render writes the rows to w in the given format. CSV, JSON Lines and
+// Parquet stream row by row; XLSX and PDF are fully built before the first
+// byte is written, so their errors happen before w is touched.
+func Render(w io.Writer, format string, src RowSource, opts Options) error {
+	if len(opts.Columns) == 0 {
+		opts.Columns = UserColumns
+	}
+
+	switch format {
+	case "csv":
+		return WriteCSV(w, src, opts.Columns)
+	case "jsonl":
+		return WriteJSONL(w, src, opts.Columns)
+	case "parquet":
+		return WriteParquet(w, src, opts.Columns)
+	case "xlsx":
+		f, err := BuildExcel(src, opts.Columns, opts.Branding)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return f.Write(w)
+	case "pdf":
+		buf, err := BuildPDF(src, PDFReport{
+			Title:     opts.Title,
+			Subtitle:  opts.Subtitle,
+			Columns:   opts.Columns,
+			Analytics: opts.Analytics,
+			Branding:  opts.Branding,
+		})
+		if err != nil {
+			return err
+		}
+		_, err = buf.WriteTo(w)
+		return err
+	}
+	return fmt.Errorf("unsupported format %q", format)
+}
@@ -0,0 +1,47 @@
+package export
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// WriteJSONL streams one JSON object per line, keeping the selected column order.
+func WriteJSONL(w io.Writer, src RowSource, columns []Column) error {
+	bw := bufio.NewWriter(w)
+
+	for n := 1; src.Next(); n++ {
+		user := src.User()
+		bw.WriteByte('{')
+		for i, col := range columns {
+			if i > 0 {
+				bw.WriteByte(',')
+			}
+			key, _ := json.Marshal(col.Key)
+			bw.Write(key)
+			bw.WriteByte(':')
+
+			value := Value(user, col.Key)
+			if t, ok := value.(time.Time); ok {
+				value = t.Format(ISODateLayout)
+			}
+			encoded, err := json.Marshal(value)
+			if err != nil {
+				return err
+			}
+			bw.Write(encoded)
+		}
+		bw.WriteString("}\n")
+
+		if n%flushEvery == 0 {
+			if err := bw.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := src.Err(); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,64 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// parquetRowType builds a struct type whose fields follow the selected column
+// order, so the Parquet schema keeps that order. IDs are INT64 and dates use
+// the DATE logical type (days since the Unix epoch).
+func parquetRowType(columns []Column) reflect.Type {
+	fields := make([]reflect.StructField, len(columns))
+	for i, col := range columns {
+		field := reflect.StructField{
+			Name: fmt.Sprintf("F%d", i),
+			Type: reflect.TypeOf(""),
+			Tag:  reflect.StructTag(fmt.Sprintf(`parquet:"%s"`, col.Key)),
+		}
+		switch col.Key {
+		case "id":
+			field.Type = reflect.TypeOf(int64(0))
+		case "date":
+			field.Type = reflect.TypeOf(int32(0))
+			field.Tag = reflect.StructTag(fmt.Sprintf(`parquet:"%s,date"`, col.Key))
+		}
+		fields[i] = field
+	}
+	return reflect.StructOf(fields)
+}
+
+// WriteParquet streams the rows into a Parquet file. Row groups are flushed
+// as they fill up and the footer is written when the source is exhausted.
+func WriteParquet(w io.Writer, src RowSource, columns []Column) error {
+	rowType := parquetRowType(columns)
+	row := reflect.New(rowType)
+	writer := parquet.NewWriter(w, parquet.SchemaOf(row.Interface()))
+
+	for src.Next() {
+		user := src.User()
+		for i, col := range columns {
+			field := row.Elem().Field(i)
+			switch value := Value(user, col.Key).(type) {
+			case int:
+				field.SetInt(int64(value))
+			case time.Time:
+				days := time.Date(value.Year(), value.Month(), value.Day(), 0, 0, 0, 0, time.UTC).Unix() / 86400
+				field.SetInt(days)
+			case string:
+				field.SetString(value)
+			}
+		}
+		if err := writer.Write(row.Interface()); err != nil {
+			return fmt.Errorf("error writing parquet row: %v", err)
+		}
+	}
+	if err := src.Err(); err != nil {
+		return err
+	}
+	return writer.Close()
+}
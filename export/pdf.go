@@ -0,0 +1,296 @@
+package export
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"project/config"
+	"project/models"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// PDF layout constants, in millimetres and points.
+const (
+	pdfMargin       = 10.0
+	pdfLineHeight   = 5.0
+	pdfCellPadding  = 1.5
+	pdfFooterHeight = 10.0
+	pdfMaxCellLines = 3
+	pdfFontSize     = 9.0
+	pdfLogoHeight   = 15.0
+)
+
+// pdfLogoName is the name the branding logo is registered under.
+const pdfLogoName = "logo"
+
+// PDFReport describes a tabular PDF report.
+type PDFReport struct {
+	Title       string
+	Subtitle    []string // lines under the title, e.g. the date filter and requester
+	Columns     []Column
+	GeneratedAt time.Time
+	Branding
+
+	// Analytics, when set, adds a chart page before the table.
+	Analytics *models.RegistrationAnalytics
+}
+
+// pdfRenderer holds the state of one report while rows are laid out.
+type pdfRenderer struct {
+	pdf       *gofpdf.Fpdf
+	report    PDFReport
+	widths    []float64
+	family    string
+	translate func(string) string
+	ellipsis  string
+	utf8      bool
+
+	fontSize   float64
+	lineHeight float64
+}
+
+// BuildPDF renders the rows into an in-memory PDF. Pages break automatically
+// and repeat the table header, long values wrap up to three lines and are
+// then truncated, and every page carries page numbers and the generation
+// time. Because nothing is written to the caller until the document is
+// complete, query and font errors can still be reported as JSON.
+//
+// Set PDF_FONT_PATH (and optionally PDF_FONT_BOLD_PATH) to a TrueType font
+// such as DejaVuSans.ttf to render non-Latin names; without it the built-in
+// Helvetica is used, which only covers Western European characters.
+func BuildPDF(src RowSource, report PDFReport) (*bytes.Buffer, error) {
+	if report.Orientation == "" {
+		report.Orientation = "L"
+	}
+	if report.GeneratedAt.IsZero() {
+		report.GeneratedAt = time.Now()
+	}
+
+	r := &pdfRenderer{pdf: gofpdf.New(report.Orientation, "mm", "A4", ""), report: report, fontSize: pdfFontSize}
+	if report.FontSize > 0 {
+		r.fontSize = report.FontSize
+	}
+	r.lineHeight = pdfLineHeight * r.fontSize / pdfFontSize
+	if err := r.setupFonts(); err != nil {
+		return nil, err
+	}
+	if err := r.registerLogo(); err != nil {
+		return nil, err
+	}
+	r.computeWidths()
+
+	pdf := r.pdf
+	pdf.SetMargins(pdfMargin, pdfMargin, pdfMargin)
+	pdf.SetAutoPageBreak(false, pdfMargin)
+	pdf.AliasNbPages("{nb}")
+	pdf.SetFooterFunc(r.footer)
+	if report.HeaderText != "" {
+		pdf.SetHeaderFunc(r.header)
+	}
+
+	pdf.AddPage()
+	r.titleBlock()
+	if report.Analytics != nil {
+		r.charts(report.Analytics)
+		pdf.AddPage()
+	}
+	r.tableHeader()
+
+	for src.Next() {
+		r.row(src.User())
+		if err := pdf.Error(); err != nil {
+			return nil, err
+		}
+	}
+	if err := src.Err(); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, fmt.Errorf("error generating PDF: %v", err)
+	}
+	return &buf, nil
+}
+
+// setupFonts embeds the configured UTF-8 font or falls back to core Helvetica.
+func (r *pdfRenderer) setupFonts() error {
+	regular := config.GetEnv("PDF_FONT_PATH", "")
+	if regular == "" {
+		family, ok := coreFonts[r.report.Font]
+		if !ok {
+			return fmt.Errorf("unknown PDF font %q", r.report.Font)
+		}
+		r.family = family
+		r.translate = r.pdf.UnicodeTranslatorFromDescriptor("")
+		r.ellipsis = "..."
+		return nil
+	}
+
+	bold := config.GetEnv("PDF_FONT_BOLD_PATH", regular)
+	r.family = "ReportFont"
+	r.pdf.AddUTF8Font(r.family, "", regular)
+	r.pdf.AddUTF8Font(r.family, "B", bold)
+	if err := r.pdf.Error(); err != nil {
+		return fmt.Errorf("error loading PDF font: %v", err)
+	}
+	r.translate = func(s string) string { return s }
+	r.ellipsis = "…"
+	r.utf8 = true
+	return nil
+}
+
+// computeWidths spreads the printable width over the columns in proportion
+// to their spreadsheet widths.
+func (r *pdfRenderer) computeWidths() {
+	pageWidth, _ := r.pdf.GetPageSize()
+	usable := pageWidth - 2*pdfMargin
+
+	total := 0.0
+	for _, col := range r.report.Columns {
+		total += col.Width
+	}
+	r.widths = make([]float64, len(r.report.Columns))
+	for i, col := range r.report.Columns {
+		r.widths[i] = usable * col.Width / total
+	}
+}
+
+// registerLogo loads the branding logo so titleBlock can place it.
+func (r *pdfRenderer) registerLogo() error {
+	if len(r.report.Logo) == 0 {
+		return nil
+	}
+	r.pdf.RegisterImageOptionsReader(pdfLogoName, gofpdf.ImageOptions{ImageType: r.report.LogoType}, bytes.NewReader(r.report.Logo))
+	if err := r.pdf.Error(); err != nil {
+		return fmt.Errorf("error loading logo: %v", err)
+	}
+	return nil
+}
+
+func (r *pdfRenderer) titleBlock() {
+	pdf := r.pdf
+	if len(r.report.Logo) > 0 {
+		pageWidth, _ := pdf.GetPageSize()
+		info := pdf.GetImageInfo(pdfLogoName)
+		width := pdfLogoHeight * info.Width() / info.Height()
+		pdf.ImageOptions(pdfLogoName, pageWidth-pdfMargin-width, pdf.GetY(), width, pdfLogoHeight, false, gofpdf.ImageOptions{}, 0, "")
+	}
+	pdf.SetFont(r.family, "B", 14)
+	pdf.CellFormat(0, 8, r.translate(r.report.Title), "", 1, "L", false, 0, "")
+
+	pdf.SetFont(r.family, "", 10)
+	for _, line := range r.report.Subtitle {
+		pdf.CellFormat(0, 5, r.translate(line), "", 1, "L", false, 0, "")
+	}
+	pdf.Ln(3)
+}
+
+func (r *pdfRenderer) tableHeader() {
+	pdf := r.pdf
+	pdf.SetFont(r.family, "B", r.fontSize)
+	pdf.SetFillColor(230, 230, 230)
+	for i, col := range r.report.Columns {
+		pdf.CellFormat(r.widths[i], r.lineHeight+2*pdfCellPadding, r.translate(col.Header), "1", 0, "C", true, 0, "")
+	}
+	pdf.Ln(-1)
+	pdf.SetFont(r.family, "", r.fontSize)
+}
+
+// row draws one user, starting a new page with a repeated header when it would not fit.
+func (r *pdfRenderer) row(user models.User) {
+	pdf := r.pdf
+
+	cells := make([][]string, len(r.report.Columns))
+	lines := 1
+	for i, col := range r.report.Columns {
+		cells[i] = r.wrap(Text(user, col.Key), r.widths[i]-2*pdfCellPadding)
+		lines = max(lines, len(cells[i]))
+	}
+	height := float64(lines)*r.lineHeight + 2*pdfCellPadding
+
+	_, pageHeight := pdf.GetPageSize()
+	if pdf.GetY()+height > pageHeight-pdfMargin-pdfFooterHeight {
+		pdf.AddPage()
+		r.tableHeader()
+	}
+
+	x, y := pdf.GetX(), pdf.GetY()
+	for i, col := range r.report.Columns {
+		pdf.Rect(x, y, r.widths[i], height, "D")
+		align := "L"
+		if col.Key == "id" || col.Key == "date" {
+			align = "C"
+		}
+		for j, line := range cells[i] {
+			pdf.SetXY(x+pdfCellPadding, y+pdfCellPadding+float64(j)*r.lineHeight)
+			pdf.CellFormat(r.widths[i]-2*pdfCellPadding, r.lineHeight, line, "", 0, align, false, 0, "")
+		}
+		x += r.widths[i]
+	}
+	pdf.SetXY(pdfMargin, y+height)
+}
+
+// wrap splits text to the cell width, truncating with an ellipsis after pdfMaxCellLines.
+func (r *pdfRenderer) wrap(text string, width float64) []string {
+	text = r.translate(text)
+	if text == "" {
+		return []string{""}
+	}
+
+	// Core fonts work on cp1252 bytes, embedded UTF-8 fonts on runes.
+	var lines []string
+	if r.utf8 {
+		lines = r.pdf.SplitText(text, width)
+	} else {
+		for _, line := range r.pdf.SplitLines([]byte(text), width) {
+			lines = append(lines, string(line))
+		}
+	}
+	if len(lines) <= pdfMaxCellLines {
+		return lines
+	}
+
+	lines = lines[:pdfMaxCellLines]
+	last := lines[pdfMaxCellLines-1]
+	for len(last) > 0 && r.pdf.GetStringWidth(last+r.ellipsis) > width {
+		if r.utf8 {
+			runes := []rune(last)
+			last = string(runes[:len(runes)-1])
+		} else {
+			last = last[:len(last)-1]
+		}
+	}
+	lines[pdfMaxCellLines-1] = last + r.ellipsis
+	return lines
+}
+
+// header prints the branding header text at the top of every page.
+func (r *pdfRenderer) header() {
+	pdf := r.pdf
+	pdf.SetXY(pdfMargin, pdfMargin)
+	pdf.SetFont(r.family, "", 8)
+	pdf.CellFormat(0, pdfLineHeight, r.translate(r.report.HeaderText), "B", 1, "C", false, 0, "")
+	pdf.Ln(2)
+	pdf.SetFont(r.family, "", r.fontSize)
+}
+
+// footer prints the generation time, the branding footer text and page
+// numbers on every page.
+func (r *pdfRenderer) footer() {
+	pdf := r.pdf
+	_, pageHeight := pdf.GetPageSize()
+	pdf.SetXY(pdfMargin, pageHeight-pdfMargin-pdfLineHeight)
+	pdf.SetFont(r.family, "", 8)
+	generated := "Generated at " + r.report.GeneratedAt.Format("02/01/2006 15:04 MST")
+	pdf.CellFormat(0, pdfLineHeight, r.translate(generated), "", 0, "L", false, 0, "")
+	if r.report.FooterText != "" {
+		pdf.SetX(pdfMargin)
+		pdf.CellFormat(0, pdfLineHeight, r.translate(r.report.FooterText), "", 0, "C", false, 0, "")
+	}
+	pdf.SetX(pdfMargin)
+	pdf.CellFormat(0, pdfLineHeight, fmt.Sprintf("Page %d of {nb}", pdf.PageNo()), "", 0, "R", false, 0, "")
+	pdf.SetFont(r.family, "", r.fontSize)
+}
@@ -0,0 +1,77 @@
+package export
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// subjectLabelWidth is the width of the field names in a subject report.
+const subjectLabelWidth = 45.0
+
+// SubjectField is one labelled value of a record.
+type SubjectField struct {
+	Label string
+	Value string
+}
+
+// SubjectSection is a titled group of records, such as the registrations or
+// the login account of a data subject.
+type SubjectSection struct {
+	Title   string
+	Records [][]SubjectField
+}
+
+// BuildSubjectPDF renders the answer to a data subject access request: one
+// section per kind of record, each record as a list of labelled values.
+// Empty sections are kept and marked, so the reader can see what was checked.
+func BuildSubjectPDF(title string, subtitle []string, sections []SubjectSection) (*bytes.Buffer, error) {
+	report := PDFReport{Title: title, Subtitle: subtitle, GeneratedAt: time.Now()}
+	report.Orientation = "P"
+	r := &pdfRenderer{pdf: gofpdf.New("P", "mm", "A4", ""), report: report, fontSize: pdfFontSize, lineHeight: pdfLineHeight}
+	if err := r.setupFonts(); err != nil {
+		return nil, err
+	}
+
+	pdf := r.pdf
+	pdf.SetMargins(pdfMargin, pdfMargin, pdfMargin)
+	pdf.SetAutoPageBreak(true, pdfMargin+pdfFooterHeight)
+	pdf.AliasNbPages("{nb}")
+	pdf.SetFooterFunc(r.footer)
+	pdf.AddPage()
+	r.titleBlock()
+
+	pageWidth, _ := pdf.GetPageSize()
+	valueWidth := pageWidth - 2*pdfMargin - subjectLabelWidth
+	for _, section := range sections {
+		pdf.SetFont(r.family, "B", 11)
+		pdf.CellFormat(0, 7, r.translate(fmt.Sprintf("%s (%d)", section.Title, len(section.Records))), "B", 1, "L", false, 0, "")
+		pdf.Ln(1)
+
+		if len(section.Records) == 0 {
+			pdf.SetFont(r.family, "", r.fontSize)
+			pdf.CellFormat(0, r.lineHeight, r.translate("No records."), "", 1, "L", false, 0, "")
+		}
+		for _, record := range section.Records {
+			for _, field := range record {
+				pdf.SetFont(r.family, "B", r.fontSize)
+				pdf.CellFormat(subjectLabelWidth, r.lineHeight, r.translate(field.Label), "", 0, "L", false, 0, "")
+				pdf.SetFont(r.family, "", r.fontSize)
+				pdf.MultiCell(valueWidth, r.lineHeight, r.translate(field.Value), "", "L", false)
+			}
+			pdf.Ln(2)
+		}
+		pdf.Ln(3)
+		if err := pdf.Error(); err != nil {
+			return nil, err
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := pdf.Output(&buf); err != nil {
+		return nil, fmt.Errorf("error generating PDF: %v", err)
+	}
+	return &buf, nil
+}
@@ -1,9 +1,12 @@
 package handlers
 
 import (
+	"database/sql"
 	"fmt"
 	"net/http"
 	"project/db" // Importing the db package for accessing the DB connection
+	"project/masking"
+	"project/models"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -11,8 +14,20 @@ import (
 
 // GetAllUsers handles the retrieval of all users from the 'users' table
 func GetAllUsers(c *gin.Context) {
+	// Mask personal data according to the caller's role unless unmask=true is allowed
+	policy, ok := requestMaskingPolicy(c, "users")
+	if !ok {
+		return
+	}
+
+	// Only registrants of ?business_id= and its branches
+	businessID, ok := businessFilter(c)
+	if !ok {
+		return
+	}
+
 	// Call FetchAllUsers to retrieve all users data from the database
-	users, err := FetchAllUsers()
+	users, err := FetchAllUsers(businessID, policy)
 	if err != nil {
 		// Log the error for debugging
 		fmt.Printf("Error fetching users: %v\n", err)
@@ -26,13 +41,15 @@ func GetAllUsers(c *gin.Context) {
 	})
 }
 
-// FetchAllUsers retrieves all user data from the 'users' table
-func FetchAllUsers() ([]map[string]interface{}, error) {
+// FetchAllUsers retrieves all user data from the 'users' table, masked by the
+// policy, or only the registrants of a business and its branches
+func FetchAllUsers(businessID int64, policy masking.Policy) ([]map[string]interface{}, error) {
 	// Prepare the SQL query to fetch all user data
-	query := `SELECT id, name, email, registration_no, phone_no, date FROM users`
+	query := `SELECT id, name, email, registration_no, phone_no, date, business_id FROM users`
+	where, args := UserQuery{BusinessID: businessID}.where()
 
 	// Execute the query
-	rows, err := db.DB.Query(query)
+	rows, err := db.DB.Query(query+where, args...)
 	if err != nil {
 		// Log the error for debugging
 		fmt.Printf("Error fetching users from database: %v\n", err)
@@ -45,33 +62,30 @@ func FetchAllUsers() ([]map[string]interface{}, error) {
 
 	// Loop through the rows and scan the data into the user slice
 	for rows.Next() {
-		var id int
-		var name, email, registrationNo, phoneNo, date string
-		if err := rows.Scan(&id, &name, &email, &registrationNo, &phoneNo, &date); err != nil {
+		var u models.User
+		var date string
+		var businessID sql.NullInt64
+		if err := rows.Scan(&u.ID, &u.Name, &u.Email, &u.RegistrationNo, &u.PhoneNo, &date, &businessID); err != nil {
 			// Log the error for debugging
 			fmt.Printf("Error scanning user data: %v\n", err)
 			return nil, fmt.Errorf("error scanning user data: %v", err)
 		}
 
-		// Parse the date from the database, format it to dd/mm/yy
+		// Parse the date from the database, it is formatted back to dd/mm/yy
 		parsedDate, err := time.Parse("02/01/06", date)
 		if err != nil {
 			// If date parsing fails, return an error
 			fmt.Printf("Error parsing date: %v\n", err)
 			return nil, fmt.Errorf("error parsing date: %v", err)
 		}
-		formattedDate := parsedDate.Format("02/01/06") // Format to dd/mm/yy
-
-		// Prepare the user map with formatted date
-		user := map[string]interface{}{
-			"id":              id,
-			"name":            name,
-			"email":           email,
-			"registration_no": registrationNo,
-			"phone_no":        phoneNo,
-			"date":            formattedDate, // Use the formatted date
+		u.Date = parsedDate
+
+		if businessID.Valid {
+			u.BusinessID = &businessID.Int64
 		}
-		users = append(users, user)
+
+		// Serialize the user the same way as every other endpoint, masked
+		users = append(users, userRecord(u, policy))
 	}
 
 	// Check for any row iteration error
@@ -81,19 +95,35 @@ func FetchAllUsers() ([]map[string]interface{}, error) {
 		return nil, fmt.Errorf("error iterating over rows: %v", err)
 	}
 
-	// Log the users data before returning it
-	fmt.Printf("Users fetched: %+v\n", users)
+	// Log how many users were fetched, not their personal data
+	fmt.Printf("Users fetched: %d\n", len(users))
 
 	return users, nil
 }
 
+// userRecord is policy.Record with the business the user belongs to, which
+// is not personal data and not an export column.
+func userRecord(u models.User, policy masking.Policy) map[string]interface{} {
+	record := policy.Record(u)
+	if u.BusinessID != nil {
+		record["business_id"] = *u.BusinessID
+	}
+	return record
+}
+
 // GetUserByID handles the retrieval of a user by their ID
 func GetUserByID(c *gin.Context) {
 	// Get the user ID from the URL parameter
 	userID := c.Param("id")
 
+	// Mask personal data according to the caller's role unless unmask=true is allowed
+	policy, ok := requestMaskingPolicy(c, "users/"+userID)
+	if !ok {
+		return
+	}
+
 	// Call FetchUser to retrieve the user data from the database
-	user, err := FetchUserByID(userID)
+	user, err := FetchUserByID(userID, policy)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -105,38 +135,31 @@ func GetUserByID(c *gin.Context) {
 	})
 }
 
-// FetchUserByID retrieves user data by ID from the 'users' table
-func FetchUserByID(userID string) (map[string]interface{}, error) {
+// FetchUserByID retrieves user data by ID from the 'users' table, masked by the policy
+func FetchUserByID(userID string, policy masking.Policy) (map[string]interface{}, error) {
 	// Prepare the SQL query to fetch user data by ID
-	query := `SELECT name, email, registration_no, phone_no, date FROM users WHERE id = ?`
+	query := `SELECT id, name, email, registration_no, phone_no, date FROM users WHERE id = ?`
 
 	// Execute the query with the provided user ID
 	row := db.DB.QueryRow(query, userID)
 
 	// Map to store the fetched user data
-	var name, email, registrationNo, phoneNo, date string
-	if err := row.Scan(&name, &email, &registrationNo, &phoneNo, &date); err != nil {
+	var u models.User
+	var date string
+	if err := row.Scan(&u.ID, &u.Name, &u.Email, &u.RegistrationNo, &u.PhoneNo, &date); err != nil {
 		if err.Error() == "sql: no rows in result set" {
 			return nil, fmt.Errorf("user not found")
 		}
 		return nil, fmt.Errorf("error fetching user data: %v", err)
 	}
 
-	// Parse and format the date into dd/mm/yy
+	// Parse the date, it is formatted back to dd/mm/yy
 	parsedDate, err := time.Parse("02/01/06", date)
 	if err != nil {
 		return nil, fmt.Errorf("error parsing date: %v", err)
 	}
-	formattedDate := parsedDate.Format("02/01/06")
-
-	// Return the user data as a map
-	user := map[string]interface{}{
-		"id":              userID,
-		"name":            name,
-		"email":           email,
-		"registration_no": registrationNo,
-		"phone_no":        phoneNo,
-		"date":            formattedDate,
-	}
-	return user, nil
+	u.Date = parsedDate
+
+	// Return the masked user data as a map
+	return policy.Record(u), nil
 }
@@ -3,12 +3,11 @@ package handlers
 import (
 	"fmt"
 	"net/http"
-	"project/db" // Make sure to import the db package or correct the path
+	"project/export"
+	"project/masking"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/jung-kurt/gofpdf"
-	"github.com/xuri/excelize/v2"
 )
 
 // Helper function to parse dates in dd/mm/yy format
@@ -40,8 +39,14 @@ func GetUsersBetweenDates(c *gin.Context) {
 		return
 	}
 
+	// Mask personal data according to the caller's role
+	policy, ok := requestMaskingPolicy(c, "users/between-dates")
+	if !ok {
+		return
+	}
+
 	// Fetch users by date range
-	users, err := FetchUsersByDateRange(start, end)
+	users, err := FetchUsersByDateRange(start, end, policy)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching users"})
 		return
@@ -50,42 +55,37 @@ func GetUsersBetweenDates(c *gin.Context) {
 	c.JSON(http.StatusOK, users)
 }
 
-// FetchUsersByDateRange retrieves users whose date falls between the specified start and end dates
-func FetchUsersByDateRange(startDate, endDate time.Time) ([]map[string]interface{}, error) {
-	query := `SELECT id, name, email, registration_no, phone_no, date FROM users WHERE STR_TO_DATE(date, '%d/%m/%y') BETWEEN ? AND ?`
-	rows, err := db.DB.Query(query, startDate, endDate)
+// FetchUsersByDateRange retrieves users whose date falls between the specified start and end dates, masked by the policy
+func FetchUsersByDateRange(startDate, endDate time.Time, policy masking.Policy) ([]map[string]interface{}, error) {
+	return FetchUsers(UserQuery{Start: startDate, End: endDate}, policy)
+}
+
+// FetchUsers returns the users matching the query, masked by the policy.
+func FetchUsers(q UserQuery, policy masking.Policy) ([]map[string]interface{}, error) {
+	rows, err := QueryUsers(q)
 	if err != nil {
-		return nil, fmt.Errorf("error fetching users: %v", err)
+		return nil, err
 	}
 	defer rows.Close()
 
 	var users []map[string]interface{}
 	for rows.Next() {
-		var id int
-		var name, email, registrationNo, phoneNo, date string
-		if err := rows.Scan(&id, &name, &email, &registrationNo, &phoneNo, &date); err != nil {
-			return nil, fmt.Errorf("error scanning user data: %v", err)
-		}
-
-		user := map[string]interface{}{
-			"id":              id,
-			"name":            name,
-			"email":           email,
-			"registration_no": registrationNo,
-			"phone_no":        phoneNo,
-			"date":            date,
-		}
-		users = append(users, user)
+		users = append(users, policy.Record(rows.User()))
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating over rows: %v", err)
+		return nil, err
 	}
 
 	return users, nil
 }
 
-// ExportUsersToExcel exports the users' data to an Excel file
+// exportFileName returns a unique download name such as users_20250101-20250131_1735689600123.xlsx.
+func exportFileName(start, end time.Time, ext string) string {
+	return fmt.Sprintf("users_%s-%s_%d.%s", start.Format("20060102"), end.Format("20060102"), time.Now().UnixMilli(), ext)
+}
+
+// ExportUsersToExcel streams the users' data to the response as an Excel file
 func ExportUsersToExcel(c *gin.Context) {
 	// Get the start and end dates
 	startDate := c.DefaultQuery("start_date", "")
@@ -109,55 +109,49 @@ func ExportUsersToExcel(c *gin.Context) {
 		return
 	}
 
-	// Fetch users by date range
-	users, err := FetchUsersByDateRange(start, end)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching users"})
+	// Only registrants of ?business_id= and its branches
+	businessID, ok := businessFilter(c)
+	if !ok {
 		return
 	}
 
-	// Create a new Excel file
-	f := excelize.NewFile()
-
-	// Create a new sheet
-	sheetIndex, err := f.NewSheet("Users")
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Error creating new sheet: %v", err)})
+	// Apply ?template=, ?columns= and ?sort=
+	opts, sort, ok := exportLayoutFromQuery(c)
+	if !ok {
 		return
 	}
 
-	// Set the active sheet to the newly created one
-	f.SetActiveSheet(sheetIndex)
-
-	// Set headers
-	headers := []string{"ID", "Name", "Email", "Registration No", "Phone No", "Date"}
-	for i, header := range headers {
-		cell, _ := excelize.CoordinatesToCellName(i+1, 1)
-		f.SetCellValue("Users", cell, header)
+	// Mask personal data according to the caller's role unless unmask=true is allowed
+	policy, ok := requestMaskingPolicy(c, "export-users/excel")
+	if !ok {
+		return
 	}
 
-	// Add user data to Excel
-	for i, user := range users {
-		f.SetCellValue("Users", fmt.Sprintf("A%d", i+2), user["id"])
-		f.SetCellValue("Users", fmt.Sprintf("B%d", i+2), user["name"])
-		f.SetCellValue("Users", fmt.Sprintf("C%d", i+2), user["email"])
-		f.SetCellValue("Users", fmt.Sprintf("D%d", i+2), user["registration_no"])
-		f.SetCellValue("Users", fmt.Sprintf("E%d", i+2), user["phone_no"])
-		f.SetCellValue("Users", fmt.Sprintf("F%d", i+2), user["date"])
+	// Open a cursor over the users instead of loading them all
+	rows, err := QueryUsers(UserQuery{Start: start, End: end, Sort: sort, BusinessID: businessID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching users"})
+		return
 	}
+	defer rows.Close()
 
-	// Save to file and send the file
-	fileName := "UsersData.xlsx"
-	if err := f.SaveAs(fileName); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving Excel file"})
+	f, err := export.BuildExcel(masking.Source(rows, policy), opts.Columns, opts.Branding)
+	if err != nil {
+		fmt.Printf("Error building Excel export: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating Excel file"})
 		return
 	}
+	defer f.Close()
 
-	c.File(fileName)
+	// Write the workbook straight to the response, no file on disk
+	c.Header("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", exportFileName(start, end, "xlsx")))
+	if err := f.Write(c.Writer); err != nil {
+		fmt.Printf("Error writing Excel export: %v\n", err)
+	}
 }
 
-// ExportUsersToPDF exports the users' data to a PDF file
-// ExportUsersToPDF handles exporting the users' data to a PDF file
+// ExportUsersToPDF exports the users' data to a paginated PDF report
 func ExportUsersToPDF(c *gin.Context) {
 	// Get the start and end dates
 	startDate := c.DefaultQuery("start_date", "")
@@ -169,62 +163,69 @@ func ExportUsersToPDF(c *gin.Context) {
 	}
 
 	// Parse start and end dates in "dd/mm/yy" format
-	start, err := time.Parse("02/01/06", startDate)
+	start, err := parseDate(startDate)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid start_date format: %v", err)})
 		return
 	}
 
-	end, err := time.Parse("02/01/06", endDate)
+	end, err := parseDate(endDate)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid end_date format: %v", err)})
 		return
 	}
 
-	// Fetch users by date range
-	users, err := FetchUsersByDateRange(start, end)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching users"})
+	// Only registrants of ?business_id= and its branches
+	businessID, ok := businessFilter(c)
+	if !ok {
 		return
 	}
 
-	// Create a new PDF document
-	pdf := gofpdf.New("L", "mm", "A4", "")
-	pdf.AddPage()
+	// Apply ?template=, ?columns= and ?sort=
+	opts, sort, ok := exportLayoutFromQuery(c)
+	if !ok {
+		return
+	}
 
-	// Add title
-	pdf.SetFont("Arial", "B", 14)
-	pdf.Cell(40, 10, "Users Data")
+	// Add a chart page when charts=true
+	analytics, ok := exportAnalytics(c)
+	if !ok {
+		return
+	}
 
-	// Add table headers
-	pdf.Ln(10)
-	pdf.SetFont("Arial", "B", 12)
-	pdf.CellFormat(20, 10, "ID", "1", 0, "C", false, 0, "")
-	pdf.CellFormat(40, 10, "Name", "1", 0, "C", false, 0, "")
-	pdf.CellFormat(60, 10, "Email", "1", 0, "C", false, 0, "")
-	pdf.CellFormat(50, 10, "Registration No", "1", 0, "C", false, 0, "")
-	pdf.CellFormat(40, 10, "Phone No", "1", 0, "C", false, 0, "")
-	pdf.CellFormat(30, 10, "Date", "1", 0, "C", false, 0, "")
-	pdf.Ln(-1) // Move to the next line
+	// Mask personal data according to the caller's role unless unmask=true is allowed
+	policy, ok := requestMaskingPolicy(c, "export-users/pdf")
+	if !ok {
+		return
+	}
 
-	// Add user data
-	pdf.SetFont("Arial", "", 12)
-	for _, user := range users {
-		pdf.CellFormat(20, 10, fmt.Sprintf("%d", user["id"]), "1", 0, "C", false, 0, "")
-		pdf.CellFormat(40, 10, fmt.Sprintf("%s", user["name"]), "1", 0, "L", false, 0, "")
-		pdf.CellFormat(60, 10, fmt.Sprintf("%s", user["email"]), "1", 0, "L", false, 0, "")
-		pdf.CellFormat(50, 10, fmt.Sprintf("%s", user["registration_no"]), "1", 0, "L", false, 0, "")
-		pdf.CellFormat(40, 10, fmt.Sprintf("%s", user["phone_no"]), "1", 0, "L", false, 0, "")
-		pdf.CellFormat(30, 10, fmt.Sprintf("%s", user["date"]), "1", 0, "C", false, 0, "")
-		pdf.Ln(-1)
+	// Open a cursor over the users in the range
+	rows, err := QueryUsers(UserQuery{Start: start, End: end, Sort: sort, BusinessID: businessID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching users"})
+		return
 	}
+	defer rows.Close()
 
-	// Output the PDF directly to the response
-	c.Header("Content-Type", "application/pdf")
-	c.Header("Content-Disposition", "attachment; filename=UsersData.pdf")
-	err = pdf.Output(c.Writer)
+	// Render the whole report first so errors can still be sent as JSON
+	report := export.PDFReport{
+		Title: opts.Title,
+		Subtitle: []string{
+			fmt.Sprintf("Registrations from %s to %s", start.Format(export.DateLayout), end.Format(export.DateLayout)),
+			"Requested by " + c.GetString("username"),
+		},
+		Columns:   opts.Columns,
+		Analytics: analytics,
+		Branding:  opts.Branding,
+	}
+	buf, err := export.BuildPDF(masking.Source(rows, policy), report)
 	if err != nil {
+		fmt.Printf("Error building PDF export: %v\n", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating PDF"})
 		return
 	}
+
+	// Output the PDF directly to the response
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", exportFileName(start, end, "pdf")))
+	c.Data(http.StatusOK, "application/pdf", buf.Bytes())
 }
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+
+	"project/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetSecurityPolicy returns the admin-managed security policy.
+func GetSecurityPolicy(c *gin.Context) {
+	required, err := utils.MFARequiredForPersonalData()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading security policy"})
+		return
+	}
+
+	// List the roles the policy currently applies to.
+	var roles []string
+	for role := range utils.RolePermissions {
+		if required && utils.RoleHasPermission(role, utils.PermExportPersonalData) {
+			roles = append(roles, role)
+		}
+	}
+	sort.Strings(roles)
+
+	c.JSON(http.StatusOK, gin.H{
+		"mfa_required_for_personal_data": required,
+		"mfa_required_roles":             roles,
+	})
+}
+
+// UpdateSecurityPolicy changes whether roles that can export personal data must use 2FA.
+func UpdateSecurityPolicy(c *gin.Context) {
+	var request struct {
+		MFARequiredForPersonalData *bool `json:"mfa_required_for_personal_data"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil || request.MFARequiredForPersonalData == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mfa_required_for_personal_data is required"})
+		return
+	}
+
+	value := strconv.FormatBool(*request.MFARequiredForPersonalData)
+	if err := utils.SetSetting(utils.SettingMFARequiredForPersonalData, value, c.GetString("username")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving security policy"})
+		return
+	}
+
+	GetSecurityPolicy(c)
+}
+
+// UpdateUserRole assigns a role to a signupusers account.
+func UpdateUserRole(c *gin.Context) {
+	var request struct {
+		Role string `json:"role"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil || !utils.IsValidRole(request.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A valid role is required"})
+		return
+	}
+
+	username := c.Param("username")
+	if err := utils.SetUserRole(username, request.Role); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Role updated", "username": username, "role": request.Role})
+}
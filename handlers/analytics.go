@@ -0,0 +1,268 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"project/db"
+	"project/export"
+	"project/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// registrationDate parses the dd/mm/yy text column of the users table.
+const registrationDate = "STR_TO_DATE(date, '%d/%m/%y')"
+
+// bucketExpressions map each interval to the SQL for the first day of its bucket.
+// Weeks start on Monday.
+var bucketExpressions = map[string]string{
+	"day":   registrationDate,
+	"week":  "DATE_SUB(" + registrationDate + ", INTERVAL WEEKDAY(" + registrationDate + ") DAY)",
+	"month": "DATE_SUB(" + registrationDate + ", INTERVAL DAYOFMONTH(" + registrationDate + ") - 1 DAY)",
+}
+
+// maxAnalyticsBuckets keeps responses and charts readable.
+const maxAnalyticsBuckets = 400
+
+// AnalyticsRequest selects what ComputeRegistrationAnalytics aggregates.
+type AnalyticsRequest struct {
+	Start        time.Time
+	End          time.Time
+	Interval     string // day, week or month; empty picks one from the range length
+	Top          int    // entries per breakdown before the rest is summed as "other"
+	PrefixLength int    // 0 groups registration numbers by their leading letters
+}
+
+// RegistrationAnalyticsHandler serves GET /analytics/registrations with
+// start_date and end_date (dd/mm/yy), and optional interval=day|week|month,
+// top=10 and prefix_length=N.
+func RegistrationAnalyticsHandler(c *gin.Context) {
+	req, ok := parseAnalyticsRequest(c)
+	if !ok {
+		return
+	}
+
+	analytics, err := ComputeRegistrationAnalytics(req)
+	if err != nil {
+		fmt.Printf("Error computing registration analytics: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error computing analytics"})
+		return
+	}
+	c.JSON(http.StatusOK, analytics)
+}
+
+// exportAnalytics computes the chart page data when an export is requested
+// with charts=true, writing an error response and returning false on failure.
+// It returns nil when no charts were requested.
+func exportAnalytics(c *gin.Context) (*models.RegistrationAnalytics, bool) {
+	if charts, _ := strconv.ParseBool(c.Query("charts")); !charts {
+		return nil, true
+	}
+	req, ok := parseAnalyticsRequest(c)
+	if !ok {
+		return nil, false
+	}
+	analytics, err := ComputeRegistrationAnalytics(req)
+	if err != nil {
+		fmt.Printf("Error computing registration analytics: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error computing analytics"})
+		return nil, false
+	}
+	return analytics, true
+}
+
+// parseAnalyticsRequest reads the analytics query parameters, writing a 400
+// response and returning false if they are invalid.
+func parseAnalyticsRequest(c *gin.Context) (AnalyticsRequest, bool) {
+	start, end, ok := parseDateRange(c)
+	if !ok {
+		return AnalyticsRequest{}, false
+	}
+	if end.Before(start) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "end_date must not be before start_date"})
+		return AnalyticsRequest{}, false
+	}
+
+	req := AnalyticsRequest{Start: start, End: end, Interval: c.Query("interval")}
+	if req.Interval == "" {
+		req.Interval = defaultInterval(start, end)
+	}
+	if _, ok := bucketExpressions[req.Interval]; !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "interval must be one of day, week, month"})
+		return AnalyticsRequest{}, false
+	}
+	if n := len(bucketStarts(start, end, req.Interval)); n > maxAnalyticsBuckets {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("The range has %d %ss, use a longer interval", n, req.Interval)})
+		return AnalyticsRequest{}, false
+	}
+
+	var err error
+	if req.Top, err = strconv.Atoi(c.DefaultQuery("top", "10")); err != nil || req.Top < 1 || req.Top > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "top must be between 1 and 100"})
+		return AnalyticsRequest{}, false
+	}
+	if req.PrefixLength, err = strconv.Atoi(c.DefaultQuery("prefix_length", "0")); err != nil || req.PrefixLength < 0 || req.PrefixLength > 20 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "prefix_length must be between 0 and 20"})
+		return AnalyticsRequest{}, false
+	}
+	return req, true
+}
+
+// defaultInterval picks daily buckets for up to a month and weekly buckets
+// for up to half a year.
+func defaultInterval(start, end time.Time) string {
+	days := end.Sub(start).Hours() / 24
+	switch {
+	case days <= 31:
+		return "day"
+	case days <= 183:
+		return "week"
+	default:
+		return "month"
+	}
+}
+
+// bucketStart returns the first day of the bucket containing t.
+func bucketStart(t time.Time, interval string) time.Time {
+	t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	switch interval {
+	case "week":
+		return t.AddDate(0, 0, -(int(t.Weekday())+6)%7)
+	case "month":
+		return t.AddDate(0, 0, 1-t.Day())
+	}
+	return t
+}
+
+// bucketStarts lists the first day of every bucket overlapping the range.
+func bucketStarts(start, end time.Time, interval string) []time.Time {
+	var starts []time.Time
+	last := bucketStart(end, interval)
+	for t := bucketStart(start, interval); !t.After(last); {
+		starts = append(starts, t)
+		switch interval {
+		case "week":
+			t = t.AddDate(0, 0, 7)
+		case "month":
+			t = t.AddDate(0, 1, 0)
+		default:
+			t = t.AddDate(0, 0, 1)
+		}
+		if len(starts) > maxAnalyticsBuckets {
+			break
+		}
+	}
+	return starts
+}
+
+// bucketLabel is the short label shown under a bar of the chart.
+func bucketLabel(t time.Time, interval string) string {
+	if interval == "month" {
+		return t.Format("Jan 06")
+	}
+	return t.Format("02/01")
+}
+
+// ComputeRegistrationAnalytics counts registrations per bucket, with
+// cumulative totals and breakdowns by email domain and registration prefix.
+// Buckets without registrations are included with a zero count.
+func ComputeRegistrationAnalytics(req AnalyticsRequest) (*models.RegistrationAnalytics, error) {
+	analytics := &models.RegistrationAnalytics{
+		StartDate: req.Start.Format(export.DateLayout),
+		EndDate:   req.End.Format(export.DateLayout),
+		Interval:  req.Interval,
+	}
+
+	if err := db.DB.QueryRow("SELECT COUNT(*) FROM users WHERE "+registrationDate+" < ?", req.Start).Scan(&analytics.Baseline); err != nil {
+		return nil, fmt.Errorf("error counting earlier registrations: %v", err)
+	}
+
+	query := "SELECT " + bucketExpressions[req.Interval] + " AS bucket, COUNT(*) FROM users WHERE " +
+		registrationDate + " BETWEEN ? AND ? GROUP BY bucket"
+	rows, err := db.DB.Query(query, req.Start, req.End)
+	if err != nil {
+		return nil, fmt.Errorf("error counting registrations: %v", err)
+	}
+	counts := make(map[string]int)
+	for rows.Next() {
+		var bucket time.Time
+		var count int
+		if err := rows.Scan(&bucket, &count); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		counts[bucket.Format(export.DateLayout)] = count
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	cumulative := analytics.Baseline
+	for _, start := range bucketStarts(req.Start, req.End, req.Interval) {
+		key := start.Format(export.DateLayout)
+		cumulative += counts[key]
+		analytics.Total += counts[key]
+		analytics.Buckets = append(analytics.Buckets, models.AnalyticsBucket{
+			Start:      key,
+			Label:      bucketLabel(start, req.Interval),
+			Count:      counts[key],
+			Cumulative: cumulative,
+		})
+	}
+
+	domain := "LOWER(SUBSTRING_INDEX(email, '@', -1))"
+	if analytics.EmailDomains, err = topCounts(domain, req, nil, analytics.Total); err != nil {
+		return nil, fmt.Errorf("error counting email domains: %v", err)
+	}
+
+	prefix := "UPPER(REGEXP_SUBSTR(registration_no, '^[A-Za-z]+'))"
+	var prefixArgs []interface{}
+	if req.PrefixLength > 0 {
+		prefix = "UPPER(LEFT(registration_no, ?))"
+		prefixArgs = append(prefixArgs, req.PrefixLength)
+	}
+	if analytics.RegistrationPrefixes, err = topCounts(prefix, req, prefixArgs, analytics.Total); err != nil {
+		return nil, fmt.Errorf("error counting registration prefixes: %v", err)
+	}
+
+	return analytics, nil
+}
+
+// topCounts returns the req.Top most common values of keyExpr in the range,
+// followed by an "other" entry for the remainder of total.
+func topCounts(keyExpr string, req AnalyticsRequest, keyArgs []interface{}, total int) ([]models.AnalyticsCount, error) {
+	query := "SELECT COALESCE(" + keyExpr + ", '') AS k, COUNT(*) AS c FROM users WHERE " + registrationDate +
+		" BETWEEN ? AND ? GROUP BY k ORDER BY c DESC, k LIMIT ?"
+	args := append(append([]interface{}{}, keyArgs...), req.Start, req.End, req.Top)
+
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := []models.AnalyticsCount{}
+	listed := 0
+	for rows.Next() {
+		var entry models.AnalyticsCount
+		if err := rows.Scan(&entry.Key, &entry.Count); err != nil {
+			return nil, err
+		}
+		if entry.Key == "" {
+			entry.Key = "(none)"
+		}
+		listed += entry.Count
+		counts = append(counts, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if total > listed {
+		counts = append(counts, models.AnalyticsCount{Key: "other", Count: total - listed})
+	}
+	return counts, nil
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"project/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateAPIKeyHandler mints a scoped API key. The plain key is only shown in this response.
+func CreateAPIKeyHandler(c *gin.Context) {
+	var request struct {
+		Name      string     `json:"name"`
+		Scopes    []string   `json:"scopes"`
+		ExpiresAt *time.Time `json:"expires_at"` // RFC 3339, optional
+	}
+	if err := c.ShouldBindJSON(&request); err != nil || request.Name == "" || len(request.Scopes) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name and at least one scope are required", "allowed_scopes": utils.APIKeyScopes})
+		return
+	}
+	if request.ExpiresAt != nil && request.ExpiresAt.Before(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expires_at must be in the future"})
+		return
+	}
+	for _, scope := range request.Scopes {
+		if !utils.IsValidAPIKeyScope(scope) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid scope %q", scope), "allowed_scopes": utils.APIKeyScopes})
+			return
+		}
+	}
+
+	plain, key, err := utils.CreateAPIKey(request.Name, request.Scopes, c.GetString("username"), request.ExpiresAt)
+	if err != nil {
+		fmt.Printf("Error creating API key: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating API key"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Store this key now, it will not be shown again",
+		"key":     plain,
+		"api_key": key,
+	})
+}
+
+// ListAPIKeysHandler lists all API keys without their secrets.
+func ListAPIKeysHandler(c *gin.Context) {
+	keys, err := utils.ListAPIKeys()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing API keys"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"api_keys": keys})
+}
+
+// RevokeAPIKeyHandler revokes an API key by ID.
+func RevokeAPIKeyHandler(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid API key id"})
+		return
+	}
+
+	revoked, err := utils.RevokeAPIKey(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error revoking API key"})
+		return
+	}
+	if !revoked {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found or already revoked"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "API key revoked"})
+}
@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"project/chatbot"
+	"project/config"
+	"project/utils"
+)
+
+// The assistant's tools: fixed, parameterized queries over users. They need
+// registrations:read, like the registration endpoints, and return rows masked
+// by the caller's policy.
+
+var assistantToolsOnce sync.Once
+
+// emailDomainPattern accepts domains such as gmail.com or mail.example.org.
+var emailDomainPattern = regexp.MustCompile(`^[a-z0-9-]+(\.[a-z0-9-]+)+$`)
+
+// registerAssistantTools makes the tools available to chatbot.Ask.
+func registerAssistantTools() {
+	dateParameters := []chatbot.ToolParameter{
+		{Name: "from", Description: "first registration date, YYYY-MM-DD; omit with to for all dates"},
+		{Name: "to", Description: "last registration date, YYYY-MM-DD; defaults to today when from is given"},
+		{Name: "email_domain", Description: "only registrations whose email is at this domain, e.g. gmail.com"},
+	}
+	chatbot.RegisterTool(chatbot.Tool{
+		Name:        "count_registrations",
+		Description: "Count registrations, optionally between two dates and by email domain.",
+		Parameters:  dateParameters,
+		Permission:  utils.PermReadRegistrations,
+		Run:         countRegistrationsTool,
+	})
+	chatbot.RegisterTool(chatbot.Tool{
+		Name:        "list_registrations",
+		Description: "List registrations, newest first, optionally between two dates and by email domain.",
+		Parameters: append(dateParameters, chatbot.ToolParameter{
+			Name: "limit", Description: "how many to return, default 20",
+		}),
+		Permission: utils.PermReadRegistrations,
+		Run:        listRegistrationsTool,
+	})
+	chatbot.RegisterTool(chatbot.Tool{
+		Name:        "find_registration",
+		Description: "Look up one registration by its registration number.",
+		Parameters:  []chatbot.ToolParameter{{Name: "registration_no", Description: "the registration number", Required: true}},
+		Permission:  utils.PermReadRegistrations,
+		Run:         findRegistrationTool,
+	})
+}
+
+// maxToolRows bounds the rows a tool returns, CHAT_TOOL_MAX_ROWS (default 50).
+func maxToolRows() int {
+	return config.GetEnvInt("CHAT_TOOL_MAX_ROWS", 50)
+}
+
+// toolUserQuery builds the filter from the from, to and email_domain arguments.
+func toolUserQuery(args map[string]string) (UserQuery, error) {
+	var q UserQuery
+	if args["from"] == "" && args["to"] != "" {
+		return q, chatbot.ArgumentError("from is required with to")
+	}
+	if args["from"] != "" {
+		var err error
+		if q.Start, err = parseToolDate(args["from"]); err != nil {
+			return q, chatbot.ArgumentError("from must be a date such as 2025-01-31")
+		}
+		q.End = time.Now()
+		if args["to"] != "" {
+			if q.End, err = parseToolDate(args["to"]); err != nil {
+				return q, chatbot.ArgumentError("to must be a date such as 2025-01-31")
+			}
+		}
+		if q.End.Before(q.Start) {
+			return q, chatbot.ArgumentError("to must not be before from")
+		}
+	}
+	if domain := strings.ToLower(strings.TrimPrefix(strings.TrimSpace(args["email_domain"]), "@")); domain != "" {
+		if !emailDomainPattern.MatchString(domain) {
+			return q, chatbot.ArgumentError("email_domain must be a domain such as gmail.com")
+		}
+		q.EmailDomain = domain
+	}
+	return q, nil
+}
+
+// parseToolDate accepts YYYY-MM-DD, which providers use, or the dd/mm/yy of
+// the rest of the API.
+func parseToolDate(value string) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	return parseDate(value)
+}
+
+// describeToolQuery states the filter in words, without personal data.
+func describeToolQuery(q UserQuery) string {
+	var parts []string
+	if !q.Start.IsZero() {
+		parts = append(parts, fmt.Sprintf("from %s to %s", q.Start.Format("2006-01-02"), q.End.Format("2006-01-02")))
+	}
+	if q.EmailDomain != "" {
+		parts = append(parts, "with an email at "+q.EmailDomain)
+	}
+	if len(parts) == 0 {
+		return "in total"
+	}
+	return strings.Join(parts, " ")
+}
+
+// registrationsNoun is "registration" or "registrations".
+func registrationsNoun(n int) string {
+	if n == 1 {
+		return "registration"
+	}
+	return "registrations"
+}
+
+// countRegistrationsTool counts the matching users, returning the newest as
+// the rows the count covers.
+func countRegistrationsTool(ctx context.Context, caller chatbot.Caller, args map[string]string) (*chatbot.ToolResult, error) {
+	q, err := toolUserQuery(args)
+	if err != nil {
+		return nil, err
+	}
+	count, err := CountUsers(q)
+	if err != nil {
+		return nil, err
+	}
+	q.Sort, q.Limit = "-date", maxToolRows()
+	rows, err := FetchUsers(q, caller.Policy)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := fmt.Sprintf("There were %d %s %s.", count, registrationsNoun(count), describeToolQuery(q))
+	if len(rows) < count {
+		summary += fmt.Sprintf(" The %d most recent are attached.", len(rows))
+	}
+	return &chatbot.ToolResult{Summary: summary, Count: count, Rows: rows}, nil
+}
+
+// listRegistrationsTool returns the newest matching users.
+func listRegistrationsTool(ctx context.Context, caller chatbot.Caller, args map[string]string) (*chatbot.ToolResult, error) {
+	filters := map[string]string{"from": args["from"], "to": args["to"], "email_domain": args["email_domain"]}
+	q, err := toolUserQuery(filters)
+	if err != nil {
+		return nil, err
+	}
+	q.Sort, q.Limit = "-date", 20
+	if args["limit"] != "" {
+		if q.Limit, err = strconv.Atoi(args["limit"]); err != nil || q.Limit < 1 || q.Limit > maxToolRows() {
+			return nil, chatbot.ArgumentError(fmt.Sprintf("limit must be between 1 and %d", maxToolRows()))
+		}
+	}
+	rows, err := FetchUsers(q, caller.Policy)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := fmt.Sprintf("Found %d %s %s, newest first.", len(rows), registrationsNoun(len(rows)), describeToolQuery(q))
+	if len(rows) == q.Limit {
+		summary = fmt.Sprintf("Showing the %d newest registrations %s; there may be more.", len(rows), describeToolQuery(q))
+	}
+	return &chatbot.ToolResult{Summary: summary, Count: len(rows), Rows: rows}, nil
+}
+
+// findRegistrationTool looks up a user by registration number.
+func findRegistrationTool(ctx context.Context, caller chatbot.Caller, args map[string]string) (*chatbot.ToolResult, error) {
+	registrationNo := strings.TrimSpace(args["registration_no"])
+	if registrationNo == "" {
+		return nil, chatbot.ArgumentError("registration_no is required")
+	}
+	if len(registrationNo) > 100 {
+		return nil, chatbot.ArgumentError("registration_no is too long")
+	}
+	rows, err := FetchUsers(UserQuery{RegistrationNo: registrationNo, Limit: 1}, caller.Policy)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return &chatbot.ToolResult{Summary: fmt.Sprintf("No registration has number %s.", registrationNo)}, nil
+	}
+
+	summary := fmt.Sprintf("Registration %s exists (id %v), registered on %v.", registrationNo, rows[0]["id"], rows[0]["date"])
+	return &chatbot.ToolResult{Summary: summary, Count: 1, Rows: rows}, nil
+}
@@ -1,51 +1,189 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
-	"io"
+	"math"
 	"net/http"
-	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"project/businesses"
+	"project/cache"
+	"project/config"
+	"project/rapidapi"
+	"project/utils"
 
 	"github.com/gin-gonic/gin"
 )
 
-// GetBusinessPhotos fetches photos from the Google Maps Data API
+var (
+	langPattern    = regexp.MustCompile(`^[a-z]{2,3}(-[A-Za-z0-9]{2,8})?$`)
+	countryPattern = regexp.MustCompile(`^[A-Z]{2}$`)
+)
+
+var (
+	photosCacheOnce sync.Once
+	photosCache     cache.Cache
+)
+
+// businessPhotosCache returns the cache selected by CACHE_BACKEND.
+func businessPhotosCache() cache.Cache {
+	photosCacheOnce.Do(func() {
+		photosCache = cache.FromEnv()
+	})
+	return photosCache
+}
+
+// GetBusinessPhotos serves GET /businesses/:id/photos?lang=en&country=IN from
+// the maps-data API on RapidAPI (see rapidapi.MapsData for its settings).
+// Successful answers are cached for BUSINESS_PHOTOS_CACHE_TTL (default 1h);
+// the X-Cache header says whether the cache answered. A numeric id is a
+// business of our directory, served by getDirectoryBusinessPhotos.
 func GetBusinessPhotos(c *gin.Context) {
-	url := "https://maps-data.p.rapidapi.com/photos.php?business_id=0x47e66e2964e34e2d%3A0x8ddca9ee380ef7e0&lang=en&country=IN"
+	id := c.Param("id")
+	if !businesses.MapsIDPattern.MatchString(id) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid business id"})
+		return
+	}
+	lang := strings.ToLower(c.DefaultQuery("lang", "en"))
+	if !langPattern.MatchString(lang) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "lang must be a language code such as en or pt-BR"})
+		return
+	}
+	country := strings.ToUpper(c.DefaultQuery("country", "IN"))
+	if !countryPattern.MatchString(country) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "country must be a two-letter country code such as IN"})
+		return
+	}
 
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create request"})
+	if businessID, err := strconv.ParseInt(id, 10, 64); err == nil {
+		getDirectoryBusinessPhotos(c, businessID, lang, country)
 		return
 	}
 
-	rapidAPIKey := os.Getenv("RAPIDAPI_KEY")
-	if rapidAPIKey == "" {
-		fmt.Println("RAPIDAPI_KEY is not set in .env")
+	key := cache.Key("business-photos", id, lang, country)
+	store := businessPhotosCache()
+	if body, ok, err := store.Get(c.Request.Context(), key); err != nil {
+		fmt.Printf("Error reading business photos cache: %v\n", err)
+	} else if ok {
+		c.Header("X-Cache", "HIT")
+		c.Data(http.StatusOK, "application/json", body)
 		return
 	}
 
-	// Add required headers
-	req.Header.Add("x-rapidapi-key", rapidAPIKey)
-	req.Header.Add("x-rapidapi-host", "maps-data.p.rapidapi.com")
+	res, err := rapidapi.BusinessPhotos(c.Request.Context(), id, lang, country)
+	if err != nil {
+		fmt.Printf("Error fetching business photos: %v\n", err)
+		respondPhotosError(c, err)
+		return
+	}
+	ttl := config.GetEnvDuration("BUSINESS_PHOTOS_CACHE_TTL", time.Hour)
+	if err := store.Set(c.Request.Context(), key, res.Body, ttl); err != nil {
+		fmt.Printf("Error writing business photos cache: %v\n", err)
+	}
+	c.Header("X-Cache", "MISS")
+	c.Data(http.StatusOK, "application/json", res.Body)
+}
 
-	// Send the request
-	res, err := http.DefaultClient.Do(req)
+// getDirectoryBusinessPhotos serves the photos stored for a business of our
+// directory, fetching them again from its maps id when they are older than
+// BUSINESS_PHOTOS_REFRESH_AFTER (default 24h) or refresh=true, which needs
+// PermWriteRegistrations because it spends maps API quota. If that fails and
+// photos were stored before, they are served with X-Cache: STALE.
+func getDirectoryBusinessPhotos(c *gin.Context, id int64, lang, country string) {
+	b, err := businesses.Get(id)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch data"})
+		fmt.Printf("Error loading business %d: %v\n", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading business"})
+		return
+	}
+	if b == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Business not found"})
+		return
+	}
+
+	refresh := c.Query("refresh") == "true"
+	if refresh && !hasPermission(c, utils.PermWriteRegistrations) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions to refresh photos"})
+		return
+	}
+	refreshAfter := config.GetEnvDuration("BUSINESS_PHOTOS_REFRESH_AFTER", 24*time.Hour)
+	fresh := b.PhotosFetchedAt != nil && time.Since(*b.PhotosFetchedAt) < refreshAfter
+	if fresh && !refresh {
+		photos, err := businesses.ListPhotos(b.ID)
+		if err != nil {
+			fmt.Printf("Error loading photos of business %d: %v\n", b.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading photos"})
+			return
+		}
+		c.Header("X-Cache", "HIT")
+		c.JSON(http.StatusOK, gin.H{"business": b, "photos": photos})
+		return
+	}
+	if b.MapsBusinessID == "" {
+		c.JSON(http.StatusConflict, gin.H{"error": "The business has no maps_business_id"})
 		return
 	}
-	defer res.Body.Close()
 
-	// Read the response body
-	body, err := io.ReadAll(res.Body)
+	photos, err := businesses.RefreshPhotos(c.Request.Context(), b, lang, country)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read response"})
+		fmt.Printf("Error refreshing photos of business %d: %v\n", b.ID, err)
+		if b.PhotosFetchedAt != nil {
+			if stale, listErr := businesses.ListPhotos(b.ID); listErr == nil {
+				c.Header("X-Cache", "STALE")
+				c.JSON(http.StatusOK, gin.H{"business": b, "photos": stale})
+				return
+			}
+		}
+		respondPhotosError(c, err)
 		return
 	}
+	c.Header("X-Cache", "MISS")
+	c.JSON(http.StatusOK, gin.H{"business": b, "photos": photos})
+}
 
-	// Send the response as JSON
-	c.Data(http.StatusOK, "application/json", body)
+// respondPhotosError answers a failed maps-data call, passing on Retry-After.
+func respondPhotosError(c *gin.Context, err error) {
+	var apiErr *rapidapi.Error
+	if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(apiErr.RetryAfter.Seconds()))))
+	}
+	status, message := photosError(err)
+	c.JSON(status, gin.H{"error": message})
 }
 
-// InitRoutes sets up the routes for the API
+// photosError maps a failed maps-data call to our status and message.
+func photosError(err error) (int, string) {
+	var apiErr *rapidapi.Error
+	switch {
+	case errors.Is(err, rapidapi.ErrNotConfigured):
+		return http.StatusServiceUnavailable, "Business photos are not configured"
+	case errors.Is(err, rapidapi.ErrQuotaExhausted):
+		return http.StatusTooManyRequests, "Photos quota exceeded, try again later"
+	case errors.Is(err, rapidapi.ErrCircuitOpen):
+		return http.StatusServiceUnavailable, "The photos service is unavailable, try again later"
+	case errors.Is(err, rapidapi.ErrResponseTooLarge):
+		return http.StatusBadGateway, "The photos service answered too much data"
+	case !errors.As(err, &apiErr):
+		return http.StatusBadGateway, "Failed to fetch data"
+	case apiErr.Timeout():
+		return http.StatusGatewayTimeout, "The photos service did not answer in time"
+	case apiErr.StatusCode == http.StatusNotFound:
+		return http.StatusNotFound, "Business not found"
+	case apiErr.StatusCode == http.StatusTooManyRequests:
+		return http.StatusTooManyRequests, "Photos quota exceeded, try again later"
+	case apiErr.StatusCode == http.StatusUnauthorized || apiErr.StatusCode == http.StatusForbidden:
+		// Our key was refused; the caller can do nothing about it.
+		return http.StatusBadGateway, "The photos service refused our credentials"
+	case apiErr.StatusCode >= 400 && apiErr.StatusCode < 500:
+		return http.StatusBadRequest, "The photos service rejected the request"
+	case apiErr.StatusCode >= 500:
+		return http.StatusBadGateway, fmt.Sprintf("The photos service failed with status %d", apiErr.StatusCode)
+	default:
+		return http.StatusBadGateway, "Failed to fetch data"
+	}
+}
@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"project/businesses"
+	"project/models"
+	"project/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// businessRequest is the body of POST and PUT /businesses.
+type businessRequest struct {
+	Name           string `json:"name"`
+	ParentID       *int64 `json:"parent_id"` // null or absent for a top-level business
+	MapsBusinessID string `json:"maps_business_id"`
+	Address        string `json:"address"`
+	Phone          string `json:"phone"`
+	Website        string `json:"website"`
+}
+
+// CreateBusinessHandler adds a business, or a branch with parent_id, at POST /businesses.
+func CreateBusinessHandler(c *gin.Context) {
+	var request businessRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	b := models.Business{
+		Name:           request.Name,
+		ParentID:       request.ParentID,
+		MapsBusinessID: request.MapsBusinessID,
+		Address:        request.Address,
+		Phone:          request.Phone,
+		Website:        request.Website,
+		CreatedBy:      c.GetString("username"),
+	}
+	if !saveBusiness(c, &b, businesses.Create, "Error creating business") {
+		return
+	}
+	recordBusinessEvent(c, b.ID, "created")
+
+	c.JSON(http.StatusCreated, gin.H{"business": b})
+}
+
+// ListBusinessesHandler serves GET /businesses with optional q (part of the
+// name), parent_id (its branches), top_level=true and limit (default 100).
+func ListBusinessesHandler(c *gin.Context) {
+	var filter businesses.Filter
+	var err error
+	filter.Query = c.Query("q")
+	if filter.Limit, err = strconv.Atoi(c.DefaultQuery("limit", "100")); err != nil || filter.Limit < 1 || filter.Limit > 500 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 500"})
+		return
+	}
+	if parentID := c.Query("parent_id"); parentID != "" {
+		if filter.ParentID, err = strconv.ParseInt(parentID, 10, 64); err != nil || filter.ParentID < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid parent_id"})
+			return
+		}
+	}
+	filter.TopLevel = c.Query("top_level") == "true"
+
+	list, err := businesses.List(filter)
+	if err != nil {
+		fmt.Printf("Error listing businesses: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing businesses"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"businesses": list})
+}
+
+// GetBusinessHandler serves GET /businesses/:id with its branches.
+func GetBusinessHandler(c *gin.Context) {
+	b, ok := loadBusiness(c)
+	if !ok {
+		return
+	}
+	branches := []models.Business{}
+	if b.ParentID == nil {
+		var err error
+		if branches, err = businesses.List(businesses.Filter{ParentID: b.ID, Limit: 1000}); err != nil {
+			fmt.Printf("Error listing branches of business %d: %v\n", b.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading business"})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"business": b, "branches": branches})
+}
+
+// UpdateBusinessHandler replaces the fields of a business at PUT
+// /businesses/:id. A new maps_business_id drops the stored photos.
+func UpdateBusinessHandler(c *gin.Context) {
+	b, ok := loadBusiness(c)
+	if !ok {
+		return
+	}
+	var request businessRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	previousMapsID := b.MapsBusinessID
+	b.Name, b.ParentID, b.MapsBusinessID = request.Name, request.ParentID, request.MapsBusinessID
+	b.Address, b.Phone, b.Website = request.Address, request.Phone, request.Website
+	update := func(b *models.Business) error { return businesses.Update(b, previousMapsID) }
+	if !saveBusiness(c, b, update, "Error updating business") {
+		return
+	}
+	recordBusinessEvent(c, b.ID, "updated")
+
+	c.JSON(http.StatusOK, gin.H{"business": b})
+}
+
+// DeleteBusinessHandler removes a business without branches at DELETE
+// /businesses/:id. Its registrants are kept without a business.
+func DeleteBusinessHandler(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid business id"})
+		return
+	}
+	deleted, err := businesses.Delete(id)
+	if errors.Is(err, businesses.ErrHasBranches) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		fmt.Printf("Error deleting business %d: %v\n", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting business"})
+		return
+	}
+	if !deleted {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Business not found"})
+		return
+	}
+	recordBusinessEvent(c, id, "deleted")
+
+	c.JSON(http.StatusOK, gin.H{"message": "Business deleted"})
+}
+
+// saveBusiness validates b and saves it with save, writing the error response
+// and returning false if either fails.
+func saveBusiness(c *gin.Context, b *models.Business, save func(*models.Business) error, failure string) bool {
+	if err := businesses.Validate(b); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	err := save(b)
+	if errors.Is(err, businesses.ErrMapsIDTaken) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return false
+	}
+	if err != nil {
+		fmt.Printf("%s: %v\n", failure, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": failure})
+		return false
+	}
+	return true
+}
+
+// loadBusiness finds the business named by :id, writing the error response
+// and returning false if it is invalid or missing.
+func loadBusiness(c *gin.Context) (*models.Business, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid business id"})
+		return nil, false
+	}
+	b, err := businesses.Get(id)
+	if err != nil {
+		fmt.Printf("Error loading business %d: %v\n", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading business"})
+		return nil, false
+	}
+	if b == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Business not found"})
+		return nil, false
+	}
+	return b, true
+}
+
+// recordBusinessEvent audits a change to the business directory.
+func recordBusinessEvent(c *gin.Context, id int64, details string) {
+	resource := fmt.Sprintf("businesses/%d", id)
+	if err := utils.RecordAuditEvent(c.GetString("username"), models.AuditBusinessChange, resource, details, c.ClientIP()); err != nil {
+		fmt.Printf("Error recording business audit event: %v\n", err)
+	}
+}
+
+// businessFilter reads the optional business_id query parameter of the
+// registration listings and exports, writing the error response and returning
+// false if it is invalid or names no business. Zero means no filter.
+func businessFilter(c *gin.Context) (int64, bool) {
+	value := c.Query("business_id")
+	if value == "" {
+		return 0, true
+	}
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || id < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid business_id"})
+		return 0, false
+	}
+	return id, checkBusinessExists(c, id)
+}
+
+// checkBusinessExists writes the error response and returns false if the
+// business does not exist.
+func checkBusinessExists(c *gin.Context, id int64) bool {
+	exists, err := businesses.Exists(id)
+	if err != nil {
+		fmt.Printf("Error loading business %d: %v\n", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading business"})
+		return false
+	}
+	if !exists {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "business_id does not exist"})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"project/chatbot"
+	"project/config"
+	"project/models"
+	"project/rapidapi"
+	"project/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// chatRequest is the body of POST /chat.
+type chatRequest struct {
+	Message        string `json:"message"`
+	ConversationID int64  `json:"conversation_id"` // 0 starts a new conversation
+	Stream         bool   `json:"stream"`
+}
+
+// ChatHandler answers a message at POST /chat, continuing conversation_id
+// when given. The assistant may run the registration tools the caller has
+// permission for; the rows it used come back as "sources", masked like GET
+// /users (unmask=true works the same way). With "stream": true or Accept:
+// text/event-stream the reply is sent as server-sent events: "delta" events
+// carry pieces of the text, then "done" carries the stored message and
+// sources, or "error" says why it stopped.
+func ChatHandler(c *gin.Context) {
+	var request chatRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+	message := strings.TrimSpace(request.Message)
+	if message == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "message is required"})
+		return
+	}
+	if max := config.GetEnvInt("CHAT_MAX_MESSAGE_CHARS", 4000); utf8.RuneCountInString(message) > max {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("message must be at most %d characters", max)})
+		return
+	}
+
+	conv := &models.ChatConversation{Username: c.GetString("username")}
+	var history []models.ChatMessage
+	if request.ConversationID != 0 {
+		var err error
+		if conv, err = chatbot.GetConversation(request.ConversationID, conv.Username); err != nil {
+			fmt.Printf("Error loading conversation %d: %v\n", request.ConversationID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading conversation"})
+			return
+		}
+		if conv == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Conversation not found"})
+			return
+		}
+		if history, err = chatbot.ListMessages(conv.ID); err != nil {
+			fmt.Printf("Error loading conversation %d: %v\n", conv.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading conversation"})
+			return
+		}
+	}
+
+	policy, ok := requestMaskingPolicy(c, "chat")
+	if !ok {
+		return
+	}
+	assistantToolsOnce.Do(registerAssistantTools)
+	caller := chatbot.Caller{
+		Username: conv.Username,
+		Can:      func(permission string) bool { return hasPermission(c, permission) },
+		Policy:   policy,
+	}
+
+	provider, err := chatbot.CurrentProvider()
+	if err != nil {
+		fmt.Printf("Error configuring chatbot: %v\n", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "The chatbot is not configured"})
+		return
+	}
+
+	// The event stream starts with the first piece of the reply, so a failure
+	// before then is still answered with a plain JSON error.
+	streaming := false
+	var emit func(chunk string) error
+	if request.Stream || strings.Contains(c.GetHeader("Accept"), "text/event-stream") {
+		emit = func(chunk string) error {
+			if !streaming {
+				c.Header("Content-Type", "text/event-stream")
+				c.Header("Cache-Control", "no-cache")
+				c.Header("X-Accel-Buffering", "no")
+				c.Status(http.StatusOK)
+				streaming = true
+			}
+			c.SSEvent("delta", gin.H{"text": chunk})
+			c.Writer.Flush()
+			return c.Request.Context().Err()
+		}
+	}
+	fail := func(status int, message string) {
+		if streaming {
+			c.SSEvent("error", gin.H{"error": message})
+			c.Writer.Flush()
+			return
+		}
+		c.JSON(status, gin.H{"error": message})
+	}
+
+	reply, sources, err := chatbot.Ask(c.Request.Context(), provider, caller, history, message, emit)
+	if err != nil {
+		fmt.Printf("Error asking chatbot %s: %v\n", provider.Name(), err)
+		fail(chatError(err))
+		return
+	}
+	toolCalls := chatbot.ToolCallRecords(sources)
+	answer, err := chatbot.SaveExchange(conv, message, reply, provider.Name(), toolCalls)
+	if err != nil {
+		fmt.Printf("Error saving chat messages: %v\n", err)
+		fail(http.StatusInternalServerError, "Error saving conversation")
+		return
+	}
+	if len(toolCalls) > 0 {
+		recordAssistantQuery(c, conv.ID, toolCalls)
+	}
+	if sources == nil {
+		sources = []chatbot.ToolResult{}
+	}
+
+	if streaming {
+		c.SSEvent("done", gin.H{"conversation_id": conv.ID, "message": answer, "sources": sources})
+		c.Writer.Flush()
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"conversation_id": conv.ID, "message": answer, "sources": sources})
+}
+
+// recordAssistantQuery audits the queries the assistant ran for the caller.
+func recordAssistantQuery(c *gin.Context, conversationID int64, toolCalls []models.ChatToolCall) {
+	var details []string
+	for _, call := range toolCalls {
+		details = append(details, fmt.Sprintf("%s %v: %d rows", call.Tool, call.Arguments, call.Count))
+	}
+	resource := fmt.Sprintf("chat/conversations/%d", conversationID)
+	if err := utils.RecordAuditEvent(c.GetString("username"), models.AuditAssistantQuery, resource, strings.Join(details, "; "), c.ClientIP()); err != nil {
+		fmt.Printf("Error recording assistant audit event: %v\n", err)
+	}
+}
+
+// chatError maps a provider failure to our status and message.
+func chatError(err error) (int, string) {
+	var apiErr *rapidapi.Error
+	switch {
+	case errors.Is(err, rapidapi.ErrNotConfigured):
+		return http.StatusServiceUnavailable, "The chatbot is not configured"
+	case errors.Is(err, rapidapi.ErrCircuitOpen):
+		return http.StatusServiceUnavailable, "The chatbot is unavailable, try again later"
+	case errors.As(err, &apiErr) && apiErr.Timeout():
+		return http.StatusGatewayTimeout, "The chatbot did not answer in time"
+	case errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusTooManyRequests:
+		return http.StatusTooManyRequests, "Chatbot quota exceeded, try again later"
+	default:
+		return http.StatusBadGateway, "The chatbot failed to answer"
+	}
+}
+
+// ListChatConversationsHandler serves GET /chat/conversations, the caller's
+// conversations with the most recent first, up to limit (default 50).
+func ListChatConversationsHandler(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 || limit > 200 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 200"})
+		return
+	}
+	conversations, err := chatbot.ListConversations(c.GetString("username"), limit)
+	if err != nil {
+		fmt.Printf("Error listing conversations: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing conversations"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"conversations": conversations})
+}
+
+// GetChatConversationHandler serves GET /chat/conversations/:id with its messages.
+func GetChatConversationHandler(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid conversation id"})
+		return
+	}
+	conv, err := chatbot.GetConversation(id, c.GetString("username"))
+	if err != nil {
+		fmt.Printf("Error loading conversation %d: %v\n", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading conversation"})
+		return
+	}
+	if conv == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Conversation not found"})
+		return
+	}
+	messages, err := chatbot.ListMessages(id)
+	if err != nil {
+		fmt.Printf("Error loading conversation %d: %v\n", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading conversation"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"conversation": conv, "messages": messages})
+}
+
+// DeleteChatConversationHandler serves DELETE /chat/conversations/:id.
+func DeleteChatConversationHandler(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid conversation id"})
+		return
+	}
+	deleted, err := chatbot.DeleteConversation(id, c.GetString("username"))
+	if err != nil {
+		fmt.Printf("Error deleting conversation %d: %v\n", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting conversation"})
+		return
+	}
+	if !deleted {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Conversation not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Conversation deleted"})
+}
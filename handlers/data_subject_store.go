@@ -0,0 +1,660 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+
+	"project/chatbot"
+	"project/db"
+	"project/export"
+	"project/models"
+	"project/notifications"
+	"project/storage"
+	"project/utils"
+	"project/webhooks"
+)
+
+// phoneMatchDigits is how many trailing digits identify a phone number, so
+// "+91 98765 43210" and "09876543210" match the same subject.
+const phoneMatchDigits = 10
+
+// erasedName replaces the name of anonymized registrations.
+const erasedName = "[erased]"
+
+// registrationTables hold registrations: temp until TransferTempData moves them to users.
+var registrationTables = []string{"users", "temp"}
+
+// attributionColumns name the account that created or changed a record.
+// Erasure replaces the username with the tombstone reference, so the
+// records stay attributable without naming the subject.
+var attributionColumns = []struct {
+	Table  string
+	Column string
+}{
+	{"audit_events", "actor"},
+	{"export_jobs", "requested_by"},
+	{"imports", "created_by"},
+	{"api_keys", "created_by"},
+	{"app_settings", "updated_by"},
+	{"export_templates", "updated_by"},
+	{"erasure_tombstones", "requested_by"},
+	{"webhook_subscriptions", "created_by"},
+}
+
+// normalizeDataSubject lower-cases the email and reduces the phone number to
+// its digits, rejecting values that cannot identify anyone.
+func normalizeDataSubject(s models.DataSubject) (models.DataSubject, error) {
+	s.Email = strings.ToLower(strings.TrimSpace(s.Email))
+	var digits strings.Builder
+	for _, r := range s.Phone {
+		if r >= '0' && r <= '9' {
+			digits.WriteRune(r)
+		}
+	}
+	s.Phone = digits.String()
+
+	if s.Email == "" && s.Phone == "" {
+		return s, fmt.Errorf("email or phone is required")
+	}
+	if s.Email != "" && !models.IsValidEmail(s.Email) {
+		return s, fmt.Errorf("email is not a valid email address")
+	}
+	if s.Phone != "" && (len(s.Phone) < 7 || len(s.Phone) > 15) {
+		return s, fmt.Errorf("phone must have 7 to 15 digits")
+	}
+	return s, nil
+}
+
+// subjectFilter is the WHERE condition matching the subject's registrations.
+func subjectFilter(s models.DataSubject) (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	if s.Email != "" {
+		conditions = append(conditions, "LOWER(TRIM(email)) = ?")
+		args = append(args, s.Email)
+	}
+	if s.Phone != "" {
+		key := s.Phone
+		if len(key) > phoneMatchDigits {
+			key = key[len(key)-phoneMatchDigits:]
+		}
+		conditions = append(conditions, "RIGHT(REGEXP_REPLACE(phone_no, '[^0-9]', ''), ?) = ?")
+		args = append(args, len(key), key)
+	}
+	return "(" + strings.Join(conditions, " OR ") + ")", args
+}
+
+// subjectHashes returns the keyed hashes a tombstone stores instead of the identifiers.
+func subjectHashes(s models.DataSubject) (string, string, error) {
+	var emailHash, phoneHash string
+	var err error
+	if s.Email != "" {
+		if emailHash, err = utils.SignValue("data-subject", "email", s.Email); err != nil {
+			return "", "", err
+		}
+	}
+	if s.Phone != "" {
+		if phoneHash, err = utils.SignValue("data-subject", "phone", s.Phone); err != nil {
+			return "", "", err
+		}
+	}
+	return emailHash, phoneHash, nil
+}
+
+// subjectUsernames returns the signupusers accounts of the subject: usernames
+// are email addresses, and external identities record the provider's email.
+func subjectUsernames(s models.DataSubject) ([]string, error) {
+	if s.Email == "" {
+		return nil, nil
+	}
+	query := `SELECT username FROM signupusers WHERE LOWER(username) = ?
+		UNION SELECT username FROM user_identities WHERE LOWER(email) = ?`
+	rows, err := db.DB.Query(query, s.Email, s.Email)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var usernames []string
+	for rows.Next() {
+		var username string
+		if err := rows.Scan(&username); err != nil {
+			return nil, err
+		}
+		usernames = append(usernames, username)
+	}
+	return usernames, rows.Err()
+}
+
+// querySubjectRegistrations returns the subject's rows of a registration table.
+func querySubjectRegistrations(table string, s models.DataSubject) ([]map[string]interface{}, error) {
+	where, args := subjectFilter(s)
+	rows, err := db.DB.Query("SELECT id, name, email, registration_no, phone_no, date FROM "+table+" WHERE "+where+" ORDER BY id", args...)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching %s: %v", table, err)
+	}
+	users := &UserRows{rows: rows}
+	defer users.Close()
+
+	records := []map[string]interface{}{}
+	for users.Next() {
+		records = append(records, export.Record(users.User()))
+	}
+	return records, users.Err()
+}
+
+// collectDataSubject gathers everything held about the subject.
+func collectDataSubject(s models.DataSubject) (*models.DataSubjectReport, error) {
+	report := &models.DataSubjectReport{
+		Subject:             s,
+		GeneratedAt:         time.Now(),
+		Identities:          []models.SubjectIdentity{},
+		ReportSubscriptions: []models.SubjectSubscription{},
+		AuditEvents:         []models.AuditEvent{},
+		ChatConversations:   []models.SubjectConversation{},
+	}
+
+	var err error
+	if report.Registrations, err = querySubjectRegistrations("users", s); err != nil {
+		return nil, err
+	}
+	if report.PendingRegistrations, err = querySubjectRegistrations("temp", s); err != nil {
+		return nil, err
+	}
+
+	usernames, err := subjectUsernames(s)
+	if err != nil {
+		return nil, fmt.Errorf("error finding accounts: %v", err)
+	}
+	for _, username := range usernames {
+		// Several accounts are only possible through differently cased usernames; the first is reported in full.
+		if report.Account == nil {
+			if report.Account, err = utils.GetProfile(username); err != nil {
+				return nil, fmt.Errorf("error loading account: %v", err)
+			}
+		}
+		identities, err := subjectIdentities(username)
+		if err != nil {
+			return nil, fmt.Errorf("error loading identities: %v", err)
+		}
+		report.Identities = append(report.Identities, identities...)
+
+		events, err := utils.ListAuditEvents(username, "", 1000)
+		if err != nil {
+			return nil, fmt.Errorf("error loading audit events: %v", err)
+		}
+		report.AuditEvents = append(report.AuditEvents, events...)
+
+		conversations, err := subjectConversations(username)
+		if err != nil {
+			return nil, fmt.Errorf("error loading chat history: %v", err)
+		}
+		report.ChatConversations = append(report.ChatConversations, conversations...)
+	}
+
+	if report.ReportSubscriptions, err = subjectSubscriptions(s, usernames); err != nil {
+		return nil, fmt.Errorf("error loading report subscriptions: %v", err)
+	}
+	return report, nil
+}
+
+// subjectConversations returns every chatbot conversation of an account with its messages.
+func subjectConversations(username string) ([]models.SubjectConversation, error) {
+	list, err := chatbot.ListConversations(username, math.MaxInt32)
+	if err != nil {
+		return nil, err
+	}
+	conversations := make([]models.SubjectConversation, 0, len(list))
+	for _, conv := range list {
+		messages, err := chatbot.ListMessages(conv.ID)
+		if err != nil {
+			return nil, err
+		}
+		conversations = append(conversations, models.SubjectConversation{ChatConversation: conv, Messages: messages})
+	}
+	return conversations, nil
+}
+
+func subjectIdentities(username string) ([]models.SubjectIdentity, error) {
+	rows, err := db.DB.Query("SELECT provider, subject, email, created_at FROM user_identities WHERE username = ?", username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var identities []models.SubjectIdentity
+	for rows.Next() {
+		var identity models.SubjectIdentity
+		if err := rows.Scan(&identity.Provider, &identity.Subject, &identity.Email, &identity.CreatedAt); err != nil {
+			return nil, err
+		}
+		identities = append(identities, identity)
+	}
+	return identities, rows.Err()
+}
+
+// subjectSubscriptions lists the report subscriptions the subject's accounts
+// own and those that email the subject.
+func subjectSubscriptions(s models.DataSubject, usernames []string) ([]models.SubjectSubscription, error) {
+	rows, err := db.DB.Query("SELECT id, name, created_by, recipients FROM report_subscriptions ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subscriptions := []models.SubjectSubscription{}
+	for rows.Next() {
+		var sub models.SubjectSubscription
+		var createdBy, recipients string
+		if err := rows.Scan(&sub.ID, &sub.Name, &createdBy, &recipients); err != nil {
+			return nil, err
+		}
+		switch {
+		case containsFold(usernames, createdBy):
+			sub.Relation = "owner"
+		case s.Email != "" && containsFold(splitList(recipients), s.Email):
+			sub.Relation = "recipient"
+		default:
+			continue
+		}
+		subscriptions = append(subscriptions, sub)
+	}
+	return subscriptions, rows.Err()
+}
+
+// containsFold reports whether the list holds the value, ignoring case.
+func containsFold(list []string, value string) bool {
+	for _, item := range list {
+		if strings.EqualFold(strings.TrimSpace(item), value) {
+			return true
+		}
+	}
+	return false
+}
+
+// eraseDataSubject deletes or anonymizes the subject's registrations, deletes
+// their accounts and owned report subscriptions, removes them from report
+// recipients and pseudonymizes records attributed to their accounts, all in
+// one transaction, and deletes the import error reports quoting them. It
+// returns the tombstone and the ids of the report subscriptions that must no
+// longer run.
+func eraseDataSubject(ctx context.Context, s models.DataSubject, mode, reason, requestedBy string) (*models.ErasureTombstone, []int64, error) {
+	usernames, err := subjectUsernames(s)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error finding accounts: %v", err)
+	}
+	// Files cannot be part of the transaction, so they go first: a failed
+	// erasure may have deleted reports, but never leaves one behind.
+	reports, err := subjectImportReports(ctx, s)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error searching import error reports: %v", err)
+	}
+	for _, report := range reports {
+		if err := exportStore.Delete(ctx, report.key); err != nil {
+			return nil, nil, fmt.Errorf("error deleting error report of import %s: %v", report.id, err)
+		}
+	}
+	tombstone := &models.ErasureTombstone{Mode: mode, Reason: reason, RequestedBy: requestedBy, Counts: map[string]int64{}, CreatedAt: time.Now()}
+	if tombstone.EmailHash, tombstone.PhoneHash, err = subjectHashes(s); err != nil {
+		return nil, nil, err
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`INSERT INTO erasure_tombstones (email_hash, phone_hash, mode, counts, reason, requested_by, created_at)
+		VALUES (?, ?, ?, '{}', ?, ?, ?)`, tombstone.EmailHash, tombstone.PhoneHash, mode, reason, requestedBy, tombstone.CreatedAt)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error creating tombstone: %v", err)
+	}
+	if tombstone.ID, err = res.LastInsertId(); err != nil {
+		return nil, nil, err
+	}
+
+	where, args := subjectFilter(s)
+	if err := queueRegistrationDeletes(tx, where, args); err != nil {
+		return nil, nil, err
+	}
+	for _, table := range registrationTables {
+		count, err := eraseRegistrations(tx, table, mode, where, args)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error erasing %s: %v", table, err)
+		}
+		tombstone.Counts[table] = count
+	}
+
+	for _, report := range reports {
+		if _, err := tx.Exec("UPDATE imports SET error_report_key = '' WHERE id = ?", report.id); err != nil {
+			return nil, nil, fmt.Errorf("error updating import %s: %v", report.id, err)
+		}
+		tombstone.Counts["import_error_reports"]++
+	}
+
+	var stopped []int64
+	for _, username := range usernames {
+		ids, err := deleteOwnedSubscriptions(tx, username, tombstone.Counts)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error deleting report subscriptions: %v", err)
+		}
+		stopped = append(stopped, ids...)
+
+		counts, err := utils.DeleteAccountRows(tx, username)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error deleting account: %v", err)
+		}
+		for table, count := range counts {
+			tombstone.Counts[table] += count
+		}
+
+		for _, col := range attributionColumns {
+			res, err := tx.Exec("UPDATE "+col.Table+" SET "+col.Column+" = ? WHERE "+col.Column+" = ?", tombstone.Reference(), username)
+			if err != nil {
+				return nil, nil, fmt.Errorf("error pseudonymizing %s: %v", col.Table, err)
+			}
+			count, _ := res.RowsAffected()
+			tombstone.Counts[col.Table+"."+col.Column] += count
+		}
+	}
+
+	if s.Email != "" {
+		ids, err := removeRecipient(tx, s.Email, tombstone.Counts)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error removing report recipient: %v", err)
+		}
+		stopped = append(stopped, ids...)
+
+		count, err := notifications.DeleteForSubject(tx, s.Email)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error deleting notifications: %v", err)
+		}
+		tombstone.Counts["notification_outbox"] = count
+
+		if count, err = webhooks.DeleteForEmail(tx, s.Email); err != nil {
+			return nil, nil, fmt.Errorf("error deleting webhook events: %v", err)
+		}
+		tombstone.Counts["webhook_events"] = count
+	}
+
+	counts, err := json.Marshal(tombstone.Counts)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := tx.Exec("UPDATE erasure_tombstones SET counts = ? WHERE id = ?", string(counts), tombstone.ID); err != nil {
+		return nil, nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+	return tombstone, stopped, nil
+}
+
+// importReport is an import error report in the export storage.
+type importReport struct{ id, key string }
+
+// subjectImportReports returns the import error reports quoting the subject's
+// email or phone number. Reports only hold the invalid values of each row, so
+// a report naming the subject has one of them as a value.
+func subjectImportReports(ctx context.Context, s models.DataSubject) ([]importReport, error) {
+	rows, err := db.DB.Query("SELECT id, error_report_key FROM imports WHERE error_report_key <> ''")
+	if err != nil {
+		return nil, err
+	}
+	var reports []importReport
+	for rows.Next() {
+		var report importReport
+		if err := rows.Scan(&report.id, &report.key); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		reports = append(reports, report)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var matching []importReport
+	for _, report := range reports {
+		found, err := importReportMentions(ctx, report.key, s)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			matching = append(matching, report)
+		}
+	}
+	return matching, nil
+}
+
+// importReportMentions reports whether a value of the error report is the
+// subject's email or phone number. A missing report mentions no one.
+func importReportMentions(ctx context.Context, key string, s models.DataSubject) (bool, error) {
+	file, err := exportStore.Open(ctx, key)
+	if err == storage.ErrNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+		// row, field, value, message
+		if len(record) > 2 && subjectValue(record[2], s) {
+			return true, nil
+		}
+	}
+}
+
+// subjectValue reports whether value is the subject's email or, matched on
+// the same trailing digits as subjectFilter, their phone number.
+func subjectValue(value string, s models.DataSubject) bool {
+	if s.Email != "" && strings.EqualFold(strings.TrimSpace(value), s.Email) {
+		return true
+	}
+	if s.Phone == "" {
+		return false
+	}
+	var digits strings.Builder
+	for _, r := range value {
+		if r >= '0' && r <= '9' {
+			digits.WriteRune(r)
+		}
+	}
+	key := s.Phone
+	if len(key) > phoneMatchDigits {
+		key = key[len(key)-phoneMatchDigits:]
+	}
+	return digits.Len() >= 7 && strings.HasSuffix(digits.String(), key)
+}
+
+// eraseRegistrations deletes or anonymizes the matching rows of a registration
+// table. Anonymized rows keep their id and date, so counts and charts stay correct.
+func eraseRegistrations(tx *sql.Tx, table, mode, where string, args []interface{}) (int64, error) {
+	query := "DELETE FROM " + table + " WHERE " + where
+	if mode == models.ErasureAnonymize {
+		query = "UPDATE " + table + " SET name = ?, email = '', registration_no = '', phone_no = '' WHERE " + where
+		args = append([]interface{}{erasedName}, args...)
+	}
+	res, err := tx.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// deleteOwnedSubscriptions removes the report subscriptions of an account with their delivery history.
+func deleteOwnedSubscriptions(tx *sql.Tx, username string, counts map[string]int64) ([]int64, error) {
+	rows, err := tx.Query("SELECT id FROM report_subscriptions WHERE created_by = ?", username)
+	if err != nil {
+		return nil, err
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, id := range ids {
+		res, err := tx.Exec("DELETE FROM report_deliveries WHERE subscription_id = ?", id)
+		if err != nil {
+			return nil, err
+		}
+		n, _ := res.RowsAffected()
+		counts["report_deliveries"] += n
+		if _, err := tx.Exec("DELETE FROM report_subscriptions WHERE id = ?", id); err != nil {
+			return nil, err
+		}
+		counts["report_subscriptions"]++
+	}
+	return ids, nil
+}
+
+// removeRecipient drops the email from report recipient lists, including the
+// delivery history. Subscriptions left without recipients are disabled and
+// returned so they can be unscheduled.
+func removeRecipient(tx *sql.Tx, email string, counts map[string]int64) ([]int64, error) {
+	var disabled []int64
+	for _, table := range []string{"report_subscriptions", "report_deliveries"} {
+		rows, err := tx.Query("SELECT id, recipients FROM "+table+" WHERE FIND_IN_SET(?, LOWER(recipients)) > 0", email)
+		if err != nil {
+			return nil, err
+		}
+		updated := map[int64][]string{}
+		for rows.Next() {
+			var id int64
+			var recipients string
+			if err := rows.Scan(&id, &recipients); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			var kept []string
+			for _, recipient := range splitList(recipients) {
+				if !strings.EqualFold(recipient, email) {
+					kept = append(kept, recipient)
+				}
+			}
+			updated[id] = kept
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+
+		for id, kept := range updated {
+			query := "UPDATE " + table + " SET recipients = ? WHERE id = ?"
+			if table == "report_subscriptions" && len(kept) == 0 {
+				query = "UPDATE " + table + " SET recipients = ?, enabled = 0 WHERE id = ?"
+				disabled = append(disabled, id)
+			}
+			if _, err := tx.Exec(query, strings.Join(kept, ","), id); err != nil {
+				return nil, err
+			}
+			counts[table+".recipients"]++
+		}
+	}
+	return disabled, nil
+}
+
+// listErasureTombstones returns the tombstones matching either identifier hash, newest first.
+func listErasureTombstones(emailHash, phoneHash string) ([]models.ErasureTombstone, error) {
+	query := `SELECT id, email_hash, phone_hash, mode, counts, reason, requested_by, created_at
+		FROM erasure_tombstones WHERE (email_hash <> '' AND email_hash = ?) OR (phone_hash <> '' AND phone_hash = ?)
+		ORDER BY id DESC`
+	rows, err := db.DB.Query(query, emailHash, phoneHash)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tombstones := []models.ErasureTombstone{}
+	for rows.Next() {
+		var t models.ErasureTombstone
+		var counts string
+		if err := rows.Scan(&t.ID, &t.EmailHash, &t.PhoneHash, &t.Mode, &counts, &t.Reason, &t.RequestedBy, &t.CreatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(counts), &t.Counts); err != nil {
+			return nil, fmt.Errorf("invalid counts in tombstone %d: %v", t.ID, err)
+		}
+		tombstones = append(tombstones, t)
+	}
+	return tombstones, rows.Err()
+}
+
+// purgeRegistrationsBefore deletes or anonymizes registrations dated before the cutoff.
+func purgeRegistrationsBefore(cutoff time.Time, mode string) (int64, error) {
+	where := registrationDate + " < ?"
+	args := []interface{}{cutoff}
+	if mode == models.ErasureAnonymize {
+		where += " AND name <> ?"
+		args = append(args, erasedName)
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if err := queueRegistrationDeletes(tx, where, args); err != nil {
+		return 0, err
+	}
+	count, err := eraseRegistrations(tx, "users", mode, where, args)
+	if err != nil {
+		return 0, err
+	}
+	return count, tx.Commit()
+}
+
+// queueRegistrationDeletes sends a registration.deleted webhook for each
+// users row matching where, before it is erased. Anonymized rows count as
+// deleted: partners should drop what they hold about the person.
+func queueRegistrationDeletes(tx *sql.Tx, where string, args []interface{}) error {
+	rows, err := tx.Query("SELECT id FROM users WHERE "+where, args...)
+	if err != nil {
+		return fmt.Errorf("error finding registrations: %v", err)
+	}
+	var events []webhooks.Event
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		events = append(events, webhooks.RegistrationDeleted(id))
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if err := webhooks.Enqueue(tx, events...); err != nil {
+		return fmt.Errorf("error queueing webhooks: %v", err)
+	}
+	return nil
+}
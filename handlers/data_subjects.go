@@ -0,0 +1,348 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"project/config"
+	"project/export"
+	"project/middleware"
+	"project/models"
+	"project/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// dataSubjectTimeLayout formats timestamps in the subject PDF.
+const dataSubjectTimeLayout = "02/01/2006 15:04"
+
+// ExportDataSubjectHandler answers an access request: POST
+// /admin/data-subjects/export with {"email": ..., "phone": ...} returns
+// everything held about the subject as a ZIP with data-subject.json and
+// data-subject.pdf, or only the JSON with ?format=json. Like every export of
+// personal data it needs a two-factor session when the policy requires one.
+func ExportDataSubjectHandler(c *gin.Context) {
+	format := c.DefaultQuery("format", "zip")
+	if format != "zip" && format != "json" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be zip or json"})
+		return
+	}
+	if !middleware.CheckMFASession(c) {
+		return
+	}
+	subject, ok := bindDataSubject(c, nil)
+	if !ok {
+		return
+	}
+
+	report, err := collectDataSubject(subject)
+	if err != nil {
+		fmt.Printf("Error collecting data subject: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error collecting personal data"})
+		return
+	}
+	// Fail closed like unmasking: the access is recorded before any data is served.
+	if err := recordDataSubjectEvent(c, models.AuditSubjectExport, subject, ""); err != nil {
+		fmt.Printf("Error recording data subject audit event: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error recording audit event"})
+		return
+	}
+
+	if format == "json" {
+		c.JSON(http.StatusOK, report)
+		return
+	}
+
+	bundle, err := buildDataSubjectBundle(report)
+	if err != nil {
+		fmt.Printf("Error building data subject bundle: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating export"})
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=data-subject_%d.zip", report.GeneratedAt.UnixMilli()))
+	c.Data(http.StatusOK, "application/zip", bundle.Bytes())
+}
+
+// EraseDataSubjectHandler answers a deletion request: POST
+// /admin/data-subjects/erase with {"email", "phone", "mode": "delete" or
+// "anonymize", "reason", "confirm": true}. Registrations are deleted or
+// anonymized, the account is deleted either way, and a tombstone without
+// personal data records the erasure.
+func EraseDataSubjectHandler(c *gin.Context) {
+	var request struct {
+		Mode    string `json:"mode"`
+		Reason  string `json:"reason"`
+		Confirm bool   `json:"confirm"`
+	}
+	subject, ok := bindDataSubject(c, &request)
+	if !ok {
+		return
+	}
+	if request.Mode == "" {
+		request.Mode = models.ErasureDelete
+	}
+	if request.Mode != models.ErasureDelete && request.Mode != models.ErasureAnonymize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mode must be delete or anonymize"})
+		return
+	}
+	if len(request.Reason) > 255 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "reason must be at most 255 characters"})
+		return
+	}
+	if !request.Confirm {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Erasure cannot be undone, set confirm to true"})
+		return
+	}
+
+	tombstone, stopped, err := eraseDataSubject(c.Request.Context(), subject, request.Mode, request.Reason, c.GetString("username"))
+	if err != nil {
+		fmt.Printf("Error erasing data subject: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error erasing personal data"})
+		return
+	}
+	for _, id := range stopped {
+		unscheduleReport(id)
+	}
+	// The tombstone already proves the erasure, so a failed audit write is only logged.
+	if err := recordDataSubjectEvent(c, models.AuditSubjectErase, subject, tombstone.Reference()); err != nil {
+		fmt.Printf("Error recording data subject audit event: %v\n", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Personal data erased", "tombstone": tombstone})
+}
+
+// ListErasureTombstonesHandler serves GET /admin/data-subjects/tombstones
+// with email and/or phone, showing whether and how the subject was erased.
+func ListErasureTombstonesHandler(c *gin.Context) {
+	subject, err := normalizeDataSubject(models.DataSubject{Email: c.Query("email"), Phone: c.Query("phone")})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	emailHash, phoneHash, err := subjectHashes(subject)
+	if err != nil {
+		fmt.Printf("Error hashing data subject: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server misconfiguration"})
+		return
+	}
+
+	tombstones, err := listErasureTombstones(emailHash, phoneHash)
+	if err != nil {
+		fmt.Printf("Error listing erasure tombstones: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing tombstones"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"tombstones": tombstones})
+}
+
+// bindDataSubject reads the subject, and optionally extra fields into
+// request, from the JSON body, writing a 400 response and returning false
+// if it is invalid.
+func bindDataSubject(c *gin.Context, request interface{}) (models.DataSubject, bool) {
+	body, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return models.DataSubject{}, false
+	}
+	var subject models.DataSubject
+	if err := json.Unmarshal(body, &subject); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return models.DataSubject{}, false
+	}
+	if request != nil {
+		if err := json.Unmarshal(body, request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+			return models.DataSubject{}, false
+		}
+	}
+
+	if subject, err = normalizeDataSubject(subject); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return models.DataSubject{}, false
+	}
+	return subject, true
+}
+
+// recordDataSubjectEvent audits an access or erasure. The subject is named
+// by the prefix of their identifier hashes only, so the audit log does not
+// itself hold the personal data that was erased.
+func recordDataSubjectEvent(c *gin.Context, action string, subject models.DataSubject, details string) error {
+	emailHash, phoneHash, err := subjectHashes(subject)
+	if err != nil {
+		return err
+	}
+	resource := "data-subject:" + shortHash(emailHash) + "/" + shortHash(phoneHash)
+	return utils.RecordAuditEvent(c.GetString("username"), action, resource, details, c.ClientIP())
+}
+
+// shortHash keeps enough of a hash to tell subjects apart in the audit log.
+func shortHash(hash string) string {
+	if len(hash) > 12 {
+		return hash[:12]
+	}
+	return hash
+}
+
+// buildDataSubjectBundle zips the JSON report and its PDF rendering.
+func buildDataSubjectBundle(report *models.DataSubjectReport) (*bytes.Buffer, error) {
+	encoded, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	var subtitle []string
+	if report.Subject.Email != "" {
+		subtitle = append(subtitle, "Email: "+report.Subject.Email)
+	}
+	if report.Subject.Phone != "" {
+		subtitle = append(subtitle, "Phone (digits): "+report.Subject.Phone)
+	}
+	pdf, err := export.BuildSubjectPDF("Personal data report", subtitle, dataSubjectSections(report))
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, file := range []struct {
+		name string
+		data []byte
+	}{
+		{"data-subject.json", encoded},
+		{"data-subject.pdf", pdf.Bytes()},
+	} {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: file.name, Method: zip.Deflate, Modified: report.GeneratedAt})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(file.data); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return &buf, nil
+}
+
+// dataSubjectSections lays the report out for BuildSubjectPDF.
+func dataSubjectSections(report *models.DataSubjectReport) []export.SubjectSection {
+	registrations := func(title string, records []map[string]interface{}) export.SubjectSection {
+		section := export.SubjectSection{Title: title}
+		for _, record := range records {
+			var fields []export.SubjectField
+			for _, col := range export.UserColumns {
+				fields = append(fields, export.SubjectField{Label: col.Header, Value: fmt.Sprint(record[col.Key])})
+			}
+			section.Records = append(section.Records, fields)
+		}
+		return section
+	}
+
+	account := export.SubjectSection{Title: "Account"}
+	if a := report.Account; a != nil {
+		preferences, _ := json.Marshal(a.Preferences)
+		deletion := ""
+		if a.DeletionScheduledAt != nil {
+			deletion = a.DeletionScheduledAt.Format(dataSubjectTimeLayout)
+		}
+		account.Records = append(account.Records, []export.SubjectField{
+			{Label: "Username", Value: a.Username},
+			{Label: "Display name", Value: a.DisplayName},
+			{Label: "Date of birth", Value: a.DOB},
+			{Label: "Role", Value: a.Role},
+			{Label: "Email verified", Value: strconv.FormatBool(a.EmailVerified)},
+			{Label: "Two-factor enabled", Value: strconv.FormatBool(a.TOTPEnabled)},
+			{Label: "Deletion scheduled", Value: deletion},
+			{Label: "Preferences", Value: string(preferences)},
+		})
+	}
+
+	identities := export.SubjectSection{Title: "External sign-ins"}
+	for _, identity := range report.Identities {
+		identities.Records = append(identities.Records, []export.SubjectField{
+			{Label: "Provider", Value: identity.Provider},
+			{Label: "Subject", Value: identity.Subject},
+			{Label: "Email", Value: identity.Email},
+			{Label: "Linked", Value: identity.CreatedAt.Format(dataSubjectTimeLayout)},
+		})
+	}
+
+	subscriptions := export.SubjectSection{Title: "Report subscriptions"}
+	for _, sub := range report.ReportSubscriptions {
+		subscriptions.Records = append(subscriptions.Records, []export.SubjectField{
+			{Label: "Report", Value: fmt.Sprintf("%s (#%d)", sub.Name, sub.ID)},
+			{Label: "Relation", Value: sub.Relation},
+		})
+	}
+
+	events := export.SubjectSection{Title: "Audit events"}
+	for _, event := range report.AuditEvents {
+		events.Records = append(events.Records, []export.SubjectField{
+			{Label: "Time", Value: event.CreatedAt.Format(dataSubjectTimeLayout)},
+			{Label: "Action", Value: event.Action},
+			{Label: "Resource", Value: event.Resource},
+			{Label: "IP address", Value: event.IP},
+		})
+	}
+
+	chat := export.SubjectSection{Title: "Chat history"}
+	for _, conv := range report.ChatConversations {
+		for _, message := range conv.Messages {
+			chat.Records = append(chat.Records, []export.SubjectField{
+				{Label: "Conversation", Value: fmt.Sprintf("%s (#%d)", conv.Title, conv.ID)},
+				{Label: "Time", Value: message.CreatedAt.Format(dataSubjectTimeLayout)},
+				{Label: "Role", Value: message.Role},
+				{Label: "Message", Value: message.Content},
+			})
+		}
+	}
+
+	return []export.SubjectSection{
+		registrations("Registrations", report.Registrations),
+		registrations("Pending registrations", report.PendingRegistrations),
+		account,
+		identities,
+		subscriptions,
+		events,
+		chat,
+	}
+}
+
+// PurgeExpiredRegistrations enforces REGISTRATION_RETENTION_DAYS (0, the
+// default, keeps registrations forever). REGISTRATION_RETENTION_MODE selects
+// whether old registrations are deleted (the default) or anonymized.
+func PurgeExpiredRegistrations() {
+	days := config.GetEnvInt("REGISTRATION_RETENTION_DAYS", 0)
+	if days <= 0 {
+		return
+	}
+	mode := strings.ToLower(config.GetEnv("REGISTRATION_RETENTION_MODE", models.ErasureDelete))
+	if mode != models.ErasureDelete && mode != models.ErasureAnonymize {
+		log.Printf("❌ Invalid REGISTRATION_RETENTION_MODE %q, expected delete or anonymize", mode)
+		return
+	}
+
+	cutoff := time.Now().AddDate(0, 0, -days)
+	count, err := purgeRegistrationsBefore(cutoff, mode)
+	if err != nil {
+		log.Printf("❌ Error purging expired registrations: %v", err)
+		return
+	}
+	if count == 0 {
+		return
+	}
+
+	log.Printf("Retention purge (%s): %d registrations older than %d days", mode, count, days)
+	details := fmt.Sprintf("%s: %d registrations dated before %s", mode, count, cutoff.Format(export.DateLayout))
+	if err := utils.RecordAuditEvent("system", models.AuditRegistrationsPurge, "users", details, ""); err != nil {
+		log.Printf("❌ Error recording retention audit event: %v", err)
+	}
+}
@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"project/config"
+	"project/db"
+	"project/export"
+	"project/models"
+	"project/storage"
+	"project/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateExportJobHandler enqueues an export and returns its id for polling.
+// Personal data is masked for the requester's role unless ?unmask=true is allowed.
+func CreateExportJobHandler(c *gin.Context) {
+	var request struct {
+		Format string `json:"format"`
+		models.ExportParams
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	format := strings.ToLower(request.Format)
+	if _, ok := export.Formats[format]; !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be one of csv, jsonl, xlsx, pdf, parquet"})
+		return
+	}
+	if err := validateExportParams(request.ExportParams); errors.Is(err, errTemplateLookup) {
+		fmt.Printf("Error resolving export template: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading export template"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if request.BusinessID < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid business_id"})
+		return
+	}
+	if request.BusinessID != 0 && !checkBusinessExists(c, request.BusinessID) {
+		return
+	}
+
+	// Resolve the masking now; the worker has no request to check permissions against.
+	policy, ok := requestMaskingPolicy(c, "exports")
+	if !ok {
+		return
+	}
+	request.ExportParams.Masking = policy
+
+	job, err := createExportJob(format, request.ExportParams, c.GetString("username"))
+	if err != nil {
+		fmt.Printf("Error creating export job: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating export job"})
+		return
+	}
+	enqueueExportJob(job.ID)
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":    "Export queued",
+		"job":        job,
+		"status_url": "/exports/" + job.ID,
+	})
+}
+
+// GetExportJobHandler reports the status and progress of an export job and,
+// once it is done, a signed download URL that expires.
+func GetExportJobHandler(c *gin.Context) {
+	job, err := getExportJob(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading export job"})
+		return
+	}
+	if job == nil || !canAccessExportJob(c, job) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Export job not found"})
+		return
+	}
+
+	response := gin.H{"job": job, "progress": exportProgress(job)}
+	if job.Status == models.ExportDone {
+		downloadURL, expires, err := signedDownloadURL(job.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error signing download URL"})
+			return
+		}
+		response["download_url"] = downloadURL
+		response["download_url_expires_at"] = expires
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// DownloadExportHandler serves a finished export. It needs no session: the
+// signed, expiring URL from GetExportJobHandler is the credential.
+func DownloadExportHandler(c *gin.Context) {
+	id := c.Param("id")
+	expires, err := strconv.ParseInt(c.Query("expires"), 10, 64)
+	if err != nil || time.Now().Unix() > expires || !utils.VerifySignedValue(c.Query("signature"), "export", id, c.Query("expires")) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid or expired download link"})
+		return
+	}
+
+	job, err := getExportJob(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading export job"})
+		return
+	}
+	if job == nil || job.Status != models.ExportDone {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Export is not available"})
+		return
+	}
+
+	file, err := exportStore.Open(c.Request.Context(), job.StorageKey)
+	if err == storage.ErrNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Export is not available"})
+		return
+	} else if err != nil {
+		fmt.Printf("Error opening export %s: %v\n", job.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error reading export"})
+		return
+	}
+	defer file.Close()
+
+	c.Header("Content-Type", export.Formats[job.Format].ContentType)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", job.FileName))
+	c.Status(http.StatusOK)
+	if _, err := io.Copy(c.Writer, file); err != nil {
+		fmt.Printf("Error streaming export %s: %v\n", job.ID, err)
+	}
+}
+
+// validateExportParams checks the filters up front so bad jobs are rejected
+// at request time rather than failing in a worker.
+func validateExportParams(p models.ExportParams) error {
+	if p.StartDate == "" || p.EndDate == "" {
+		return fmt.Errorf("Both start_date and end_date are required")
+	}
+	if _, err := parseDate(p.StartDate); err != nil {
+		return fmt.Errorf("Invalid start_date format: %v", err)
+	}
+	if _, err := parseDate(p.EndDate); err != nil {
+		return fmt.Errorf("Invalid end_date format: %v", err)
+	}
+	_, _, err := exportLayout(p.Template, p.Columns, p.Sort)
+	return err
+}
+
+// canAccessExportJob lets requesters see their own jobs and admins see all.
+func canAccessExportJob(c *gin.Context, job *models.ExportJob) bool {
+	return job.RequestedBy == c.GetString("username") || utils.RoleHasPermission(c.GetString("role"), utils.PermAdmin)
+}
+
+// exportProgress returns the completion percentage of a job.
+func exportProgress(job *models.ExportJob) int {
+	switch {
+	case job.Status == models.ExportDone:
+		return 100
+	case job.TotalRows == 0:
+		return 0
+	}
+	return min(99, job.ProcessedRows*100/job.TotalRows)
+}
+
+// signedDownloadURL returns a download link valid for EXPORT_DOWNLOAD_URL_TTL.
+func signedDownloadURL(id string) (string, time.Time, error) {
+	expires := time.Now().Add(config.GetEnvDuration("EXPORT_DOWNLOAD_URL_TTL", 15*time.Minute))
+	expiresParam := strconv.FormatInt(expires.Unix(), 10)
+	signature, err := utils.SignValue("export", id, expiresParam)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	baseURL := strings.TrimRight(config.GetEnv("APP_BASE_URL", "http://localhost:8080"), "/")
+	query := url.Values{"expires": {expiresParam}, "signature": {signature}}
+	return fmt.Sprintf("%s/exports/%s/download?%s", baseURL, id, query.Encode()), expires, nil
+}
+
+func createExportJob(format string, params models.ExportParams, requestedBy string) (*models.ExportJob, error) {
+	id, err := utils.RandomHex(16)
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `INSERT INTO export_jobs (id, status, format, params, requested_by) VALUES (?, ?, ?, ?, ?)`
+	if _, err := db.DB.Exec(query, id, models.ExportQueued, format, string(encoded), requestedBy); err != nil {
+		return nil, err
+	}
+	return &models.ExportJob{
+		ID:          id,
+		Status:      models.ExportQueued,
+		Format:      format,
+		Params:      params,
+		RequestedBy: requestedBy,
+		CreatedAt:   time.Now(),
+	}, nil
+}
+
+// getExportJob loads a job, returning nil if it does not exist.
+func getExportJob(id string) (*models.ExportJob, error) {
+	query := `SELECT id, status, format, params, total_rows, processed_rows, file_name, storage_key,
+			error, requested_by, created_at, finished_at, expires_at
+		FROM export_jobs WHERE id = ?`
+
+	var job models.ExportJob
+	var params string
+	var jobErr sql.NullString
+	var finished, expires sql.NullTime
+	err := db.DB.QueryRow(query, id).Scan(&job.ID, &job.Status, &job.Format, &params, &job.TotalRows, &job.ProcessedRows,
+		&job.FileName, &job.StorageKey, &jobErr, &job.RequestedBy, &job.CreatedAt, &finished, &expires)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(params), &job.Params); err != nil {
+		return nil, fmt.Errorf("error decoding export params: %v", err)
+	}
+	job.Error = jobErr.String
+	if finished.Valid {
+		job.FinishedAt = &finished.Time
+	}
+	if expires.Valid {
+		job.ExpiresAt = &expires.Time
+	}
+	return &job, nil
+}
@@ -0,0 +1,449 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg" // register decoders for logo uploads
+	_ "image/png"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"project/db"
+	"project/export"
+	"project/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-sql-driver/mysql"
+)
+
+// defaultExportTitle is the report title when no template sets one.
+const defaultExportTitle = "Users Data"
+
+// maxLogoBytes bounds logo uploads; logos are stored in the database.
+const maxLogoBytes = 1 << 20
+
+var templateNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// errTemplateLookup marks database failures while resolving a template, as
+// opposed to invalid template names, columns or sort orders.
+var errTemplateLookup = errors.New("error loading export template")
+
+// exportLayout resolves a template name and the explicit columns and sort of
+// a request into render options and a sort order. Explicit values win over
+// the template's; labels and branding always come from the template.
+func exportLayout(templateName, columns, sort string) (export.Options, string, error) {
+	opts := export.Options{Title: defaultExportTitle}
+
+	var tmpl *models.ExportTemplate
+	if templateName != "" {
+		var err error
+		if tmpl, err = getExportTemplate(templateName, true); err != nil {
+			return opts, "", fmt.Errorf("%w: %v", errTemplateLookup, err)
+		}
+		if tmpl == nil {
+			return opts, "", fmt.Errorf("unknown export template %q", templateName)
+		}
+		if columns == "" {
+			columns = tmpl.Columns
+		}
+		if sort == "" {
+			sort = tmpl.Sort
+		}
+	}
+
+	selected, err := export.SelectColumns(columns)
+	if err != nil {
+		return opts, "", err
+	}
+	if _, err := (UserQuery{Sort: sort}).orderBy(); err != nil {
+		return opts, "", err
+	}
+	opts.Columns = selected
+
+	if tmpl != nil {
+		opts.Columns = export.WithLabels(selected, tmpl.Labels)
+		opts.Title = tmpl.Title
+		opts.Branding = export.Branding{
+			Orientation: tmpl.Orientation,
+			Logo:        tmpl.Logo,
+			LogoType:    tmpl.LogoType,
+			HeaderText:  tmpl.HeaderText,
+			FooterText:  tmpl.FooterText,
+			Font:        tmpl.Font,
+			FontSize:    tmpl.FontSize,
+		}
+	}
+	return opts, sort, nil
+}
+
+// exportLayoutFromQuery applies exportLayout to the template, columns and
+// sort query parameters, writing an error response and returning false on failure.
+func exportLayoutFromQuery(c *gin.Context) (export.Options, string, bool) {
+	opts, sort, err := exportLayout(c.Query("template"), c.Query("columns"), c.Query("sort"))
+	if errors.Is(err, errTemplateLookup) {
+		fmt.Printf("Error resolving export template: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading export template"})
+		return opts, "", false
+	} else if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return opts, "", false
+	}
+	return opts, sort, true
+}
+
+// templateRequest is the body of create and update requests for export templates.
+type templateRequest struct {
+	Name        string            `json:"name"`
+	Title       string            `json:"title"`
+	Columns     string            `json:"columns"`
+	Labels      map[string]string `json:"labels"`
+	Sort        string            `json:"sort"`
+	HeaderText  string            `json:"header_text"`
+	FooterText  string            `json:"footer_text"`
+	Orientation string            `json:"orientation"`
+	Font        string            `json:"font"`
+	FontSize    float64           `json:"font_size"`
+}
+
+// toTemplate validates the request and converts it to a template.
+func (r templateRequest) toTemplate() (models.ExportTemplate, error) {
+	tmpl := models.ExportTemplate{
+		Name:        strings.ToLower(strings.TrimSpace(r.Name)),
+		Title:       strings.TrimSpace(r.Title),
+		Columns:     r.Columns,
+		Labels:      r.Labels,
+		Sort:        r.Sort,
+		HeaderText:  r.HeaderText,
+		FooterText:  r.FooterText,
+		Orientation: strings.ToUpper(r.Orientation),
+		Font:        strings.ToLower(r.Font),
+		FontSize:    r.FontSize,
+	}
+	if tmpl.Title == "" {
+		tmpl.Title = defaultExportTitle
+	}
+	if tmpl.Orientation == "" {
+		tmpl.Orientation = "L"
+	}
+	if tmpl.Labels == nil {
+		tmpl.Labels = map[string]string{}
+	}
+
+	if !templateNamePattern.MatchString(tmpl.Name) {
+		return tmpl, fmt.Errorf("name must be 1-64 lowercase letters, digits, '-' or '_'")
+	}
+	if len(tmpl.Title) > 255 || len(tmpl.HeaderText) > 255 || len(tmpl.FooterText) > 255 {
+		return tmpl, fmt.Errorf("title, header_text and footer_text must be at most 255 characters")
+	}
+	if _, err := export.SelectColumns(tmpl.Columns); err != nil {
+		return tmpl, err
+	}
+	for key, label := range tmpl.Labels {
+		if _, err := export.SelectColumns(key); err != nil {
+			return tmpl, fmt.Errorf("label for %v", err)
+		}
+		if len(label) > 64 {
+			return tmpl, fmt.Errorf("label for %q must be at most 64 characters", key)
+		}
+	}
+	if _, err := (UserQuery{Sort: tmpl.Sort}).orderBy(); err != nil {
+		return tmpl, err
+	}
+	if tmpl.Orientation != "L" && tmpl.Orientation != "P" {
+		return tmpl, fmt.Errorf("orientation must be L (landscape) or P (portrait)")
+	}
+	if !export.IsCoreFont(tmpl.Font) {
+		return tmpl, fmt.Errorf("font must be helvetica, times or courier")
+	}
+	if tmpl.FontSize != 0 && (tmpl.FontSize < 6 || tmpl.FontSize > 16) {
+		return tmpl, fmt.Errorf("font_size must be between 6 and 16")
+	}
+	return tmpl, nil
+}
+
+// CreateExportTemplateHandler adds an export template.
+func CreateExportTemplateHandler(c *gin.Context) {
+	var request templateRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+	tmpl, err := request.toTemplate()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	tmpl.UpdatedBy = c.GetString("username")
+
+	if err := createExportTemplate(&tmpl); isDuplicateKey(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "An export template with this name already exists"})
+		return
+	} else if err != nil {
+		fmt.Printf("Error creating export template: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating export template"})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"template": tmpl})
+}
+
+// ListExportTemplatesHandler lists the export templates, without logos.
+func ListExportTemplatesHandler(c *gin.Context) {
+	templates, err := listExportTemplates()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing export templates"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"templates": templates})
+}
+
+// GetExportTemplateHandler returns one export template.
+func GetExportTemplateHandler(c *gin.Context) {
+	tmpl, ok := loadExportTemplate(c, false)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"template": tmpl})
+}
+
+// UpdateExportTemplateHandler replaces the settings of a template, keeping its logo.
+// The name in the body may rename the template.
+func UpdateExportTemplateHandler(c *gin.Context) {
+	existing, ok := loadExportTemplate(c, false)
+	if !ok {
+		return
+	}
+
+	var request templateRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+	if request.Name == "" {
+		request.Name = existing.Name
+	}
+	tmpl, err := request.toTemplate()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	tmpl.ID = existing.ID
+	tmpl.HasLogo = existing.HasLogo
+	tmpl.CreatedAt = existing.CreatedAt
+	tmpl.UpdatedBy = c.GetString("username")
+
+	if err := updateExportTemplate(tmpl); isDuplicateKey(err) {
+		c.JSON(http.StatusConflict, gin.H{"error": "An export template with this name already exists"})
+		return
+	} else if err != nil {
+		fmt.Printf("Error updating export template %s: %v\n", existing.Name, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating export template"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"template": tmpl})
+}
+
+// DeleteExportTemplateHandler deletes a template. Exports referencing it fail with 400.
+func DeleteExportTemplateHandler(c *gin.Context) {
+	tmpl, ok := loadExportTemplate(c, false)
+	if !ok {
+		return
+	}
+	if _, err := db.DB.Exec("DELETE FROM export_templates WHERE id = ?", tmpl.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting export template"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Export template deleted"})
+}
+
+// UploadExportTemplateLogoHandler stores a PNG or JPEG logo from the "logo" form field.
+func UploadExportTemplateLogoHandler(c *gin.Context) {
+	tmpl, ok := loadExportTemplate(c, false)
+	if !ok {
+		return
+	}
+
+	upload, err := c.FormFile("logo")
+	if err != nil || upload.Size > maxLogoBytes {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("A PNG or JPEG logo of at most %d bytes is required", maxLogoBytes)})
+		return
+	}
+	file, err := upload.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error reading upload"})
+		return
+	}
+	defer file.Close()
+	logo, err := io.ReadAll(io.LimitReader(file, maxLogoBytes))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error reading upload"})
+		return
+	}
+
+	config, format, err := image.DecodeConfig(bytes.NewReader(logo))
+	if err != nil || (format != "png" && format != "jpeg") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Logo must be a PNG or JPEG image"})
+		return
+	}
+	if config.Width > 4000 || config.Height > 4000 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Logo must be at most 4000x4000 pixels"})
+		return
+	}
+	logoType := "PNG"
+	if format == "jpeg" {
+		logoType = "JPG"
+	}
+
+	query := "UPDATE export_templates SET logo = ?, logo_type = ?, updated_by = ? WHERE id = ?"
+	if _, err := db.DB.Exec(query, logo, logoType, c.GetString("username"), tmpl.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving logo"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Logo saved"})
+}
+
+// GetExportTemplateLogoHandler serves the logo of a template.
+func GetExportTemplateLogoHandler(c *gin.Context) {
+	tmpl, ok := loadExportTemplate(c, true)
+	if !ok {
+		return
+	}
+	if !tmpl.HasLogo {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Export template has no logo"})
+		return
+	}
+	contentType := "image/png"
+	if tmpl.LogoType == "JPG" {
+		contentType = "image/jpeg"
+	}
+	c.Data(http.StatusOK, contentType, tmpl.Logo)
+}
+
+// DeleteExportTemplateLogoHandler removes the logo of a template.
+func DeleteExportTemplateLogoHandler(c *gin.Context) {
+	tmpl, ok := loadExportTemplate(c, false)
+	if !ok {
+		return
+	}
+	query := "UPDATE export_templates SET logo = NULL, logo_type = '', updated_by = ? WHERE id = ?"
+	if _, err := db.DB.Exec(query, c.GetString("username"), tmpl.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error removing logo"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Logo removed"})
+}
+
+// loadExportTemplate resolves the :name parameter, writing an error response
+// and returning false if the template does not exist.
+func loadExportTemplate(c *gin.Context, withLogo bool) (*models.ExportTemplate, bool) {
+	tmpl, err := getExportTemplate(c.Param("name"), withLogo)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading export template"})
+		return nil, false
+	}
+	if tmpl == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Export template not found"})
+		return nil, false
+	}
+	return tmpl, true
+}
+
+// isDuplicateKey reports whether err is a MySQL unique key violation.
+func isDuplicateKey(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == 1062
+}
+
+func createExportTemplate(tmpl *models.ExportTemplate) error {
+	labels, err := json.Marshal(tmpl.Labels)
+	if err != nil {
+		return err
+	}
+	query := `INSERT INTO export_templates (name, title, columns, labels, sort, header_text, footer_text,
+		orientation, font, font_size, updated_by) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	res, err := db.DB.Exec(query, tmpl.Name, tmpl.Title, tmpl.Columns, string(labels), tmpl.Sort, tmpl.HeaderText,
+		tmpl.FooterText, tmpl.Orientation, tmpl.Font, tmpl.FontSize, tmpl.UpdatedBy)
+	if err != nil {
+		return err
+	}
+	tmpl.ID, _ = res.LastInsertId()
+	return nil
+}
+
+func updateExportTemplate(tmpl models.ExportTemplate) error {
+	labels, err := json.Marshal(tmpl.Labels)
+	if err != nil {
+		return err
+	}
+	query := `UPDATE export_templates SET name = ?, title = ?, columns = ?, labels = ?, sort = ?, header_text = ?,
+		footer_text = ?, orientation = ?, font = ?, font_size = ?, updated_by = ? WHERE id = ?`
+	_, err = db.DB.Exec(query, tmpl.Name, tmpl.Title, tmpl.Columns, string(labels), tmpl.Sort, tmpl.HeaderText,
+		tmpl.FooterText, tmpl.Orientation, tmpl.Font, tmpl.FontSize, tmpl.UpdatedBy, tmpl.ID)
+	return err
+}
+
+// exportTemplateColumns selects everything but the logo, which is only
+// loaded when a report is rendered.
+const exportTemplateColumns = `id, name, title, columns, labels, sort, header_text, footer_text, orientation, font,
+	font_size, logo IS NOT NULL, logo_type, updated_by, created_at, updated_at`
+
+func scanExportTemplate(scanner interface{ Scan(...interface{}) error }, extra ...interface{}) (*models.ExportTemplate, error) {
+	var tmpl models.ExportTemplate
+	var labels string
+	dest := []interface{}{&tmpl.ID, &tmpl.Name, &tmpl.Title, &tmpl.Columns, &labels, &tmpl.Sort, &tmpl.HeaderText,
+		&tmpl.FooterText, &tmpl.Orientation, &tmpl.Font, &tmpl.FontSize, &tmpl.HasLogo, &tmpl.LogoType,
+		&tmpl.UpdatedBy, &tmpl.CreatedAt, &tmpl.UpdatedAt}
+	if err := scanner.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(labels), &tmpl.Labels); err != nil {
+		return nil, fmt.Errorf("error decoding template labels: %v", err)
+	}
+	return &tmpl, nil
+}
+
+// getExportTemplate loads a template by name, returning nil if it does not exist.
+func getExportTemplate(name string, withLogo bool) (*models.ExportTemplate, error) {
+	query := "SELECT " + exportTemplateColumns
+	if withLogo {
+		query += ", logo"
+	}
+	query += " FROM export_templates WHERE name = ?"
+
+	var logo []byte
+	var extra []interface{}
+	if withLogo {
+		extra = append(extra, &logo)
+	}
+	tmpl, err := scanExportTemplate(db.DB.QueryRow(query, name), extra...)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	tmpl.Logo = logo
+	return tmpl, nil
+}
+
+func listExportTemplates() ([]models.ExportTemplate, error) {
+	rows, err := db.DB.Query("SELECT " + exportTemplateColumns + " FROM export_templates ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	templates := []models.ExportTemplate{}
+	for rows.Next() {
+		tmpl, err := scanExportTemplate(rows)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, *tmpl)
+	}
+	return templates, rows.Err()
+}
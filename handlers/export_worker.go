@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"project/config"
+	"project/db"
+	"project/export"
+	"project/masking"
+	"project/models"
+	"project/storage"
+)
+
+// progressEvery is how many rows a worker exports between progress updates.
+const progressEvery = 500
+
+var (
+	exportQueue chan string
+	exportStore storage.Store
+)
+
+// StartExportWorkers starts EXPORT_WORKERS goroutines that generate queued
+// exports into the configured storage. Jobs left queued or interrupted by a
+// restart are picked up again.
+func StartExportWorkers() {
+	exportStore = storage.FromEnv()
+	exportQueue = make(chan string, 100)
+
+	for i := 0; i < config.GetEnvInt("EXPORT_WORKERS", 2); i++ {
+		go exportWorker()
+	}
+
+	if _, err := db.DB.Exec("UPDATE export_jobs SET status = ? WHERE status = ?", models.ExportQueued, models.ExportRunning); err != nil {
+		log.Printf("❌ Error resetting interrupted export jobs: %v", err)
+	}
+	rows, err := db.DB.Query("SELECT id FROM export_jobs WHERE status = ? ORDER BY created_at", models.ExportQueued)
+	if err != nil {
+		log.Printf("❌ Error loading queued export jobs: %v", err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err == nil {
+			enqueueExportJob(id)
+		}
+	}
+}
+
+// enqueueExportJob hands a job to the worker pool without blocking the request.
+func enqueueExportJob(id string) {
+	go func() { exportQueue <- id }()
+}
+
+func exportWorker() {
+	for id := range exportQueue {
+		// Claim the job so a duplicate queue entry cannot run it twice.
+		res, err := db.DB.Exec("UPDATE export_jobs SET status = ?, started_at = ? WHERE id = ? AND status = ?",
+			models.ExportRunning, time.Now(), id, models.ExportQueued)
+		if err != nil {
+			log.Printf("❌ Error claiming export job %s: %v", id, err)
+			continue
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			continue
+		}
+
+		if err := runExportJob(id); err != nil {
+			log.Printf("❌ Export job %s failed: %v", id, err)
+			query := "UPDATE export_jobs SET status = ?, error = ?, finished_at = ? WHERE id = ?"
+			if _, dbErr := db.DB.Exec(query, models.ExportFailed, err.Error(), time.Now(), id); dbErr != nil {
+				log.Printf("❌ Error marking export job %s failed: %v", id, dbErr)
+			}
+		}
+	}
+}
+
+// runExportJob renders the export to a temporary file and uploads it.
+func runExportJob(id string) error {
+	job, err := getExportJob(id)
+	if err != nil || job == nil {
+		return fmt.Errorf("error loading job: %v", err)
+	}
+
+	start, _ := parseDate(job.Params.StartDate)
+	end, _ := parseDate(job.Params.EndDate)
+	opts, sort, err := exportLayout(job.Params.Template, job.Params.Columns, job.Params.Sort)
+	if err != nil {
+		return err
+	}
+	q := UserQuery{Start: start, End: end, Sort: sort, BusinessID: job.Params.BusinessID}
+
+	total, err := CountUsers(q)
+	if err != nil {
+		return err
+	}
+	if _, err := db.DB.Exec("UPDATE export_jobs SET total_rows = ? WHERE id = ?", total, id); err != nil {
+		return err
+	}
+
+	rows, err := QueryUsers(q)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	tmp, err := os.CreateTemp("", "export-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	opts.Subtitle = []string{
+		fmt.Sprintf("Registrations from %s to %s", job.Params.StartDate, job.Params.EndDate),
+		"Requested by " + job.RequestedBy,
+	}
+	source := &progressSource{RowSource: masking.Source(rows, job.Params.Masking), jobID: id}
+	if err := export.Render(tmp, job.Format, source, opts); err != nil {
+		return err
+	}
+
+	size, err := tmp.Seek(0, 1)
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Seek(0, 0); err != nil {
+		return err
+	}
+
+	format := export.Formats[job.Format]
+	key := "exports/" + id + "." + format.Extension
+	if err := exportStore.Put(context.Background(), key, tmp, size, format.ContentType); err != nil {
+		return err
+	}
+
+	expires := time.Now().Add(config.GetEnvDuration("EXPORT_RETENTION", 24*time.Hour))
+	query := `UPDATE export_jobs SET status = ?, processed_rows = ?, file_name = ?, storage_key = ?,
+		finished_at = ?, expires_at = ? WHERE id = ?`
+	_, err = db.DB.Exec(query, models.ExportDone, source.count, exportFileName(start, end, format.Extension), key, time.Now(), expires, id)
+	return err
+}
+
+// progressSource counts rows as they are exported and periodically records progress.
+type progressSource struct {
+	export.RowSource
+	jobID string
+	count int
+}
+
+func (p *progressSource) Next() bool {
+	if !p.RowSource.Next() {
+		return false
+	}
+	p.count++
+	if p.count%progressEvery == 0 {
+		if _, err := db.DB.Exec("UPDATE export_jobs SET processed_rows = ? WHERE id = ?", p.count, p.jobID); err != nil {
+			log.Printf("❌ Error updating progress of export job %s: %v", p.jobID, err)
+		}
+	}
+	return true
+}
+
+// CleanupExpiredExports deletes export files past their retention and marks
+// the jobs expired, then deletes expired import error reports.
+func CleanupExpiredExports() {
+	defer cleanupExpiredImportReports()
+
+	rows, err := db.DB.Query("SELECT id, storage_key FROM export_jobs WHERE status = ? AND expires_at < ?", models.ExportDone, time.Now())
+	if err != nil {
+		log.Printf("❌ Error finding expired exports: %v", err)
+		return
+	}
+	type expired struct{ id, key string }
+	var jobs []expired
+	for rows.Next() {
+		var job expired
+		if err := rows.Scan(&job.id, &job.key); err == nil {
+			jobs = append(jobs, job)
+		}
+	}
+	rows.Close()
+
+	for _, job := range jobs {
+		if err := exportStore.Delete(context.Background(), job.key); err != nil {
+			log.Printf("❌ Error deleting export %s: %v", job.id, err)
+			continue
+		}
+		if _, err := db.DB.Exec("UPDATE export_jobs SET status = ? WHERE id = ?", models.ExportExpired, job.id); err != nil {
+			log.Printf("❌ Error expiring export job %s: %v", job.id, err)
+		}
+	}
+}
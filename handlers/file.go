@@ -1,11 +1,15 @@
 package handlers
 
 import (
+	"database/sql"
 	"fmt"
 	"log"
 	"net/http"
+	"project/config"
 	"project/db"
 	"project/models"
+	"project/notifications"
+	"project/webhooks"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -21,6 +25,9 @@ func CreateUser(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
 		return
 	}
+	if user.BusinessID != nil && !checkBusinessExists(c, *user.BusinessID) {
+		return
+	}
 
 	// Insert into temp table
 	err := WriteTempData(user)
@@ -38,10 +45,10 @@ func WriteTempData(user models.User) error {
 	currentDate := time.Now().Format("02/01/06")
 
 	query := `
-		INSERT INTO temp (name, email, registration_no, phone_no, date)
-		VALUES (?, ?, ?, ?, ?)
+		INSERT INTO temp (name, email, registration_no, phone_no, date, business_id)
+		VALUES (?, ?, ?, ?, ?, ?)
 	`
-	_, err := db.DB.Exec(query, user.Name, user.Email, user.RegistrationNo, user.PhoneNo, currentDate)
+	_, err := db.DB.Exec(query, user.Name, user.Email, user.RegistrationNo, user.PhoneNo, currentDate, user.BusinessID)
 	if err != nil {
 		return fmt.Errorf("❌ Error inserting data into temp: %v", err)
 	}
@@ -49,7 +56,10 @@ func WriteTempData(user models.User) error {
 	return nil
 }
 
-// TransferTempData moves data from temp to users table
+// TransferTempData moves data from temp to users table and queues a
+// "registration confirmed" notification and a registration.created webhook
+// for every moved registration in the same transaction, so none is lost or
+// sent for a rolled-back transfer.
 func TransferTempData() {
 
 	// Begin a transaction
@@ -58,24 +68,78 @@ func TransferTempData() {
 		log.Printf("❌ Error starting transaction: %v", err)
 		return
 	}
+	defer tx.Rollback()
 
-	// Insert into users from temp
-	insertQuery := `
-		INSERT INTO users (name, email, registration_no, phone_no, date)
-		SELECT name, email, registration_no, phone_no, date FROM temp
-	`
-	_, err = tx.Exec(insertQuery)
+	// Lock the rows to move; rows written meanwhile wait for the next run
+	rows, err := tx.Query("SELECT id, name, email, registration_no, phone_no, date, business_id FROM temp ORDER BY id FOR UPDATE")
+	if err != nil {
+		log.Printf("❌ Error reading temp data: %v", err)
+		return
+	}
+	var pending []models.User
+	var dates []string
+	for rows.Next() {
+		var u models.User
+		var date string
+		var businessID sql.NullInt64
+		if err := rows.Scan(&u.ID, &u.Name, &u.Email, &u.RegistrationNo, &u.PhoneNo, &date, &businessID); err != nil {
+			rows.Close()
+			log.Printf("❌ Error scanning temp data: %v", err)
+			return
+		}
+		if businessID.Valid {
+			u.BusinessID = &businessID.Int64
+		}
+		u.Date, _ = parseDate(date)
+		pending = append(pending, u)
+		dates = append(dates, date)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		log.Printf("❌ Error reading temp data: %v", err)
+		return
+	}
+	if len(pending) == 0 {
+		return
+	}
+	lastTempID := pending[len(pending)-1].ID
+
+	// Insert into users, one row at a time to learn the new ids
+	insert, err := tx.Prepare("INSERT INTO users (name, email, registration_no, phone_no, date, business_id) VALUES (?, ?, ?, ?, ?, ?)")
 	if err != nil {
-		tx.Rollback()
 		log.Printf("❌ Error transferring data to users: %v", err)
 		return
 	}
+	defer insert.Close()
+	events := make([]notifications.Event, 0, len(pending))
+	created := make([]webhooks.Event, 0, len(pending))
+	for i, u := range pending {
+		res, err := insert.Exec(u.Name, u.Email, u.RegistrationNo, u.PhoneNo, dates[i], u.BusinessID)
+		if err != nil {
+			log.Printf("❌ Error transferring data to users: %v", err)
+			return
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			log.Printf("❌ Error transferring data to users: %v", err)
+			return
+		}
+		u.ID = int(id)
+		events = append(events, notifications.RegistrationConfirmedEvent(u))
+		created = append(created, webhooks.RegistrationCreated(u))
+	}
+
+	if err := notifications.Enqueue(tx, events...); err != nil {
+		log.Printf("❌ Error queueing registration notifications: %v", err)
+		return
+	}
+	if err := webhooks.Enqueue(tx, created...); err != nil {
+		log.Printf("❌ Error queueing registration webhooks: %v", err)
+		return
+	}
 
 	// Delete transferred records from temp
-	deleteQuery := `DELETE FROM temp`
-	_, err = tx.Exec(deleteQuery)
-	if err != nil {
-		tx.Rollback()
+	if _, err := tx.Exec("DELETE FROM temp WHERE id <= ?", lastTempID); err != nil {
 		log.Printf("❌ Error deleting temp data: %v", err)
 		return
 	}
@@ -89,14 +153,42 @@ func TransferTempData() {
 
 }
 
+// scheduler runs the periodic tasks. It is shared so report subscriptions
+// can be added and removed while it runs.
+var scheduler = gocron.NewScheduler(time.Local)
+
 // StartScheduler initializes and starts the scheduler for periodic tasks
 func StartScheduler() {
-	// Create a new scheduler instance
-	scheduler := gocron.NewScheduler(time.Local)
 
 	// Schedule the TransferTempData function to run every 10 seconds
 	scheduler.Every(10).Seconds().Do(TransferTempData)
 
+	// Remove accounts whose deletion grace period has passed
+	scheduler.Every(1).Hour().Do(PurgeDeletedAccounts)
+
+	// Delete or anonymize registrations past REGISTRATION_RETENTION_DAYS
+	scheduler.Every(1).Day().At("03:00").Do(PurgeExpiredRegistrations)
+
+	// Delete export files past their retention
+	scheduler.Every(10).Minutes().Do(CleanupExpiredExports)
+
+	// Import registrations mailed to the GMAIL_INGEST_ACCOUNTS inboxes
+	if len(config.GetEnvList("GMAIL_INGEST_ACCOUNTS")) > 0 {
+		interval := config.GetEnvDuration("GMAIL_INGEST_INTERVAL", 5*time.Minute)
+		scheduler.Every(interval).SingletonMode().Do(IngestGmail)
+	}
+
+	// Deliver queued notifications and drop old ones
+	scheduler.Every(30).Seconds().SingletonMode().Do(notifications.DeliverPending)
+	scheduler.Every(1).Day().At("03:30").Do(notifications.PurgeDelivered)
+
+	// Deliver webhooks to partner systems and drop old delivery logs
+	scheduler.Every(15).Seconds().SingletonMode().Do(webhooks.DeliverPending)
+	scheduler.Every(1).Day().At("03:45").Do(webhooks.PurgeDelivered)
+
+	// Recurring email reports
+	ScheduleReportSubscriptions()
+
 	// Start the scheduler in a separate goroutine
 	go scheduler.StartAsync()
 }
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"project/config"
+	"project/models"
+	"project/utils"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/oauth2"
+)
+
+// ConnectGmailHandler starts connecting a mailbox: POST /admin/gmail/connect
+// with an optional {"login_hint": "inbox@gmail.com"} returns the consent URL
+// to open in a browser. Google then redirects to GmailCallbackHandler.
+func ConnectGmailHandler(c *gin.Context) {
+	var request struct {
+		LoginHint string `json:"login_hint"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+			return
+		}
+	}
+
+	cfg, ok := gmailOAuthConfig(c)
+	if !ok {
+		return
+	}
+	state, err := utils.NewUserOAuthState(utils.GmailProvider, oauth2.GenerateVerifier(), c.GetString("username"))
+	if err != nil {
+		fmt.Printf("Error storing OAuth state: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error starting Gmail connection"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"auth_url":   utils.GmailAuthCodeURL(cfg, state, strings.TrimSpace(request.LoginHint)),
+		"expires_in": int(utils.OAuthStateTTL.Seconds()),
+	})
+}
+
+// GmailCallbackHandler completes the consent flow at GET /gmail/callback. It
+// is reached by browser redirect without a session, so the single-use state
+// identifies the admin who started it.
+func GmailCallbackHandler(c *gin.Context) {
+	if errCode := c.Query("error"); errCode != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Gmail access was not granted: " + errCode})
+		return
+	}
+	code := c.Query("code")
+	if code == "" || c.Query("state") == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Both code and state are required"})
+		return
+	}
+
+	state, err := utils.ConsumeOAuthState(utils.GmailProvider, c.Query("state"))
+	if err == utils.ErrInvalidOAuthState {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired connection attempt"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error validating connection attempt"})
+		return
+	}
+
+	cfg, ok := gmailOAuthConfig(c)
+	if !ok {
+		return
+	}
+	account, err := utils.CompleteGmailConnect(c.Request.Context(), cfg, code, state.CodeVerifier, state.Username)
+	if err != nil {
+		fmt.Printf("Error connecting Gmail account: %v\n", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Could not connect the Gmail account"})
+		return
+	}
+	if err := utils.RecordAuditEvent(state.Username, models.AuditGmailConnect, "gmail:"+account, "", c.ClientIP()); err != nil {
+		fmt.Printf("Error recording Gmail audit event: %v\n", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Gmail account connected", "account": account})
+}
+
+// ListGmailAccountsHandler returns the connected mailboxes and their token status.
+func ListGmailAccountsHandler(c *gin.Context) {
+	accounts, err := utils.ListGmailAccounts()
+	if err != nil {
+		fmt.Printf("Error listing Gmail accounts: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing Gmail accounts"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"accounts": accounts})
+}
+
+// DisconnectGmailAccountHandler revokes and deletes a mailbox token.
+func DisconnectGmailAccountHandler(c *gin.Context) {
+	account := strings.ToLower(c.Param("account"))
+	err := utils.DisconnectGmailAccount(c.Request.Context(), account)
+	if err == utils.ErrGmailAccountNotConnected {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		fmt.Printf("Error disconnecting Gmail account: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error disconnecting Gmail account"})
+		return
+	}
+	if err := utils.RecordAuditEvent(c.GetString("username"), models.AuditGmailDisconnect, "gmail:"+account, "", c.ClientIP()); err != nil {
+		fmt.Printf("Error recording Gmail audit event: %v\n", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Gmail account disconnected", "account": account})
+}
+
+// gmailOAuthConfig loads the OAuth client, writing an error response and
+// returning false if it is missing or invalid.
+func gmailOAuthConfig(c *gin.Context) (*oauth2.Config, bool) {
+	cfg, err := utils.GetOAuthConfig()
+	if err == utils.ErrGmailNotConfigured {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return nil, false
+	} else if err != nil {
+		fmt.Printf("Error loading Gmail OAuth client: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server misconfiguration"})
+		return nil, false
+	}
+	return cfg, true
+}
+
+// ImportLegacyGmailToken moves a token.json left by the old command-line
+// consent flow (GMAIL_LEGACY_TOKEN_FILE, default token.json) into encrypted
+// storage, then deletes the file so the refresh token is no longer kept in
+// plain text. It only logs failures so the server starts without Gmail access.
+func ImportLegacyGmailToken() {
+	path := config.GetEnv("GMAIL_LEGACY_TOKEN_FILE", "token.json")
+	if _, err := os.Stat(path); err != nil {
+		return
+	}
+	account, err := utils.ImportLegacyGmailToken(context.Background(), path)
+	if err != nil {
+		log.Printf("❌ Error importing Gmail token from %s: %v", path, err)
+		return
+	}
+	if err := os.Remove(path); err != nil {
+		log.Printf("❌ Imported the Gmail token of %s but could not delete %s: %v; delete the file", account, path, err)
+		return
+	}
+	log.Printf("Imported the Gmail token of %s from %s and deleted the file", account, path)
+}
@@ -0,0 +1,624 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"project/config"
+	"project/db"
+	"project/models"
+	"project/utils"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/api/gmail/v1"
+	"google.golang.org/api/googleapi"
+)
+
+// gmailIngestMu keeps scheduled and manual runs from processing the same messages.
+var gmailIngestMu sync.Mutex
+
+// GmailIngestResult summarizes one run over a mailbox.
+type GmailIngestResult struct {
+	Account      string `json:"account"`
+	FullSync     bool   `json:"full_sync"`
+	Messages     int    `json:"messages"`
+	ImportedRows int    `json:"imported_rows"`
+	ErrorRows    int    `json:"error_rows"`
+	Error        string `json:"error,omitempty"`
+}
+
+// IngestGmail is the scheduled job: it reads new messages of GMAIL_INGEST_LABEL
+// (default "registrations") in every mailbox of GMAIL_INGEST_ACCOUNTS and
+// writes the registrations they contain to temp.
+func IngestGmail() {
+	for _, result := range RunGmailIngestion(context.Background()) {
+		if result.Error != "" {
+			log.Printf("❌ Error ingesting Gmail account %s: %s", result.Account, result.Error)
+		} else if result.Messages > 0 {
+			log.Printf("Ingested %d Gmail messages of %s: %d registrations, %d invalid rows",
+				result.Messages, result.Account, result.ImportedRows, result.ErrorRows)
+		}
+	}
+}
+
+// RunGmailIngestion syncs every configured mailbox once.
+func RunGmailIngestion(ctx context.Context) []GmailIngestResult {
+	gmailIngestMu.Lock()
+	defer gmailIngestMu.Unlock()
+
+	label := config.GetEnv("GMAIL_INGEST_LABEL", "registrations")
+	results := []GmailIngestResult{}
+	for _, account := range config.GetEnvList("GMAIL_INGEST_ACCOUNTS") {
+		account = strings.ToLower(account)
+		result := GmailIngestResult{Account: account}
+		if err := ingestGmailAccount(ctx, account, label, &result); err != nil {
+			result.Error = err.Error()
+			if dbErr := saveGmailSyncError(account, err); dbErr != nil {
+				log.Printf("❌ Error recording Gmail sync error of %s: %v", account, dbErr)
+			}
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// GetGmailIngestHandler serves GET /admin/gmail/ingest: the sync state of
+// each mailbox and its latest processed messages (limit, default 50).
+func GetGmailIngestHandler(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 || limit > 500 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 500"})
+		return
+	}
+
+	states, err := listGmailSyncStates()
+	if err != nil {
+		fmt.Printf("Error loading Gmail sync state: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading Gmail ingestion status"})
+		return
+	}
+	accounts := []gin.H{}
+	for _, state := range states {
+		messages, err := listGmailMessages(state.Account, limit)
+		if err != nil {
+			fmt.Printf("Error listing Gmail messages: %v\n", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading Gmail ingestion status"})
+			return
+		}
+		accounts = append(accounts, gin.H{"state": state, "messages": messages})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":  len(config.GetEnvList("GMAIL_INGEST_ACCOUNTS")) > 0,
+		"label":    config.GetEnv("GMAIL_INGEST_LABEL", "registrations"),
+		"accounts": accounts,
+	})
+}
+
+// RunGmailIngestHandler serves POST /admin/gmail/ingest/run, syncing every
+// configured mailbox now instead of waiting for the schedule.
+func RunGmailIngestHandler(c *gin.Context) {
+	if len(config.GetEnvList("GMAIL_INGEST_ACCOUNTS")) == 0 {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Gmail ingestion is not configured"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"results": RunGmailIngestion(c.Request.Context())})
+}
+
+// GetGmailTemplatesHandler serves GET /admin/gmail/ingest/templates.
+func GetGmailTemplatesHandler(c *gin.Context) {
+	templates, err := loadGmailTemplates()
+	if err != nil {
+		fmt.Printf("Error loading Gmail templates: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading Gmail templates"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"templates": templates})
+}
+
+// UpdateGmailTemplatesHandler replaces the body templates at PUT
+// /admin/gmail/ingest/templates. Every template must extract all four
+// registration fields with one capture group each.
+func UpdateGmailTemplatesHandler(c *gin.Context) {
+	var request struct {
+		Templates []models.GmailTemplate `json:"templates"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil || len(request.Templates) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "templates is required"})
+		return
+	}
+	if _, err := compileGmailTemplates(request.Templates); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	value, err := json.Marshal(request.Templates)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving Gmail templates"})
+		return
+	}
+	if err := utils.SetSetting(settingGmailTemplates, string(value), c.GetString("username")); err != nil {
+		fmt.Printf("Error saving Gmail templates: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving Gmail templates"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"templates": request.Templates})
+}
+
+// ingestGmailAccount processes the label's messages added since the stored
+// history id, or every message of the label on the first run and whenever
+// Gmail no longer has that history.
+func ingestGmailAccount(ctx context.Context, account, label string, result *GmailIngestResult) error {
+	srv, err := utils.GmailService(ctx, account)
+	if err != nil {
+		return err
+	}
+	templates, err := loadGmailTemplates()
+	if err != nil {
+		return err
+	}
+	compiled, err := compileGmailTemplates(templates)
+	if err != nil {
+		return err
+	}
+
+	state, err := loadGmailSyncState(account)
+	if err != nil {
+		return err
+	}
+	if state == nil || state.Label != label {
+		state = &models.GmailSyncState{Account: account, Label: label}
+	}
+	if state.LabelID == "" {
+		if state.LabelID, err = gmailLabelID(ctx, srv, label); err != nil {
+			return err
+		}
+	}
+
+	var ids []string
+	var historyID uint64
+	if state.HistoryID > 0 {
+		ids, historyID, err = gmailHistoryMessageIDs(ctx, srv, state.LabelID, state.HistoryID)
+		if isGmailNotFound(err) {
+			state.HistoryID = 0 // history expired, fall back to a full listing
+		} else if err != nil {
+			return err
+		}
+	}
+	if state.HistoryID == 0 {
+		result.FullSync = true
+		// Taken before listing, so messages arriving meanwhile are seen by the next incremental run.
+		profile, err := srv.Users.GetProfile("me").Context(ctx).Do()
+		if err != nil {
+			return fmt.Errorf("error reading Gmail profile: %v", err)
+		}
+		historyID = profile.HistoryId
+		if ids, err = gmailLabelMessageIDs(ctx, srv, state.LabelID); err != nil {
+			return err
+		}
+	}
+
+	for _, id := range ids {
+		done, err := gmailMessageProcessed(account, id)
+		if err != nil {
+			return err
+		}
+		if done {
+			continue
+		}
+		record, err := ingestGmailMessage(ctx, srv, compiled, account, id)
+		if err != nil {
+			// Stop without advancing the history id, so the message is retried.
+			return fmt.Errorf("error ingesting message %s: %v", id, err)
+		}
+		result.Messages++
+		result.ImportedRows += record.ImportedRows
+		result.ErrorRows += record.ErrorRows
+	}
+
+	state.HistoryID = historyID
+	return saveGmailSyncState(state)
+}
+
+// gmailLabelID resolves a label name, case-insensitively, to its id.
+func gmailLabelID(ctx context.Context, srv *gmail.Service, name string) (string, error) {
+	labels, err := srv.Users.Labels.List("me").Context(ctx).Do()
+	if err != nil {
+		return "", fmt.Errorf("error listing Gmail labels: %v", err)
+	}
+	for _, l := range labels.Labels {
+		if strings.EqualFold(l.Name, name) || l.Id == name {
+			return l.Id, nil
+		}
+	}
+	return "", fmt.Errorf("Gmail label %q not found", name)
+}
+
+// gmailLabelMessageIDs lists every message of the label, oldest first.
+func gmailLabelMessageIDs(ctx context.Context, srv *gmail.Service, labelID string) ([]string, error) {
+	var ids []string
+	call := srv.Users.Messages.List("me").LabelIds(labelID).MaxResults(500)
+	err := call.Pages(ctx, func(page *gmail.ListMessagesResponse) error {
+		for _, m := range page.Messages {
+			ids = append(ids, m.Id)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing Gmail messages: %v", err)
+	}
+	// The API lists newest first.
+	for i, j := 0, len(ids)-1; i < j; i, j = i+1, j-1 {
+		ids[i], ids[j] = ids[j], ids[i]
+	}
+	return ids, nil
+}
+
+// gmailHistoryMessageIDs returns the messages added to the label since
+// startHistoryID, in order, and the history id to continue from.
+func gmailHistoryMessageIDs(ctx context.Context, srv *gmail.Service, labelID string, startHistoryID uint64) ([]string, uint64, error) {
+	var ids []string
+	seen := map[string]bool{}
+	add := func(m *gmail.Message) {
+		if m != nil && !seen[m.Id] {
+			seen[m.Id] = true
+			ids = append(ids, m.Id)
+		}
+	}
+
+	latest := startHistoryID
+	call := srv.Users.History.List("me").StartHistoryId(startHistoryID).LabelId(labelID).
+		HistoryTypes("messageAdded", "labelAdded").MaxResults(500)
+	err := call.Pages(ctx, func(page *gmail.ListHistoryResponse) error {
+		for _, h := range page.History {
+			for _, added := range h.MessagesAdded {
+				add(added.Message)
+			}
+			for _, labeled := range h.LabelsAdded {
+				for _, id := range labeled.LabelIds {
+					if id == labelID {
+						add(labeled.Message)
+					}
+				}
+			}
+		}
+		if page.HistoryId > latest {
+			latest = page.HistoryId
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return ids, latest, nil
+}
+
+// isGmailNotFound reports the 404 Gmail returns for an expired start history id.
+func isGmailNotFound(err error) bool {
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound
+}
+
+// ingestGmailMessage parses one message and writes its registrations to temp
+// together with the message record, so a message is imported exactly once.
+// Errors are only returned for failures worth retrying; unusable messages
+// are recorded as rejected.
+func ingestGmailMessage(ctx context.Context, srv *gmail.Service, templates []compiledGmailTemplate, account, id string) (*models.GmailMessage, error) {
+	msg, err := srv.Users.Messages.Get("me", id).Format("full").Context(ctx).Do()
+	if isGmailNotFound(err) {
+		// Deleted since it was listed.
+		record := &models.GmailMessage{Account: account, ID: id, Status: models.GmailMessageRejected, Error: "message no longer exists"}
+		return record, saveGmailMessage(nil, record)
+	} else if err != nil {
+		return nil, err
+	}
+	record := &models.GmailMessage{Account: account, ID: id, Status: models.GmailMessageRejected}
+
+	content, err := extractGmailContent(msg)
+	if err != nil {
+		record.Error = err.Error()
+		return record, saveGmailMessage(nil, record)
+	}
+	record.MessageID = truncate(content.messageID, 255)
+
+	if record.MessageID != "" {
+		duplicate, err := gmailMessageIDSeen(account, record.MessageID)
+		if err != nil {
+			return nil, err
+		}
+		if duplicate {
+			record.Status = models.GmailMessageDuplicate
+			return record, saveGmailMessage(nil, record)
+		}
+	}
+
+	rows, rowErrors, source, err := gmailMessageRows(ctx, srv, templates, id, content)
+	if err != nil {
+		return nil, err
+	}
+	record.Source = truncate(source, 255)
+	record.ImportedRows = len(rows)
+	record.ErrorRows = countErrorRows(rowErrors)
+	if len(rowErrors) > 0 {
+		record.Error = summarizeRowErrors(rowErrors)
+	}
+	if source == "" {
+		record.Error = "no attachment or template matched the message"
+	}
+	if len(rows) > 0 {
+		record.Status = models.GmailMessageImported
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	if err := insertTempRowsTx(tx, rows); err != nil {
+		return nil, err
+	}
+	if err := saveGmailMessage(tx, record); err != nil {
+		return nil, err
+	}
+	return record, tx.Commit()
+}
+
+// gmailMessageRows reads the registrations of a message: the rows of its
+// CSV/XLSX attachments if it has any, otherwise the body parsed by the first
+// matching template. It returns a description of where they came from.
+func gmailMessageRows(ctx context.Context, srv *gmail.Service, templates []compiledGmailTemplate, id string, content gmailContent) ([]importedRow, []models.ImportRowError, string, error) {
+	maxBytes := int64(config.GetEnvInt("IMPORT_MAX_BYTES", 10<<20))
+
+	if len(content.attachments) > 0 {
+		var rows []importedRow
+		var rowErrors []models.ImportRowError
+		var names []string
+		for _, attachment := range content.attachments {
+			names = append(names, attachment.filename)
+			if attachment.attachmentID != "" {
+				body, err := srv.Users.Messages.Attachments.Get("me", id, attachment.attachmentID).Context(ctx).Do()
+				if err != nil {
+					return nil, nil, "", fmt.Errorf("error fetching attachment %s: %v", attachment.filename, err)
+				}
+				if body.Size > maxBytes {
+					rowErrors = append(rowErrors, fileError(attachment.filename, fmt.Sprintf("larger than %d bytes", maxBytes)))
+					continue
+				}
+				if attachment.data, err = decodeGmailData(body.Data); err != nil {
+					rowErrors = append(rowErrors, fileError(attachment.filename, "cannot be decoded"))
+					continue
+				}
+			}
+			fileRows, fileErrors, err := readAttachmentRows(attachment)
+			if err != nil {
+				rowErrors = append(rowErrors, fileError(attachment.filename, err.Error()))
+				continue
+			}
+			rows = append(rows, fileRows...)
+			rowErrors = append(rowErrors, fileErrors...)
+		}
+		rows, duplicateErrors := rejectDuplicateAttachmentRows(rows)
+		rowErrors = append(rowErrors, duplicateErrors...)
+		rows, existingErrors, err := rejectExistingRegistrations(rows)
+		if err != nil {
+			return nil, nil, "", err
+		}
+		return rows, append(rowErrors, existingErrors...), strings.Join(names, ","), nil
+	}
+
+	user, template, ok := parseWithTemplates(templates, content.subject, content.body)
+	if !ok {
+		return nil, nil, "", nil
+	}
+	var rowErrors []models.ImportRowError
+	for _, fe := range user.Validate() {
+		rowErrors = append(rowErrors, models.ImportRowError{Row: 1, FieldError: fe})
+	}
+	if len(rowErrors) > 0 {
+		return nil, rowErrors, template, nil
+	}
+	rows, rowErrors, err := rejectExistingRegistrations([]importedRow{{row: 1, user: user}})
+	if err != nil {
+		return nil, nil, "", err
+	}
+	return rows, rowErrors, template, nil
+}
+
+// rejectDuplicateAttachmentRows drops rows repeating a registration number of
+// an earlier attachment of the same message. Duplicates within one file are
+// already rejected by readImportRows.
+func rejectDuplicateAttachmentRows(rows []importedRow) ([]importedRow, []models.ImportRowError) {
+	first := map[string]importedRow{}
+	var kept []importedRow
+	var rowErrors []models.ImportRowError
+	for _, r := range rows {
+		if earlier, dup := first[r.user.RegistrationNo]; dup {
+			rowErrors = append(rowErrors, models.ImportRowError{File: r.file, Row: r.row, FieldError: models.FieldError{
+				Field:   "registration_no",
+				Value:   r.user.RegistrationNo,
+				Message: fmt.Sprintf("duplicates row %d of %s", earlier.row, earlier.file),
+			}})
+			continue
+		}
+		first[r.user.RegistrationNo] = r
+		kept = append(kept, r)
+	}
+	return kept, rowErrors
+}
+
+// fileError reports an attachment that could not be read at all.
+func fileError(filename, message string) models.ImportRowError {
+	return models.ImportRowError{File: filename, FieldError: models.FieldError{Field: "file", Value: filename, Message: message}}
+}
+
+// countErrorRows counts the distinct rows with errors, an unreadable file
+// counting as one. Row numbers restart in every attachment.
+func countErrorRows(rowErrors []models.ImportRowError) int {
+	type fileRow struct {
+		file string
+		row  int
+	}
+	rows := map[fileRow]bool{}
+	for _, e := range rowErrors {
+		rows[fileRow{e.File, e.Row}] = true
+	}
+	return len(rows)
+}
+
+// summarizeRowErrors describes the errors without their values, which are personal data.
+func summarizeRowErrors(rowErrors []models.ImportRowError) string {
+	var parts []string
+	for i, e := range rowErrors {
+		if i == 10 {
+			parts = append(parts, fmt.Sprintf("and %d more", len(rowErrors)-i))
+			break
+		}
+		if e.Field == "file" {
+			parts = append(parts, fmt.Sprintf("%s: %s", e.Value, e.Message))
+		} else if e.File != "" {
+			parts = append(parts, fmt.Sprintf("%s row %d %s: %s", e.File, e.Row, e.Field, e.Message))
+		} else {
+			parts = append(parts, fmt.Sprintf("row %d %s: %s", e.Row, e.Field, e.Message))
+		}
+	}
+	return strings.Join(parts, "; ")
+}
+
+// truncate shortens s to at most n bytes for a VARCHAR column.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
+
+// gmailMessageProcessed reports whether the message was already handled.
+func gmailMessageProcessed(account, id string) (bool, error) {
+	var count int
+	err := db.DB.QueryRow("SELECT COUNT(*) FROM gmail_messages WHERE account = ? AND id = ?", account, id).Scan(&count)
+	return count > 0, err
+}
+
+// gmailMessageIDSeen reports whether a message with the same Message-ID header
+// was already handled, such as a copy sent to the label twice.
+func gmailMessageIDSeen(account, messageID string) (bool, error) {
+	var count int
+	query := "SELECT COUNT(*) FROM gmail_messages WHERE account = ? AND message_id = ? AND status <> ?"
+	err := db.DB.QueryRow(query, account, messageID, models.GmailMessageDuplicate).Scan(&count)
+	return count > 0, err
+}
+
+// saveGmailMessage records a processed message, within tx when given.
+func saveGmailMessage(tx *sql.Tx, m *models.GmailMessage) error {
+	m.ProcessedAt = time.Now()
+	query := `INSERT INTO gmail_messages (account, id, message_id, status, source, imported_rows, error_rows, error, processed_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	args := []interface{}{m.Account, m.ID, m.MessageID, m.Status, m.Source, m.ImportedRows, m.ErrorRows, m.Error, m.ProcessedAt}
+	var err error
+	if tx != nil {
+		_, err = tx.Exec(query, args...)
+	} else {
+		_, err = db.DB.Exec(query, args...)
+	}
+	return err
+}
+
+// listGmailMessages returns the latest processed messages of an account.
+func listGmailMessages(account string, limit int) ([]models.GmailMessage, error) {
+	query := `SELECT account, id, message_id, status, source, imported_rows, error_rows, error, processed_at
+		FROM gmail_messages WHERE account = ? ORDER BY processed_at DESC LIMIT ?`
+	rows, err := db.DB.Query(query, account, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := []models.GmailMessage{}
+	for rows.Next() {
+		var m models.GmailMessage
+		var messageErr sql.NullString
+		if err := rows.Scan(&m.Account, &m.ID, &m.MessageID, &m.Status, &m.Source, &m.ImportedRows, &m.ErrorRows, &messageErr, &m.ProcessedAt); err != nil {
+			return nil, err
+		}
+		m.Error = messageErr.String
+		messages = append(messages, m)
+	}
+	return messages, rows.Err()
+}
+
+// loadGmailSyncState returns the account's sync state, or nil before its first run.
+func loadGmailSyncState(account string) (*models.GmailSyncState, error) {
+	var state models.GmailSyncState
+	var synced sql.NullTime
+	var lastError sql.NullString
+	query := "SELECT account, label, label_id, history_id, last_synced_at, last_error FROM gmail_sync_state WHERE account = ?"
+	err := db.DB.QueryRow(query, account).Scan(&state.Account, &state.Label, &state.LabelID, &state.HistoryID, &synced, &lastError)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if synced.Valid {
+		state.LastSyncedAt = &synced.Time
+	}
+	state.LastError = lastError.String
+	return &state, nil
+}
+
+// listGmailSyncStates returns the sync state of every mailbox ever synced.
+func listGmailSyncStates() ([]models.GmailSyncState, error) {
+	rows, err := db.DB.Query("SELECT account FROM gmail_sync_state ORDER BY account")
+	if err != nil {
+		return nil, err
+	}
+	var accounts []string
+	for rows.Next() {
+		var account string
+		if err := rows.Scan(&account); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		accounts = append(accounts, account)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	states := []models.GmailSyncState{}
+	for _, account := range accounts {
+		state, err := loadGmailSyncState(account)
+		if err != nil {
+			return nil, err
+		}
+		if state != nil {
+			states = append(states, *state)
+		}
+	}
+	return states, nil
+}
+
+// saveGmailSyncState stores a successful run and clears the last error.
+func saveGmailSyncState(state *models.GmailSyncState) error {
+	query := `INSERT INTO gmail_sync_state (account, label, label_id, history_id, last_synced_at, last_error)
+		VALUES (?, ?, ?, ?, ?, NULL)
+		ON DUPLICATE KEY UPDATE label = VALUES(label), label_id = VALUES(label_id), history_id = VALUES(history_id),
+			last_synced_at = VALUES(last_synced_at), last_error = NULL`
+	_, err := db.DB.Exec(query, state.Account, state.Label, state.LabelID, state.HistoryID, time.Now())
+	return err
+}
+
+// saveGmailSyncError records why the last run of an account failed.
+func saveGmailSyncError(account string, syncErr error) error {
+	_, err := db.DB.Exec("UPDATE gmail_sync_state SET last_error = ? WHERE account = ?", syncErr.Error(), account)
+	return err
+}
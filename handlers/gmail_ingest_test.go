@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"project/db"
+	"project/models"
+
+	"google.golang.org/api/gmail/v1"
+	"google.golang.org/api/option"
+)
+
+// fakeGmail serves the parts of the Gmail API that ingestion calls.
+type fakeGmail struct {
+	messages    map[string]*gmail.Message
+	attachments map[string]string // attachment id -> contents
+	history     []*gmail.History
+	historyID   uint64
+}
+
+func (f *fakeGmail) serve(t *testing.T) *gmail.Service {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /gmail/v1/users/me/messages/{id}", func(w http.ResponseWriter, r *http.Request) {
+		msg, ok := f.messages[r.PathValue("id")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			writeJSON(w, map[string]interface{}{"error": map[string]interface{}{"code": 404, "message": "Not Found"}})
+			return
+		}
+		writeJSON(w, msg)
+	})
+	mux.HandleFunc("GET /gmail/v1/users/me/messages/{id}/attachments/{attachment}", func(w http.ResponseWriter, r *http.Request) {
+		data := f.attachments[r.PathValue("attachment")]
+		writeJSON(w, gmail.MessagePartBody{Data: encodeGmailData(data), Size: int64(len(data))})
+	})
+	mux.HandleFunc("GET /gmail/v1/users/me/history", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, gmail.ListHistoryResponse{History: f.history, HistoryId: f.historyID})
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	srv, err := gmail.NewService(context.Background(), option.WithHTTPClient(server.Client()), option.WithEndpoint(server.URL+"/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return srv
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func encodeGmailData(s string) string {
+	return base64.URLEncoding.EncodeToString([]byte(s))
+}
+
+// fakeRegistrations stands in for the database behind rejectExistingRegistrations:
+// every query returns the registration numbers in existing, or fails with err.
+type fakeRegistrations struct {
+	existing []string
+	err      error
+}
+
+func (f *fakeRegistrations) Open(string) (driver.Conn, error) { return fakeConn{f}, nil }
+
+type fakeConn struct{ f *fakeRegistrations }
+
+func (c fakeConn) Prepare(string) (driver.Stmt, error) { return fakeStmt(c), nil }
+func (c fakeConn) Close() error                        { return nil }
+func (c fakeConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+type fakeStmt struct{ f *fakeRegistrations }
+
+func (s fakeStmt) Close() error  { return nil }
+func (s fakeStmt) NumInput() int { return -1 }
+func (s fakeStmt) Exec([]driver.Value) (driver.Result, error) {
+	return nil, errors.New("not supported")
+}
+func (s fakeStmt) Query([]driver.Value) (driver.Rows, error) {
+	if s.f.err != nil {
+		return nil, s.f.err
+	}
+	return &fakeRows{values: s.f.existing}, nil
+}
+
+type fakeRows struct{ values []string }
+
+func (r *fakeRows) Columns() []string { return []string{"registration_no"} }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	dest[0], r.values = r.values[0], r.values[1:]
+	return nil
+}
+
+// useFakeDB points db.DB at f for the rest of the test.
+func useFakeDB(t *testing.T, f *fakeRegistrations) {
+	t.Helper()
+	name := "fake-" + t.Name()
+	sql.Register(name, f)
+	conn, err := sql.Open(name, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := db.DB
+	db.DB = conn
+	t.Cleanup(func() {
+		db.DB = previous
+		conn.Close()
+	})
+}
+
+const csvHeader = "name,email,registration_no,phone_no\n"
+
+func TestGmailMessageRowsAcrossAttachments(t *testing.T) {
+	useFakeDB(t, &fakeRegistrations{existing: []string{"R9"}})
+	f := &fakeGmail{attachments: map[string]string{
+		"att-b": csvHeader + "Bo,bo@example.com,R1,5551234567\nCy,not-an-email,R3,5551234567\n",
+	}}
+	srv := f.serve(t)
+
+	content := gmailContent{attachments: []gmailAttachment{
+		{filename: "a.csv", data: []byte(csvHeader + "Al,al@example.com,R1,5551234567\nDi,di@example.com,R9,5551234567\nEd,bad,R4,5551234567\n")},
+		{filename: "b.csv", attachmentID: "att-b"},
+		{filename: "c.xlsx", data: []byte("not a workbook")},
+	}}
+	rows, rowErrors, source, err := gmailMessageRows(context.Background(), srv, nil, "m1", content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if source != "a.csv,b.csv,c.xlsx" {
+		t.Errorf("source = %q", source)
+	}
+	if len(rows) != 1 || rows[0].file != "a.csv" || rows[0].user.RegistrationNo != "R1" {
+		t.Fatalf("rows = %+v, want only R1 of a.csv", rows)
+	}
+
+	var duplicate, existing bool
+	for _, e := range rowErrors {
+		if e.File == "b.csv" && e.Row == 2 && e.Message == "duplicates row 2 of a.csv" {
+			duplicate = true
+		}
+		if e.File == "a.csv" && e.Row == 3 && e.Message == "already registered" {
+			existing = true
+		}
+	}
+	if !duplicate {
+		t.Errorf("R1 of b.csv was not rejected as a duplicate of a.csv: %+v", rowErrors)
+	}
+	if !existing {
+		t.Errorf("R9 was not rejected as already registered: %+v", rowErrors)
+	}
+	// a.csv rows 3 and 4, b.csv rows 2 and 3, and the unreadable c.xlsx.
+	if n := countErrorRows(rowErrors); n != 5 {
+		t.Errorf("countErrorRows = %d, want 5: %+v", n, rowErrors)
+	}
+}
+
+func TestGmailMessageRowsReturnsDatabaseErrors(t *testing.T) {
+	useFakeDB(t, &fakeRegistrations{err: errors.New("connection refused")})
+	srv := (&fakeGmail{}).serve(t)
+
+	content := gmailContent{attachments: []gmailAttachment{
+		{filename: "a.csv", data: []byte(csvHeader + "Al,al@example.com,R1,5551234567\n")},
+	}}
+	_, rowErrors, _, err := gmailMessageRows(context.Background(), srv, nil, "m1", content)
+	if err == nil || !strings.Contains(err.Error(), "connection refused") {
+		t.Fatalf("err = %v, rowErrors = %+v; want the database error so the message is retried", err, rowErrors)
+	}
+}
+
+func TestCountErrorRowsKeepsFilesApart(t *testing.T) {
+	rowErrors := []models.ImportRowError{
+		{File: "a.csv", Row: 2, FieldError: models.FieldError{Field: "email"}},
+		{File: "b.csv", Row: 2, FieldError: models.FieldError{Field: "email"}},
+		{File: "a.csv", Row: 2, FieldError: models.FieldError{Field: "phone_no"}},
+	}
+	if n := countErrorRows(rowErrors); n != 2 {
+		t.Errorf("countErrorRows = %d, want 2", n)
+	}
+}
+
+func TestGmailHistoryMessageIDs(t *testing.T) {
+	f := &fakeGmail{historyID: 42, history: []*gmail.History{
+		{MessagesAdded: []*gmail.HistoryMessageAdded{{Message: &gmail.Message{Id: "m1"}}}},
+		{LabelsAdded: []*gmail.HistoryLabelAdded{
+			{LabelIds: []string{"Label_1"}, Message: &gmail.Message{Id: "m2"}},
+			{LabelIds: []string{"Label_2"}, Message: &gmail.Message{Id: "m3"}},
+			{LabelIds: []string{"Label_1"}, Message: &gmail.Message{Id: "m1"}},
+		}},
+	}}
+	srv := f.serve(t)
+
+	ids, latest, err := gmailHistoryMessageIDs(context.Background(), srv, "Label_1", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(ids, ",") != "m1,m2" || latest != 42 {
+		t.Errorf("ids = %v, latest = %d; want [m1 m2], 42", ids, latest)
+	}
+}
+
+func TestIsGmailNotFound(t *testing.T) {
+	srv := (&fakeGmail{}).serve(t)
+	_, err := srv.Users.Messages.Get("me", "gone").Context(context.Background()).Do()
+	if !isGmailNotFound(err) {
+		t.Errorf("isGmailNotFound(%v) = false", err)
+	}
+}
@@ -0,0 +1,244 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"project/models"
+	"project/utils"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+// settingGmailTemplates stores the admin-managed body templates as JSON.
+const settingGmailTemplates = "gmail_ingest_templates"
+
+// defaultGmailTemplates read "Field: value" lines, the format of the
+// registration form notification emails.
+var defaultGmailTemplates = []models.GmailTemplate{{
+	Name: "default",
+	Fields: map[string]string{
+		"name":            `(?im)^\s*(?:full\s+)?name\s*[:\-]\s*(.+?)\s*$`,
+		"email":           `(?im)^\s*e-?mail(?:\s+address)?\s*[:\-]\s*(\S+@\S+?)\s*$`,
+		"registration_no": `(?im)^\s*reg(?:istration)?\.?\s*(?:no|number|#)\.?\s*[:\-]\s*(.+?)\s*$`,
+		"phone_no":        `(?im)^\s*(?:phone|mobile)(?:\s*(?:no|number))?\.?\s*[:\-]\s*(.+?)\s*$`,
+	},
+}}
+
+// compiledGmailTemplate is a GmailTemplate with its expressions compiled.
+type compiledGmailTemplate struct {
+	name    string
+	subject *regexp.Regexp
+	fields  map[string]*regexp.Regexp
+}
+
+// loadGmailTemplates returns the stored templates, or the defaults if none are stored.
+func loadGmailTemplates() ([]models.GmailTemplate, error) {
+	value, ok, err := utils.GetSetting(settingGmailTemplates)
+	if err != nil || !ok {
+		return defaultGmailTemplates, err
+	}
+	var templates []models.GmailTemplate
+	if err := json.Unmarshal([]byte(value), &templates); err != nil {
+		return nil, fmt.Errorf("invalid stored Gmail templates: %v", err)
+	}
+	return templates, nil
+}
+
+// compileGmailTemplates validates templates: every registration field needs
+// an expression with a capture group.
+func compileGmailTemplates(templates []models.GmailTemplate) ([]compiledGmailTemplate, error) {
+	compiled := make([]compiledGmailTemplate, 0, len(templates))
+	names := map[string]bool{}
+	for i, t := range templates {
+		if strings.TrimSpace(t.Name) == "" {
+			return nil, fmt.Errorf("template %d: name is required", i+1)
+		}
+		if names[t.Name] {
+			return nil, fmt.Errorf("template %q is defined twice", t.Name)
+		}
+		names[t.Name] = true
+
+		ct := compiledGmailTemplate{name: t.Name, fields: map[string]*regexp.Regexp{}}
+		if t.SubjectPattern != "" {
+			re, err := regexp.Compile(t.SubjectPattern)
+			if err != nil {
+				return nil, fmt.Errorf("template %q: invalid subject_pattern: %v", t.Name, err)
+			}
+			ct.subject = re
+		}
+		for field := range t.Fields {
+			if !isImportField(field) {
+				return nil, fmt.Errorf("template %q: unknown field %q, expected one of %s", t.Name, field, strings.Join(importFields, ", "))
+			}
+		}
+		for _, field := range importFields {
+			pattern, ok := t.Fields[field]
+			if !ok {
+				return nil, fmt.Errorf("template %q: field %s is required", t.Name, field)
+			}
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("template %q: invalid pattern for %s: %v", t.Name, field, err)
+			}
+			if re.NumSubexp() < 1 {
+				return nil, fmt.Errorf("template %q: pattern for %s needs a capture group", t.Name, field)
+			}
+			ct.fields[field] = re
+		}
+		compiled = append(compiled, ct)
+	}
+	return compiled, nil
+}
+
+// parseWithTemplates applies the first template whose subject pattern
+// matches and which finds at least one field in the body.
+func parseWithTemplates(templates []compiledGmailTemplate, subject, body string) (models.User, string, bool) {
+	for _, t := range templates {
+		if t.subject != nil && !t.subject.MatchString(subject) {
+			continue
+		}
+		values := map[string]string{}
+		for field, re := range t.fields {
+			if m := re.FindStringSubmatch(body); m != nil {
+				values[field] = strings.TrimSpace(m[1])
+			}
+		}
+		if len(values) == 0 {
+			continue
+		}
+		return models.User{
+			Name:           values["name"],
+			Email:          values["email"],
+			RegistrationNo: values["registration_no"],
+			PhoneNo:        values["phone_no"],
+		}, t.name, true
+	}
+	return models.User{}, "", false
+}
+
+// gmailAttachment is a spreadsheet attached to a message.
+type gmailAttachment struct {
+	filename     string
+	data         []byte
+	attachmentID string // set when the data must be fetched separately
+}
+
+// gmailContent is what ingestion needs from a message.
+type gmailContent struct {
+	subject     string
+	messageID   string
+	body        string
+	attachments []gmailAttachment
+}
+
+// extractGmailContent walks the MIME tree of a message fetched with format=full.
+// The plain text body is preferred; HTML is reduced to text when it is the only body.
+func extractGmailContent(msg *gmail.Message) (gmailContent, error) {
+	var content gmailContent
+	if msg.Payload == nil {
+		return content, fmt.Errorf("message has no payload")
+	}
+	for _, h := range msg.Payload.Headers {
+		switch strings.ToLower(h.Name) {
+		case "subject":
+			content.subject = h.Value
+		case "message-id":
+			content.messageID = strings.Trim(strings.TrimSpace(h.Value), "<>")
+		}
+	}
+
+	var plain, htmlBody string
+	var walk func(part *gmail.MessagePart) error
+	walk = func(part *gmail.MessagePart) error {
+		ext := strings.ToLower(filepath.Ext(part.Filename))
+		switch {
+		case ext == ".csv" || ext == ".xlsx":
+			attachment := gmailAttachment{filename: part.Filename}
+			if part.Body != nil && part.Body.AttachmentId != "" {
+				attachment.attachmentID = part.Body.AttachmentId
+			} else if part.Body != nil {
+				data, err := decodeGmailData(part.Body.Data)
+				if err != nil {
+					return fmt.Errorf("error decoding %s: %v", part.Filename, err)
+				}
+				attachment.data = data
+			}
+			content.attachments = append(content.attachments, attachment)
+		case part.Filename == "" && part.MimeType == "text/plain" && plain == "" && part.Body != nil:
+			data, err := decodeGmailData(part.Body.Data)
+			if err != nil {
+				return fmt.Errorf("error decoding text body: %v", err)
+			}
+			plain = string(data)
+		case part.Filename == "" && part.MimeType == "text/html" && htmlBody == "" && part.Body != nil:
+			data, err := decodeGmailData(part.Body.Data)
+			if err != nil {
+				return fmt.Errorf("error decoding HTML body: %v", err)
+			}
+			htmlBody = string(data)
+		}
+		for _, child := range part.Parts {
+			if err := walk(child); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(msg.Payload); err != nil {
+		return content, err
+	}
+
+	content.body = plain
+	if content.body == "" {
+		content.body = htmlToText(htmlBody)
+	}
+	return content, nil
+}
+
+// decodeGmailData decodes the base64url data of the Gmail API, which may or
+// may not be padded.
+func decodeGmailData(data string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(data, "="))
+}
+
+var (
+	htmlBreaks = regexp.MustCompile(`(?i)<br\s*/?>|</(?:p|div|tr|li|h[1-6])>`)
+	htmlTags   = regexp.MustCompile(`<[^>]*>`)
+)
+
+// htmlToText keeps one line per block element so line-based templates match HTML mail too.
+func htmlToText(body string) string {
+	body = htmlBreaks.ReplaceAllString(body, "\n")
+	body = htmlTags.ReplaceAllString(body, "")
+	return html.UnescapeString(body)
+}
+
+// readAttachmentRows parses a spreadsheet attachment like an uploaded import,
+// tagging rows and errors with the file name. An error means the file is
+// unreadable.
+func readAttachmentRows(attachment gmailAttachment) ([]importedRow, []models.ImportRowError, error) {
+	reader, err := openRowReader(bytes.NewReader(attachment.data), strings.ToLower(filepath.Ext(attachment.filename)), "")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer reader.Close()
+
+	rows, rowErrors, _, err := readImportRows(reader, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i := range rows {
+		rows[i].file = attachment.filename
+	}
+	for i := range rowErrors {
+		rowErrors[i].File = attachment.filename
+	}
+	return rows, rowErrors, nil
+}
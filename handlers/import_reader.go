@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// importFields are the models.User fields an import fills, in header-mapping order.
+var importFields = []string{"name", "email", "registration_no", "phone_no"}
+
+// headerAliases maps normalised spreadsheet headers to import fields, so files
+// exported from other tools import without an explicit mapping.
+var headerAliases = map[string]string{
+	"name":               "name",
+	"fullname":           "name",
+	"studentname":        "name",
+	"email":              "email",
+	"emailaddress":       "email",
+	"emailid":            "email",
+	"mail":               "email",
+	"registrationno":     "registration_no",
+	"registrationnumber": "registration_no",
+	"regno":              "registration_no",
+	"registration":       "registration_no",
+	"phoneno":            "phone_no",
+	"phone":              "phone_no",
+	"phonenumber":        "phone_no",
+	"mobile":             "phone_no",
+	"mobileno":           "phone_no",
+	"mobilenumber":       "phone_no",
+}
+
+// rowReader yields spreadsheet rows one at a time, returning io.EOF at the end.
+type rowReader interface {
+	Next() ([]string, error)
+	Close() error
+}
+
+// openRowReader opens a .csv or .xlsx upload. For workbooks the named sheet
+// is read, or the first sheet when sheet is empty.
+func openRowReader(file io.Reader, ext, sheet string) (rowReader, error) {
+	switch ext {
+	case ".csv":
+		reader := csv.NewReader(skipBOM(file))
+		reader.FieldsPerRecord = -1
+		reader.LazyQuotes = true
+		return &csvRowReader{reader: reader}, nil
+	case ".xlsx":
+		workbook, err := excelize.OpenReader(file)
+		if err != nil {
+			return nil, fmt.Errorf("error opening workbook: %v", err)
+		}
+		if sheet == "" {
+			sheet = workbook.GetSheetName(0)
+		}
+		rows, err := workbook.Rows(sheet)
+		if err != nil {
+			workbook.Close()
+			return nil, fmt.Errorf("error reading sheet %q: %v", sheet, err)
+		}
+		return &xlsxRowReader{workbook: workbook, rows: rows}, nil
+	default:
+		return nil, fmt.Errorf("file must be a .csv or .xlsx spreadsheet")
+	}
+}
+
+// skipBOM drops the UTF-8 byte order mark Excel writes at the start of CSV files.
+func skipBOM(r io.Reader) io.Reader {
+	buffered := bufio.NewReader(r)
+	if bom, err := buffered.Peek(3); err == nil && string(bom) == "\xef\xbb\xbf" {
+		buffered.Discard(3)
+	}
+	return buffered
+}
+
+type csvRowReader struct {
+	reader *csv.Reader
+}
+
+func (r *csvRowReader) Next() ([]string, error) {
+	return r.reader.Read()
+}
+
+func (r *csvRowReader) Close() error {
+	return nil
+}
+
+type xlsxRowReader struct {
+	workbook *excelize.File
+	rows     *excelize.Rows
+}
+
+func (r *xlsxRowReader) Next() ([]string, error) {
+	if !r.rows.Next() {
+		if err := r.rows.Error(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+	return r.rows.Columns()
+}
+
+func (r *xlsxRowReader) Close() error {
+	r.rows.Close()
+	return r.workbook.Close()
+}
+
+// normalizeHeader lowercases a header and drops everything but letters and
+// digits, so "Reg. No", "reg_no" and "REG NO" all match.
+func normalizeHeader(header string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(header) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// mapHeaders returns the column index of each import field. Explicit
+// mappings from spreadsheet header to field take precedence over aliases.
+func mapHeaders(headers []string, mapping map[string]string) (map[string]int, error) {
+	explicit := make(map[string]string, len(mapping))
+	for header, field := range mapping {
+		if !isImportField(field) {
+			return nil, fmt.Errorf("cannot map %q to unknown field %q", header, field)
+		}
+		explicit[normalizeHeader(header)] = field
+	}
+
+	columns := make(map[string]int)
+	for i, header := range headers {
+		key := normalizeHeader(header)
+		field, ok := explicit[key]
+		if !ok {
+			field, ok = headerAliases[key]
+		}
+		if !ok {
+			continue
+		}
+		if _, dup := columns[field]; dup {
+			return nil, fmt.Errorf("more than one column maps to %s", field)
+		}
+		columns[field] = i
+	}
+
+	var missing []string
+	for _, field := range importFields {
+		if _, ok := columns[field]; !ok {
+			missing = append(missing, field)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("no column found for %s; add a mapping for these fields", strings.Join(missing, ", "))
+	}
+	return columns, nil
+}
+
+func isImportField(field string) bool {
+	for _, f := range importFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// cell returns the trimmed value at index i, or "" for short rows.
+func cell(row []string, i int) string {
+	if i >= len(row) {
+		return ""
+	}
+	return strings.TrimSpace(row[i])
+}
+
+// isBlankRow reports whether every cell of the row is empty.
+func isBlankRow(row []string) bool {
+	for _, value := range row {
+		if strings.TrimSpace(value) != "" {
+			return false
+		}
+	}
+	return true
+}
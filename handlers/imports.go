@@ -0,0 +1,420 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"project/config"
+	"project/db"
+	"project/models"
+	"project/storage"
+	"project/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// importBatchSize is how many rows go into one multi-row INSERT.
+const importBatchSize = 500
+
+// importErrorPreview is how many row errors are returned inline; the rest
+// are only in the downloadable error report.
+const importErrorPreview = 100
+
+// importedRow is a valid registration and the spreadsheet row it came from.
+type importedRow struct {
+	file string // attachment name for Gmail ingestion
+	row  int
+	user models.User
+}
+
+// ImportUsersHandler handles POST /imports, a multipart upload with:
+//
+//	file          the .csv or .xlsx spreadsheet (required)
+//	mapping       JSON object from spreadsheet header to field, e.g. {"Student": "name"}
+//	sheet         worksheet to read from a workbook, default the first one
+//	dry_run       "true" to only validate
+//	skip_invalid  "true" to import the valid rows even when others fail
+//
+// Every row is validated against models.User. Unless dry_run is set, the
+// rows are written to the temp table in one transaction so TransferTempData
+// moves them to users together. A CSV of row errors can be downloaded from
+// GET /imports/:id/errors until EXPORT_RETENTION (default 24h) has passed.
+func ImportUsersHandler(c *gin.Context) {
+	maxBytes := int64(config.GetEnvInt("IMPORT_MAX_BYTES", 10<<20))
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes)
+
+	upload, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("A .csv or .xlsx file of at most %d bytes is required", maxBytes)})
+		return
+	}
+	dryRun, _ := strconv.ParseBool(c.PostForm("dry_run"))
+	skipInvalid, _ := strconv.ParseBool(c.PostForm("skip_invalid"))
+
+	var mapping map[string]string
+	if raw := c.PostForm("mapping"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &mapping); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "mapping must be a JSON object of header to field", "fields": importFields})
+			return
+		}
+	}
+
+	file, err := upload.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error reading upload"})
+		return
+	}
+	defer file.Close()
+
+	reader, err := openRowReader(file, strings.ToLower(filepath.Ext(upload.Filename)), c.PostForm("sheet"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer reader.Close()
+
+	rows, rowErrors, total, err := readImportRows(reader, mapping)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "fields": importFields})
+		return
+	}
+	rows, existingErrors, err := rejectExistingRegistrations(rows)
+	if err != nil {
+		fmt.Printf("Error checking existing registrations: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking existing registrations"})
+		return
+	}
+	rowErrors = append(rowErrors, existingErrors...)
+
+	id, err := utils.RandomHex(16)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error starting import"})
+		return
+	}
+	imp := models.Import{
+		ID:        id,
+		FileName:  upload.Filename,
+		DryRun:    dryRun,
+		TotalRows: total,
+		ValidRows: len(rows),
+		ErrorRows: total - len(rows),
+		CreatedBy: c.GetString("username"),
+		CreatedAt: time.Now(),
+	}
+
+	if len(rowErrors) > 0 {
+		imp.ErrorReportKey = "imports/" + id + "-errors.csv"
+		expires := time.Now().Add(config.GetEnvDuration("EXPORT_RETENTION", 24*time.Hour))
+		imp.ErrorReportExpiresAt = &expires
+		if err := saveImportErrorReport(c.Request.Context(), imp.ErrorReportKey, rowErrors); err != nil {
+			fmt.Printf("Error saving import error report: %v\n", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving import error report"})
+			return
+		}
+	}
+
+	switch {
+	case dryRun:
+		imp.Status = models.ImportValidated
+	case len(rowErrors) > 0 && !skipInvalid:
+		imp.Status = models.ImportRejected
+	default:
+		if err := insertTempRows(rows); err != nil {
+			fmt.Printf("Error importing rows: %v\n", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error writing rows, nothing was imported"})
+			return
+		}
+		imp.Status = models.ImportCommitted
+		imp.ImportedRows = len(rows)
+	}
+
+	if err := saveImport(imp); err != nil {
+		fmt.Printf("Error recording import: %v\n", err)
+	}
+
+	response := gin.H{"import": imp, "errors": rowErrors[:min(len(rowErrors), importErrorPreview)]}
+	if imp.ErrorReportKey != "" {
+		response["error_report_url"] = "/imports/" + id + "/errors"
+	}
+	status := http.StatusOK
+	if imp.Status == models.ImportRejected {
+		response["error"] = "Some rows are invalid, nothing was imported. Fix them or retry with skip_invalid=true"
+		status = http.StatusUnprocessableEntity
+	}
+	c.JSON(status, response)
+}
+
+// GetImportHandler returns the summary of an import.
+func GetImportHandler(c *gin.Context) {
+	imp, ok := loadImport(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"import": imp})
+}
+
+// DownloadImportErrorsHandler serves the CSV of row errors of an import.
+func DownloadImportErrorsHandler(c *gin.Context) {
+	imp, ok := loadImport(c)
+	if !ok {
+		return
+	}
+	if imp.ErrorReportKey == "" && imp.ErrorRows > 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Error report is no longer available"})
+		return
+	} else if imp.ErrorReportKey == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Import has no errors"})
+		return
+	}
+
+	report, err := exportStore.Open(c.Request.Context(), imp.ErrorReportKey)
+	if err == storage.ErrNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Error report is no longer available"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error reading error report"})
+		return
+	}
+	defer report.Close()
+
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=import_%s_errors.csv", imp.ID))
+	c.Status(http.StatusOK)
+	if _, err := io.Copy(c.Writer, report); err != nil {
+		fmt.Printf("Error streaming import error report %s: %v\n", imp.ID, err)
+	}
+}
+
+// readImportRows maps the header row and validates every data row. It returns
+// the valid rows, the row errors and the number of non-blank data rows. Its
+// errors are about the file itself; registrations already in the database are
+// left to rejectExistingRegistrations.
+func readImportRows(reader rowReader, mapping map[string]string) ([]importedRow, []models.ImportRowError, int, error) {
+	headers, err := reader.Next()
+	if err == io.EOF {
+		return nil, nil, 0, fmt.Errorf("the file is empty")
+	} else if err != nil {
+		return nil, nil, 0, fmt.Errorf("error reading header row: %v", err)
+	}
+	columns, err := mapHeaders(headers, mapping)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	maxRows := config.GetEnvInt("IMPORT_MAX_ROWS", 10000)
+	var rows []importedRow
+	rowErrors := []models.ImportRowError{}
+	seen := make(map[string]int) // registration_no -> first row
+	total := 0
+	for rowNumber := 2; ; rowNumber++ {
+		record, err := reader.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, nil, 0, fmt.Errorf("error reading row %d: %v", rowNumber, err)
+		}
+		if isBlankRow(record) {
+			continue
+		}
+		total++
+		if total > maxRows {
+			return nil, nil, 0, fmt.Errorf("the file has more than %d rows; split it into smaller files", maxRows)
+		}
+
+		user := models.User{
+			Name:           cell(record, columns["name"]),
+			Email:          cell(record, columns["email"]),
+			RegistrationNo: cell(record, columns["registration_no"]),
+			PhoneNo:        cell(record, columns["phone_no"]),
+		}
+		fieldErrors := user.Validate()
+		if first, dup := seen[user.RegistrationNo]; dup && user.RegistrationNo != "" {
+			fieldErrors = append(fieldErrors, models.FieldError{
+				Field:   "registration_no",
+				Value:   user.RegistrationNo,
+				Message: fmt.Sprintf("duplicates row %d", first),
+			})
+		} else {
+			seen[user.RegistrationNo] = rowNumber
+		}
+
+		for _, fe := range fieldErrors {
+			rowErrors = append(rowErrors, models.ImportRowError{Row: rowNumber, FieldError: fe})
+		}
+		if len(fieldErrors) == 0 {
+			rows = append(rows, importedRow{row: rowNumber, user: user})
+		}
+	}
+
+	return rows, rowErrors, total, nil
+}
+
+// rejectExistingRegistrations drops rows whose registration number is already
+// in users or waiting in temp.
+func rejectExistingRegistrations(rows []importedRow) ([]importedRow, []models.ImportRowError, error) {
+	existing := make(map[string]bool)
+	for start := 0; start < len(rows); start += importBatchSize {
+		batch := rows[start:min(start+importBatchSize, len(rows))]
+		args := make([]interface{}, len(batch))
+		for i, r := range batch {
+			args[i] = r.user.RegistrationNo
+		}
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", len(batch)), ",")
+		query := fmt.Sprintf(`SELECT registration_no FROM users WHERE registration_no IN (%[1]s)
+			UNION SELECT registration_no FROM temp WHERE registration_no IN (%[1]s)`, placeholders)
+
+		result, err := db.DB.Query(query, append(args, args...)...)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error checking existing registrations: %v", err)
+		}
+		for result.Next() {
+			var regNo string
+			if err := result.Scan(&regNo); err != nil {
+				result.Close()
+				return nil, nil, err
+			}
+			existing[regNo] = true
+		}
+		result.Close()
+	}
+
+	var kept []importedRow
+	var rowErrors []models.ImportRowError
+	for _, r := range rows {
+		if existing[r.user.RegistrationNo] {
+			rowErrors = append(rowErrors, models.ImportRowError{File: r.file, Row: r.row, FieldError: models.FieldError{
+				Field:   "registration_no",
+				Value:   r.user.RegistrationNo,
+				Message: "already registered",
+			}})
+			continue
+		}
+		kept = append(kept, r)
+	}
+	return kept, rowErrors, nil
+}
+
+// insertTempRows writes the rows to temp in a single transaction, dated today
+// like rows submitted through POST /users.
+func insertTempRows(rows []importedRow) error {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	if err := insertTempRowsTx(tx, rows); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// insertTempRowsTx writes the rows to temp in batches within tx, so callers
+// can commit them together with their own bookkeeping.
+func insertTempRowsTx(tx *sql.Tx, rows []importedRow) error {
+	currentDate := time.Now().Format("02/01/06")
+	for start := 0; start < len(rows); start += importBatchSize {
+		batch := rows[start:min(start+importBatchSize, len(rows))]
+		args := make([]interface{}, 0, len(batch)*5)
+		for _, r := range batch {
+			args = append(args, r.user.Name, r.user.Email, r.user.RegistrationNo, r.user.PhoneNo, currentDate)
+		}
+		placeholders := strings.TrimSuffix(strings.Repeat("(?, ?, ?, ?, ?),", len(batch)), ",")
+		query := "INSERT INTO temp (name, email, registration_no, phone_no, date) VALUES " + placeholders
+		if _, err := tx.Exec(query, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cleanupExpiredImportReports deletes import error reports past their
+// retention. Reports saved before their expiry was recorded expire
+// EXPORT_RETENTION after the import.
+func cleanupExpiredImportReports() {
+	now := time.Now()
+	retention := config.GetEnvDuration("EXPORT_RETENTION", 24*time.Hour)
+	rows, err := db.DB.Query(`SELECT id, error_report_key FROM imports WHERE error_report_key <> ''
+		AND (error_report_expires_at < ? OR (error_report_expires_at IS NULL AND created_at < ?))`, now, now.Add(-retention))
+	if err != nil {
+		log.Printf("❌ Error finding expired import error reports: %v", err)
+		return
+	}
+	type expired struct{ id, key string }
+	var reports []expired
+	for rows.Next() {
+		var report expired
+		if err := rows.Scan(&report.id, &report.key); err == nil {
+			reports = append(reports, report)
+		}
+	}
+	rows.Close()
+
+	for _, report := range reports {
+		if err := exportStore.Delete(context.Background(), report.key); err != nil {
+			log.Printf("❌ Error deleting error report of import %s: %v", report.id, err)
+			continue
+		}
+		if _, err := db.DB.Exec("UPDATE imports SET error_report_key = '' WHERE id = ?", report.id); err != nil {
+			log.Printf("❌ Error expiring error report of import %s: %v", report.id, err)
+		}
+	}
+}
+
+// saveImportErrorReport writes the row errors as CSV to the export storage.
+func saveImportErrorReport(ctx context.Context, key string, rowErrors []models.ImportRowError) error {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	writer.Write([]string{"row", "field", "value", "message"})
+	for _, e := range rowErrors {
+		writer.Write([]string{strconv.Itoa(e.Row), e.Field, e.Value, e.Message})
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return err
+	}
+	return exportStore.Put(ctx, key, &buf, int64(buf.Len()), "text/csv; charset=utf-8")
+}
+
+func saveImport(imp models.Import) error {
+	query := `INSERT INTO imports (id, file_name, status, dry_run, total_rows, valid_rows, error_rows, imported_rows,
+		error_report_key, error_report_expires_at, created_by, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := db.DB.Exec(query, imp.ID, imp.FileName, imp.Status, imp.DryRun, imp.TotalRows, imp.ValidRows,
+		imp.ErrorRows, imp.ImportedRows, imp.ErrorReportKey, imp.ErrorReportExpiresAt, imp.CreatedBy, imp.CreatedAt)
+	return err
+}
+
+// loadImport resolves the :id parameter to an import the caller may see,
+// writing an error response and returning false otherwise.
+func loadImport(c *gin.Context) (*models.Import, bool) {
+	query := `SELECT id, file_name, status, dry_run, total_rows, valid_rows, error_rows, imported_rows,
+		error_report_key, error_report_expires_at, created_by, created_at FROM imports WHERE id = ?`
+
+	var imp models.Import
+	var expires sql.NullTime
+	err := db.DB.QueryRow(query, c.Param("id")).Scan(&imp.ID, &imp.FileName, &imp.Status, &imp.DryRun, &imp.TotalRows,
+		&imp.ValidRows, &imp.ErrorRows, &imp.ImportedRows, &imp.ErrorReportKey, &expires, &imp.CreatedBy, &imp.CreatedAt)
+	if expires.Valid {
+		imp.ErrorReportExpiresAt = &expires.Time
+	}
+	if err != nil && err != sql.ErrNoRows {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading import"})
+		return nil, false
+	}
+	isAdmin := utils.RoleHasPermission(c.GetString("role"), utils.PermAdmin)
+	if err == sql.ErrNoRows || (imp.CreatedBy != c.GetString("username") && !isAdmin) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Import not found"})
+		return nil, false
+	}
+	return &imp, true
+}
@@ -3,6 +3,7 @@ package handlers
 import (
 	"net/http"
 
+	"project/config"
 	"project/utils"
 
 	"github.com/gin-gonic/gin"
@@ -31,12 +32,48 @@ func LoginHandler(c *gin.Context) {
 		return
 	}
 
+	// Block unverified accounts when REQUIRE_EMAIL_VERIFICATION is enabled.
+	if config.GetEnvBool("REQUIRE_EMAIL_VERIFICATION", false) && !user.EmailVerified {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Email address not verified"})
+		return
+	}
+
+	// Accounts with TOTP enabled get a challenge token instead of a session.
+	if user.TOTPEnabled {
+		challenge, err := utils.GenerateMFAChallengeToken(user.Username)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication required", "mfa_required": true, "mfa_token": challenge})
+		return
+	}
+
+	issueLoginToken(c, user, false)
+}
+
+// issueLoginToken responds with the session JWT for an authenticated user.
+func issueLoginToken(c *gin.Context, user *utils.User, mfa bool) {
 	// Generate JWT Token
-	token, err := utils.GenerateJWT(request.Username)
+	token, err := utils.GenerateJWT(user.Username, user.Role, mfa)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Login successful", "token": token})
+	response := gin.H{"message": "Login successful", "token": token}
+
+	// Tell users whose role needs 2FA for personal data that they must enroll.
+	if !mfa {
+		required, err := utils.RoleRequiresMFA(user.Role)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading security policy"})
+			return
+		}
+		if required {
+			response["mfa_enrollment_required"] = true
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
 }
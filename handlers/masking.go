@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"project/masking"
+	"project/middleware"
+	"project/models"
+	"project/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maskingRole is the role whose masking policy applies to the request.
+func maskingRole(c *gin.Context) string {
+	if _, ok := c.Get("api_key"); ok {
+		return utils.MaskingRoleAPIKey
+	}
+	if c.GetString("username") == "" {
+		return utils.MaskingRoleAnonymous
+	}
+	return c.GetString("role")
+}
+
+// canUnmask reports whether the caller holds PermUnmaskPersonalData, as a
+// role permission or an API key scope.
+func canUnmask(c *gin.Context) bool {
+	return hasPermission(c, utils.PermUnmaskPersonalData)
+}
+
+// hasPermission reports whether the caller's role grants the permission, or
+// for API keys whether the key has it as a scope.
+func hasPermission(c *gin.Context, permission string) bool {
+	if value, ok := c.Get("api_key"); ok {
+		key, _ := value.(*utils.APIKey)
+		return key != nil && key.HasScope(permission)
+	}
+	return utils.RoleHasPermission(c.GetString("role"), permission)
+}
+
+// requestMaskingPolicy returns the masking policy for a response or export of
+// resource. With unmask=true the caller needs PermUnmaskPersonalData and a
+// two-factor session when the policy requires one, gets unmasked data, and
+// the access is written to the audit log. It writes an
+// error response and returns false if the request cannot be served.
+func requestMaskingPolicy(c *gin.Context, resource string) (masking.Policy, bool) {
+	if unmask, _ := strconv.ParseBool(c.Query("unmask")); unmask {
+		if !canUnmask(c) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions to unmask personal data"})
+			return nil, false
+		}
+		if !middleware.CheckMFASession(c) {
+			return nil, false
+		}
+		// Fail closed: unmasked data is only served once the access is recorded.
+		if err := utils.RecordAuditEvent(c.GetString("username"), models.AuditUnmaskPersonalData, resource, c.Request.URL.RawQuery, c.ClientIP()); err != nil {
+			fmt.Printf("Error recording unmask audit event: %v\n", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error recording audit event"})
+			return nil, false
+		}
+		return nil, true
+	}
+
+	policy, err := utils.MaskingPolicyFor(maskingRole(c))
+	if err != nil {
+		fmt.Printf("Error loading masking policy: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading masking policy"})
+		return nil, false
+	}
+	return policy, true
+}
+
+// GetMaskingPolicyHandler returns the effective masking policy of every role.
+func GetMaskingPolicyHandler(c *gin.Context) {
+	policies, err := utils.MaskingPolicies()
+	if err != nil {
+		fmt.Printf("Error loading masking policy: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading masking policy"})
+		return
+	}
+
+	// List who may bypass the policy with unmask=true.
+	var unmaskRoles []string
+	for role := range utils.RolePermissions {
+		if utils.RoleHasPermission(role, utils.PermUnmaskPersonalData) {
+			unmaskRoles = append(unmaskRoles, role)
+		}
+	}
+	sort.Strings(unmaskRoles)
+
+	c.JSON(http.StatusOK, gin.H{
+		"policies":     policies,
+		"fields":       masking.Fields,
+		"unmask_roles": unmaskRoles,
+	})
+}
+
+// UpdateMaskingPolicyHandler replaces the policy of the roles in the body,
+// e.g. {"policies": {"viewer": {"email": "full", "phone_no": "partial"}}}.
+func UpdateMaskingPolicyHandler(c *gin.Context) {
+	var request struct {
+		Policies map[string]masking.Policy `json:"policies"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil || len(request.Policies) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "policies is required"})
+		return
+	}
+
+	username := c.GetString("username")
+	if err := utils.SetMaskingPolicies(request.Policies, username); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var roles []string
+	for role := range request.Policies {
+		roles = append(roles, role)
+	}
+	sort.Strings(roles)
+	if err := utils.RecordAuditEvent(username, models.AuditMaskingPolicy, "masking_policy", fmt.Sprint(roles), c.ClientIP()); err != nil {
+		fmt.Printf("Error recording masking policy audit event: %v\n", err)
+	}
+
+	GetMaskingPolicyHandler(c)
+}
+
+// ListAuditEventsHandler serves GET /admin/audit-events with optional
+// actor, action and limit (default 100, at most 1000).
+func ListAuditEventsHandler(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit < 1 || limit > 1000 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 1000"})
+		return
+	}
+
+	events, err := utils.ListAuditEvents(c.Query("actor"), c.Query("action"), limit)
+	if err != nil {
+		fmt.Printf("Error listing audit events: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing audit events"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"events": events})
+}
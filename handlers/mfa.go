@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"project/config"
+	"project/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LoginMFAHandler completes a two-step login with a TOTP or recovery code.
+func LoginMFAHandler(c *gin.Context) {
+	var request struct {
+		MFAToken     string `json:"mfa_token"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil || request.MFAToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	username, err := utils.ParseMFAChallengeToken(request.MFAToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired MFA token"})
+		return
+	}
+
+	user, err := utils.GetUserByUsername(username)
+	if err != nil || user == nil || !user.TOTPEnabled {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		return
+	}
+
+	var ok bool
+	switch {
+	case request.Code != "":
+		ok, err = utils.VerifyTOTP(username, request.Code)
+	case request.RecoveryCode != "":
+		ok, err = utils.ConsumeRecoveryCode(username, request.RecoveryCode)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Either code or recovery_code is required"})
+		return
+	}
+
+	if err == utils.ErrMFALocked {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many invalid codes, try again later"})
+		return
+	} else if err != nil {
+		fmt.Printf("Error verifying second factor: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error verifying code"})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid code"})
+		return
+	}
+
+	issueLoginToken(c, user, true)
+}
+
+// EnrollTOTPHandler starts TOTP enrollment and returns the secret and the
+// otpauth:// provisioning URI to render as a QR code.
+func EnrollTOTPHandler(c *gin.Context) {
+	username := c.GetString("username")
+
+	user, err := utils.GetUserByUsername(username)
+	if err != nil || user == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if user.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating secret"})
+		return
+	}
+	if err := utils.SetPendingTOTPSecret(username, secret); err != nil {
+		fmt.Printf("Error storing TOTP secret: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error storing secret"})
+		return
+	}
+
+	issuer := config.GetEnv("TOTP_ISSUER", "my-go-backend")
+	c.JSON(http.StatusOK, gin.H{
+		"secret":           secret,
+		"provisioning_uri": utils.TOTPProvisioningURI(issuer, username, secret),
+		"message":          "Scan the QR code, then confirm with a code from your authenticator app",
+	})
+}
+
+// ConfirmTOTPHandler activates a pending TOTP secret and returns recovery codes.
+func ConfirmTOTPHandler(c *gin.Context) {
+	var request struct {
+		Code string `json:"code"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil || request.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	username := c.GetString("username")
+
+	if !verifyCurrentTOTP(c, username, request.Code) {
+		return
+	}
+	if err := utils.EnableTOTP(username); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error enabling two-factor authentication"})
+		return
+	}
+
+	codes, err := utils.GenerateRecoveryCodes(username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating recovery codes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Two-factor authentication enabled, store your recovery codes safely",
+		"recovery_codes": codes,
+	})
+}
+
+// DisableTOTPHandler turns off TOTP after checking a current code.
+func DisableTOTPHandler(c *gin.Context) {
+	var request struct {
+		Code string `json:"code"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil || request.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	username := c.GetString("username")
+
+	if !verifyCurrentTOTP(c, username, request.Code) {
+		return
+	}
+	if err := utils.DisableTOTP(username); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error disabling two-factor authentication"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodesHandler replaces all recovery codes after checking a current code.
+func RegenerateRecoveryCodesHandler(c *gin.Context) {
+	var request struct {
+		Code string `json:"code"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil || request.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	username := c.GetString("username")
+
+	if !verifyCurrentTOTP(c, username, request.Code) {
+		return
+	}
+	codes, err := utils.GenerateRecoveryCodes(username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating recovery codes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// verifyCurrentTOTP checks a code and writes the error response if it fails.
+func verifyCurrentTOTP(c *gin.Context, username, code string) bool {
+	ok, err := utils.VerifyTOTP(username, code)
+	if err == utils.ErrMFALocked {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many invalid codes, try again later"})
+		return false
+	} else if err != nil {
+		fmt.Printf("Error verifying TOTP: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error verifying code"})
+		return false
+	}
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid code"})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"project/models"
+	"project/notifications"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListNotificationsHandler serves GET /admin/notifications with optional
+// status (pending, sending, sent or failed) and limit (default 100).
+func ListNotificationsHandler(c *gin.Context) {
+	status := c.Query("status")
+	switch status {
+	case "", models.NotificationPending, models.NotificationSending, models.NotificationSent, models.NotificationFailed:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be pending, sending, sent or failed"})
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit < 1 || limit > 1000 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 1000"})
+		return
+	}
+
+	list, err := notifications.List(status, limit)
+	if err != nil {
+		fmt.Printf("Error listing notifications: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing notifications"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"notifications": list})
+}
+
+// RetryNotificationHandler serves POST /admin/notifications/:id/retry,
+// queueing a failed notification again.
+func RetryNotificationHandler(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid notification id"})
+		return
+	}
+
+	retried, err := notifications.Retry(id)
+	if err != nil {
+		fmt.Printf("Error retrying notification %d: %v\n", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error retrying notification"})
+		return
+	}
+	if !retried {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only failed notifications can be retried"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Notification queued", "id": id})
+}
@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"project/config"
+	"project/oidc"
+	"project/utils"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/oauth2"
+)
+
+// OIDCLoginHandler redirects the browser to the provider's consent screen,
+// e.g. GET /auth/google.
+func OIDCLoginHandler(c *gin.Context) {
+	provider, ok := oidc.Lookup(c.Param("provider"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown identity provider"})
+		return
+	}
+
+	state, err := utils.NewOAuthState(provider.Name, oauth2.GenerateVerifier())
+	if err != nil {
+		fmt.Printf("Error storing OAuth state: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error starting login"})
+		return
+	}
+
+	authURL, err := provider.AuthCodeURL(c.Request.Context(), state.State, state.Nonce, state.CodeVerifier)
+	if err != nil {
+		fmt.Printf("Error building %s authorization URL: %v\n", provider.Name, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Identity provider unavailable"})
+		return
+	}
+
+	// Bind the attempt to this browser so a callback URL started by someone
+	// else cannot log the browser into their account.
+	setOIDCStateCookie(c, provider.Name, state.State, int(utils.OAuthStateTTL.Seconds()))
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// oidcStateCookie holds the state of the login started in this browser.
+const oidcStateCookie = "oidc_state"
+
+// setOIDCStateCookie sets, or with maxAge -1 clears, the state cookie. It is
+// only sent to the provider's callback path.
+func setOIDCStateCookie(c *gin.Context, provider, state string, maxAge int) {
+	secure := strings.HasPrefix(config.GetEnv("APP_BASE_URL", "http://localhost:8080"), "https://")
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, state, maxAge, "/auth/"+provider, "", secure, true)
+}
+
+// OIDCCallbackHandler completes the login: it validates state, PKCE and nonce,
+// links or creates the account by verified email and issues our own JWT.
+func OIDCCallbackHandler(c *gin.Context) {
+	provider, ok := oidc.Lookup(c.Param("provider"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown identity provider"})
+		return
+	}
+
+	if errCode := c.Query("error"); errCode != "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login was not completed: " + errCode})
+		return
+	}
+	code := c.Query("code")
+	if code == "" || c.Query("state") == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Both code and state are required"})
+		return
+	}
+	cookieState, _ := c.Cookie(oidcStateCookie)
+	setOIDCStateCookie(c, provider.Name, "", -1)
+	if subtle.ConstantTimeCompare([]byte(cookieState), []byte(c.Query("state"))) != 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Login was started in another browser"})
+		return
+	}
+
+	state, err := utils.ConsumeOAuthState(provider.Name, c.Query("state"))
+	if err == utils.ErrInvalidOAuthState {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired login attempt"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error validating login attempt"})
+		return
+	}
+
+	claims, err := provider.Exchange(c.Request.Context(), code, state.CodeVerifier, state.Nonce)
+	if err != nil {
+		fmt.Printf("Error completing %s login: %v\n", provider.Name, err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Could not verify identity"})
+		return
+	}
+
+	username, err := resolveOIDCUser(provider.Name, claims)
+	if err != nil {
+		fmt.Printf("Error linking %s identity: %v\n", provider.Name, err)
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := utils.GetUserByUsername(username)
+	if err != nil || user == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading account"})
+		return
+	}
+
+	// The second factor still applies to accounts that enabled it.
+	if user.TOTPEnabled {
+		challenge, err := utils.GenerateMFAChallengeToken(user.Username)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication required", "mfa_required": true, "mfa_token": challenge})
+		return
+	}
+
+	issueLoginToken(c, user, false)
+}
+
+// resolveOIDCUser returns the account for the identity, linking an existing
+// account with the same verified email or creating a new one.
+func resolveOIDCUser(provider string, claims *oidc.Claims) (string, error) {
+	username, err := utils.GetIdentityUsername(provider, claims.Subject)
+	if err != nil {
+		return "", err
+	}
+	if username != "" {
+		return username, nil
+	}
+
+	email := strings.ToLower(claims.Email)
+	if email == "" || !claims.EmailVerified {
+		return "", fmt.Errorf("identity provider did not supply a verified email address")
+	}
+
+	exists, err := utils.UserExists(email)
+	if err != nil {
+		return "", err
+	}
+	if exists {
+		// The provider proved ownership of the address. An unverified account
+		// loses its password so whoever pre-registered the address is locked out.
+		if err := utils.ClaimAccountForIdentity(email); err != nil {
+			return "", err
+		}
+	} else if err := utils.CreateExternalUser(email); err != nil {
+		return "", err
+	}
+
+	if err := utils.LinkIdentity(provider, claims.Subject, email, email); err != nil {
+		return "", err
+	}
+	return email, nil
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"project/config"
+	"project/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxPreferencesSize caps the stored preferences JSON.
+const maxPreferencesSize = 4096
+
+// GetMeHandler returns the logged-in user's profile.
+func GetMeHandler(c *gin.Context) {
+	profile, err := utils.GetProfile(c.GetString("username"))
+	if err != nil {
+		fmt.Printf("Error loading profile: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading profile"})
+		return
+	}
+	if profile == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Profile not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"profile": profile})
+}
+
+// UpdateMeHandler applies a partial update to the logged-in user's profile.
+// Preferences are merged key by key; a null value removes the key.
+func UpdateMeHandler(c *gin.Context) {
+	var request struct {
+		DisplayName *string                `json:"display_name"`
+		DOB         *string                `json:"dob"`
+		Preferences map[string]interface{} `json:"preferences"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	profile, err := utils.GetProfile(c.GetString("username"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading profile"})
+		return
+	}
+	if profile == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Profile not found"})
+		return
+	}
+
+	if request.DisplayName != nil {
+		name := strings.TrimSpace(*request.DisplayName)
+		if len([]rune(name)) > 100 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "display_name must be at most 100 characters"})
+			return
+		}
+		profile.DisplayName = name
+	}
+
+	if request.DOB != nil {
+		if _, err := utils.ParseDOB(*request.DOB); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		profile.DOB = *request.DOB
+	} else if profile.DOB != "" {
+		// Legacy free-form values are dropped rather than blocking unrelated edits.
+		if _, err := utils.ParseDOB(profile.DOB); err != nil {
+			profile.DOB = ""
+		}
+	}
+
+	for key, value := range request.Preferences {
+		if value == nil {
+			delete(profile.Preferences, key)
+		} else {
+			profile.Preferences[key] = value
+		}
+	}
+	if encoded, _ := json.Marshal(profile.Preferences); len(encoded) > maxPreferencesSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("preferences must be at most %d bytes", maxPreferencesSize)})
+		return
+	}
+
+	if err := utils.SaveProfile(profile); err != nil {
+		fmt.Printf("Error saving profile: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error saving profile"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"profile": profile})
+}
+
+// DeleteMeHandler schedules the logged-in account for deletion after
+// ACCOUNT_DELETION_GRACE_PERIOD (default 30 days).
+func DeleteMeHandler(c *gin.Context) {
+	grace := config.GetEnvDuration("ACCOUNT_DELETION_GRACE_PERIOD", 30*24*time.Hour)
+
+	at, err := utils.ScheduleAccountDeletion(c.GetString("username"), grace)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error scheduling account deletion"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":               "Account scheduled for deletion, restore it before the deadline to keep it",
+		"deletion_scheduled_at": at,
+	})
+}
+
+// RestoreMeHandler cancels a pending account deletion.
+func RestoreMeHandler(c *gin.Context) {
+	if err := utils.CancelAccountDeletion(c.GetString("username")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error restoring account"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Account deletion cancelled"})
+}
+
+// PurgeDeletedAccounts deletes accounts whose grace period has expired.
+func PurgeDeletedAccounts() {
+	count, err := utils.PurgeDeletedAccounts()
+	if err != nil {
+		log.Printf("❌ Error purging deleted accounts: %v", err)
+	}
+	if count > 0 {
+		log.Printf("Purged %d deleted accounts", count)
+	}
+}
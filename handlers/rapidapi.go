@@ -0,0 +1,15 @@
+package handlers
+
+import (
+	"net/http"
+
+	"project/rapidapi"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetRapidAPIStatusHandler serves GET /admin/rapidapi: for each RapidAPI API,
+// whether it has a key, its circuit state and the quotas from its last answer.
+func GetRapidAPIStatusHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"apis": rapidapi.Statuses()})
+}
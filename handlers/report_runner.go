@@ -0,0 +1,294 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"project/config"
+	"project/db"
+	"project/export"
+	"project/mailer"
+	"project/masking"
+	"project/models"
+	"project/utils"
+
+	"github.com/robfig/cron/v3"
+)
+
+// reportScheduleMu serialises changes to report jobs, because gocron's
+// builder methods share state on the scheduler.
+var reportScheduleMu sync.Mutex
+
+// reportWindowPattern matches relative windows such as "last 7 days".
+var reportWindowPattern = regexp.MustCompile(`^last (\d+) (day|week|month)s?$`)
+
+// reportJobTag identifies the scheduler job of a subscription.
+func reportJobTag(id int64) string {
+	return fmt.Sprintf("report-%d", id)
+}
+
+// ScheduleReportSubscriptions registers a job for every enabled subscription.
+// It is called once by StartScheduler; handlers reschedule on every change.
+func ScheduleReportSubscriptions() {
+	subs, err := listReportSubscriptions("")
+	if err != nil {
+		log.Printf("❌ Error loading report subscriptions: %v", err)
+		return
+	}
+	for _, sub := range subs {
+		if err := scheduleReport(sub); err != nil {
+			log.Printf("❌ Error scheduling report %d: %v", sub.ID, err)
+		}
+	}
+}
+
+// scheduleReport replaces the scheduler job of a subscription, or only
+// removes it when the subscription is disabled.
+func scheduleReport(sub models.ReportSubscription) error {
+	reportScheduleMu.Lock()
+	defer reportScheduleMu.Unlock()
+
+	unscheduleReportLocked(sub.ID)
+	if !sub.Enabled {
+		return nil
+	}
+	_, err := scheduler.Cron(sub.Cron).Tag(reportJobTag(sub.ID)).SingletonMode().Do(runScheduledReport, sub.ID)
+	return err
+}
+
+// unscheduleReport removes the scheduler job of a subscription, if any.
+func unscheduleReport(id int64) {
+	reportScheduleMu.Lock()
+	defer reportScheduleMu.Unlock()
+	unscheduleReportLocked(id)
+}
+
+func unscheduleReportLocked(id int64) {
+	// An error only means the subscription had no job.
+	_ = scheduler.RemoveByTag(reportJobTag(id))
+}
+
+// nextReportRun returns when a cron expression fires next.
+func nextReportRun(expr string) (time.Time, error) {
+	schedule, err := cron.ParseStandard(expr)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return schedule.Next(time.Now()), nil
+}
+
+// parseReportWindow resolves a window such as "last 7 days", "yesterday" or
+// "previous month" to an inclusive date range relative to now. "last N ..."
+// windows end yesterday, so a morning report only covers complete days.
+func parseReportWindow(spec string, now time.Time) (time.Time, time.Time, error) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	yesterday := today.AddDate(0, 0, -1)
+
+	spec = strings.Join(strings.Fields(strings.ToLower(spec)), " ")
+	switch spec {
+	case "today":
+		return today, today, nil
+	case "yesterday":
+		return yesterday, yesterday, nil
+	case "previous week":
+		monday := today.AddDate(0, 0, -(int(today.Weekday())+6)%7)
+		return monday.AddDate(0, 0, -7), monday.AddDate(0, 0, -1), nil
+	case "previous month":
+		first := time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, today.Location())
+		return first.AddDate(0, -1, 0), first.AddDate(0, 0, -1), nil
+	case "month to date":
+		return time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, today.Location()), today, nil
+	}
+
+	match := reportWindowPattern.FindStringSubmatch(spec)
+	if match == nil {
+		return time.Time{}, time.Time{}, fmt.Errorf(`window must be "today", "yesterday", "previous week", "previous month", "month to date" or "last N days|weeks|months"`)
+	}
+	n, err := strconv.Atoi(match[1])
+	if err != nil || n < 1 || n > 366 {
+		return time.Time{}, time.Time{}, fmt.Errorf("window length must be between 1 and 366")
+	}
+	switch match[2] {
+	case "day":
+		return today.AddDate(0, 0, -n), yesterday, nil
+	case "week":
+		return today.AddDate(0, 0, -7*n), yesterday, nil
+	default:
+		return today.AddDate(0, -n, 0), yesterday, nil
+	}
+}
+
+// runScheduledReport is the scheduler entry point for a subscription.
+func runScheduledReport(id int64) {
+	sub, err := getReportSubscription(id)
+	if err != nil || sub == nil {
+		log.Printf("❌ Error loading report subscription %d: %v", id, err)
+		return
+	}
+	if _, err := runReport(*sub, models.TriggerSchedule); err != nil {
+		log.Printf("❌ Report %d (%s) failed: %v", sub.ID, sub.Name, err)
+	}
+}
+
+// runReport renders a subscription and emails it to its recipients. Every
+// run is recorded in report_deliveries, whether it succeeds or not.
+func runReport(sub models.ReportSubscription, trigger string) (*models.ReportDelivery, error) {
+	delivery := &models.ReportDelivery{
+		SubscriptionID: sub.ID,
+		Trigger:        trigger,
+		Recipients:     sub.Recipients,
+		StartedAt:      time.Now(),
+	}
+
+	start, end, err := parseReportWindow(sub.Window, delivery.StartedAt)
+	if err == nil {
+		delivery.WindowStart = start.Format(export.DateLayout)
+		delivery.WindowEnd = end.Format(export.DateLayout)
+		err = deliverReport(sub, start, end, delivery)
+	}
+
+	delivery.Status = models.DeliverySent
+	if err != nil {
+		delivery.Status = models.DeliveryFailed
+		delivery.Error = err.Error()
+	}
+	finished := time.Now()
+	delivery.FinishedAt = &finished
+
+	if dbErr := recordReportDelivery(delivery, start, end); dbErr != nil {
+		log.Printf("❌ Error recording delivery of report %d: %v", sub.ID, dbErr)
+	}
+	if _, dbErr := db.DB.Exec("UPDATE report_subscriptions SET last_run_at = ? WHERE id = ?", finished, sub.ID); dbErr != nil {
+		log.Printf("❌ Error updating last run of report %d: %v", sub.ID, dbErr)
+	}
+	return delivery, err
+}
+
+// deliverReport renders the report into memory and sends it as an attachment.
+func deliverReport(sub models.ReportSubscription, start, end time.Time, delivery *models.ReportDelivery) error {
+	// The report goes out under its creator's name, so it stops when they lose export access.
+	owner, err := utils.GetUserByUsername(sub.CreatedBy)
+	if err != nil {
+		return fmt.Errorf("error loading report owner: %v", err)
+	}
+	if owner == nil || !utils.RoleHasPermission(owner.Role, utils.PermExportPersonalData) {
+		return fmt.Errorf("%s is no longer allowed to export personal data", sub.CreatedBy)
+	}
+
+	// Recipients see what the owner would see without unmasking.
+	policy, err := utils.MaskingPolicyFor(owner.Role)
+	if err != nil {
+		return fmt.Errorf("error loading masking policy: %v", err)
+	}
+
+	format := export.Formats[sub.Format]
+	columns, err := export.SelectColumns(sub.Columns)
+	if err != nil {
+		return err
+	}
+	rows, err := QueryUsers(UserQuery{Start: start, End: end, Sort: sub.Sort})
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	window := fmt.Sprintf("%s to %s", start.Format(export.DateLayout), end.Format(export.DateLayout))
+	opts := export.Options{
+		Columns:  columns,
+		Title:    sub.Name,
+		Subtitle: []string{"Registrations from " + window, "Scheduled by " + sub.CreatedBy},
+	}
+	var buf bytes.Buffer
+	source := &countingSource{RowSource: masking.Source(rows, policy)}
+	if err := export.Render(&buf, format.Name, source, opts); err != nil {
+		return err
+	}
+	delivery.RowCount = source.count
+	delivery.FileName = exportFileName(start, end, format.Extension)
+
+	maxSize := config.GetEnvInt("REPORT_MAX_ATTACHMENT_BYTES", 10<<20)
+	if buf.Len() > maxSize {
+		return fmt.Errorf("report is %d bytes, over the %d byte attachment limit; narrow the window or use POST /exports", buf.Len(), maxSize)
+	}
+
+	return mailer.Default().Send(mailer.Message{
+		To:      sub.Recipients,
+		Subject: fmt.Sprintf("%s: %s", sub.Name, window),
+		Text: fmt.Sprintf("Attached is the %q report with %d registrations from %s.\n\n"+
+			"You receive this report because %s subscribed you to it.\n",
+			sub.Name, source.count, window, sub.CreatedBy),
+		Attachments: []mailer.Attachment{{
+			Filename:    delivery.FileName,
+			ContentType: format.ContentType,
+			Data:        buf.Bytes(),
+		}},
+	})
+}
+
+// countingSource counts the rows read from a RowSource.
+type countingSource struct {
+	export.RowSource
+	count int
+}
+
+func (s *countingSource) Next() bool {
+	if !s.RowSource.Next() {
+		return false
+	}
+	s.count++
+	return true
+}
+
+func recordReportDelivery(d *models.ReportDelivery, start, end time.Time) error {
+	query := `INSERT INTO report_deliveries
+		(subscription_id, ` + "`trigger`" + `, status, window_start, window_end, row_count, recipients, file_name, error, started_at, finished_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	res, err := db.DB.Exec(query, d.SubscriptionID, d.Trigger, d.Status, start, end, d.RowCount,
+		strings.Join(d.Recipients, ","), d.FileName, d.Error, d.StartedAt, d.FinishedAt)
+	if err != nil {
+		return err
+	}
+	d.ID, _ = res.LastInsertId()
+	return nil
+}
+
+// listReportDeliveries returns the most recent deliveries of a subscription.
+func listReportDeliveries(subscriptionID int64, limit int) ([]models.ReportDelivery, error) {
+	query := `SELECT id, subscription_id, ` + "`trigger`" + `, status, window_start, window_end, row_count,
+			recipients, file_name, error, started_at, finished_at
+		FROM report_deliveries WHERE subscription_id = ? ORDER BY started_at DESC, id DESC LIMIT ?`
+	rows, err := db.DB.Query(query, subscriptionID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []models.ReportDelivery{}
+	for rows.Next() {
+		var d models.ReportDelivery
+		var start, end time.Time
+		var recipients string
+		var deliveryErr sql.NullString
+		var finished sql.NullTime
+		if err := rows.Scan(&d.ID, &d.SubscriptionID, &d.Trigger, &d.Status, &start, &end, &d.RowCount,
+			&recipients, &d.FileName, &deliveryErr, &d.StartedAt, &finished); err != nil {
+			return nil, err
+		}
+		d.WindowStart = start.Format(export.DateLayout)
+		d.WindowEnd = end.Format(export.DateLayout)
+		d.Recipients = splitList(recipients)
+		d.Error = deliveryErr.String
+		if finished.Valid {
+			d.FinishedAt = &finished.Time
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
@@ -0,0 +1,346 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"project/db"
+	"project/export"
+	"project/models"
+	"project/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// reportRequest is the body of create and update requests for report subscriptions.
+type reportRequest struct {
+	Name       string   `json:"name"`
+	Cron       string   `json:"cron"`
+	Format     string   `json:"format"`
+	Window     string   `json:"window"`
+	Columns    string   `json:"columns"`
+	Sort       string   `json:"sort"`
+	Recipients []string `json:"recipients"`
+	Enabled    *bool    `json:"enabled"`
+}
+
+// toSubscription validates the request and converts it to a subscription.
+func (r reportRequest) toSubscription() (models.ReportSubscription, error) {
+	sub := models.ReportSubscription{
+		Name:    strings.TrimSpace(r.Name),
+		Cron:    strings.TrimSpace(r.Cron),
+		Format:  strings.ToLower(r.Format),
+		Window:  strings.TrimSpace(r.Window),
+		Columns: r.Columns,
+		Sort:    r.Sort,
+		Enabled: r.Enabled == nil || *r.Enabled,
+	}
+
+	if sub.Name == "" {
+		return sub, fmt.Errorf("name is required")
+	}
+	if _, err := nextReportRun(sub.Cron); err != nil {
+		return sub, fmt.Errorf("Invalid cron expression: %v", err)
+	}
+	if _, ok := export.Formats[sub.Format]; !ok {
+		return sub, fmt.Errorf("format must be one of csv, jsonl, xlsx, pdf, parquet")
+	}
+	if _, _, err := parseReportWindow(sub.Window, time.Now()); err != nil {
+		return sub, err
+	}
+	if _, err := export.SelectColumns(sub.Columns); err != nil {
+		return sub, err
+	}
+	if _, err := (UserQuery{Sort: sub.Sort}).orderBy(); err != nil {
+		return sub, err
+	}
+
+	if len(r.Recipients) == 0 {
+		return sub, fmt.Errorf("at least one recipient is required")
+	}
+	for _, recipient := range r.Recipients {
+		recipient = strings.TrimSpace(recipient)
+		if !models.IsValidEmail(recipient) {
+			return sub, fmt.Errorf("Invalid recipient %q", recipient)
+		}
+		sub.Recipients = append(sub.Recipients, recipient)
+	}
+	return sub, nil
+}
+
+// CreateReportSubscriptionHandler creates a recurring report and schedules it.
+func CreateReportSubscriptionHandler(c *gin.Context) {
+	var request reportRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+	sub, err := request.toSubscription()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	sub.CreatedBy = c.GetString("username")
+
+	if err := createReportSubscription(&sub); err != nil {
+		fmt.Printf("Error creating report subscription: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating report subscription"})
+		return
+	}
+	if err := scheduleReport(sub); err != nil {
+		fmt.Printf("Error scheduling report %d: %v\n", sub.ID, err)
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"subscription": withNextRun(sub)})
+}
+
+// ListReportSubscriptionsHandler lists the caller's subscriptions, or all of them for admins.
+func ListReportSubscriptionsHandler(c *gin.Context) {
+	owner := c.GetString("username")
+	if utils.RoleHasPermission(c.GetString("role"), utils.PermAdmin) {
+		owner = ""
+	}
+
+	subs, err := listReportSubscriptions(owner)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing report subscriptions"})
+		return
+	}
+	for i := range subs {
+		subs[i] = withNextRun(subs[i])
+	}
+	c.JSON(http.StatusOK, gin.H{"subscriptions": subs})
+}
+
+// GetReportSubscriptionHandler returns one subscription.
+func GetReportSubscriptionHandler(c *gin.Context) {
+	sub, ok := loadReportSubscription(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"subscription": withNextRun(*sub)})
+}
+
+// UpdateReportSubscriptionHandler replaces a subscription's settings and reschedules it.
+func UpdateReportSubscriptionHandler(c *gin.Context) {
+	existing, ok := loadReportSubscription(c)
+	if !ok {
+		return
+	}
+
+	var request reportRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+	sub, err := request.toSubscription()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	sub.ID = existing.ID
+	sub.CreatedBy = existing.CreatedBy
+	sub.CreatedAt = existing.CreatedAt
+	sub.LastRunAt = existing.LastRunAt
+
+	if err := updateReportSubscription(sub); err != nil {
+		fmt.Printf("Error updating report subscription %d: %v\n", sub.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating report subscription"})
+		return
+	}
+	if err := scheduleReport(sub); err != nil {
+		fmt.Printf("Error scheduling report %d: %v\n", sub.ID, err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"subscription": withNextRun(sub)})
+}
+
+// DeleteReportSubscriptionHandler unschedules a subscription and deletes it with its history.
+func DeleteReportSubscriptionHandler(c *gin.Context) {
+	sub, ok := loadReportSubscription(c)
+	if !ok {
+		return
+	}
+
+	unscheduleReport(sub.ID)
+	if err := deleteReportSubscription(sub.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting report subscription"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Report subscription deleted"})
+}
+
+// RunReportSubscriptionHandler sends a report immediately, outside its schedule.
+func RunReportSubscriptionHandler(c *gin.Context) {
+	sub, ok := loadReportSubscription(c)
+	if !ok {
+		return
+	}
+
+	delivery, err := runReport(*sub, models.TriggerManual)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Report delivery failed", "delivery": delivery})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Report sent", "delivery": delivery})
+}
+
+// ListReportDeliveriesHandler returns the delivery history of a subscription, newest first.
+func ListReportDeliveriesHandler(c *gin.Context) {
+	sub, ok := loadReportSubscription(c)
+	if !ok {
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 || limit > 500 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 500"})
+		return
+	}
+
+	deliveries, err := listReportDeliveries(sub.ID, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing report deliveries"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"deliveries": deliveries})
+}
+
+// loadReportSubscription resolves the :id parameter to a subscription the
+// caller may manage, writing an error response and returning false otherwise.
+func loadReportSubscription(c *gin.Context) (*models.ReportSubscription, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid report subscription id"})
+		return nil, false
+	}
+
+	sub, err := getReportSubscription(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading report subscription"})
+		return nil, false
+	}
+	isAdmin := utils.RoleHasPermission(c.GetString("role"), utils.PermAdmin)
+	if sub == nil || (sub.CreatedBy != c.GetString("username") && !isAdmin) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Report subscription not found"})
+		return nil, false
+	}
+	return sub, true
+}
+
+// withNextRun fills in when an enabled subscription runs next.
+func withNextRun(sub models.ReportSubscription) models.ReportSubscription {
+	if !sub.Enabled {
+		return sub
+	}
+	if next, err := nextReportRun(sub.Cron); err == nil {
+		sub.NextRunAt = &next
+	}
+	return sub
+}
+
+// splitList parses a comma-separated column value.
+func splitList(value string) []string {
+	if value == "" {
+		return []string{}
+	}
+	return strings.Split(value, ",")
+}
+
+func createReportSubscription(sub *models.ReportSubscription) error {
+	query := `INSERT INTO report_subscriptions (name, cron_expr, format, window_spec, columns, sort, recipients, enabled, created_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	res, err := db.DB.Exec(query, sub.Name, sub.Cron, sub.Format, sub.Window, sub.Columns, sub.Sort,
+		strings.Join(sub.Recipients, ","), sub.Enabled, sub.CreatedBy)
+	if err != nil {
+		return err
+	}
+	sub.ID, _ = res.LastInsertId()
+	sub.CreatedAt = time.Now()
+	sub.UpdatedAt = sub.CreatedAt
+	return nil
+}
+
+func updateReportSubscription(sub models.ReportSubscription) error {
+	query := `UPDATE report_subscriptions
+		SET name = ?, cron_expr = ?, format = ?, window_spec = ?, columns = ?, sort = ?, recipients = ?, enabled = ?
+		WHERE id = ?`
+	_, err := db.DB.Exec(query, sub.Name, sub.Cron, sub.Format, sub.Window, sub.Columns, sub.Sort,
+		strings.Join(sub.Recipients, ","), sub.Enabled, sub.ID)
+	return err
+}
+
+func deleteReportSubscription(id int64) error {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM report_deliveries WHERE subscription_id = ?", id); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM report_subscriptions WHERE id = ?", id); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+const reportSubscriptionColumns = "id, name, cron_expr, format, window_spec, columns, sort, recipients, enabled, created_by, created_at, updated_at, last_run_at"
+
+func scanReportSubscription(scanner interface{ Scan(...interface{}) error }) (models.ReportSubscription, error) {
+	var sub models.ReportSubscription
+	var recipients string
+	var lastRun sql.NullTime
+	err := scanner.Scan(&sub.ID, &sub.Name, &sub.Cron, &sub.Format, &sub.Window, &sub.Columns, &sub.Sort,
+		&recipients, &sub.Enabled, &sub.CreatedBy, &sub.CreatedAt, &sub.UpdatedAt, &lastRun)
+	if err != nil {
+		return sub, err
+	}
+	sub.Recipients = splitList(recipients)
+	if lastRun.Valid {
+		sub.LastRunAt = &lastRun.Time
+	}
+	return sub, nil
+}
+
+// getReportSubscription loads a subscription, returning nil if it does not exist.
+func getReportSubscription(id int64) (*models.ReportSubscription, error) {
+	row := db.DB.QueryRow("SELECT "+reportSubscriptionColumns+" FROM report_subscriptions WHERE id = ?", id)
+	sub, err := scanReportSubscription(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &sub, nil
+}
+
+// listReportSubscriptions returns the subscriptions created by owner, or all when owner is empty.
+func listReportSubscriptions(owner string) ([]models.ReportSubscription, error) {
+	query := "SELECT " + reportSubscriptionColumns + " FROM report_subscriptions"
+	var args []interface{}
+	if owner != "" {
+		query += " WHERE created_by = ?"
+		args = append(args, owner)
+	}
+	rows, err := db.DB.Query(query+" ORDER BY id", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subs := []models.ReportSubscription{}
+	for rows.Next() {
+		sub, err := scanReportSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, sub)
+	}
+	return subs, rows.Err()
+}
@@ -1,14 +1,17 @@
 package handlers
 
 import (
+	"fmt"
 	"net/http"
 
+	"project/models"
 	"project/utils"
 
 	"github.com/gin-gonic/gin"
 )
 
-// SignUpHandler registers a new user with Gmail, password, and date of birth.
+// SignUpHandler registers a new, unverified user with Gmail, password, and date
+// of birth, and emails them a verification link.
 func SignUpHandler(c *gin.Context) {
 	var request struct {
 		Username string `json:"username"` // Expected to be a Gmail address.
@@ -22,6 +25,16 @@ func SignUpHandler(c *gin.Context) {
 		return
 	}
 
+	if !models.IsValidEmail(request.Username) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Username must be a valid email address"})
+		return
+	}
+
+	if _, err := utils.ParseDOB(request.DOB); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	// Check if the user already exists.
 	exists, err := utils.UserExists(request.Username)
 	if err != nil {
@@ -46,5 +59,18 @@ func SignUpHandler(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "User created successfully"})
+	// Profile details live apart from the credentials.
+	profile := &models.Profile{Username: request.Username, DOB: request.DOB, Preferences: map[string]interface{}{}}
+	if err := utils.SaveProfile(profile); err != nil {
+		fmt.Printf("Error creating profile: %v\n", err)
+	}
+
+	// The account stays usable even if the mail transport fails; the user can resend.
+	if err := sendVerificationEmail(request.Username); err != nil {
+		fmt.Println(err)
+		c.JSON(http.StatusOK, gin.H{"message": "User created successfully, but the verification email could not be sent"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User created successfully, check your email to verify your account"})
 }
@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"project/db"
+	"project/models"
+	"project/utils"
+	"project/webhooks"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UpdateUserHandler changes a registration at PATCH /users/:id. Only the
+// fields present in the body are changed; the result must still pass
+// validation and keep its registration number unique. Subscribed partners
+// receive a registration.updated webhook.
+func UpdateUserHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user id"})
+		return
+	}
+	var request struct {
+		Name           *string `json:"name"`
+		Email          *string `json:"email"`
+		RegistrationNo *string `json:"registration_no"`
+		PhoneNo        *string `json:"phone_no"`
+		BusinessID     *int64  `json:"business_id"` // 0 removes the user from their business
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	if request.BusinessID != nil && *request.BusinessID != 0 && !checkBusinessExists(c, *request.BusinessID) {
+		return
+	}
+
+	// Mask the response according to the caller's role unless unmask=true is allowed
+	policy, ok := requestMaskingPolicy(c, "users/"+c.Param("id"))
+	if !ok {
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating user"})
+		return
+	}
+	defer tx.Rollback()
+
+	user, err := lockUser(tx, id)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	} else if err != nil {
+		fmt.Printf("Error loading user %d: %v\n", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating user"})
+		return
+	}
+
+	var changed []string
+	apply := func(field string, value *string, target *string) {
+		if value != nil && strings.TrimSpace(*value) != *target {
+			*target = strings.TrimSpace(*value)
+			changed = append(changed, field)
+		}
+	}
+	apply("name", request.Name, &user.Name)
+	apply("email", request.Email, &user.Email)
+	apply("registration_no", request.RegistrationNo, &user.RegistrationNo)
+	apply("phone_no", request.PhoneNo, &user.PhoneNo)
+	if request.BusinessID != nil {
+		var current int64
+		if user.BusinessID != nil {
+			current = *user.BusinessID
+		}
+		if *request.BusinessID != current {
+			user.BusinessID = nil
+			if *request.BusinessID != 0 {
+				user.BusinessID = request.BusinessID
+			}
+			changed = append(changed, "business_id")
+		}
+	}
+	if len(changed) == 0 {
+		c.JSON(http.StatusOK, gin.H{"user": userRecord(*user, policy)})
+		return
+	}
+	if errs := user.Validate(); len(errs) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid registration", "errors": errs})
+		return
+	}
+
+	var taken int
+	err = tx.QueryRow(`SELECT (SELECT COUNT(*) FROM users WHERE registration_no = ? AND id <> ?)
+		+ (SELECT COUNT(*) FROM temp WHERE registration_no = ?)`, user.RegistrationNo, id, user.RegistrationNo).Scan(&taken)
+	if err != nil {
+		fmt.Printf("Error checking registration number: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating user"})
+		return
+	}
+	if taken > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "registration_no is already registered"})
+		return
+	}
+
+	_, err = tx.Exec("UPDATE users SET name = ?, email = ?, registration_no = ?, phone_no = ?, business_id = ? WHERE id = ?",
+		user.Name, user.Email, user.RegistrationNo, user.PhoneNo, user.BusinessID, id)
+	if err != nil {
+		fmt.Printf("Error updating user %d: %v\n", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating user"})
+		return
+	}
+	if err := webhooks.Enqueue(tx, webhooks.RegistrationUpdated(*user)); err != nil {
+		fmt.Printf("Error queueing webhook: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating user"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating user"})
+		return
+	}
+
+	// Record which fields changed, not their values
+	resource := fmt.Sprintf("users/%d", id)
+	if err := utils.RecordAuditEvent(c.GetString("username"), models.AuditRegistrationUpdate, resource, strings.Join(changed, ","), c.ClientIP()); err != nil {
+		fmt.Printf("Error recording registration audit event: %v\n", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user": userRecord(*user, policy)})
+}
+
+// DeleteUserHandler removes a registration at DELETE /users/:id. Subscribed
+// partners receive a registration.deleted webhook carrying only the id.
+func DeleteUserHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user id"})
+		return
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting user"})
+		return
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("DELETE FROM users WHERE id = ?", id)
+	if err != nil {
+		fmt.Printf("Error deleting user %d: %v\n", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting user"})
+		return
+	}
+	if count, _ := res.RowsAffected(); count == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+	if err := webhooks.Enqueue(tx, webhooks.RegistrationDeleted(id)); err != nil {
+		fmt.Printf("Error queueing webhook: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting user"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting user"})
+		return
+	}
+
+	resource := fmt.Sprintf("users/%d", id)
+	if err := utils.RecordAuditEvent(c.GetString("username"), models.AuditRegistrationDelete, resource, "", c.ClientIP()); err != nil {
+		fmt.Printf("Error recording registration audit event: %v\n", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User deleted", "id": id})
+}
+
+// lockUser loads a registration and locks it until tx ends.
+func lockUser(tx *sql.Tx, id int) (*models.User, error) {
+	var u models.User
+	var date string
+	var businessID sql.NullInt64
+	err := tx.QueryRow("SELECT id, name, email, registration_no, phone_no, date, business_id FROM users WHERE id = ? FOR UPDATE", id).
+		Scan(&u.ID, &u.Name, &u.Email, &u.RegistrationNo, &u.PhoneNo, &date, &businessID)
+	if err != nil {
+		return nil, err
+	}
+	if businessID.Valid {
+		u.BusinessID = &businessID.Int64
+	}
+	// Dates are stored as dd/mm/yy strings
+	u.Date, _ = parseDate(date)
+	return &u, nil
+}
@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"project/db"
+	"project/models"
+)
+
+// UserRows is a forward-only cursor over rows of the 'users' table, so exports
+// can stream large result sets without holding them in memory.
+type UserRows struct {
+	rows *sql.Rows
+	user models.User
+	err  error
+}
+
+// UserQuery is the shared filter used by the between-dates endpoint and every export.
+type UserQuery struct {
+	Start          time.Time // with End, both zero for any date
+	End            time.Time
+	Sort           string // comma-separated columns, "-" prefix for descending, e.g. "date,-id"
+	EmailDomain    string // only emails ending in @EmailDomain
+	RegistrationNo string // only this registration
+	BusinessID     int64  // only registrants of this business or its branches
+	Limit          int    // 0 for every match
+}
+
+// where returns the WHERE clause and its arguments.
+func (q UserQuery) where() (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	if !q.Start.IsZero() || !q.End.IsZero() {
+		conditions = append(conditions, "STR_TO_DATE(date, '%d/%m/%y') BETWEEN ? AND ?")
+		args = append(args, q.Start, q.End)
+	}
+	if q.EmailDomain != "" {
+		conditions = append(conditions, "email LIKE ?")
+		args = append(args, "%@"+db.EscapeLike(q.EmailDomain))
+	}
+	if q.RegistrationNo != "" {
+		conditions = append(conditions, "registration_no = ?")
+		args = append(args, q.RegistrationNo)
+	}
+	if q.BusinessID != 0 {
+		conditions = append(conditions, "business_id IN (SELECT id FROM businesses WHERE id = ? OR parent_id = ?)")
+		args = append(args, q.BusinessID, q.BusinessID)
+	}
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// sortExpressions maps sortable columns to SQL; dates are stored as dd/mm/yy text.
+var sortExpressions = map[string]string{
+	"id":              "id",
+	"name":            "name",
+	"email":           "email",
+	"registration_no": "registration_no",
+	"phone_no":        "phone_no",
+	"date":            "STR_TO_DATE(date, '%d/%m/%y')",
+}
+
+// orderBy turns the Sort field into an ORDER BY clause, always ending with id for stable output.
+func (q UserQuery) orderBy() (string, error) {
+	var parts []string
+	hasID := false
+	for _, field := range strings.Split(q.Sort, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		direction := "ASC"
+		if strings.HasPrefix(field, "-") {
+			direction = "DESC"
+			field = field[1:]
+		}
+		expr, ok := sortExpressions[field]
+		if !ok {
+			return "", fmt.Errorf("cannot sort by %q", field)
+		}
+		hasID = hasID || field == "id"
+		parts = append(parts, expr+" "+direction)
+	}
+	if !hasID {
+		parts = append(parts, "id ASC")
+	}
+	return " ORDER BY " + strings.Join(parts, ", "), nil
+}
+
+// QueryUsers opens a cursor over the users matching the query.
+func QueryUsers(q UserQuery) (*UserRows, error) {
+	orderBy, err := q.orderBy()
+	if err != nil {
+		return nil, err
+	}
+
+	where, args := q.where()
+	query := `SELECT id, name, email, registration_no, phone_no, date FROM users` + where + orderBy
+	if q.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, q.Limit)
+	}
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching users: %v", err)
+	}
+	return &UserRows{rows: rows}, nil
+}
+
+// CountUsers returns how many users match the query, for progress reporting.
+func CountUsers(q UserQuery) (int, error) {
+	var count int
+	where, args := q.where()
+	if err := db.DB.QueryRow("SELECT COUNT(*) FROM users"+where, args...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("error counting users: %v", err)
+	}
+	return count, nil
+}
+
+// QueryUsersByDateRange opens a cursor over users whose date falls between start and end.
+func QueryUsersByDateRange(startDate, endDate time.Time) (*UserRows, error) {
+	return QueryUsers(UserQuery{Start: startDate, End: endDate})
+}
+
+// Next advances to the next user, returning false at the end or on error.
+func (r *UserRows) Next() bool {
+	if r.err != nil || !r.rows.Next() {
+		return false
+	}
+
+	var date string
+	var u models.User
+	if err := r.rows.Scan(&u.ID, &u.Name, &u.Email, &u.RegistrationNo, &u.PhoneNo, &date); err != nil {
+		r.err = fmt.Errorf("error scanning user data: %v", err)
+		return false
+	}
+
+	// Dates are stored as dd/mm/yy strings
+	parsed, err := parseDate(date)
+	if err != nil {
+		r.err = fmt.Errorf("error parsing date of user %d: %v", u.ID, err)
+		return false
+	}
+	u.Date = parsed
+	r.user = u
+	return true
+}
+
+// User returns the current row.
+func (r *UserRows) User() models.User {
+	return r.user
+}
+
+// Err returns the first error met while iterating.
+func (r *UserRows) Err() error {
+	if r.err != nil {
+		return r.err
+	}
+	if err := r.rows.Err(); err != nil {
+		return fmt.Errorf("error iterating over rows: %v", err)
+	}
+	return nil
+}
+
+// Close releases the underlying rows.
+func (r *UserRows) Close() error {
+	return r.rows.Close()
+}
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"project/config"
+	"project/mailer"
+	"project/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sendVerificationEmail issues a new verification and mails the link and code to the user.
+func sendVerificationEmail(username string) error {
+	token, code, err := utils.CreateEmailVerification(username)
+	if err != nil {
+		return err
+	}
+
+	baseURL := strings.TrimRight(config.GetEnv("APP_BASE_URL", "http://localhost:8080"), "/")
+	link := fmt.Sprintf("%s/verify-email?token=%s", baseURL, url.QueryEscape(token))
+
+	msg := mailer.Message{
+		To:      []string{username},
+		Subject: "Verify your email address",
+		Text: fmt.Sprintf("Open the link below to verify your email address:\n\n%s\n\n"+
+			"Or enter this code: %s\n\nThe link and code expire in %s.", link, code, utils.VerificationTTL),
+	}
+	if err := mailer.Default().Send(msg); err != nil {
+		return fmt.Errorf("error sending verification email: %v", err)
+	}
+	return nil
+}
+
+// VerifyEmailHandler confirms an email address using either ?token= from the
+// emailed link or ?username=&code= from the emailed code.
+func VerifyEmailHandler(c *gin.Context) {
+	token := c.Query("token")
+	username := c.Query("username")
+	code := c.Query("code")
+
+	var err error
+	switch {
+	case token != "":
+		_, err = utils.ConsumeVerificationToken(token)
+	case username != "" && code != "":
+		err = utils.ConsumeVerificationCode(username, code)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Either token or username and code are required"})
+		return
+	}
+
+	if err == utils.ErrInvalidVerification {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired verification"})
+		return
+	} else if err != nil {
+		fmt.Printf("Error verifying email: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error verifying email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified successfully"})
+}
+
+// ResendVerificationHandler sends a fresh verification email, limited by
+// VERIFICATION_RESEND_INTERVAL between sends and VERIFICATION_MAX_PER_HOUR.
+func ResendVerificationHandler(c *gin.Context) {
+	var request struct {
+		Username string `json:"username"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil || request.Username == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	// The same response is returned whether or not the account exists.
+	accepted := gin.H{"message": "If the account exists and is unverified, a verification email has been sent"}
+
+	user, err := utils.GetUserByUsername(request.Username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error looking up user"})
+		return
+	}
+	if user == nil || user.EmailVerified {
+		c.JSON(http.StatusOK, accepted)
+		return
+	}
+
+	interval := config.GetEnvDuration("VERIFICATION_RESEND_INTERVAL", time.Minute)
+	maxPerHour := config.GetEnvInt("VERIFICATION_MAX_PER_HOUR", 5)
+
+	count, last, err := utils.VerificationStats(user.Username, time.Now().Add(-time.Hour))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking verification history"})
+		return
+	}
+	if count >= maxPerHour || (!last.IsZero() && time.Since(last) < interval) {
+		c.Header("Retry-After", fmt.Sprintf("%d", int(interval.Seconds())))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many verification emails requested, try again later"})
+		return
+	}
+
+	if err := sendVerificationEmail(user.Username); err != nil {
+		fmt.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error sending verification email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, accepted)
+}
@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"project/models"
+	"project/utils"
+	"project/webhooks"
+
+	"github.com/gin-gonic/gin"
+)
+
+// webhookRequest is the body of POST and PUT /admin/webhooks.
+type webhookRequest struct {
+	URL          string   `json:"url"`
+	Events       []string `json:"events"`
+	Description  string   `json:"description"`
+	Enabled      *bool    `json:"enabled"`
+	Secret       string   `json:"secret"`        // create only; generated when empty
+	RotateSecret bool     `json:"rotate_secret"` // update only
+}
+
+// CreateWebhookHandler subscribes a URL to registration events at POST
+// /admin/webhooks. The signing secret is only returned in this response.
+func CreateWebhookHandler(c *gin.Context) {
+	var request webhookRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+	if request.Secret != "" && len(request.Secret) < 16 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "secret must be at least 16 characters"})
+		return
+	}
+
+	sub := models.WebhookSubscription{
+		URL:         request.URL,
+		Events:      request.Events,
+		Description: request.Description,
+		Enabled:     request.Enabled == nil || *request.Enabled,
+		Secret:      request.Secret,
+		CreatedBy:   c.GetString("username"),
+	}
+	if err := webhooks.ValidateSubscription(&sub); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := webhooks.CreateSubscription(&sub); err != nil {
+		fmt.Printf("Error creating webhook: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating webhook"})
+		return
+	}
+	recordWebhookEvent(c, sub.ID, "created")
+
+	c.JSON(http.StatusCreated, gin.H{"webhook": sub})
+}
+
+// ListWebhooksHandler serves GET /admin/webhooks.
+func ListWebhooksHandler(c *gin.Context) {
+	subs, err := webhooks.ListSubscriptions()
+	if err != nil {
+		fmt.Printf("Error listing webhooks: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing webhooks"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"webhooks": subs, "events": models.WebhookEventTypes})
+}
+
+// GetWebhookHandler serves GET /admin/webhooks/:id.
+func GetWebhookHandler(c *gin.Context) {
+	sub, ok := loadWebhook(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"webhook": sub})
+}
+
+// UpdateWebhookHandler replaces the URL, events, description and enabled flag
+// at PUT /admin/webhooks/:id. With rotate_secret the new secret is returned.
+func UpdateWebhookHandler(c *gin.Context) {
+	sub, ok := loadWebhook(c)
+	if !ok {
+		return
+	}
+	var request webhookRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	sub.URL, sub.Events, sub.Description = request.URL, request.Events, request.Description
+	if request.Enabled != nil {
+		sub.Enabled = *request.Enabled
+	}
+	if err := webhooks.ValidateSubscription(sub); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := webhooks.UpdateSubscription(sub, request.RotateSecret); err != nil {
+		fmt.Printf("Error updating webhook %d: %v\n", sub.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating webhook"})
+		return
+	}
+	if request.RotateSecret {
+		recordWebhookEvent(c, sub.ID, "secret rotated")
+	} else {
+		recordWebhookEvent(c, sub.ID, "updated")
+	}
+
+	c.JSON(http.StatusOK, gin.H{"webhook": sub})
+}
+
+// DeleteWebhookHandler removes a subscription at DELETE /admin/webhooks/:id.
+// Its delivery log is kept until it expires.
+func DeleteWebhookHandler(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook id"})
+		return
+	}
+	deleted, err := webhooks.DeleteSubscription(id)
+	if err != nil {
+		fmt.Printf("Error deleting webhook %d: %v\n", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting webhook"})
+		return
+	}
+	if !deleted {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+		return
+	}
+	recordWebhookEvent(c, id, "deleted")
+
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook deleted"})
+}
+
+// ListWebhookDeliveriesHandler serves GET /admin/webhooks/:id/deliveries with
+// optional status and limit (default 100).
+func ListWebhookDeliveriesHandler(c *gin.Context) {
+	sub, ok := loadWebhook(c)
+	if !ok {
+		return
+	}
+	status := c.Query("status")
+	switch status {
+	case "", models.WebhookPending, models.WebhookSending, models.WebhookDelivered, models.WebhookFailed:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be pending, sending, delivered or failed"})
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit < 1 || limit > 1000 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 1000"})
+		return
+	}
+
+	deliveries, err := webhooks.ListDeliveries(sub.ID, status, limit)
+	if err != nil {
+		fmt.Printf("Error listing webhook deliveries: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error listing deliveries"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"deliveries": deliveries})
+}
+
+// GetWebhookDeliveryHandler serves GET /admin/webhook-deliveries/:id with
+// the log of every attempt.
+func GetWebhookDeliveryHandler(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid delivery id"})
+		return
+	}
+	delivery, err := webhooks.GetDelivery(id)
+	if err != nil {
+		fmt.Printf("Error loading webhook delivery %d: %v\n", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading delivery"})
+		return
+	}
+	if delivery == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Delivery not found"})
+		return
+	}
+	attempts, err := webhooks.ListAttempts(id)
+	if err != nil {
+		fmt.Printf("Error loading webhook attempts %d: %v\n", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading delivery"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"delivery": delivery, "attempts": attempts})
+}
+
+// ReplayWebhookDeliveryHandler sends a delivery's event again at POST
+// /admin/webhook-deliveries/:id/replay, as a new delivery with the same event id.
+func ReplayWebhookDeliveryHandler(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid delivery id"})
+		return
+	}
+	if existing, err := webhooks.GetDelivery(id); err != nil {
+		fmt.Printf("Error loading webhook delivery %d: %v\n", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error replaying delivery"})
+		return
+	} else if existing == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Delivery not found"})
+		return
+	}
+
+	delivery, err := webhooks.Replay(id)
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	recordWebhookEvent(c, delivery.SubscriptionID, fmt.Sprintf("replayed delivery %d", id))
+
+	c.JSON(http.StatusAccepted, gin.H{"delivery": delivery})
+}
+
+// loadWebhook finds the subscription named by :id, writing the error response
+// and returning false if it is invalid or missing.
+func loadWebhook(c *gin.Context) (*models.WebhookSubscription, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook id"})
+		return nil, false
+	}
+	sub, err := webhooks.GetSubscription(id)
+	if err != nil {
+		fmt.Printf("Error loading webhook %d: %v\n", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading webhook"})
+		return nil, false
+	}
+	if sub == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+		return nil, false
+	}
+	return sub, true
+}
+
+// recordWebhookEvent audits a change to a subscription; partners receive personal data.
+func recordWebhookEvent(c *gin.Context, id int64, details string) {
+	resource := fmt.Sprintf("webhooks/%d", id)
+	if err := utils.RecordAuditEvent(c.GetString("username"), models.AuditWebhookChange, resource, details, c.ClientIP()); err != nil {
+		fmt.Printf("Error recording webhook audit event: %v\n", err)
+	}
+}
@@ -0,0 +1,221 @@
+package mailer
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"strings"
+	"sync"
+	"time"
+
+	"project/config"
+)
+
+// Message is a single outgoing email.
+type Message struct {
+	From    string
+	To      []string
+	Subject string
+	Text    string
+	HTML    string
+
+	Attachments []Attachment
+}
+
+// Attachment is a file sent along with a message.
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// Mailer delivers messages through a transport such as SMTP or a local file sink.
+type Mailer interface {
+	Send(msg Message) error
+}
+
+var (
+	defaultMailer Mailer
+	defaultOnce   sync.Once
+)
+
+// ErrNotConfigured is returned by Send when MAIL_TRANSPORT is not set outside
+// development.
+var ErrNotConfigured = errors.New("mail is not configured: set MAIL_TRANSPORT to smtp, file or log")
+
+// Default returns the mailer selected by MAIL_TRANSPORT ("smtp", "file" or "log").
+func Default() Mailer {
+	defaultOnce.Do(func() {
+		defaultMailer = FromEnv()
+	})
+	return defaultMailer
+}
+
+// FromEnv builds a mailer from environment variables. Without MAIL_TRANSPORT
+// development uses the log mailer, so it never sends mail; anywhere else, and
+// for unknown transports, every Send fails so no mail is silently dropped.
+func FromEnv() Mailer {
+	if err := CheckConfig(); err != nil {
+		return unconfiguredMailer{err: err}
+	}
+	switch transport() {
+	case "smtp":
+		return SMTPFromEnv()
+	case "file":
+		return &FileMailer{
+			Dir:  config.GetEnv("MAIL_FILE_DIR", "mail"),
+			From: config.GetEnv("MAIL_FROM", "no-reply@localhost"),
+		}
+	default:
+		return &LogMailer{From: config.GetEnv("MAIL_FROM", "no-reply@localhost")}
+	}
+}
+
+// CheckConfig reports a MAIL_TRANSPORT that cannot deliver mail, for main
+// to check at startup.
+func CheckConfig() error {
+	switch t := transport(); t {
+	case "smtp", "file", "log":
+		return nil
+	case "":
+		return ErrNotConfigured
+	default:
+		return fmt.Errorf("unknown MAIL_TRANSPORT %q, expected smtp, file or log", t)
+	}
+}
+
+// transport is the configured MAIL_TRANSPORT, "log" by default in development.
+func transport() string {
+	fallback := ""
+	if config.IsDevelopment() {
+		fallback = "log"
+	}
+	return strings.ToLower(config.GetEnv("MAIL_TRANSPORT", fallback))
+}
+
+// unconfiguredMailer fails every message with the configuration error.
+type unconfiguredMailer struct {
+	err error
+}
+
+// Send returns the configuration error.
+func (m unconfiguredMailer) Send(Message) error {
+	return m.err
+}
+
+// LogMailer logs that a message would have been sent instead of delivering
+// it. Only the subject and the number of recipients are logged: bodies carry
+// verification links and personal data.
+type LogMailer struct {
+	From string
+}
+
+// Send logs the message without its body.
+func (m *LogMailer) Send(msg Message) error {
+	log.Printf("📧 Mail not sent (MAIL_TRANSPORT=log): %q to %d recipient(s), %d attachment(s)",
+		msg.Subject, len(msg.To), len(msg.Attachments))
+	return nil
+}
+
+// Build renders the message as an RFC 5322 document with a MIME body.
+func Build(msg Message) ([]byte, error) {
+	if len(msg.To) == 0 {
+		return nil, fmt.Errorf("message has no recipients")
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", msg.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(msg.To, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+
+	contentType, body, err := renderBody(msg)
+	if err != nil {
+		return nil, err
+	}
+	if len(msg.Attachments) == 0 {
+		fmt.Fprintf(&buf, "Content-Type: %s\r\n\r\n", contentType)
+		buf.Write(body)
+		return buf.Bytes(), nil
+	}
+
+	writer := multipart.NewWriter(&buf)
+	fmt.Fprintf(&buf, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", writer.Boundary())
+	part, err := writer.CreatePart(textproto.MIMEHeader{"Content-Type": {contentType}})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := part.Write(body); err != nil {
+		return nil, err
+	}
+
+	for _, a := range msg.Attachments {
+		attachmentType := a.ContentType
+		if attachmentType == "" {
+			attachmentType = "application/octet-stream"
+		}
+		part, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {attachmentType},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": a.Filename})},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeBase64(part, a.Data); err != nil {
+			return nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// renderBody returns the content type and body of the text, or of the text
+// and HTML alternatives when the message has HTML.
+func renderBody(msg Message) (string, []byte, error) {
+	if msg.HTML == "" {
+		return "text/plain; charset=utf-8", []byte(msg.Text), nil
+	}
+
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	parts := []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", msg.HTML},
+	}
+	for _, p := range parts {
+		part, err := writer.CreatePart(textproto.MIMEHeader{"Content-Type": {p.contentType}})
+		if err != nil {
+			return "", nil, err
+		}
+		if _, err := part.Write([]byte(p.body)); err != nil {
+			return "", nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return "", nil, err
+	}
+	return "multipart/alternative; boundary=" + writer.Boundary(), buf.Bytes(), nil
+}
+
+// writeBase64 encodes data in 76-character lines as required by RFC 2045.
+func writeBase64(w io.Writer, data []byte) error {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 76 {
+		if _, err := io.WriteString(w, encoded[:76]+"\r\n"); err != nil {
+			return err
+		}
+		encoded = encoded[76:]
+	}
+	_, err := io.WriteString(w, encoded+"\r\n")
+	return err
+}
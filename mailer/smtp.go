@@ -0,0 +1,56 @@
+package mailer
+
+import (
+	"fmt"
+	"net"
+	"net/smtp"
+
+	"project/config"
+)
+
+// SMTPMailer delivers messages through an SMTP relay using PLAIN auth.
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// SMTPFromEnv configures the relay from SMTP_HOST, SMTP_PORT, SMTP_USERNAME,
+// SMTP_PASSWORD and MAIL_FROM.
+func SMTPFromEnv() *SMTPMailer {
+	return &SMTPMailer{
+		Host:     config.GetEnv("SMTP_HOST", ""),
+		Port:     config.GetEnv("SMTP_PORT", "587"),
+		Username: config.GetEnv("SMTP_USERNAME", ""),
+		Password: config.GetEnv("SMTP_PASSWORD", ""),
+		From:     config.GetEnv("MAIL_FROM", ""),
+	}
+}
+
+// Send delivers the message through the configured relay.
+func (m *SMTPMailer) Send(msg Message) error {
+	if m.Host == "" {
+		return fmt.Errorf("SMTP_HOST is not set")
+	}
+	if msg.From == "" {
+		msg.From = m.From
+	}
+
+	body, err := Build(msg)
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+
+	addr := net.JoinHostPort(m.Host, m.Port)
+	if err := smtp.SendMail(addr, auth, msg.From, msg.To, body); err != nil {
+		return fmt.Errorf("error sending mail via %s: %v", addr, err)
+	}
+	return nil
+}
@@ -1,10 +1,14 @@
 package main
 
 import (
+	"errors"
 	"log"
+	"project/config"
 	"project/db"
 	"project/handlers"
+	"project/mailer"
 	"project/routes"
+	"project/utils"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -14,16 +18,36 @@ import (
 func main() {
 	// Initialize the database
 	db.InitDB()
+	db.Migrate()
+	if err := utils.EnsureAdmins(); err != nil {
+		log.Printf("Error promoting ADMIN_USERNAMES: %v", err)
+	}
 
 	err := godotenv.Load()
 	if err != nil {
 		log.Fatalf("Error loading .env file")
 	}
 
+	// Read the chatbot API key; warns when RAPIDAPI_CHATBOT_KEY is missing
+	config.LoadConfig()
+
+	// Refuse an unknown mail transport; warn loudly when none is set outside development
+	if err := mailer.CheckConfig(); errors.Is(err, mailer.ErrNotConfigured) {
+		log.Printf("⚠️  WARNING: %v. Verification emails and reports will fail until it is set.", err)
+	} else if err != nil {
+		log.Fatalf("Invalid mail configuration: %v", err)
+	}
+
 	// Retrieve the secret key
 
 	// Start the scheduler for transferring data from temp to users
 	go handlers.StartScheduler() // This will run in the background
+
+	// Start the worker pool for asynchronous exports
+	handlers.StartExportWorkers()
+
+	// Move a token.json from the old command-line Gmail consent into the database
+	handlers.ImportLegacyGmailToken()
 	// Setup Gin router
 	r := routes.SetupRouter()
 
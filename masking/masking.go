@@ -0,0 +1,141 @@
+// Package masking hides parts of personal data according to a per-role
+// policy. The same policy is applied to JSON responses and to every export
+// format, so a field masked in one place is masked everywhere.
+package masking
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"project/models"
+)
+
+// Masking modes for a field.
+const (
+	ModeNone    = "none"    // show the value
+	ModePartial = "partial" // keep enough to recognise it, e.g. j***@gmail.com
+	ModeFull    = "full"    // hide the value entirely
+)
+
+// Fields are the models.User fields a policy can mask.
+var Fields = []string{"name", "email", "phone_no", "registration_no"}
+
+// hidden replaces fully masked values.
+const hidden = "******"
+
+// Policy maps field names to masking modes. Fields that are not listed, and
+// the nil policy, are not masked.
+type Policy map[string]string
+
+// Validate reports unknown fields or modes.
+func (p Policy) Validate() error {
+	for field, mode := range p {
+		if !isField(field) {
+			return fmt.Errorf("unknown field %q, expected one of %s", field, strings.Join(Fields, ", "))
+		}
+		if mode != ModeNone && mode != ModePartial && mode != ModeFull {
+			return fmt.Errorf("invalid mode %q for %s, expected none, partial or full", mode, field)
+		}
+	}
+	return nil
+}
+
+// IsNone reports whether the policy leaves every field visible.
+func (p Policy) IsNone() bool {
+	for _, mode := range p {
+		if mode != ModeNone {
+			return false
+		}
+	}
+	return true
+}
+
+// Apply returns a copy of the user with the policy's fields masked.
+func (p Policy) Apply(u models.User) models.User {
+	if p.IsNone() {
+		return u
+	}
+	u.Name = maskName(u.Name, p["name"])
+	u.Email = maskEmail(u.Email, p["email"])
+	u.PhoneNo = maskPhone(u.PhoneNo, p["phone_no"])
+	u.RegistrationNo = maskTail(u.RegistrationNo, p["registration_no"], 3)
+	return u
+}
+
+func isField(field string) bool {
+	for _, f := range Fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// maskEmail keeps the first letter and the domain: jane@gmail.com becomes j***@gmail.com.
+func maskEmail(value, mode string) string {
+	switch mode {
+	case ModePartial:
+		at := strings.LastIndex(value, "@")
+		if at < 1 {
+			return hidden
+		}
+		first, _ := utf8.DecodeRuneInString(value)
+		return string(first) + "***" + value[at:]
+	case ModeFull:
+		return hidden
+	}
+	return value
+}
+
+// maskPhone keeps the last four digits behind a fixed-width mask that hides
+// the length: +91 98765 43210 becomes ******3210.
+func maskPhone(value, mode string) string {
+	switch mode {
+	case ModePartial:
+		var digits []rune
+		for _, r := range value {
+			if r >= '0' && r <= '9' {
+				digits = append(digits, r)
+			}
+		}
+		if len(digits) <= 4 {
+			return hidden
+		}
+		return hidden + string(digits[len(digits)-4:])
+	case ModeFull:
+		return hidden
+	}
+	return value
+}
+
+// maskName keeps the first letter of every word: Jane Doe becomes J*** D***.
+func maskName(value, mode string) string {
+	switch mode {
+	case ModePartial:
+		words := strings.Fields(value)
+		for i, word := range words {
+			first, _ := utf8.DecodeRuneInString(word)
+			words[i] = string(first) + "***"
+		}
+		return strings.Join(words, " ")
+	case ModeFull:
+		return hidden
+	}
+	return value
+}
+
+// maskTail keeps the last n characters: CS2021-0042 becomes ********042.
+func maskTail(value, mode string, n int) string {
+	switch mode {
+	case ModePartial:
+		runes := []rune(value)
+		if len(runes) <= n {
+			return hidden
+		}
+		return strings.Repeat("*", len(runes)-n) + string(runes[len(runes)-n:])
+	case ModeFull:
+		return hidden
+	}
+	return value
+}
@@ -0,0 +1,29 @@
+package masking
+
+import (
+	"project/export"
+	"project/models"
+)
+
+// maskedSource masks every user read from a row source.
+type maskedSource struct {
+	export.RowSource
+	policy Policy
+}
+
+// Source wraps a row source so every export format sees masked users.
+func Source(src export.RowSource, policy Policy) export.RowSource {
+	if policy.IsNone() {
+		return src
+	}
+	return &maskedSource{RowSource: src, policy: policy}
+}
+
+func (s *maskedSource) User() models.User {
+	return s.policy.Apply(s.RowSource.User())
+}
+
+// Record serializes a user for a JSON response with the policy applied.
+func (p Policy) Record(u models.User) map[string]interface{} {
+	return export.Record(p.Apply(u))
+}
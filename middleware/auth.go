@@ -6,18 +6,43 @@ import (
 	"os"
 	"strings"
 
+	"project/utils"
+
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v4"
 )
 
-// AuthMiddleware ensures that a valid JWT token is provided
+// AuthMiddleware ensures that a valid JWT token or API key is provided
 func AuthMiddleware() gin.HandlerFunc {
+	return authenticate(false)
+}
+
+// RestoreAuthMiddleware is AuthMiddleware that also admits accounts scheduled
+// for deletion, for the endpoint that cancels the deletion.
+func RestoreAuthMiddleware() gin.HandlerFunc {
+	return authenticate(true)
+}
+
+// authenticate builds the authentication middleware. Tokens stay valid until
+// they expire, so the account is loaded on every request: deleted accounts
+// and, unless allowPendingDeletion, accounts scheduled for deletion are
+// refused, and the stored role applies instead of the one in the token.
+func authenticate(allowPendingDeletion bool) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		fmt.Println("Received Headers:")
 		for key, value := range c.Request.Header {
+			if key == "Authorization" || key == "X-Api-Key" {
+				value = []string{"[redacted]"}
+			}
 			fmt.Printf("%s: %s\n", key, value)
 		}
 
+		// Machine clients authenticate with an API key instead of a bearer JWT.
+		if apiKey := apiKeyFromRequest(c); apiKey != "" {
+			authenticateAPIKey(c, apiKey)
+			return
+		}
+
 		authHeader := strings.TrimSpace(c.GetHeader("Authorization"))
 		if authHeader == "" {
 			fmt.Println("Error: Authorization header missing")
@@ -36,8 +61,6 @@ func AuthMiddleware() gin.HandlerFunc {
 		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 		tokenString = strings.Trim(tokenString, "\"")
 
-		fmt.Println("Processed Token:", tokenString)
-
 		secretKey := os.Getenv("JWT_SECRET")
 		if secretKey == "" {
 			fmt.Println("Error: JWT_SECRET is not set in environment variables")
@@ -68,6 +91,14 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		// MFA challenge tokens only unlock the second login step.
+		if purpose, _ := claims["purpose"].(string); purpose != "" {
+			fmt.Println("Error: Token is not an access token")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			c.Abort()
+			return
+		}
+
 		username, exists := claims["username"].(string)
 		if !exists {
 			fmt.Println("Error: Invalid token payload")
@@ -76,8 +107,69 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		user, err := utils.GetUserByUsername(username)
+		if err != nil {
+			fmt.Println("Error: Account lookup failed -", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error validating token"})
+			c.Abort()
+			return
+		}
+		if user == nil {
+			fmt.Println("Error: Token account no longer exists")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			c.Abort()
+			return
+		}
+		if user.DeletionScheduledAt != nil && !allowPendingDeletion {
+			fmt.Println("Error: Account is scheduled for deletion")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Account is scheduled for deletion, restore it to continue"})
+			c.Abort()
+			return
+		}
+
+		// Accounts created before roles existed fall back to the default role.
+		role := user.Role
+		if role == "" {
+			role = utils.DefaultRole
+		}
+		mfa, _ := claims["mfa"].(bool)
+
 		c.Set("username", username)
+		c.Set("role", role)
+		c.Set("mfa", mfa)
 		fmt.Println("User authenticated:", username)
 		c.Next()
 	}
 }
+
+// apiKeyFromRequest returns a key sent as "X-API-Key: <key>" or "Authorization: ApiKey <key>".
+func apiKeyFromRequest(c *gin.Context) string {
+	if key := strings.TrimSpace(c.GetHeader("X-API-Key")); key != "" {
+		return key
+	}
+	if authHeader := strings.TrimSpace(c.GetHeader("Authorization")); strings.HasPrefix(authHeader, "ApiKey ") {
+		return strings.TrimSpace(strings.TrimPrefix(authHeader, "ApiKey "))
+	}
+	return ""
+}
+
+// authenticateAPIKey validates the key and exposes its scopes to RequirePermission.
+func authenticateAPIKey(c *gin.Context, plain string) {
+	key, err := utils.AuthenticateAPIKey(plain)
+	if err == utils.ErrInvalidAPIKey {
+		fmt.Println("Error: Invalid API key")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired API key"})
+		c.Abort()
+		return
+	} else if err != nil {
+		fmt.Println("Error: API key lookup failed -", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error validating API key"})
+		c.Abort()
+		return
+	}
+
+	// Names are labels and may repeat; the prefix identifies the key in audit records.
+	c.Set("username", "apikey:"+key.Prefix)
+	c.Set("api_key", key)
+	c.Next()
+}
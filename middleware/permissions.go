@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"project/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequirePermission allows the request only if the authenticated role grants
+// the permission. It must run after AuthMiddleware. Access to personal data
+// and to the admin routes additionally requires a two-factor session when the
+// admin policy says so.
+// API keys are checked against their scopes instead.
+func RequirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if value, ok := c.Get("api_key"); ok {
+			if key, _ := value.(*utils.APIKey); key == nil || !key.HasScope(permission) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "API key is missing the required scope"})
+				c.Abort()
+				return
+			}
+			c.Next()
+			return
+		}
+
+		role := c.GetString("role")
+		if !utils.RoleHasPermission(role, permission) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+			c.Abort()
+			return
+		}
+
+		if mfaPermissions[permission] && !CheckMFASession(c) {
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// mfaPermissions are the permissions that fall under the two-factor policy.
+var mfaPermissions = map[string]bool{
+	utils.PermExportPersonalData: true,
+	utils.PermAdmin:              true,
+}
+
+// CheckMFASession writes the error response and returns false if the policy
+// requires two-factor authentication for the role and the session was
+// signed in without it. Handlers serving personal data outside
+// RequirePermission(PermExportPersonalData) call it directly. API keys have
+// no second factor and are limited by their scopes instead.
+func CheckMFASession(c *gin.Context) bool {
+	if _, ok := c.Get("api_key"); ok {
+		return true
+	}
+	required, err := utils.RoleRequiresMFA(c.GetString("role"))
+	if err != nil {
+		fmt.Printf("Error loading MFA policy: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error loading security policy"})
+		return false
+	}
+	if required && !c.GetBool("mfa") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Two-factor authentication required", "mfa_required": true})
+		return false
+	}
+	return true
+}
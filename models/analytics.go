@@ -0,0 +1,28 @@
+package models
+
+// RegistrationAnalytics aggregates the users table over a date range.
+type RegistrationAnalytics struct {
+	StartDate            string            `json:"start_date"` // dd/mm/yy
+	EndDate              string            `json:"end_date"`   // dd/mm/yy
+	Interval             string            `json:"interval"`   // day, week or month
+	Total                int               `json:"total"`      // registrations in the range
+	Baseline             int               `json:"baseline"`   // registrations before the range
+	Buckets              []AnalyticsBucket `json:"buckets"`
+	EmailDomains         []AnalyticsCount  `json:"email_domains"`
+	RegistrationPrefixes []AnalyticsCount  `json:"registration_prefixes"`
+}
+
+// AnalyticsBucket is the number of registrations in one day, week or month.
+type AnalyticsBucket struct {
+	Start      string `json:"start"` // dd/mm/yy, the first day of the bucket
+	Label      string `json:"label"`
+	Count      int    `json:"count"`
+	Cumulative int    `json:"cumulative"` // all registrations up to the end of the bucket
+}
+
+// AnalyticsCount is the number of registrations sharing a key, such as an
+// email domain. The key "other" sums everything outside the top entries.
+type AnalyticsCount struct {
+	Key   string `json:"key"`
+	Count int    `json:"count"`
+}
@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// Audit actions.
+const (
+	AuditUnmaskPersonalData = "personal_data.unmask"
+	AuditMaskingPolicy      = "masking_policy.update"
+	AuditSubjectExport      = "personal_data.subject_export"
+	AuditSubjectErase       = "personal_data.erase"
+	AuditRegistrationsPurge = "registrations.purge"
+	AuditGmailConnect       = "gmail.connect"
+	AuditGmailDisconnect    = "gmail.disconnect"
+	AuditRegistrationUpdate = "registration.update"
+	AuditRegistrationDelete = "registration.delete"
+	AuditWebhookChange      = "webhook.change"
+	AuditAssistantQuery     = "assistant.query"
+	AuditBusinessChange     = "business.change"
+)
+
+// AuditEvent records a sensitive action in the audit_events table.
+type AuditEvent struct {
+	ID        int64     `json:"id"`
+	Actor     string    `json:"actor"`
+	Action    string    `json:"action"`
+	Resource  string    `json:"resource"`
+	Details   string    `json:"details,omitempty"`
+	IP        string    `json:"ip,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
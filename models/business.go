@@ -0,0 +1,34 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Business is an organisation registrants can belong to. A business with a
+// ParentID is a branch of that business; branches do not have branches.
+type Business struct {
+	ID              int64      `json:"id"`
+	Name            string     `json:"name"`
+	ParentID        *int64     `json:"parent_id,omitempty"`
+	MapsBusinessID  string     `json:"maps_business_id,omitempty"` // id in the maps API, such as 0x47e6...:0x8ddc...
+	Address         string     `json:"address,omitempty"`
+	Phone           string     `json:"phone,omitempty"`
+	Website         string     `json:"website,omitempty"`
+	PhotosFetchedAt *time.Time `json:"photos_fetched_at,omitempty"`
+	CreatedBy       string     `json:"created_by"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// BusinessPhoto is the metadata of a photo from the maps API, kept so the
+// photos of a directory business are served without calling the API.
+type BusinessPhoto struct {
+	ID         int64           `json:"id"`
+	BusinessID int64           `json:"business_id"`
+	PhotoID    string          `json:"photo_id,omitempty"`
+	URL        string          `json:"url"`
+	LargeURL   string          `json:"large_url,omitempty"`
+	TakenAt    *time.Time      `json:"taken_at,omitempty"`
+	Metadata   json.RawMessage `json:"metadata,omitempty"` // the photo as the API described it
+}
@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// Chat message roles.
+const (
+	ChatRoleUser      = "user"
+	ChatRoleAssistant = "assistant"
+	ChatRoleTool      = "tool" // query results given to the provider, not stored
+)
+
+// ChatConversation is one thread of messages between a user and the chatbot.
+type ChatConversation struct {
+	ID        int64     `json:"id"`
+	Username  string    `json:"-"`
+	Title     string    `json:"title"` // the start of the first message
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ChatMessage is a message in a conversation. Provider names the chatbot
+// backend that wrote an assistant message, and ToolCalls the queries its
+// answer was based on.
+type ChatMessage struct {
+	ID             int64          `json:"id"`
+	ConversationID int64          `json:"conversation_id"`
+	Role           string         `json:"role"`
+	Content        string         `json:"content"`
+	Provider       string         `json:"provider,omitempty"`
+	ToolCalls      []ChatToolCall `json:"tool_calls,omitempty"`
+	CreatedAt      time.Time      `json:"created_at"`
+}
+
+// ChatToolCall records a query the assistant ran. The rows it returned are
+// not kept, so chat history holds no copies of registrations.
+type ChatToolCall struct {
+	Tool      string            `json:"tool"`
+	Arguments map[string]string `json:"arguments,omitempty"`
+	Count     int               `json:"count"`
+	Error     string            `json:"error,omitempty"`
+}
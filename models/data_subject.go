@@ -0,0 +1,72 @@
+package models
+
+import (
+	"strconv"
+	"time"
+)
+
+// Erasure modes.
+const (
+	ErasureDelete    = "delete"    // remove the subject's rows
+	ErasureAnonymize = "anonymize" // keep registrations for statistics, without personal data
+)
+
+// DataSubject identifies a person by email, phone number or both.
+type DataSubject struct {
+	Email string `json:"email,omitempty"`
+	Phone string `json:"phone,omitempty"`
+}
+
+// SubjectIdentity is an external sign-in linked to the subject's account.
+type SubjectIdentity struct {
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"subject"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SubjectSubscription is a report subscription the subject owns or receives.
+type SubjectSubscription struct {
+	ID       int64  `json:"id"`
+	Name     string `json:"name"`
+	Relation string `json:"relation"` // owner or recipient
+}
+
+// DataSubjectReport is everything held about a data subject, as returned by
+// an access request.
+type DataSubjectReport struct {
+	Subject              DataSubject              `json:"subject"`
+	GeneratedAt          time.Time                `json:"generated_at"`
+	Registrations        []map[string]interface{} `json:"registrations"`
+	PendingRegistrations []map[string]interface{} `json:"pending_registrations"`
+	Account              *Profile                 `json:"account,omitempty"`
+	Identities           []SubjectIdentity        `json:"identities"`
+	ReportSubscriptions  []SubjectSubscription    `json:"report_subscriptions"`
+	AuditEvents          []AuditEvent             `json:"audit_events"`
+	ChatConversations    []SubjectConversation    `json:"chat_conversations"`
+}
+
+// SubjectConversation is a chatbot conversation of the subject's account with its messages.
+type SubjectConversation struct {
+	ChatConversation
+	Messages []ChatMessage `json:"messages"`
+}
+
+// ErasureTombstone records that a subject was erased without keeping their
+// personal data: identifiers are stored as keyed hashes, so a later request
+// can be checked against it but the subject cannot be recovered from it.
+type ErasureTombstone struct {
+	ID          int64            `json:"id"`
+	EmailHash   string           `json:"email_hash,omitempty"`
+	PhoneHash   string           `json:"phone_hash,omitempty"`
+	Mode        string           `json:"mode"`
+	Counts      map[string]int64 `json:"counts"` // affected rows per table
+	Reason      string           `json:"reason"`
+	RequestedBy string           `json:"requested_by"`
+	CreatedAt   time.Time        `json:"created_at"`
+}
+
+// Reference is the pseudonym that replaces the erased account in audit records.
+func (t ErasureTombstone) Reference() string {
+	return "erased:" + strconv.FormatInt(t.ID, 10)
+}
@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+// Export job states.
+const (
+	ExportQueued  = "queued"
+	ExportRunning = "running"
+	ExportDone    = "done"
+	ExportFailed  = "failed"
+	ExportExpired = "expired"
+)
+
+// ExportParams are the filters of an export job, as accepted by GET /exports/users.
+type ExportParams struct {
+	StartDate string `json:"start_date"` // dd/mm/yy
+	EndDate   string `json:"end_date"`   // dd/mm/yy
+	Columns   string `json:"columns,omitempty"`
+	Sort      string `json:"sort,omitempty"`
+	Template  string `json:"template,omitempty"`
+
+	// BusinessID limits the export to a business and its branches.
+	BusinessID int64 `json:"business_id,omitempty"`
+
+	// Masking is the field masking policy resolved when the job was created,
+	// so the export matches what the requester could see. Empty is unmasked.
+	Masking map[string]string `json:"masking,omitempty"`
+}
+
+// ExportJob is an asynchronous export tracked in the export_jobs table.
+type ExportJob struct {
+	ID            string       `json:"id"`
+	Status        string       `json:"status"`
+	Format        string       `json:"format"`
+	Params        ExportParams `json:"params"`
+	TotalRows     int          `json:"total_rows"`
+	ProcessedRows int          `json:"processed_rows"`
+	FileName      string       `json:"file_name,omitempty"`
+	StorageKey    string       `json:"-"`
+	Error         string       `json:"error,omitempty"`
+	RequestedBy   string       `json:"requested_by"`
+	CreatedAt     time.Time    `json:"created_at"`
+	FinishedAt    *time.Time   `json:"finished_at,omitempty"`
+	ExpiresAt     *time.Time   `json:"expires_at,omitempty"`
+}
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// ExportTemplate is an admin-managed report layout, selected with ?template=<name>.
+type ExportTemplate struct {
+	ID          int64             `json:"id"`
+	Name        string            `json:"name"`
+	Title       string            `json:"title"`
+	Columns     string            `json:"columns"`     // comma-separated column keys, empty for all
+	Labels      map[string]string `json:"labels"`      // column key to header label
+	Sort        string            `json:"sort"`        // e.g. "date,-id"
+	HeaderText  string            `json:"header_text"` // top of every page
+	FooterText  string            `json:"footer_text"` // bottom of every page
+	Orientation string            `json:"orientation"` // "L" or "P"
+	Font        string            `json:"font"`        // helvetica, times or courier
+	FontSize    float64           `json:"font_size"`   // 0 for the default
+	HasLogo     bool              `json:"has_logo"`
+	Logo        []byte            `json:"-"`
+	LogoType    string            `json:"-"` // PNG or JPG
+	UpdatedBy   string            `json:"updated_by"`
+	CreatedAt   time.Time         `json:"created_at"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+}
@@ -0,0 +1,56 @@
+package models
+
+import "time"
+
+// GmailAccount is a mailbox the server may read, connected through the
+// OAuth consent flow. The token itself is stored encrypted and never returned.
+type GmailAccount struct {
+	Account         string     `json:"account"` // the mailbox address
+	Scopes          []string   `json:"scopes"`
+	ConnectedBy     string     `json:"connected_by"`
+	TokenExpiry     *time.Time `json:"token_expiry,omitempty"`
+	LastRefreshedAt *time.Time `json:"last_refreshed_at,omitempty"`
+	LastError       string     `json:"last_error,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// Outcomes of an ingested message.
+const (
+	GmailMessageImported  = "imported"  // at least one registration was written to temp
+	GmailMessageRejected  = "rejected"  // nothing usable: no template matched or every row was invalid
+	GmailMessageDuplicate = "duplicate" // another copy with the same Message-ID was already ingested
+)
+
+// GmailTemplate extracts one registration from an email body. Each field is a
+// regular expression whose first capture group is the value; the template
+// applies to messages whose subject matches SubjectPattern (empty for all).
+type GmailTemplate struct {
+	Name           string            `json:"name"`
+	SubjectPattern string            `json:"subject_pattern"`
+	Fields         map[string]string `json:"fields"`
+}
+
+// GmailSyncState is how far ingestion has read a mailbox label.
+type GmailSyncState struct {
+	Account      string     `json:"account"`
+	Label        string     `json:"label"`
+	LabelID      string     `json:"label_id"`
+	HistoryID    uint64     `json:"history_id"`
+	LastSyncedAt *time.Time `json:"last_synced_at,omitempty"`
+	LastError    string     `json:"last_error,omitempty"`
+}
+
+// GmailMessage records an ingested message so it is never processed twice.
+// Subjects and senders are not kept, they usually name the registrant.
+type GmailMessage struct {
+	Account      string    `json:"account"`
+	ID           string    `json:"id"`         // Gmail message id
+	MessageID    string    `json:"message_id"` // RFC 5322 Message-ID header
+	Status       string    `json:"status"`
+	Source       string    `json:"source"` // template name or attachment file name
+	ImportedRows int       `json:"imported_rows"`
+	ErrorRows    int       `json:"error_rows"`
+	Error        string    `json:"error,omitempty"`
+	ProcessedAt  time.Time `json:"processed_at"`
+}
@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// Import outcomes.
+const (
+	ImportValidated = "validated" // dry run, nothing written
+	ImportCommitted = "committed" // rows written to temp
+	ImportRejected  = "rejected"  // invalid rows and skip_invalid not set, nothing written
+)
+
+// Import is one uploaded spreadsheet of registrations, tracked in the imports table.
+type Import struct {
+	ID                   string     `json:"id"`
+	FileName             string     `json:"file_name"`
+	Status               string     `json:"status"`
+	DryRun               bool       `json:"dry_run"`
+	TotalRows            int        `json:"total_rows"`
+	ValidRows            int        `json:"valid_rows"`
+	ErrorRows            int        `json:"error_rows"`
+	ImportedRows         int        `json:"imported_rows"`
+	ErrorReportKey       string     `json:"-"`
+	ErrorReportExpiresAt *time.Time `json:"error_report_expires_at,omitempty"` // then CleanupExpiredExports deletes the report
+	CreatedBy            string     `json:"created_by"`
+	CreatedAt            time.Time  `json:"created_at"`
+}
+
+// ImportRowError is a validation error on one spreadsheet row. Row numbers
+// count the header as row 1, matching what spreadsheet users see. File names
+// the attachment when one email carries several spreadsheets.
+type ImportRowError struct {
+	File string `json:"file,omitempty"`
+	Row  int    `json:"row"`
+	FieldError
+}
@@ -10,4 +10,5 @@ type User struct {
 	RegistrationNo string    `json:"registration_no"`
 	PhoneNo        string    `json:"phone_no"`
 	Date           time.Time `json:"date"`
+	BusinessID     *int64    `json:"business_id,omitempty"` // the business or branch the registrant belongs to
 }
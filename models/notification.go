@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// Notification outbox states.
+const (
+	NotificationPending = "pending"
+	NotificationSending = "sending" // claimed by a dispatcher until its lease ends
+	NotificationSent    = "sent"
+	NotificationFailed  = "failed" // gave up after NOTIFY_MAX_ATTEMPTS
+)
+
+// Notification is one rendered message waiting in, or delivered from, the
+// notification_outbox table. It is written in the same transaction as the
+// change it reports, so it is delivered at least once.
+type Notification struct {
+	ID            int64      `json:"id"`
+	Event         string     `json:"event"`
+	Channel       string     `json:"channel"`
+	Recipient     string     `json:"recipient"` // an email address, or the URL for webhooks
+	Subject       string     `json:"subject"`
+	Text          string     `json:"text,omitempty"`
+	HTML          string     `json:"html,omitempty"`
+	Payload       string     `json:"payload,omitempty"` // JSON body for webhooks
+	Status        string     `json:"status"`
+	Attempts      int        `json:"attempts"`
+	NextAttemptAt time.Time  `json:"next_attempt_at"`
+	LastError     string     `json:"last_error,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	SentAt        *time.Time `json:"sent_at,omitempty"`
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// Profile holds the editable, non-credential details of a signupusers account.
+type Profile struct {
+	Username            string                 `json:"username"`
+	DisplayName         string                 `json:"display_name"`
+	DOB                 string                 `json:"dob"` // YYYY-MM-DD
+	Preferences         map[string]interface{} `json:"preferences"`
+	Role                string                 `json:"role"`
+	EmailVerified       bool                   `json:"email_verified"`
+	TOTPEnabled         bool                   `json:"totp_enabled"`
+	DeletionScheduledAt *time.Time             `json:"deletion_scheduled_at,omitempty"`
+}
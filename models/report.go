@@ -0,0 +1,46 @@
+package models
+
+import "time"
+
+// Report delivery states and triggers.
+const (
+	DeliverySent   = "sent"
+	DeliveryFailed = "failed"
+
+	TriggerSchedule = "schedule"
+	TriggerManual   = "manual"
+)
+
+// ReportSubscription is a recurring report emailed to a list of recipients.
+type ReportSubscription struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	Cron       string     `json:"cron"`   // standard 5-field cron expression, e.g. "0 8 * * MON"
+	Format     string     `json:"format"` // csv, jsonl, xlsx, pdf or parquet
+	Window     string     `json:"window"` // e.g. "last 7 days", "previous month"
+	Columns    string     `json:"columns,omitempty"`
+	Sort       string     `json:"sort,omitempty"`
+	Recipients []string   `json:"recipients"`
+	Enabled    bool       `json:"enabled"`
+	CreatedBy  string     `json:"created_by"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	LastRunAt  *time.Time `json:"last_run_at,omitempty"`
+	NextRunAt  *time.Time `json:"next_run_at,omitempty"`
+}
+
+// ReportDelivery records one run of a subscription.
+type ReportDelivery struct {
+	ID             int64      `json:"id"`
+	SubscriptionID int64      `json:"subscription_id"`
+	Trigger        string     `json:"trigger"`
+	Status         string     `json:"status"`
+	WindowStart    string     `json:"window_start"` // dd/mm/yy
+	WindowEnd      string     `json:"window_end"`   // dd/mm/yy
+	RowCount       int        `json:"row_count"`
+	Recipients     []string   `json:"recipients"`
+	FileName       string     `json:"file_name,omitempty"`
+	Error          string     `json:"error,omitempty"`
+	StartedAt      time.Time  `json:"started_at"`
+	FinishedAt     *time.Time `json:"finished_at,omitempty"`
+}
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"net/mail"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// FieldError describes why one field of a record is invalid.
+type FieldError struct {
+	Field   string `json:"field"`
+	Value   string `json:"value"`
+	Message string `json:"message"`
+}
+
+// phonePattern accepts digits with an optional leading + and common separators.
+var phonePattern = regexp.MustCompile(`^\+?[0-9 ()\-.]+$`)
+
+// IsValidEmail reports whether value is a bare address such as jane@example.com.
+func IsValidEmail(value string) bool {
+	addr, err := mail.ParseAddress(value)
+	return err == nil && addr.Address == value && strings.Contains(value[strings.LastIndex(value, "@"):], ".")
+}
+
+// Validate checks the fields a registration needs before it is written to
+// the temp table, returning one error per invalid field. The limits mirror
+// the column sizes of the temp and users tables.
+func (u User) Validate() []FieldError {
+	var errs []FieldError
+	check := func(field, value string, ok bool, message string) {
+		if !ok {
+			errs = append(errs, FieldError{Field: field, Value: value, Message: message})
+		}
+	}
+
+	check("name", u.Name, strings.TrimSpace(u.Name) != "", "name is required")
+	check("name", u.Name, utf8.RuneCountInString(u.Name) <= 255, "name must be at most 255 characters")
+
+	check("email", u.Email, IsValidEmail(u.Email), "email must be a valid address")
+	check("email", u.Email, len(u.Email) <= 255, "email must be at most 255 characters")
+
+	check("registration_no", u.RegistrationNo, strings.TrimSpace(u.RegistrationNo) != "", "registration_no is required")
+	check("registration_no", u.RegistrationNo, len(u.RegistrationNo) <= 100, "registration_no must be at most 100 characters")
+
+	digits := 0
+	for _, r := range u.PhoneNo {
+		if r >= '0' && r <= '9' {
+			digits++
+		}
+	}
+	check("phone_no", u.PhoneNo, phonePattern.MatchString(u.PhoneNo) && digits >= 7 && digits <= 15,
+		"phone_no must contain 7 to 15 digits")
+
+	return errs
+}
@@ -0,0 +1,72 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Webhook event types.
+const (
+	WebhookRegistrationCreated = "registration.created" // moved from temp into users
+	WebhookRegistrationUpdated = "registration.updated"
+	WebhookRegistrationDeleted = "registration.deleted" // deleted, erased or anonymized; carries only the id
+)
+
+// WebhookEventTypes lists the events a subscription may select.
+var WebhookEventTypes = []string{WebhookRegistrationCreated, WebhookRegistrationUpdated, WebhookRegistrationDeleted}
+
+// Webhook delivery states.
+const (
+	WebhookPending   = "pending"
+	WebhookSending   = "sending" // claimed by a dispatcher until its lease ends
+	WebhookDelivered = "delivered"
+	WebhookFailed    = "failed" // gave up after WEBHOOK_MAX_ATTEMPTS, or the subscription is gone
+)
+
+// WebhookSubscription is a partner endpoint receiving signed events.
+type WebhookSubscription struct {
+	ID          int64     `json:"id"`
+	URL         string    `json:"url"`
+	Events      []string  `json:"events"`
+	Description string    `json:"description,omitempty"`
+	Enabled     bool      `json:"enabled"`
+	Secret      string    `json:"secret,omitempty"` // only returned when created or rotated
+	CreatedBy   string    `json:"created_by"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// WebhookEvent is an event recorded in the outbox in the same transaction
+// as the change it describes.
+type WebhookEvent struct {
+	ID        int64           `json:"id"`
+	Type      string          `json:"type"`
+	Data      json.RawMessage `json:"data"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// WebhookDelivery is one event to send to one subscription.
+type WebhookDelivery struct {
+	ID             int64      `json:"id"`
+	SubscriptionID int64      `json:"subscription_id"`
+	EventID        int64      `json:"event_id"`
+	EventType      string     `json:"event_type"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  time.Time  `json:"next_attempt_at"`
+	LastStatusCode int        `json:"last_status_code,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+	ReplayOf       *int64     `json:"replay_of,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+}
+
+// WebhookAttempt logs one HTTP request of a delivery.
+type WebhookAttempt struct {
+	Attempt      int       `json:"attempt"`
+	StatusCode   int       `json:"status_code,omitempty"`
+	Error        string    `json:"error,omitempty"`
+	ResponseBody string    `json:"response_body,omitempty"` // the first KiB
+	DurationMS   int64     `json:"duration_ms"`
+	CreatedAt    time.Time `json:"created_at"`
+}
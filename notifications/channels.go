@@ -0,0 +1,126 @@
+package notifications
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"project/config"
+	"project/mailer"
+	"project/models"
+	"project/outbound"
+	"project/utils"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+// MailChannel sends notifications as email through a mailer, SMTP by default.
+type MailChannel struct {
+	Mailer mailer.Mailer
+}
+
+// Send mails the notification to its recipient.
+func (ch *MailChannel) Send(ctx context.Context, n models.Notification) error {
+	return ch.Mailer.Send(mailMessage(n, ""))
+}
+
+// GmailChannel sends notifications from a mailbox connected through
+// /admin/gmail/connect (NOTIFY_GMAIL_ACCOUNT), using the Gmail API.
+type GmailChannel struct {
+	Account string
+}
+
+// Send submits the notification as a raw message of the mailbox.
+func (ch *GmailChannel) Send(ctx context.Context, n models.Notification) error {
+	if ch.Account == "" {
+		return fmt.Errorf("NOTIFY_GMAIL_ACCOUNT is not set")
+	}
+	srv, err := utils.GmailService(ctx, ch.Account)
+	if err != nil {
+		return err
+	}
+	raw, err := mailer.Build(mailMessage(n, ch.Account))
+	if err != nil {
+		return err
+	}
+	_, err = srv.Users.Messages.Send("me", &gmail.Message{Raw: base64.URLEncoding.EncodeToString(raw)}).Context(ctx).Do()
+	if err != nil {
+		return fmt.Errorf("error sending via Gmail: %v", err)
+	}
+	return nil
+}
+
+// mailMessage converts a notification into an email.
+func mailMessage(n models.Notification, from string) mailer.Message {
+	return mailer.Message{From: from, To: []string{n.Recipient}, Subject: n.Subject, Text: n.Text, HTML: n.HTML}
+}
+
+// WebhookChannel posts the JSON payload of a notification to its recipient URL.
+type WebhookChannel struct {
+	Client *http.Client
+}
+
+// newWebhookChannel applies NOTIFY_WEBHOOK_TIMEOUT (default 10s) and, when
+// set, the NOTIFY_WEBHOOK_ALLOWED_HOSTS allow-list. Private addresses are
+// refused like for every outbound call.
+func newWebhookChannel() *WebhookChannel {
+	return &WebhookChannel{Client: outbound.New(outbound.Options{
+		Name:             "notifications",
+		Timeout:          config.GetEnvDuration("NOTIFY_WEBHOOK_TIMEOUT", 10*time.Second),
+		MaxResponseBytes: 1 << 20,
+		AllowedHosts:     config.GetEnvList("NOTIFY_WEBHOOK_ALLOWED_HOSTS"),
+	})}
+}
+
+// Send posts the payload and expects a 2xx answer. The notification id is
+// sent along so receivers can drop repeated deliveries.
+func (ch *WebhookChannel) Send(ctx context.Context, n models.Notification) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.Recipient, bytes.NewReader([]byte(n.Payload)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Notification-Event", n.Event)
+	req.Header.Set("X-Notification-Id", strconv.FormatInt(n.ID, 10))
+
+	resp, err := ch.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error posting webhook: %v", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return nil
+}
+
+// FileChannel writes each notification as <id>.json in Dir, for local
+// development and tests. Repeated deliveries overwrite the same file.
+type FileChannel struct {
+	Dir string
+}
+
+// Send writes the notification file.
+func (ch *FileChannel) Send(ctx context.Context, n models.Notification) error {
+	if err := os.MkdirAll(ch.Dir, 0o755); err != nil {
+		return fmt.Errorf("error creating notification directory: %v", err)
+	}
+	body, err := json.MarshalIndent(n, "", "  ")
+	if err != nil {
+		return err
+	}
+	name := filepath.Join(ch.Dir, strconv.FormatInt(n.ID, 10)+".json")
+	if err := os.WriteFile(name, body, 0o600); err != nil {
+		return fmt.Errorf("error writing notification file: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+// Package notifications tells registrants and staff about events such as a
+// confirmed registration. Events are rendered from templates into a persisted
+// outbox in the same transaction as the change they report, and a scheduled
+// dispatcher delivers them through pluggable channels with retries.
+package notifications
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"project/config"
+	"project/mailer"
+	"project/models"
+)
+
+// RegistrationConfirmed is raised when TransferTempData moves a registration
+// from temp into users.
+const RegistrationConfirmed = "registration.confirmed"
+
+// Audiences an event is rendered for, each with its own template.
+const (
+	AudienceRegistrant = "registrant" // the person the event is about
+	AudienceStaff      = "staff"      // the NOTIFY_STAFF_EMAILS addresses
+)
+
+// Channel names, as listed in NOTIFY_CHANNELS.
+const (
+	ChannelSMTP    = "smtp"
+	ChannelGmail   = "gmail"
+	ChannelWebhook = "webhook"
+	ChannelFile    = "file"
+)
+
+// Channel delivers one notification. Implementations must tolerate the same
+// notification being sent again after a crash, since delivery is at least once.
+type Channel interface {
+	Send(ctx context.Context, n models.Notification) error
+}
+
+// Event is something to notify about.
+type Event struct {
+	Name       string
+	Registrant string      // email address of the person concerned, if any
+	Data       interface{} // template data, also sent as the webhook payload
+}
+
+// RegistrationConfirmedEvent describes a registration that reached users.
+func RegistrationConfirmedEvent(u models.User) Event {
+	return Event{Name: RegistrationConfirmed, Registrant: u.Email, Data: u}
+}
+
+var (
+	channelsMu sync.Mutex
+	channels   = map[string]Channel{}
+)
+
+// Register replaces the channel used for name, such as a fake in tests.
+func Register(name string, ch Channel) {
+	channelsMu.Lock()
+	defer channelsMu.Unlock()
+	channels[name] = ch
+}
+
+// channel returns the registered channel, creating it from the environment on first use.
+func channel(name string) (Channel, error) {
+	channelsMu.Lock()
+	defer channelsMu.Unlock()
+	if ch, ok := channels[name]; ok {
+		return ch, nil
+	}
+	ch, err := newChannel(name)
+	if err != nil {
+		return nil, err
+	}
+	channels[name] = ch
+	return ch, nil
+}
+
+// newChannel configures a channel from environment variables.
+func newChannel(name string) (Channel, error) {
+	switch name {
+	case ChannelSMTP:
+		return &MailChannel{Mailer: mailer.SMTPFromEnv()}, nil
+	case ChannelGmail:
+		return &GmailChannel{Account: strings.ToLower(config.GetEnv("NOTIFY_GMAIL_ACCOUNT", ""))}, nil
+	case ChannelWebhook:
+		return newWebhookChannel(), nil
+	case ChannelFile:
+		return &FileChannel{Dir: config.GetEnv("NOTIFY_FILE_DIR", "notifications-out")}, nil
+	default:
+		return nil, fmt.Errorf("unknown notification channel %q", name)
+	}
+}
+
+// enabledChannels returns NOTIFY_CHANNELS; notifications are off when it is empty.
+func enabledChannels() []string {
+	var names []string
+	for _, name := range config.GetEnvList("NOTIFY_CHANNELS") {
+		names = append(names, strings.ToLower(name))
+	}
+	return names
+}
+
+// isEmailChannel reports whether the channel addresses people by email.
+// The file sink counts as one so it records what would have been mailed.
+func isEmailChannel(name string) bool {
+	return name == ChannelSMTP || name == ChannelGmail || name == ChannelFile
+}
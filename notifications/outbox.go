@@ -0,0 +1,260 @@
+package notifications
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"project/config"
+	"project/db"
+	"project/models"
+	"project/outbox"
+)
+
+// queue leases due notifications for five minutes; if a dispatcher dies
+// while sending, the notification becomes due again when the lease ends.
+var queue = outbox.Queue{
+	Table:   "notification_outbox",
+	Pending: models.NotificationPending,
+	Sending: models.NotificationSending,
+	Lease:   5 * time.Minute,
+	Batch:   100,
+}
+
+// Enqueue renders events for every channel in NOTIFY_CHANNELS and adds them
+// to the outbox within tx, so notifications exist exactly when the change
+// they report is committed:
+//   - smtp, gmail and file notify the registrant (unless NOTIFY_REGISTRANTS
+//     is false) and each address in NOTIFY_STAFF_EMAILS;
+//   - webhook posts the event as JSON to NOTIFY_WEBHOOK_URL.
+func Enqueue(tx *sql.Tx, events ...Event) error {
+	names := enabledChannels()
+	if len(names) == 0 || len(events) == 0 {
+		return nil
+	}
+	for _, name := range names {
+		if _, err := channel(name); err != nil {
+			return err
+		}
+	}
+
+	notifyRegistrants := config.GetEnvBool("NOTIFY_REGISTRANTS", true)
+	staff := config.GetEnvList("NOTIFY_STAFF_EMAILS")
+	webhookURL := config.GetEnv("NOTIFY_WEBHOOK_URL", "")
+
+	stmt, err := tx.Prepare(`INSERT INTO notification_outbox
+		(event, channel, recipient, subject_email, subject, body_text, body_html, payload, status, next_attempt_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	now := time.Now()
+
+	for _, event := range events {
+		// Every row of the event, staff emails included, quotes the registrant,
+		// so each is tagged with their address for erasure.
+		subjectEmail := sql.NullString{String: strings.ToLower(event.Registrant), Valid: event.Registrant != ""}
+		insert := func(n models.Notification) error {
+			_, err := stmt.Exec(n.Event, n.Channel, n.Recipient, subjectEmail, n.Subject, n.Text, n.HTML, n.Payload, models.NotificationPending, now)
+			return err
+		}
+
+		rendered := map[string]Rendered{}
+		for _, audience := range []string{AudienceRegistrant, AudienceStaff} {
+			if t := templateFor(event.Name, audience); t != nil {
+				r, err := t.Render(event.Data)
+				if err != nil {
+					return fmt.Errorf("error rendering %s notification for %s: %v", event.Name, audience, err)
+				}
+				rendered[audience] = r
+			}
+		}
+
+		for _, name := range names {
+			if name == ChannelWebhook {
+				if webhookURL == "" {
+					continue
+				}
+				payload, err := json.Marshal(map[string]interface{}{"event": event.Name, "occurred_at": now, "data": event.Data})
+				if err != nil {
+					return err
+				}
+				if err := insert(models.Notification{Event: event.Name, Channel: name, Recipient: webhookURL, Payload: string(payload)}); err != nil {
+					return err
+				}
+				continue
+			}
+			if !isEmailChannel(name) {
+				continue
+			}
+
+			if r, ok := rendered[AudienceRegistrant]; ok && notifyRegistrants && event.Registrant != "" {
+				n := models.Notification{Event: event.Name, Channel: name, Recipient: event.Registrant, Subject: r.Subject, Text: r.Text, HTML: r.HTML}
+				if err := insert(n); err != nil {
+					return err
+				}
+			}
+			if r, ok := rendered[AudienceStaff]; ok {
+				for _, address := range staff {
+					n := models.Notification{Event: event.Name, Channel: name, Recipient: address, Subject: r.Subject, Text: r.Text, HTML: r.HTML}
+					if err := insert(n); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// DeliverPending is the scheduled dispatcher job.
+func DeliverPending() {
+	sent, failed, err := Dispatch(context.Background())
+	if err != nil {
+		log.Printf("❌ Error dispatching notifications: %v", err)
+	}
+	if failed > 0 {
+		log.Printf("❌ %d notifications failed, %d sent", failed, sent)
+	}
+}
+
+// Dispatch delivers the notifications that are due and returns how many were
+// sent and how many failed this attempt. Failed ones are retried with
+// exponential backoff until NOTIFY_MAX_ATTEMPTS (default 8) is reached.
+func Dispatch(ctx context.Context) (sent, failed int, err error) {
+	return outbox.Dispatch(queue, Get, func(n *models.Notification) (bool, error) {
+		if err := deliver(ctx, n); err != nil {
+			return false, recordFailure(n, err)
+		}
+		_, err := db.DB.Exec("UPDATE notification_outbox SET status = ?, sent_at = ?, last_error = NULL WHERE id = ?",
+			models.NotificationSent, time.Now(), n.ID)
+		return true, err
+	})
+}
+
+// deliver sends a notification through its channel.
+func deliver(ctx context.Context, n *models.Notification) error {
+	ch, err := channel(n.Channel)
+	if err != nil {
+		return err
+	}
+	return ch.Send(ctx, *n)
+}
+
+// recordFailure schedules the next attempt, waiting one minute after the
+// first failure and doubling up to six hours, or gives up after
+// NOTIFY_MAX_ATTEMPTS.
+func recordFailure(n *models.Notification, sendErr error) error {
+	attempts := n.Attempts + 1
+	status := models.NotificationPending
+	if attempts >= config.GetEnvInt("NOTIFY_MAX_ATTEMPTS", 8) {
+		status = models.NotificationFailed
+	}
+	_, err := db.DB.Exec("UPDATE notification_outbox SET status = ?, attempts = ?, next_attempt_at = ?, last_error = ? WHERE id = ?",
+		status, attempts, time.Now().Add(outbox.Backoff(attempts, time.Minute, 6*time.Hour)), sendErr.Error(), n.ID)
+	return err
+}
+
+// notificationColumns is the select list scanNotification expects.
+const notificationColumns = `id, event, channel, recipient, subject, body_text, body_html, payload, status,
+	attempts, next_attempt_at, last_error, created_at, sent_at`
+
+// scanNotification reads one notification_outbox row.
+func scanNotification(row interface{ Scan(...interface{}) error }) (*models.Notification, error) {
+	var n models.Notification
+	var text, html, payload, lastError sql.NullString
+	var sentAt sql.NullTime
+	err := row.Scan(&n.ID, &n.Event, &n.Channel, &n.Recipient, &n.Subject, &text, &html, &payload, &n.Status,
+		&n.Attempts, &n.NextAttemptAt, &lastError, &n.CreatedAt, &sentAt)
+	if err != nil {
+		return nil, err
+	}
+	n.Text, n.HTML, n.Payload, n.LastError = text.String, html.String, payload.String, lastError.String
+	if sentAt.Valid {
+		n.SentAt = &sentAt.Time
+	}
+	return &n, nil
+}
+
+// Get returns a notification, or nil if it does not exist.
+func Get(id int64) (*models.Notification, error) {
+	n, err := scanNotification(db.DB.QueryRow("SELECT "+notificationColumns+" FROM notification_outbox WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return n, err
+}
+
+// List returns the newest notifications, optionally only those with a status.
+func List(status string, limit int) ([]models.Notification, error) {
+	query := "SELECT " + notificationColumns + " FROM notification_outbox"
+	var args []interface{}
+	if status != "" {
+		query += " WHERE status = ?"
+		args = append(args, status)
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notifications := []models.Notification{}
+	for rows.Next() {
+		n, err := scanNotification(rows)
+		if err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, *n)
+	}
+	return notifications, rows.Err()
+}
+
+// Retry makes a failed notification due again with a fresh attempt count.
+// It reports false if the notification does not exist or has not failed.
+func Retry(id int64) (bool, error) {
+	res, err := db.DB.Exec("UPDATE notification_outbox SET status = ?, attempts = 0, next_attempt_at = ? WHERE id = ? AND status = ?",
+		models.NotificationPending, time.Now(), id, models.NotificationFailed)
+	if err != nil {
+		return false, err
+	}
+	count, _ := res.RowsAffected()
+	return count > 0, nil
+}
+
+// PurgeDelivered deletes sent and failed notifications older than
+// NOTIFY_RETENTION (default 30 days); they hold personal data.
+func PurgeDelivered() {
+	cutoff := time.Now().Add(-config.GetEnvDuration("NOTIFY_RETENTION", 30*24*time.Hour))
+	_, err := db.DB.Exec("DELETE FROM notification_outbox WHERE status IN (?, ?) AND created_at < ?",
+		models.NotificationSent, models.NotificationFailed, cutoff)
+	if err != nil {
+		log.Printf("❌ Error purging notifications: %v", err)
+	}
+}
+
+// DeleteForSubject removes every notification about or addressed to an
+// email address, for data subject erasure: rows tagged with it as the
+// registrant, rows sent to it, and webhook payloads carrying it from before
+// rows were tagged.
+func DeleteForSubject(tx *sql.Tx, email string) (int64, error) {
+	quoted, err := json.Marshal(email)
+	if err != nil {
+		return 0, err
+	}
+	pattern := `%"email":` + db.EscapeLike(string(quoted)) + `%`
+	email = strings.ToLower(email)
+	res, err := tx.Exec("DELETE FROM notification_outbox WHERE subject_email = ? OR LOWER(recipient) = ? OR payload LIKE ?", email, email, pattern)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
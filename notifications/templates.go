@@ -0,0 +1,179 @@
+package notifications
+
+import (
+	"bytes"
+	htmltemplate "html/template"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+	"time"
+
+	"project/config"
+)
+
+// Template renders one audience's message for an event. Subject and Text
+// use text/template; HTML uses html/template so values are escaped.
+type Template struct {
+	Subject *texttemplate.Template
+	Text    *texttemplate.Template
+	HTML    *htmltemplate.Template
+}
+
+// Rendered is a message produced by a Template.
+type Rendered struct {
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// templateSource is the unparsed form of a Template.
+type templateSource struct {
+	subject, text, html string
+}
+
+// defaultTemplates are keyed by "<event>.<audience>". The data is the event's
+// Data, a models.User for registration events.
+var defaultTemplates = map[string]templateSource{
+	RegistrationConfirmed + "." + AudienceRegistrant: {
+		subject: `Your registration {{.RegistrationNo}} is confirmed`,
+		text: `Hello {{.Name}},
+
+your registration {{.RegistrationNo}} of {{date .Date}} is confirmed.
+We will contact you at {{.Email}} or {{.PhoneNo}} if anything changes.
+`,
+		html: `<p>Hello {{.Name}},</p>
+<p>your registration <strong>{{.RegistrationNo}}</strong> of {{date .Date}} is confirmed.</p>
+<p>We will contact you at {{.Email}} or {{.PhoneNo}} if anything changes.</p>
+`,
+	},
+	RegistrationConfirmed + "." + AudienceStaff: {
+		subject: `New registration {{.RegistrationNo}}: {{.Name}}`,
+		text: `A registration was confirmed.
+
+Name: {{.Name}}
+Email: {{.Email}}
+Registration No: {{.RegistrationNo}}
+Phone: {{.PhoneNo}}
+Date: {{date .Date}}
+`,
+		html: `<p>A registration was confirmed.</p>
+<table>
+<tr><th align="left">Name</th><td>{{.Name}}</td></tr>
+<tr><th align="left">Email</th><td>{{.Email}}</td></tr>
+<tr><th align="left">Registration No</th><td>{{.RegistrationNo}}</td></tr>
+<tr><th align="left">Phone</th><td>{{.PhoneNo}}</td></tr>
+<tr><th align="left">Date</th><td>{{date .Date}}</td></tr>
+</table>
+`,
+	},
+}
+
+// templateFuncs are available in every template: {{date .Date}} formats a
+// registration date like the rest of the application (dd/mm/yyyy).
+var templateFuncs = map[string]interface{}{
+	"date": func(t time.Time) string { return t.Format("02/01/2006") },
+}
+
+var (
+	templatesOnce sync.Once
+	templates     map[string]*Template
+)
+
+// loadTemplates parses the defaults, replacing any part found in
+// NOTIFY_TEMPLATE_DIR as "<event>.<audience>.subject", ".txt" or ".html".
+// A part that fails to parse is logged and the default kept, so a bad file
+// cannot stop registrations from being confirmed.
+func loadTemplates() map[string]*Template {
+	templatesOnce.Do(func() {
+		dir := config.GetEnv("NOTIFY_TEMPLATE_DIR", "")
+		templates = map[string]*Template{}
+		for key, def := range defaultTemplates {
+			src := def
+			if dir != "" {
+				src.subject = overrideTemplate(dir, key+".subject", src.subject, false)
+				src.text = overrideTemplate(dir, key+".txt", src.text, false)
+				src.html = overrideTemplate(dir, key+".html", src.html, true)
+			}
+			t, err := parseTemplate(key, src)
+			if err != nil {
+				// Only the built-in sources can get here, and they parse.
+				log.Printf("❌ Error parsing notification template %s: %v", key, err)
+				continue
+			}
+			templates[key] = t
+		}
+	})
+	return templates
+}
+
+// overrideTemplate returns the file's content if it exists and parses.
+func overrideTemplate(dir, name, fallback string, isHTML bool) string {
+	b, err := os.ReadFile(filepath.Join(dir, name))
+	if os.IsNotExist(err) {
+		return fallback
+	} else if err != nil {
+		log.Printf("❌ Error reading notification template %s: %v", name, err)
+		return fallback
+	}
+	src := string(b)
+	if isHTML {
+		_, err = htmltemplate.New(name).Funcs(templateFuncs).Option("missingkey=error").Parse(src)
+	} else {
+		_, err = texttemplate.New(name).Funcs(templateFuncs).Option("missingkey=error").Parse(src)
+	}
+	if err != nil {
+		log.Printf("❌ Error parsing notification template %s, using the default: %v", name, err)
+		return fallback
+	}
+	return src
+}
+
+// parseTemplate compiles the three parts of a template.
+func parseTemplate(name string, src templateSource) (*Template, error) {
+	subject, err := texttemplate.New(name + ".subject").Funcs(templateFuncs).Option("missingkey=error").Parse(src.subject)
+	if err != nil {
+		return nil, err
+	}
+	text, err := texttemplate.New(name + ".txt").Funcs(templateFuncs).Option("missingkey=error").Parse(src.text)
+	if err != nil {
+		return nil, err
+	}
+	html, err := htmltemplate.New(name + ".html").Funcs(templateFuncs).Option("missingkey=error").Parse(src.html)
+	if err != nil {
+		return nil, err
+	}
+	return &Template{Subject: subject, Text: text, HTML: html}, nil
+}
+
+// Render fills the template with data.
+func (t *Template) Render(data interface{}) (Rendered, error) {
+	var r Rendered
+	var buf bytes.Buffer
+	if err := t.Subject.Execute(&buf, data); err != nil {
+		return r, err
+	}
+	// Header values must stay on one line.
+	r.Subject = strings.Join(strings.Fields(buf.String()), " ")
+
+	buf.Reset()
+	if err := t.Text.Execute(&buf, data); err != nil {
+		return r, err
+	}
+	r.Text = buf.String()
+
+	buf.Reset()
+	if err := t.HTML.Execute(&buf, data); err != nil {
+		return r, err
+	}
+	r.HTML = buf.String()
+	return r, nil
+}
+
+// templateFor returns the template of an event for an audience, or nil if the
+// audience is not notified of that event.
+func templateFor(event, audience string) *Template {
+	return loadTemplates()[event+"."+audience]
+}
@@ -0,0 +1,61 @@
+package oidc
+
+import (
+	"strings"
+	"sync"
+
+	"project/config"
+)
+
+// GoogleIssuer is the issuer used for the "google" provider unless overridden.
+const GoogleIssuer = "https://accounts.google.com"
+
+var (
+	providers     map[string]*Provider
+	providersOnce sync.Once
+)
+
+// Lookup returns the configured provider with the given name.
+func Lookup(name string) (*Provider, bool) {
+	providersOnce.Do(func() {
+		providers = providersFromEnv()
+	})
+	p, ok := providers[strings.ToLower(name)]
+	return p, ok
+}
+
+// providersFromEnv reads OIDC_PROVIDERS (default "google") and, for each name,
+// OIDC_<NAME>_ISSUER, _CLIENT_ID, _CLIENT_SECRET, _REDIRECT_URL and _SCOPES.
+// Pointing a provider's issuer at a local mock IdP is enough to test the flow.
+func providersFromEnv() map[string]*Provider {
+	names := config.GetEnvList("OIDC_PROVIDERS")
+	if len(names) == 0 {
+		names = []string{"google"}
+	}
+
+	baseURL := strings.TrimRight(config.GetEnv("APP_BASE_URL", "http://localhost:8080"), "/")
+	result := make(map[string]*Provider)
+	for _, name := range names {
+		name = strings.ToLower(name)
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+
+		issuer := config.GetEnv(prefix+"ISSUER", "")
+		if issuer == "" && name == "google" {
+			issuer = GoogleIssuer
+		}
+		clientID := config.GetEnv(prefix+"CLIENT_ID", "")
+		if issuer == "" || clientID == "" {
+			continue
+		}
+
+		result[name] = NewProvider(
+			name,
+			issuer,
+			clientID,
+			config.GetEnv(prefix+"CLIENT_SECRET", ""),
+			config.GetEnv(prefix+"REDIRECT_URL", baseURL+"/auth/"+name+"/callback"),
+			config.GetEnvList(prefix+"SCOPES"),
+		)
+	}
+	return result
+}
@@ -0,0 +1,98 @@
+package outbound
+
+import (
+	"fmt"
+	"net/netip"
+	"net/url"
+	"strings"
+
+	"project/config"
+)
+
+// reservedPrefixes are ranges outside public address space that netip does
+// not already classify: shared, benchmarking, documentation and future-use
+// IPv4 space, and IPv6 prefixes that can embed an IPv4 address.
+var reservedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("192.0.2.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("198.51.100.0/24"),
+	netip.MustParsePrefix("203.0.113.0/24"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+	netip.MustParsePrefix("100::/64"),
+	netip.MustParsePrefix("2001::/32"),
+	netip.MustParsePrefix("2001:db8::/32"),
+	netip.MustParsePrefix("2002::/16"),
+}
+
+// PublicAddress reports whether addr is in public address space: not
+// loopback, private, link-local, multicast, unspecified or reserved.
+func PublicAddress(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsValid() || addr.IsUnspecified() || addr.IsLoopback() || addr.IsPrivate() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() {
+		return false
+	}
+	for _, prefix := range reservedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// HostAllowed reports whether host matches one of the patterns: a host name
+// or address, or "*.example.com" for any subdomain of example.com. An empty
+// list allows every host.
+func HostAllowed(host string, patterns []string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	host = normalizeHost(host)
+	for _, pattern := range patterns {
+		pattern = normalizeHost(pattern)
+		if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+			if strings.HasSuffix(host, "."+suffix) {
+				return true
+			}
+		} else if host == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckURL validates a URL given by a user, such as a webhook target, before
+// it is stored: it must be absolute http or https, its host must be allowed
+// and it must not name a private address or localhost. Host names are
+// checked again on the resolved address when the request is sent.
+func CheckURL(raw string, allowedHosts []string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Hostname() == "" {
+		return fmt.Errorf("url must be an absolute http or https URL")
+	}
+	host := normalizeHost(u.Hostname())
+	if !HostAllowed(host, allowedHosts) || !HostAllowed(host, config.GetEnvList("OUTBOUND_ALLOWED_HOSTS")) {
+		return fmt.Errorf("%w: %s", ErrHostNotAllowed, host)
+	}
+	if config.GetEnvBool("OUTBOUND_ALLOW_PRIVATE_NETWORKS", false) {
+		return nil
+	}
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return fmt.Errorf("%w: %s", ErrPrivateAddress, host)
+	}
+	if addr, err := netip.ParseAddr(host); err == nil && !PublicAddress(addr) {
+		return fmt.Errorf("%w: %s", ErrPrivateAddress, host)
+	}
+	return nil
+}
+
+// normalizeHost lower-cases a host name and drops a trailing dot.
+func normalizeHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(host)), ".")
+}
@@ -0,0 +1,198 @@
+// Package outbound builds the HTTP clients every integration uses to call
+// other services. The clients time out, cap response bodies, only reach
+// allowed hosts, never connect to private or reserved addresses (checked on
+// the resolved address, so DNS cannot be used to get around it) and limit
+// connections per host.
+//
+// Settings shared by all clients:
+//
+//	OUTBOUND_CONNECT_TIMEOUT        dial and TLS handshake, default 5s
+//	OUTBOUND_READ_TIMEOUT           wait for the response headers, default 30s
+//	OUTBOUND_TIMEOUT                whole request when Options.Timeout is 0, default 60s
+//	OUTBOUND_MAX_RESPONSE_BYTES     when Options.MaxResponseBytes is 0, default 10 MiB
+//	OUTBOUND_MAX_CONNS_PER_HOST     when Options.MaxConnsPerHost is 0, default 16
+//	OUTBOUND_ALLOWED_HOSTS          if set, no client reaches any other host
+//	OUTBOUND_ALLOW_PRIVATE_NETWORKS allow private addresses, for local development
+package outbound
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"syscall"
+	"time"
+
+	"project/config"
+)
+
+// ErrHostNotAllowed is returned for a request to a host outside the allow-lists.
+var ErrHostNotAllowed = errors.New("outbound: host is not allowed")
+
+// ErrPrivateAddress is returned for a connection to a private or reserved address.
+var ErrPrivateAddress = errors.New("outbound: private or reserved address")
+
+// ErrResponseTooLarge is returned when reading more than MaxResponseBytes.
+var ErrResponseTooLarge = errors.New("outbound: response too large")
+
+// maxRedirects bounds the redirects a client follows when FollowRedirects is set.
+const maxRedirects = 5
+
+// Options describe the client of one integration.
+type Options struct {
+	Name             string        // used in errors, e.g. "webhooks"
+	Timeout          time.Duration // whole request including the body
+	MaxResponseBytes int64
+	MaxConnsPerHost  int
+	AllowedHosts     []string // "api.example.com" or "*.example.com"; empty for any public host
+	FollowRedirects  bool     // up to 5, each to an allowed host and never from https to http
+}
+
+// New returns a client for opts. Environment proxies are not used, so the
+// address check applies to the server actually reached.
+func New(opts Options) *http.Client {
+	if opts.Timeout <= 0 {
+		opts.Timeout = config.GetEnvDuration("OUTBOUND_TIMEOUT", time.Minute)
+	}
+	if opts.MaxResponseBytes <= 0 {
+		opts.MaxResponseBytes = int64(config.GetEnvInt("OUTBOUND_MAX_RESPONSE_BYTES", 10<<20))
+	}
+	if opts.MaxConnsPerHost <= 0 {
+		opts.MaxConnsPerHost = config.GetEnvInt("OUTBOUND_MAX_CONNS_PER_HOST", 16)
+	}
+	connectTimeout := config.GetEnvDuration("OUTBOUND_CONNECT_TIMEOUT", 5*time.Second)
+	allowPrivate := config.GetEnvBool("OUTBOUND_ALLOW_PRIVATE_NETWORKS", false)
+
+	dialer := &net.Dialer{
+		Timeout:   connectTimeout,
+		KeepAlive: 30 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			if allowPrivate {
+				return nil
+			}
+			return checkDialAddress(address)
+		},
+	}
+	base := &http.Transport{
+		Proxy:                 nil,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		TLSHandshakeTimeout:   connectTimeout,
+		ResponseHeaderTimeout: config.GetEnvDuration("OUTBOUND_READ_TIMEOUT", 30*time.Second),
+		ExpectContinueTimeout: time.Second,
+		MaxConnsPerHost:       opts.MaxConnsPerHost,
+		MaxIdleConnsPerHost:   opts.MaxConnsPerHost,
+		IdleConnTimeout:       90 * time.Second,
+	}
+
+	return &http.Client{
+		Timeout: opts.Timeout,
+		Transport: &transport{
+			name:         opts.Name,
+			base:         base,
+			allowedHosts: opts.AllowedHosts,
+			globalHosts:  config.GetEnvList("OUTBOUND_ALLOWED_HOSTS"),
+			maxBytes:     opts.MaxResponseBytes,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if !opts.FollowRedirects {
+				return http.ErrUseLastResponse
+			}
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("%s: stopped after %d redirects", opts.Name, maxRedirects)
+			}
+			if via[len(via)-1].URL.Scheme == "https" && req.URL.Scheme != "https" {
+				return fmt.Errorf("%s: refusing redirect from https to %s", opts.Name, req.URL.Scheme)
+			}
+			return nil
+		},
+	}
+}
+
+// transport checks the host of every request, redirects included, and caps
+// the response body.
+type transport struct {
+	name         string
+	base         http.RoundTripper
+	allowedHosts []string
+	globalHosts  []string
+	maxBytes     int64
+}
+
+// RoundTrip sends the request if its host is allowed.
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme != "https" && req.URL.Scheme != "http" {
+		return nil, fmt.Errorf("%s: unsupported scheme %q", t.name, req.URL.Scheme)
+	}
+	host := req.URL.Hostname()
+	if !HostAllowed(host, t.allowedHosts) || !HostAllowed(host, t.globalHosts) {
+		return nil, fmt.Errorf("%s: %w: %s", t.name, ErrHostNotAllowed, host)
+	}
+
+	res, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.ContentLength > t.maxBytes {
+		res.Body.Close()
+		return nil, fmt.Errorf("%s: %w: %d bytes", t.name, ErrResponseTooLarge, res.ContentLength)
+	}
+	res.Body = &limitedBody{ReadCloser: res.Body, remaining: t.maxBytes}
+	return res, nil
+}
+
+// limitedBody fails with ErrResponseTooLarge once more than the limit is read.
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+}
+
+// Read reads up to the limit, then only to see whether the body has ended.
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		var probe [1]byte
+		n, err := b.ReadCloser.Read(probe[:])
+		if n > 0 {
+			return 0, ErrResponseTooLarge
+		}
+		return 0, err
+	}
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	return n, err
+}
+
+// Blocked reports whether err is a request the egress rules refused.
+func Blocked(err error) bool {
+	return errors.Is(err, ErrHostNotAllowed) || errors.Is(err, ErrPrivateAddress)
+}
+
+// HostsFromURLs returns the hosts of the URLs, for allowing exactly the
+// services an integration is configured with. Unparseable URLs are skipped.
+func HostsFromURLs(urls ...string) []string {
+	var hosts []string
+	for _, raw := range urls {
+		if u, err := url.Parse(raw); err == nil && u.Hostname() != "" {
+			hosts = append(hosts, normalizeHost(u.Hostname()))
+		}
+	}
+	return hosts
+}
+
+// checkDialAddress refuses a resolved ip:port outside public address space.
+func checkDialAddress(address string) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrPrivateAddress, address)
+	}
+	if !PublicAddress(addrPort.Addr()) {
+		return fmt.Errorf("%w: %s", ErrPrivateAddress, addrPort.Addr())
+	}
+	return nil
+}
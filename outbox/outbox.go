@@ -0,0 +1,108 @@
+// Package outbox runs the lease-and-retry loop shared by the tables that hold
+// outgoing messages, such as notification_outbox and webhook_deliveries. A
+// row is due while it is pending, or sending with an expired lease, and its
+// next_attempt_at has passed. A dispatcher leases a row before the attempt by
+// moving next_attempt_at past the lease, so a dispatcher that dies while
+// sending leaves the row to be retried when the lease ends.
+package outbox
+
+import (
+	"time"
+
+	"project/db"
+)
+
+// Queue describes an outbox table. The table needs id, status and
+// next_attempt_at columns.
+type Queue struct {
+	Table   string
+	Pending string        // status of rows waiting for an attempt
+	Sending string        // status of rows leased by a dispatcher
+	Lease   time.Duration // how long a dispatcher owns a row
+	Batch   int           // how many due rows one run handles
+}
+
+// Due returns the ids of up to Batch due rows, oldest first.
+func (q Queue) Due() ([]int64, error) {
+	rows, err := db.DB.Query(`SELECT id FROM `+q.Table+`
+		WHERE status IN (?, ?) AND next_attempt_at <= ? ORDER BY id LIMIT ?`,
+		q.Pending, q.Sending, time.Now(), q.Batch)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// Claim takes the lease on a due row. It reports false if another
+// dispatcher got it first.
+func (q Queue) Claim(id int64) (bool, error) {
+	now := time.Now()
+	res, err := db.DB.Exec(`UPDATE `+q.Table+` SET status = ?, next_attempt_at = ?
+		WHERE id = ? AND status IN (?, ?) AND next_attempt_at <= ?`,
+		q.Sending, now.Add(q.Lease), id, q.Pending, q.Sending, now)
+	if err != nil {
+		return false, err
+	}
+	count, _ := res.RowsAffected()
+	return count > 0, nil
+}
+
+// Dispatch claims each due row of q, loads it and makes one attempt with
+// send, which reports whether the attempt succeeded and records the outcome.
+// Rows claimed by another dispatcher or deleted meanwhile are skipped.
+// Errors from load and send are database failures and stop the run.
+func Dispatch[T any](q Queue, load func(id int64) (*T, error), send func(*T) (bool, error)) (succeeded, failed int, err error) {
+	ids, err := q.Due()
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, id := range ids {
+		claimed, err := q.Claim(id)
+		if err != nil {
+			return succeeded, failed, err
+		}
+		if !claimed {
+			continue
+		}
+		row, err := load(id)
+		if err != nil {
+			return succeeded, failed, err
+		}
+		if row == nil {
+			continue
+		}
+		ok, err := send(row)
+		if err != nil {
+			return succeeded, failed, err
+		}
+		if ok {
+			succeeded++
+		} else {
+			failed++
+		}
+	}
+	return succeeded, failed, nil
+}
+
+// Backoff is the wait before the next attempt: base after the first failed
+// attempt, doubling after each further one, up to max.
+func Backoff(attempts int, base, max time.Duration) time.Duration {
+	wait := base
+	for i := 1; i < attempts && wait < max; i++ {
+		wait *= 2
+	}
+	if wait > max {
+		wait = max
+	}
+	return wait
+}
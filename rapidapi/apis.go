@@ -0,0 +1,71 @@
+package rapidapi
+
+import (
+	"context"
+	"net/url"
+	"sync"
+
+	"project/config"
+)
+
+var (
+	mapsDataOnce sync.Once
+	mapsData     *Client
+
+	chatbotOnce sync.Once
+	chatbot     *Client
+)
+
+// MapsData is the maps-data API, configured by the MAPS_DATA_* variables and
+// RAPIDAPI_MAPS_DATA_KEY or RAPIDAPI_KEY.
+func MapsData() *Client {
+	mapsDataOnce.Do(func() {
+		mapsData = New(ConfigFromEnv("maps-data", "MAPS_DATA_", "https://maps-data.p.rapidapi.com"))
+	})
+	return mapsData
+}
+
+// Chatbot is the custom chatbot API at config.BaseURL, configured by the
+// CHATBOT_* variables and the key config.LoadConfig read.
+func Chatbot() *Client {
+	chatbotOnce.Do(func() {
+		cfg := ConfigFromEnv("chatbot", "CHATBOT_", config.BaseURL)
+		if config.ChatbotAPIKey != "" {
+			cfg.Key = config.ChatbotAPIKey
+		}
+		chatbot = New(cfg)
+	})
+	return chatbot
+}
+
+// BusinessPhotos fetches the photos of a business from maps-data. The answer
+// is returned as received so callers can cache and pass it on unchanged.
+func BusinessPhotos(ctx context.Context, businessID, lang, country string) (*Response, error) {
+	query := url.Values{"business_id": {businessID}, "lang": {lang}, "country": {country}}
+	return MapsData().Get(ctx, "/photos.php", query)
+}
+
+// APIStatus is what the client knows about an API's health and quotas.
+type APIStatus struct {
+	Name       string        `json:"name"`
+	Host       string        `json:"host"`
+	Configured bool          `json:"configured"`
+	Circuit    BreakerStatus `json:"circuit"`
+	Quotas     []QuotaStatus `json:"quotas"`
+}
+
+// Status returns the client's circuit state and last known quotas.
+func (c *Client) Status() APIStatus {
+	return APIStatus{
+		Name:       c.cfg.Name,
+		Host:       c.cfg.Host,
+		Configured: c.Configured(),
+		Circuit:    c.breaker.status(),
+		Quotas:     c.quota.Snapshot(),
+	}
+}
+
+// Statuses reports on every API this service uses.
+func Statuses() []APIStatus {
+	return []APIStatus{MapsData().Status(), Chatbot().Status()}
+}
@@ -0,0 +1,102 @@
+package rapidapi
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned, without calling the API, while it is considered
+// down after repeated failures.
+var ErrCircuitOpen = errors.New("rapidapi: circuit open, API is failing")
+
+// Circuit states.
+const (
+	CircuitClosed   = "closed"    // calls go through
+	CircuitOpen     = "open"      // calls are refused until the cooldown ends
+	CircuitHalfOpen = "half-open" // one trial call decides
+)
+
+// BreakerStatus is the state of an API's circuit.
+type BreakerStatus struct {
+	State    string    `json:"state"`
+	Failures int       `json:"consecutive_failures"`
+	OpenedAt time.Time `json:"opened_at,omitempty"`
+}
+
+// breaker opens after threshold consecutive failures, refuses calls for the
+// cooldown, then lets a single call through: success closes it again and
+// failure restarts the cooldown.
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	trial    bool // a half-open trial call is in flight
+}
+
+func newBreaker(threshold int, cooldown time.Duration) *breaker {
+	return &breaker{threshold: threshold, cooldown: cooldown, state: CircuitClosed}
+}
+
+// allow reports whether a call may go out, or how long until one may.
+func (b *breaker) allow() (time.Duration, bool) {
+	if b.threshold <= 0 {
+		return 0, true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case CircuitOpen:
+		if wait := time.Until(b.openedAt.Add(b.cooldown)); wait > 0 {
+			return wait, false
+		}
+		b.state = CircuitHalfOpen
+		fallthrough
+	case CircuitHalfOpen:
+		if b.trial {
+			return b.cooldown, false
+		}
+		b.trial = true
+	}
+	return 0, true
+}
+
+// record counts the outcome of a call that allow let through.
+func (b *breaker) record(success bool) {
+	if b.threshold <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trial = false
+	if success {
+		b.state, b.failures = CircuitClosed, 0
+		return
+	}
+	b.failures++
+	if b.state == CircuitHalfOpen || b.failures >= b.threshold {
+		b.state, b.openedAt = CircuitOpen, time.Now()
+	}
+}
+
+// release ends a call without counting it, freeing the half-open trial.
+func (b *breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trial = false
+}
+
+// status returns the current state.
+func (b *breaker) status() BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := BreakerStatus{State: b.state, Failures: b.failures}
+	if b.state != CircuitClosed {
+		s.OpenedAt = b.openedAt
+	}
+	return s
+}
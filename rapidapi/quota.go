@@ -0,0 +1,113 @@
+package rapidapi
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrQuotaExhausted is returned, without calling the API, while the last
+// answer said a quota had nothing remaining and it has not reset yet.
+var ErrQuotaExhausted = errors.New("rapidapi: quota exhausted")
+
+// QuotaStatus is the last known state of one x-ratelimit-<name>-* quota.
+// RapidAPI sends "requests" for every plan; APIs may add their own.
+type QuotaStatus struct {
+	Name      string    `json:"name"`
+	Limit     int64     `json:"limit"`
+	Remaining int64     `json:"remaining"`
+	ResetsAt  time.Time `json:"resets_at,omitempty"` // zero when the API did not say
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Quota remembers the x-ratelimit-* headers of the latest answer.
+type Quota struct {
+	mu     sync.Mutex
+	quotas map[string]QuotaStatus
+}
+
+// rateLimitHeader matches X-Ratelimit-Requests-Remaining and the like.
+var rateLimitHeader = regexp.MustCompile(`^X-Ratelimit-(.+)-(Limit|Remaining|Reset)$`)
+
+func newQuota() *Quota {
+	return &Quota{quotas: map[string]QuotaStatus{}}
+}
+
+// update reads the quota headers of an answer. The reset header is the number
+// of seconds until the quota renews.
+func (q *Quota) update(header http.Header) {
+	now := time.Now()
+	seen := map[string]QuotaStatus{}
+	for key, values := range header {
+		m := rateLimitHeader.FindStringSubmatch(key)
+		if m == nil || len(values) == 0 {
+			continue
+		}
+		value, err := strconv.ParseInt(strings.TrimSpace(values[0]), 10, 64)
+		if err != nil {
+			continue
+		}
+		name := strings.ToLower(m[1])
+		status, ok := seen[name]
+		if !ok {
+			status = QuotaStatus{Name: name, Limit: -1, Remaining: -1, UpdatedAt: now}
+		}
+		switch m[2] {
+		case "Limit":
+			status.Limit = value
+		case "Remaining":
+			status.Remaining = value
+		case "Reset":
+			status.ResetsAt = now.Add(time.Duration(value) * time.Second)
+		}
+		seen[name] = status
+	}
+	if len(seen) == 0 {
+		return
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for name, status := range seen {
+		q.quotas[name] = status
+	}
+}
+
+// exhausted reports whether a quota is used up and how long until it resets.
+// A quota without a reset time is trusted for a minute, then tried again.
+func (q *Quota) exhausted() (time.Duration, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	now := time.Now()
+	var wait time.Duration
+	for _, status := range q.quotas {
+		if status.Remaining != 0 {
+			continue
+		}
+		resetsAt := status.ResetsAt
+		if resetsAt.IsZero() {
+			resetsAt = status.UpdatedAt.Add(time.Minute)
+		}
+		if d := resetsAt.Sub(now); d > wait {
+			wait = d
+		}
+	}
+	return wait, wait > 0
+}
+
+// Snapshot returns the known quotas sorted by name.
+func (q *Quota) Snapshot() []QuotaStatus {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	quotas := make([]QuotaStatus, 0, len(q.quotas))
+	for _, status := range q.quotas {
+		quotas = append(quotas, status)
+	}
+	sort.Slice(quotas, func(i, j int) bool { return quotas[i].Name < quotas[j].Name })
+	return quotas
+}
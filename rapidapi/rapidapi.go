@@ -0,0 +1,289 @@
+// Package rapidapi calls APIs published on RapidAPI. A Client adds the
+// x-rapidapi-host and x-rapidapi-key headers, retries 429 and 5xx answers with
+// backoff, tracks the x-ratelimit-* quota headers and stops calling an API
+// that keeps failing until it has had time to recover.
+package rapidapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"project/config"
+	"project/outbound"
+)
+
+// Config describes one API and how the client treats it.
+type Config struct {
+	Name             string        // used in logs and errors, e.g. "maps-data"
+	BaseURL          string        // e.g. https://maps-data.p.rapidapi.com
+	Host             string        // x-rapidapi-host; defaults to the host of BaseURL
+	Key              string        // x-rapidapi-key
+	Timeout          time.Duration // per attempt
+	MaxRetries       int           // extra attempts after a 429, 5xx or network error
+	RetryBackoff     time.Duration // first retry delay, doubled for each retry
+	MaxRetryWait     time.Duration // longest Retry-After the client waits for itself
+	MaxResponseBytes int64
+	BreakerThreshold int           // consecutive failures that open the circuit
+	BreakerCooldown  time.Duration // how long the circuit stays open
+}
+
+// ConfigFromEnv reads the settings of an API from variables starting with
+// prefix, such as MAPS_DATA_BASE_URL. The key is RAPIDAPI_<prefix>KEY, for
+// example RAPIDAPI_CHATBOT_KEY, falling back to the shared RAPIDAPI_KEY.
+func ConfigFromEnv(name, prefix, defaultBaseURL string) Config {
+	return Config{
+		Name:             name,
+		BaseURL:          config.GetEnv(prefix+"BASE_URL", defaultBaseURL),
+		Host:             config.GetEnv(prefix+"RAPIDAPI_HOST", ""),
+		Key:              config.GetEnv("RAPIDAPI_"+prefix+"KEY", config.GetEnv("RAPIDAPI_KEY", "")),
+		Timeout:          config.GetEnvDuration(prefix+"TIMEOUT", 10*time.Second),
+		MaxRetries:       config.GetEnvInt(prefix+"MAX_RETRIES", 2),
+		RetryBackoff:     config.GetEnvDuration(prefix+"RETRY_BACKOFF", 500*time.Millisecond),
+		MaxRetryWait:     config.GetEnvDuration(prefix+"MAX_RETRY_WAIT", 5*time.Second),
+		MaxResponseBytes: int64(config.GetEnvInt(prefix+"MAX_RESPONSE_BYTES", 5<<20)),
+		BreakerThreshold: config.GetEnvInt(prefix+"BREAKER_THRESHOLD", 5),
+		BreakerCooldown:  config.GetEnvDuration(prefix+"BREAKER_COOLDOWN", 30*time.Second),
+	}
+}
+
+// ErrNotConfigured is returned when the API has no key.
+var ErrNotConfigured = errors.New("rapidapi: API key is not configured")
+
+// ErrResponseTooLarge is returned when an answer exceeds MaxResponseBytes.
+var ErrResponseTooLarge = outbound.ErrResponseTooLarge
+
+// Error is a call that failed after any retries. StatusCode is the upstream
+// status, or 0 when no answer was received, in which case Err says why.
+type Error struct {
+	API        string
+	StatusCode int
+	RetryAfter time.Duration // when the upstream, the quota or the circuit says to wait
+	Err        error
+}
+
+// Error describes the failure for the server log.
+func (e *Error) Error() string {
+	switch {
+	case e.Err != nil:
+		return fmt.Sprintf("rapidapi %s: %v", e.API, e.Err)
+	default:
+		return fmt.Sprintf("rapidapi %s: status %d", e.API, e.StatusCode)
+	}
+}
+
+// Unwrap exposes the transport failure, ErrCircuitOpen or ErrQuotaExhausted.
+func (e *Error) Unwrap() error { return e.Err }
+
+// Timeout reports whether the upstream did not answer in time.
+func (e *Error) Timeout() bool {
+	var netErr net.Error
+	return errors.Is(e.Err, context.DeadlineExceeded) || (errors.As(e.Err, &netErr) && netErr.Timeout())
+}
+
+// Response is a successful (2xx) answer.
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// Decode unmarshals the JSON body into v.
+func (r *Response) Decode(v interface{}) error {
+	if err := json.Unmarshal(r.Body, v); err != nil {
+		return fmt.Errorf("rapidapi: invalid JSON response: %v", err)
+	}
+	return nil
+}
+
+// Client calls one API. It is safe for concurrent use.
+type Client struct {
+	cfg     Config
+	http    *http.Client
+	quota   *Quota
+	breaker *breaker
+}
+
+// New returns a client for the API described by cfg. It only reaches the
+// host of BaseURL, through the shared outbound client settings.
+func New(cfg Config) *Client {
+	cfg.BaseURL = strings.TrimRight(cfg.BaseURL, "/")
+	if cfg.Host == "" {
+		if u, err := url.Parse(cfg.BaseURL); err == nil {
+			cfg.Host = u.Host
+		}
+	}
+	if cfg.MaxResponseBytes <= 0 {
+		cfg.MaxResponseBytes = 5 << 20
+	}
+	return &Client{
+		cfg: cfg,
+		http: outbound.New(outbound.Options{
+			Name:             cfg.Name,
+			Timeout:          cfg.Timeout,
+			MaxResponseBytes: cfg.MaxResponseBytes,
+			AllowedHosts:     outbound.HostsFromURLs(cfg.BaseURL),
+		}),
+		quota:   newQuota(),
+		breaker: newBreaker(cfg.BreakerThreshold, cfg.BreakerCooldown),
+	}
+}
+
+// Name returns the API name from the configuration.
+func (c *Client) Name() string { return c.cfg.Name }
+
+// Configured reports whether the API has a key.
+func (c *Client) Configured() bool { return c.cfg.Key != "" }
+
+// Get calls path with the query parameters.
+func (c *Client) Get(ctx context.Context, path string, query url.Values) (*Response, error) {
+	return c.Do(ctx, http.MethodGet, path, query, nil)
+}
+
+// GetJSON calls path and decodes the JSON answer into out.
+func (c *Client) GetJSON(ctx context.Context, path string, query url.Values, out interface{}) error {
+	res, err := c.Get(ctx, path, query)
+	if err != nil {
+		return err
+	}
+	return res.Decode(out)
+}
+
+// PostJSON sends body as JSON to path and decodes the JSON answer into out.
+func (c *Client) PostJSON(ctx context.Context, path string, query url.Values, body, out interface{}) error {
+	res, err := c.Do(ctx, http.MethodPost, path, query, body)
+	if err != nil {
+		return err
+	}
+	return res.Decode(out)
+}
+
+// Do calls the API, encoding a non-nil body as JSON. A 429 is retried for any
+// method; a 5xx or network error only for GET, since the upstream may have
+// acted on the request. Any answer other than 2xx is returned as an *Error.
+func (c *Client) Do(ctx context.Context, method, path string, query url.Values, body interface{}) (*Response, error) {
+	if c.cfg.Key == "" {
+		return nil, ErrNotConfigured
+	}
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return nil, err
+		}
+	}
+	target := c.cfg.BaseURL + "/" + strings.TrimLeft(path, "/")
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	for attempt := 0; ; attempt++ {
+		if wait, ok := c.quota.exhausted(); ok {
+			return nil, &Error{API: c.cfg.Name, StatusCode: http.StatusTooManyRequests, RetryAfter: wait, Err: ErrQuotaExhausted}
+		}
+		if wait, ok := c.breaker.allow(); !ok {
+			return nil, &Error{API: c.cfg.Name, RetryAfter: wait, Err: ErrCircuitOpen}
+		}
+
+		res, err := c.attempt(ctx, method, target, payload)
+		switch {
+		case errors.Is(ctx.Err(), context.Canceled), outbound.Blocked(err):
+			// The caller went away or the egress rules refused the call;
+			// that says nothing about the upstream.
+			c.breaker.release()
+		case err != nil && !errors.Is(err, ErrResponseTooLarge):
+			c.breaker.record(false)
+		default:
+			c.breaker.record(err != nil || res.StatusCode < 500)
+		}
+		if err == nil && res.StatusCode >= 200 && res.StatusCode < 300 {
+			return res, nil
+		}
+
+		callErr := &Error{API: c.cfg.Name, Err: err}
+		retryable := err != nil && !errors.Is(err, ErrResponseTooLarge) && !outbound.Blocked(err) && ctx.Err() == nil && method == http.MethodGet
+		if err == nil {
+			callErr.StatusCode = res.StatusCode
+			callErr.RetryAfter = parseRetryAfter(res.Header.Get("Retry-After"))
+			retryable = res.StatusCode == http.StatusTooManyRequests || (res.StatusCode >= 500 && method == http.MethodGet)
+		}
+		if !retryable || attempt >= c.cfg.MaxRetries {
+			return nil, callErr
+		}
+
+		wait := c.cfg.RetryBackoff << attempt
+		wait += time.Duration(rand.Int63n(int64(wait)/2 + 1))
+		if callErr.RetryAfter > 0 {
+			if callErr.RetryAfter > c.cfg.MaxRetryWait {
+				// Longer than we should hold the caller; let them retry later.
+				return nil, callErr
+			}
+			wait = callErr.RetryAfter
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, callErr
+		case <-timer.C:
+		}
+	}
+}
+
+// attempt sends one request and reads the whole answer.
+func (c *Client) attempt(ctx context.Context, method, target string, payload []byte) (*Response, error) {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("x-rapidapi-key", c.cfg.Key)
+	req.Header.Set("x-rapidapi-host", c.cfg.Host)
+	req.Header.Set("Accept", "application/json")
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	c.quota.update(res.Header)
+
+	// The outbound client stops the body at MaxResponseBytes.
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	return &Response{StatusCode: res.StatusCode, Header: res.Header, Body: data}, nil
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as a date.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
@@ -1,8 +1,10 @@
 package routes
 
 import (
+	"project/config"
 	"project/handlers"
 	"project/middleware"
+	"project/utils"
 
 	"github.com/gin-contrib/cors" // CORS middleware for Gin
 	"github.com/gin-gonic/gin"    // Gin web framework
@@ -18,6 +20,16 @@ func SetupRouter() *gin.Engine {
 	// Authentication routes.
 	r.POST("/signup", handlers.SignUpHandler) // New signup route.
 	r.POST("/login", handlers.LoginHandler)
+	r.POST("/login/mfa", handlers.LoginMFAHandler)
+	r.GET("/verify-email", handlers.VerifyEmailHandler)
+	r.POST("/verify-email/resend", handlers.ResendVerificationHandler)
+
+	// Sign in with Google or another configured OpenID Connect provider.
+	r.GET("/auth/:provider", handlers.OIDCLoginHandler)
+	r.GET("/auth/:provider/callback", handlers.OIDCCallbackHandler)
+
+	// Google redirects here after an admin grants access to a mailbox.
+	r.GET("/gmail/callback", handlers.GmailCallbackHandler)
 
 	// Test route.
 	r.GET("/test", func(c *gin.Context) {
@@ -27,15 +39,125 @@ func SetupRouter() *gin.Engine {
 	})
 
 	// You can remove or repurpose this route if /signup is your sign-up endpoint.
-	r.POST("/users", handlers.CreateUser)
+	// Set REQUIRE_AUTH_FOR_REGISTRATIONS to only accept staff JWTs or API keys
+	// with the registrations:write scope (kiosks, partner scripts).
+	if config.GetEnvBool("REQUIRE_AUTH_FOR_REGISTRATIONS", false) {
+		r.POST("/users", middleware.AuthMiddleware(), middleware.RequirePermission(utils.PermWriteRegistrations), handlers.CreateUser)
+	} else {
+		r.POST("/users", handlers.CreateUser)
+	}
+
+	// Protected route to get all users; API keys need the registrations:read scope.
+	readAuth := []gin.HandlerFunc{middleware.AuthMiddleware(), middleware.RequirePermission(utils.PermReadRegistrations)}
+	r.GET("/users", append(readAuth, handlers.GetAllUsers)...)
 
-	// Protected route to get all users.
-	r.GET("/users", middleware.AuthMiddleware(), handlers.GetAllUsers)
+	// Changes to confirmed registrations; partners are told through webhooks.
+	writeAuth := []gin.HandlerFunc{middleware.AuthMiddleware(), middleware.RequirePermission(utils.PermWriteRegistrations)}
+	r.PATCH("/users/:id", append(writeAuth, handlers.UpdateUserHandler)...)
+	r.DELETE("/users/:id", append(writeAuth, handlers.DeleteUserHandler)...)
 
 	// Additional routes.
-	r.GET("/export-users/excel", handlers.ExportUsersToExcel)
-	r.GET("/export-users/pdf", handlers.ExportUsersToPDF)
-	r.GET("/users/between-dates", handlers.GetUsersBetweenDates)
+	exportAuth := []gin.HandlerFunc{middleware.AuthMiddleware(), middleware.RequirePermission(utils.PermExportPersonalData)}
+	r.GET("/export-users/excel", append(exportAuth, handlers.ExportUsersToExcel)...)
+	r.GET("/export-users/pdf", append(exportAuth, handlers.ExportUsersToPDF)...)
+	r.GET("/users/between-dates", append(readAuth, handlers.GetUsersBetweenDates)...)
+	r.GET("/exports/users", append(exportAuth, handlers.ExportUsersHandler)...)
+	r.POST("/exports", append(exportAuth, handlers.CreateExportJobHandler)...)
+	r.GET("/exports/:id", append(exportAuth, handlers.GetExportJobHandler)...)
+	r.GET("/exports/:id/download", handlers.DownloadExportHandler) // signed URL, no session
+	r.GET("/export-templates", append(exportAuth, handlers.ListExportTemplatesHandler)...)
+
+	// Directory of businesses and branches registrants belong to.
+	r.GET("/businesses", append(readAuth, handlers.ListBusinessesHandler)...)
+	r.GET("/businesses/:id", append(readAuth, handlers.GetBusinessHandler)...)
+	r.POST("/businesses", append(writeAuth, handlers.CreateBusinessHandler)...)
+	r.PUT("/businesses/:id", append(writeAuth, handlers.UpdateBusinessHandler)...)
+	r.DELETE("/businesses/:id", append(writeAuth, handlers.DeleteBusinessHandler)...)
+
+	// Photos of a business from the maps API, cached; stored for directory businesses.
+	r.GET("/businesses/:id/photos", append(readAuth, handlers.GetBusinessPhotos)...)
+
+	// Aggregate registration counts; no personal data, so read access is enough.
+	r.GET("/analytics/registrations", middleware.AuthMiddleware(), middleware.RequirePermission(utils.PermReadRegistrations), handlers.RegistrationAnalyticsHandler)
+
+	// Bulk registration imports from spreadsheets.
+	imports := r.Group("/imports", middleware.AuthMiddleware(), middleware.RequirePermission(utils.PermWriteRegistrations))
+	imports.POST("", handlers.ImportUsersHandler)
+	imports.GET("/:id", handlers.GetImportHandler)
+	imports.GET("/:id/errors", handlers.DownloadImportErrorsHandler)
+
+	// Recurring reports emailed on a cron schedule.
+	reports := r.Group("/reports/subscriptions", exportAuth...)
+	reports.POST("", handlers.CreateReportSubscriptionHandler)
+	reports.GET("", handlers.ListReportSubscriptionsHandler)
+	reports.GET("/:id", handlers.GetReportSubscriptionHandler)
+	reports.PUT("/:id", handlers.UpdateReportSubscriptionHandler)
+	reports.DELETE("/:id", handlers.DeleteReportSubscriptionHandler)
+	reports.POST("/:id/run", handlers.RunReportSubscriptionHandler)
+	reports.GET("/:id/deliveries", handlers.ListReportDeliveriesHandler)
+
+	// Chatbot with per-user conversation history; its tools read registrations.
+	chat := r.Group("/chat", readAuth...)
+	chat.POST("", handlers.ChatHandler)
+	chat.GET("/conversations", handlers.ListChatConversationsHandler)
+	chat.GET("/conversations/:id", handlers.GetChatConversationHandler)
+	chat.DELETE("/conversations/:id", handlers.DeleteChatConversationHandler)
+
+	// Profile of the logged-in user.
+	me := r.Group("/me", middleware.AuthMiddleware())
+	me.GET("", handlers.GetMeHandler)
+	me.PATCH("", handlers.UpdateMeHandler)
+	me.DELETE("", handlers.DeleteMeHandler)
+	// Accounts scheduled for deletion can only restore themselves.
+	r.POST("/me/restore", middleware.RestoreAuthMiddleware(), handlers.RestoreMeHandler)
+
+	// Two-factor authentication enrollment for the logged-in user.
+	mfa := r.Group("/mfa", middleware.AuthMiddleware())
+	mfa.POST("/totp/enroll", handlers.EnrollTOTPHandler)
+	mfa.POST("/totp/confirm", handlers.ConfirmTOTPHandler)
+	mfa.POST("/totp/disable", handlers.DisableTOTPHandler)
+	mfa.POST("/recovery-codes", handlers.RegenerateRecoveryCodesHandler)
+
+	// Admin routes.
+	admin := r.Group("/admin", middleware.AuthMiddleware(), middleware.RequirePermission(utils.PermAdmin))
+	admin.GET("/security-policy", handlers.GetSecurityPolicy)
+	admin.PUT("/security-policy", handlers.UpdateSecurityPolicy)
+	admin.GET("/masking-policy", handlers.GetMaskingPolicyHandler)
+	admin.PUT("/masking-policy", handlers.UpdateMaskingPolicyHandler)
+	admin.GET("/audit-events", handlers.ListAuditEventsHandler)
+	admin.POST("/data-subjects/export", handlers.ExportDataSubjectHandler)
+	admin.POST("/data-subjects/erase", handlers.EraseDataSubjectHandler)
+	admin.GET("/data-subjects/tombstones", handlers.ListErasureTombstonesHandler)
+	admin.POST("/gmail/connect", handlers.ConnectGmailHandler)
+	admin.GET("/gmail/accounts", handlers.ListGmailAccountsHandler)
+	admin.DELETE("/gmail/accounts/:account", handlers.DisconnectGmailAccountHandler)
+	admin.GET("/gmail/ingest", handlers.GetGmailIngestHandler)
+	admin.POST("/gmail/ingest/run", handlers.RunGmailIngestHandler)
+	admin.GET("/gmail/ingest/templates", handlers.GetGmailTemplatesHandler)
+	admin.PUT("/gmail/ingest/templates", handlers.UpdateGmailTemplatesHandler)
+	admin.GET("/notifications", handlers.ListNotificationsHandler)
+	admin.POST("/notifications/:id/retry", handlers.RetryNotificationHandler)
+	admin.POST("/webhooks", handlers.CreateWebhookHandler)
+	admin.GET("/webhooks", handlers.ListWebhooksHandler)
+	admin.GET("/webhooks/:id", handlers.GetWebhookHandler)
+	admin.PUT("/webhooks/:id", handlers.UpdateWebhookHandler)
+	admin.DELETE("/webhooks/:id", handlers.DeleteWebhookHandler)
+	admin.GET("/webhooks/:id/deliveries", handlers.ListWebhookDeliveriesHandler)
+	admin.GET("/webhook-deliveries/:id", handlers.GetWebhookDeliveryHandler)
+	admin.POST("/webhook-deliveries/:id/replay", handlers.ReplayWebhookDeliveryHandler)
+	admin.GET("/rapidapi", handlers.GetRapidAPIStatusHandler)
+	admin.PUT("/users/:username/role", handlers.UpdateUserRole)
+	admin.POST("/api-keys", handlers.CreateAPIKeyHandler)
+	admin.GET("/api-keys", handlers.ListAPIKeysHandler)
+	admin.DELETE("/api-keys/:id", handlers.RevokeAPIKeyHandler)
+	admin.POST("/export-templates", handlers.CreateExportTemplateHandler)
+	admin.GET("/export-templates", handlers.ListExportTemplatesHandler)
+	admin.GET("/export-templates/:name", handlers.GetExportTemplateHandler)
+	admin.PUT("/export-templates/:name", handlers.UpdateExportTemplateHandler)
+	admin.DELETE("/export-templates/:name", handlers.DeleteExportTemplateHandler)
+	admin.PUT("/export-templates/:name/logo", handlers.UploadExportTemplateLogoHandler)
+	admin.GET("/export-templates/:name/logo", handlers.GetExportTemplateLogoHandler)
+	admin.DELETE("/export-templates/:name/logo", handlers.DeleteExportTemplateLogoHandler)
 
 	return r
 }
@@ -0,0 +1,188 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"project/config"
+	"project/outbound"
+)
+
+// S3Store keeps objects in an S3-compatible bucket (AWS S3, MinIO, or a local
+// stand-in), signing requests with AWS Signature Version 4.
+type S3Store struct {
+	Endpoint     string // e.g. https://s3.eu-west-1.amazonaws.com or http://localhost:9000
+	Region       string
+	Bucket       string
+	AccessKey    string
+	SecretKey    string
+	UsePathStyle bool // http://host/bucket/key instead of http://bucket.host/key
+
+	Client     *http.Client // built by client when nil
+	clientOnce sync.Once
+}
+
+// unsignedPayload lets uploads stream without hashing the body first.
+const unsignedPayload = "UNSIGNED-PAYLOAD"
+
+// client returns Client, or builds an outbound client that only reaches the
+// endpoint's host (and the bucket's virtual host under it) and allows objects
+// up to S3_MAX_OBJECT_BYTES (default 5 GiB, the largest single upload). An
+// endpoint on a private network, such as a local MinIO, also needs
+// OUTBOUND_ALLOW_PRIVATE_NETWORKS.
+func (s *S3Store) client() *http.Client {
+	s.clientOnce.Do(func() {
+		if s.Client != nil {
+			return
+		}
+		hosts := outbound.HostsFromURLs(s.Endpoint)
+		if !s.UsePathStyle {
+			for _, host := range hosts {
+				hosts = append(hosts, s.Bucket+"."+host)
+			}
+		}
+		s.Client = outbound.New(outbound.Options{
+			Name:             "s3",
+			Timeout:          5 * time.Minute,
+			MaxResponseBytes: int64(config.GetEnvInt("S3_MAX_OBJECT_BYTES", 5<<30)),
+			AllowedHosts:     hosts,
+		})
+	})
+	return s.Client
+}
+
+// objectURL returns the URL of the object under key.
+func (s *S3Store) objectURL(key string) (*url.URL, error) {
+	if s.Bucket == "" {
+		return nil, fmt.Errorf("S3_BUCKET is not set")
+	}
+	u, err := url.Parse(s.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid S3 endpoint: %v", err)
+	}
+	if s.UsePathStyle {
+		u.Path = "/" + s.Bucket + "/" + strings.TrimPrefix(key, "/")
+	} else {
+		u.Host = s.Bucket + "." + u.Host
+		u.Path = "/" + strings.TrimPrefix(key, "/")
+	}
+	return u, nil
+}
+
+func (s *S3Store) do(ctx context.Context, method, key string, body io.Reader, size int64, contentType string) (*http.Response, error) {
+	u, err := s.objectURL(key)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	s.sign(req, unsignedPayload, time.Now().UTC())
+	return s.client().Do(req)
+}
+
+// Put uploads the object.
+func (s *S3Store) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	res, err := s.do(ctx, http.MethodPut, key, r, size, contentType)
+	if err != nil {
+		return fmt.Errorf("error uploading %s: %v", key, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		return s3Error("uploading", key, res)
+	}
+	return nil
+}
+
+// Open downloads the object; the caller closes the returned body.
+func (s *S3Store) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	res, err := s.do(ctx, http.MethodGet, key, nil, 0, "")
+	if err != nil {
+		return nil, fmt.Errorf("error downloading %s: %v", key, err)
+	}
+	if res.StatusCode == http.StatusNotFound {
+		res.Body.Close()
+		return nil, ErrNotFound
+	}
+	if res.StatusCode != http.StatusOK {
+		defer res.Body.Close()
+		return nil, s3Error("downloading", key, res)
+	}
+	return res.Body, nil
+}
+
+// Delete removes the object.
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	res, err := s.do(ctx, http.MethodDelete, key, nil, 0, "")
+	if err != nil {
+		return fmt.Errorf("error deleting %s: %v", key, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 && res.StatusCode != http.StatusNotFound {
+		return s3Error("deleting", key, res)
+	}
+	return nil
+}
+
+func s3Error(action, key string, res *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+	return fmt.Errorf("error %s %s: status %d: %s", action, key, res.StatusCode, strings.TrimSpace(string(body)))
+}
+
+// sign adds AWS Signature Version 4 headers to the request.
+func (s *S3Store) sign(req *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalHeaders := "host:" + req.URL.Host + "\n" +
+		"x-amz-content-sha256:" + payloadHash + "\n" +
+		"x-amz-date:" + amzDate + "\n"
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.Query().Encode(),
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.Region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretKey), date)
+	key = hmacSHA256(key, s.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
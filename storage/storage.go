@@ -0,0 +1,40 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+
+	"project/config"
+)
+
+// ErrNotFound is returned when a key does not exist in the store.
+var ErrNotFound = errors.New("object not found")
+
+// Store keeps generated files such as export results.
+type Store interface {
+	// Put stores size bytes read from r under key.
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Open returns a reader for the object stored under key.
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the object; deleting a missing key is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// FromEnv builds the store selected by EXPORT_STORAGE ("local" or "s3").
+func FromEnv() Store {
+	switch strings.ToLower(config.GetEnv("EXPORT_STORAGE", "local")) {
+	case "s3":
+		return &S3Store{
+			Endpoint:     strings.TrimRight(config.GetEnv("S3_ENDPOINT", "https://s3.amazonaws.com"), "/"),
+			Region:       config.GetEnv("S3_REGION", "us-east-1"),
+			Bucket:       config.GetEnv("S3_BUCKET", ""),
+			AccessKey:    config.GetEnv("S3_ACCESS_KEY_ID", ""),
+			SecretKey:    config.GetEnv("S3_SECRET_ACCESS_KEY", ""),
+			UsePathStyle: config.GetEnvBool("S3_FORCE_PATH_STYLE", true),
+		}
+	default:
+		return &LocalStore{Dir: config.GetEnv("EXPORT_STORAGE_DIR", "exports")}
+	}
+}
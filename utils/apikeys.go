@@ -0,0 +1,191 @@
+package utils
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"project/db"
+)
+
+// APIKeyPrefix starts every key so leaked keys are easy to recognise and scan for.
+const APIKeyPrefix = "mgb_"
+
+// ErrInvalidAPIKey is returned for unknown, revoked or expired keys.
+var ErrInvalidAPIKey = errors.New("invalid API key")
+
+// APIKeyScopes are the permissions an API key may be granted. Admin access is
+// deliberately excluded so keys cannot mint further keys.
+var APIKeyScopes = []string{PermReadRegistrations, PermWriteRegistrations, PermExportPersonalData, PermUnmaskPersonalData}
+
+// APIKey is a machine credential. The secret itself is only returned once, at creation.
+type APIKey struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedBy  string     `json:"created_by"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+// HasScope reports whether the key was granted the permission.
+func (k *APIKey) HasScope(permission string) bool {
+	for _, s := range k.Scopes {
+		if s == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// IsValidAPIKeyScope reports whether the scope may be granted to an API key.
+func IsValidAPIKeyScope(scope string) bool {
+	for _, s := range APIKeyScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateAPIKey mints a key and returns the plain key alongside its stored record.
+// The key looks like mgb_<8 hex lookup id>_<secret>; only its SHA-256 is stored.
+func CreateAPIKey(name string, scopes []string, createdBy string, expiresAt *time.Time) (string, *APIKey, error) {
+	for _, s := range scopes {
+		if !IsValidAPIKeyScope(s) {
+			return "", nil, fmt.Errorf("invalid scope %q", s)
+		}
+	}
+
+	lookup, err := randomToken(4)
+	if err != nil {
+		return "", nil, err
+	}
+	secret, err := randomToken(24)
+	if err != nil {
+		return "", nil, err
+	}
+	prefix := APIKeyPrefix + lookup
+	plain := prefix + "_" + secret
+
+	query := `INSERT INTO api_keys (name, prefix, key_hash, scopes, created_by, expires_at) VALUES (?, ?, ?, ?, ?, ?)`
+	res, err := db.DB.Exec(query, name, prefix, hashSecret(plain), strings.Join(scopes, ","), createdBy, expiresAt)
+	if err != nil {
+		return "", nil, fmt.Errorf("error storing API key: %v", err)
+	}
+	id, _ := res.LastInsertId()
+
+	return plain, &APIKey{
+		ID:        id,
+		Name:      name,
+		Prefix:    prefix,
+		Scopes:    scopes,
+		CreatedBy: createdBy,
+		CreatedAt: time.Now(),
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+const apiKeyColumns = "id, name, prefix, scopes, created_by, created_at, expires_at, last_used_at, revoked_at"
+
+func scanAPIKey(scanner interface{ Scan(...interface{}) error }) (*APIKey, error) {
+	var key APIKey
+	var scopes string
+	var expires, lastUsed, revoked sql.NullTime
+	if err := scanner.Scan(&key.ID, &key.Name, &key.Prefix, &scopes, &key.CreatedBy, &key.CreatedAt, &expires, &lastUsed, &revoked); err != nil {
+		return nil, err
+	}
+	if scopes != "" {
+		key.Scopes = strings.Split(scopes, ",")
+	}
+	if expires.Valid {
+		key.ExpiresAt = &expires.Time
+	}
+	if lastUsed.Valid {
+		key.LastUsedAt = &lastUsed.Time
+	}
+	if revoked.Valid {
+		key.RevokedAt = &revoked.Time
+	}
+	return &key, nil
+}
+
+// ListAPIKeys returns every key, newest first.
+func ListAPIKeys() ([]*APIKey, error) {
+	rows, err := db.DB.Query("SELECT " + apiKeyColumns + " FROM api_keys ORDER BY id DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []*APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// RevokeAPIKey disables a key immediately. It returns false if no active key has the ID.
+func RevokeAPIKey(id int64) (bool, error) {
+	res, err := db.DB.Exec("UPDATE api_keys SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL", time.Now(), id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// AuthenticateAPIKey looks a presented key up by its prefix, checks the hash,
+// revocation and expiry, and records when it was last used.
+func AuthenticateAPIKey(plain string) (*APIKey, error) {
+	if !strings.HasPrefix(plain, APIKeyPrefix) {
+		return nil, ErrInvalidAPIKey
+	}
+	sep := strings.LastIndex(plain, "_")
+	if sep <= len(APIKeyPrefix) {
+		return nil, ErrInvalidAPIKey
+	}
+	prefix := plain[:sep]
+
+	var keyHash string
+	query := "SELECT " + apiKeyColumns + ", key_hash FROM api_keys WHERE prefix = ?"
+	row := db.DB.QueryRow(query, prefix)
+	key, err := scanAPIKey(scannerFunc(func(dest ...interface{}) error {
+		return row.Scan(append(dest, &keyHash)...)
+	}))
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidAPIKey
+	} else if err != nil {
+		return nil, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(keyHash), []byte(hashSecret(plain))) != 1 {
+		return nil, ErrInvalidAPIKey
+	}
+	if key.RevokedAt != nil || (key.ExpiresAt != nil && time.Now().After(*key.ExpiresAt)) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	// Only write last_used_at once a minute to keep busy kiosks from hammering the row.
+	if key.LastUsedAt == nil || time.Since(*key.LastUsedAt) > time.Minute {
+		if _, err := db.DB.Exec("UPDATE api_keys SET last_used_at = ? WHERE id = ?", time.Now(), key.ID); err != nil {
+			fmt.Printf("Error updating API key last_used_at: %v\n", err)
+		}
+	}
+	return key, nil
+}
+
+// scannerFunc adapts a function to the Scan interface used by scanAPIKey.
+type scannerFunc func(dest ...interface{}) error
+
+func (f scannerFunc) Scan(dest ...interface{}) error { return f(dest...) }
@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"project/db"
+	"project/models"
+)
+
+// RecordAuditEvent appends an entry to the audit log.
+func RecordAuditEvent(actor, action, resource, details, ip string) error {
+	_, err := db.DB.Exec(
+		"INSERT INTO audit_events (actor, action, resource, details, ip) VALUES (?, ?, ?, ?, ?)",
+		actor, action, resource, details, ip,
+	)
+	return err
+}
+
+// ListAuditEvents returns the latest audit entries, newest first, optionally
+// only those of one actor or action.
+func ListAuditEvents(actor, action string, limit int) ([]models.AuditEvent, error) {
+	query := "SELECT id, actor, action, resource, details, ip, created_at FROM audit_events WHERE 1 = 1"
+	var args []interface{}
+	if actor != "" {
+		query += " AND actor = ?"
+		args = append(args, actor)
+	}
+	if action != "" {
+		query += " AND action = ?"
+		args = append(args, action)
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []models.AuditEvent{}
+	for rows.Next() {
+		var e models.AuditEvent
+		if err := rows.Scan(&e.ID, &e.Actor, &e.Action, &e.Resource, &e.Details, &e.IP, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
@@ -2,80 +2,380 @@ package utils
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"project/config"
+	"project/db"
+	"project/models"
+	"project/outbound"
 
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
 	"google.golang.org/api/gmail/v1"
+	"google.golang.org/api/option"
+)
+
+// GmailProvider names Gmail connect flows in oauth_states.
+const GmailProvider = "gmail"
+
+// GmailScopes are requested when a mailbox is connected: reading for inbox
+// ingestion and sending for notifications. Mailboxes connected before the
+// send scope was added must be connected again to send.
+var GmailScopes = []string{gmail.GmailReadonlyScope, gmail.GmailSendScope}
+
+var (
+	// ErrGmailNotConfigured is returned when no OAuth client is configured.
+	ErrGmailNotConfigured = errors.New("Gmail OAuth client is not configured")
+	// ErrGmailAccountNotConnected is returned for mailboxes without a stored token.
+	ErrGmailAccountNotConnected = errors.New("Gmail account is not connected")
+)
+
+// gmailRevokeURL revokes a token at Google when a mailbox is disconnected.
+const gmailRevokeURL = "https://oauth2.googleapis.com/revoke"
+
+var (
+	gmailHTTPOnce sync.Once
+	gmailHTTP     *http.Client
 )
 
-// Load credentials.json and return OAuth2 config
+// gmailHTTPClient is the outbound client for Google's OAuth and Gmail APIs.
+// It only reaches Google hosts and the host of GMAIL_API_ENDPOINT, within
+// GMAIL_HTTP_TIMEOUT (default 30s) and GMAIL_MAX_RESPONSE_BYTES (default
+// 50 MiB, for messages with attachments).
+func gmailHTTPClient() *http.Client {
+	gmailHTTPOnce.Do(func() {
+		hosts := append([]string{"accounts.google.com", "*.googleapis.com"},
+			outbound.HostsFromURLs(config.GetEnv("GMAIL_API_ENDPOINT", ""))...)
+		gmailHTTP = outbound.New(outbound.Options{
+			Name:             "gmail",
+			Timeout:          config.GetEnvDuration("GMAIL_HTTP_TIMEOUT", 30*time.Second),
+			MaxResponseBytes: int64(config.GetEnvInt("GMAIL_MAX_RESPONSE_BYTES", 50<<20)),
+			AllowedHosts:     hosts,
+		})
+	})
+	return gmailHTTP
+}
+
+// gmailContext makes the oauth2 package send token requests with gmailHTTPClient.
+func gmailContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, oauth2.HTTPClient, gmailHTTPClient())
+}
+
+// authorizedGmailClient is gmailHTTPClient authorized by the token source.
+func authorizedGmailClient(ctx context.Context, ts oauth2.TokenSource) *http.Client {
+	base := gmailHTTPClient()
+	client := oauth2.NewClient(gmailContext(ctx), ts)
+	client.Timeout, client.CheckRedirect = base.Timeout, base.CheckRedirect
+	return client
+}
+
+// GetOAuthConfig returns the OAuth client used to connect Gmail mailboxes.
+// It is read from GMAIL_CLIENT_ID and GMAIL_CLIENT_SECRET, or else from the
+// client JSON downloaded from the Google Cloud console at
+// GMAIL_CREDENTIALS_FILE (default credentials.json). The redirect URL is
+// GMAIL_REDIRECT_URL, by default APP_BASE_URL + /gmail/callback, and must be
+// registered with the client.
 func GetOAuthConfig() (*oauth2.Config, error) {
-	b, err := ioutil.ReadFile("credentials.json")
+	baseURL := strings.TrimRight(config.GetEnv("APP_BASE_URL", "http://localhost:8080"), "/")
+	redirectURL := config.GetEnv("GMAIL_REDIRECT_URL", baseURL+"/gmail/callback")
+
+	if clientID := config.GetEnv("GMAIL_CLIENT_ID", ""); clientID != "" {
+		return &oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: config.GetEnv("GMAIL_CLIENT_SECRET", ""),
+			Endpoint:     google.Endpoint,
+			RedirectURL:  redirectURL,
+			Scopes:       GmailScopes,
+		}, nil
+	}
+
+	path := config.GetEnv("GMAIL_CREDENTIALS_FILE", "credentials.json")
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, ErrGmailNotConfigured
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to read %s: %v", path, err)
+	}
+	cfg, err := google.ConfigFromJSON(b, GmailScopes...)
 	if err != nil {
-		log.Fatalf("Unable to read credentials.json: %v", err)
-		return nil, err
+		return nil, fmt.Errorf("unable to parse %s: %v", path, err)
 	}
+	cfg.RedirectURL = redirectURL
+	return cfg, nil
+}
+
+// GmailAuthCodeURL returns the consent screen URL for a connect flow. Offline
+// access with forced consent makes Google return a refresh token every time.
+func GmailAuthCodeURL(cfg *oauth2.Config, state *OAuthState, loginHint string) string {
+	opts := []oauth2.AuthCodeOption{oauth2.AccessTypeOffline, oauth2.ApprovalForce, oauth2.S256ChallengeOption(state.CodeVerifier)}
+	if loginHint != "" {
+		opts = append(opts, oauth2.SetAuthURLParam("login_hint", loginHint))
+	}
+	return cfg.AuthCodeURL(state.State, opts...)
+}
 
-	config, err := google.ConfigFromJSON(b, gmail.GmailReadonlyScope)
+// CompleteGmailConnect exchanges the authorization code, looks up which
+// mailbox consented and stores its token. It returns the mailbox address.
+func CompleteGmailConnect(ctx context.Context, cfg *oauth2.Config, code, codeVerifier, connectedBy string) (string, error) {
+	tok, err := cfg.Exchange(gmailContext(ctx), code, oauth2.VerifierOption(codeVerifier))
+	if err != nil {
+		return "", fmt.Errorf("error exchanging authorization code: %v", err)
+	}
+	account, tok, err := gmailProfileAddress(ctx, cfg, tok)
+	if err != nil {
+		return "", err
+	}
+	if err := SaveGmailToken(account, tok, connectedBy); err != nil {
+		return "", fmt.Errorf("error saving token: %v", err)
+	}
+	return account, nil
+}
+
+// gmailProfileAddress asks Gmail which mailbox the token belongs to. The
+// token is returned again because the call may have refreshed it.
+func gmailProfileAddress(ctx context.Context, cfg *oauth2.Config, tok *oauth2.Token) (string, *oauth2.Token, error) {
+	ts := cfg.TokenSource(gmailContext(ctx), tok)
+	srv, err := gmail.NewService(ctx, option.WithHTTPClient(authorizedGmailClient(ctx, ts)))
+	if err != nil {
+		return "", nil, err
+	}
+	profile, err := srv.Users.GetProfile("me").Context(ctx).Do()
+	if err != nil {
+		return "", nil, fmt.Errorf("error reading Gmail profile: %v", err)
+	}
+	current, err := ts.Token()
+	if err != nil {
+		return "", nil, err
+	}
+	return strings.ToLower(profile.EmailAddress), current, nil
+}
+
+// GetClient returns an HTTP client authorized for the mailbox. Access tokens
+// are refreshed automatically and every refreshed token is written back, so
+// the stored refresh token stays current.
+func GetClient(ctx context.Context, cfg *oauth2.Config, account string) (*http.Client, error) {
+	tok, err := loadGmailToken(account)
 	if err != nil {
-		log.Fatalf("Unable to parse client secret file to config: %v", err)
 		return nil, err
 	}
-	return config, nil
+	source := &persistingTokenSource{account: account, base: cfg.TokenSource(gmailContext(ctx), tok), last: tok.AccessToken}
+	return authorizedGmailClient(ctx, oauth2.ReuseTokenSource(tok, source)), nil
 }
 
-// Get authenticated HTTP client
-func GetClient(config *oauth2.Config) *http.Client {
-	tokFile := "token.json"
-	tok, err := tokenFromFile(tokFile)
+// GmailService returns a Gmail API client for a connected mailbox.
+// GMAIL_API_ENDPOINT points it at another server, such as a recorded or fake
+// Gmail API in tests; a local one needs OUTBOUND_ALLOW_PRIVATE_NETWORKS.
+func GmailService(ctx context.Context, account string) (*gmail.Service, error) {
+	cfg, err := GetOAuthConfig()
 	if err != nil {
-		tok = getTokenFromWeb(config)
-		saveToken(tokFile, tok)
+		return nil, err
 	}
-	return config.Client(context.Background(), tok)
+	client, err := GetClient(ctx, cfg, account)
+	if err != nil {
+		return nil, err
+	}
+	opts := []option.ClientOption{option.WithHTTPClient(client)}
+	if endpoint := config.GetEnv("GMAIL_API_ENDPOINT", ""); endpoint != "" {
+		opts = append(opts, option.WithEndpoint(endpoint))
+	}
+	return gmail.NewService(ctx, opts...)
+}
+
+// persistingTokenSource stores tokens that differ from the last stored one.
+type persistingTokenSource struct {
+	account string
+	base    oauth2.TokenSource
+
+	mu   sync.Mutex
+	last string // access token last written to the database
 }
 
-// Request user authorization
-func getTokenFromWeb(config *oauth2.Config) *oauth2.Token {
-	authURL := config.AuthCodeURL("state-token", oauth2.AccessTypeOffline)
-	fmt.Printf("Go to the following link in your browser:\n%v\n", authURL)
+// Token returns a valid token, refreshing and persisting it when needed.
+func (s *persistingTokenSource) Token() (*oauth2.Token, error) {
+	tok, err := s.base.Token()
+	if err != nil {
+		if dbErr := recordGmailTokenError(s.account, err); dbErr != nil {
+			log.Printf("❌ Error recording token error of %s: %v", s.account, dbErr)
+		}
+		return nil, fmt.Errorf("error refreshing token of %s: %v", s.account, err)
+	}
 
-	var authCode string
-	fmt.Print("Enter the authorization code: ")
-	fmt.Scan(&authCode)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if tok.AccessToken != s.last {
+		// The refreshed token is usable even if storing it fails; the stored
+		// refresh token still works for the next process.
+		if err := updateGmailToken(s.account, tok); err != nil {
+			log.Printf("❌ Error storing refreshed token of %s: %v", s.account, err)
+		} else {
+			s.last = tok.AccessToken
+		}
+	}
+	return tok, nil
+}
 
-	tok, err := config.Exchange(context.TODO(), authCode)
+// SaveGmailToken stores the mailbox token encrypted. Google omits the refresh
+// token on some re-consents, in which case the stored one is kept.
+func SaveGmailToken(account string, tok *oauth2.Token, connectedBy string) error {
+	if tok.RefreshToken == "" {
+		if existing, err := loadGmailToken(account); err == nil {
+			tok.RefreshToken = existing.RefreshToken
+		} else if err != ErrGmailAccountNotConnected {
+			return err
+		}
+	}
+	encrypted, err := encryptGmailToken(tok)
 	if err != nil {
-		log.Fatalf("Unable to retrieve token from web: %v", err)
+		return err
 	}
-	return tok
+
+	query := `INSERT INTO gmail_accounts (account, token, scopes, connected_by, token_expiry, last_refreshed_at, last_error)
+		VALUES (?, ?, ?, ?, ?, ?, NULL)
+		ON DUPLICATE KEY UPDATE token = VALUES(token), scopes = VALUES(scopes), connected_by = VALUES(connected_by),
+			token_expiry = VALUES(token_expiry), last_refreshed_at = VALUES(last_refreshed_at), last_error = NULL`
+	_, err = db.DB.Exec(query, account, encrypted, strings.Join(GmailScopes, ","), connectedBy, tokenExpiry(tok), time.Now())
+	return err
 }
 
-// Load token from file
-func tokenFromFile(file string) (*oauth2.Token, error) {
-	f, err := os.Open(file)
+func updateGmailToken(account string, tok *oauth2.Token) error {
+	encrypted, err := encryptGmailToken(tok)
 	if err != nil {
+		return err
+	}
+	query := "UPDATE gmail_accounts SET token = ?, token_expiry = ?, last_refreshed_at = ?, last_error = NULL WHERE account = ?"
+	_, err = db.DB.Exec(query, encrypted, tokenExpiry(tok), time.Now(), account)
+	return err
+}
+
+func recordGmailTokenError(account string, tokenErr error) error {
+	_, err := db.DB.Exec("UPDATE gmail_accounts SET last_error = ? WHERE account = ?", tokenErr.Error(), account)
+	return err
+}
+
+func loadGmailToken(account string) (*oauth2.Token, error) {
+	var encrypted string
+	err := db.DB.QueryRow("SELECT token FROM gmail_accounts WHERE account = ?", account).Scan(&encrypted)
+	if err == sql.ErrNoRows {
+		return nil, ErrGmailAccountNotConnected
+	} else if err != nil {
 		return nil, err
 	}
-	defer f.Close()
+
+	plain, err := DecryptString(encrypted)
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting token of %s: %v", account, err)
+	}
 	tok := &oauth2.Token{}
-	err = json.NewDecoder(f).Decode(tok)
-	return tok, err
+	if err := json.Unmarshal([]byte(plain), tok); err != nil {
+		return nil, fmt.Errorf("invalid stored token of %s: %v", account, err)
+	}
+	return tok, nil
+}
+
+func encryptGmailToken(tok *oauth2.Token) (string, error) {
+	encoded, err := json.Marshal(tok)
+	if err != nil {
+		return "", err
+	}
+	return EncryptString(string(encoded))
+}
+
+// tokenExpiry is the NULL-able expiry column value of a token.
+func tokenExpiry(tok *oauth2.Token) *time.Time {
+	if tok.Expiry.IsZero() {
+		return nil
+	}
+	return &tok.Expiry
 }
 
-// Save token to file
-func saveToken(path string, token *oauth2.Token) {
-	fmt.Printf("Saving credential file to: %s\n", path)
-	f, err := os.Create(path)
+// ListGmailAccounts returns the connected mailboxes without their tokens.
+func ListGmailAccounts() ([]models.GmailAccount, error) {
+	query := `SELECT account, scopes, connected_by, token_expiry, last_refreshed_at, last_error, created_at, updated_at
+		FROM gmail_accounts ORDER BY account`
+	rows, err := db.DB.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	accounts := []models.GmailAccount{}
+	for rows.Next() {
+		var a models.GmailAccount
+		var scopes string
+		var expiry, refreshed sql.NullTime
+		var lastError sql.NullString
+		if err := rows.Scan(&a.Account, &scopes, &a.ConnectedBy, &expiry, &refreshed, &lastError, &a.CreatedAt, &a.UpdatedAt); err != nil {
+			return nil, err
+		}
+		a.Scopes = strings.Split(scopes, ",")
+		if expiry.Valid {
+			a.TokenExpiry = &expiry.Time
+		}
+		if refreshed.Valid {
+			a.LastRefreshedAt = &refreshed.Time
+		}
+		a.LastError = lastError.String
+		accounts = append(accounts, a)
+	}
+	return accounts, rows.Err()
+}
+
+// DisconnectGmailAccount revokes the mailbox token at Google and deletes it.
+// Revocation is best effort: the stored token is deleted even if Google
+// cannot be reached, so the server can no longer use it either way.
+func DisconnectGmailAccount(ctx context.Context, account string) error {
+	tok, err := loadGmailToken(account)
+	if err != nil {
+		return err
+	}
+
+	revoke := tok.RefreshToken
+	if revoke == "" {
+		revoke = tok.AccessToken
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, gmailRevokeURL, strings.NewReader(url.Values{"token": {revoke}}.Encode()))
+	if err == nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if res, err := gmailHTTPClient().Do(req); err != nil {
+			log.Printf("❌ Error revoking token of %s: %v", account, err)
+		} else {
+			res.Body.Close()
+		}
+	}
+
+	_, err = db.DB.Exec("DELETE FROM gmail_accounts WHERE account = ?", account)
+	return err
+}
+
+// ImportLegacyGmailToken moves a token.json written by the old command-line
+// consent flow into the database, returning the mailbox it belongs to.
+func ImportLegacyGmailToken(ctx context.Context, path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	tok := &oauth2.Token{}
+	if err := json.Unmarshal(b, tok); err != nil {
+		return "", fmt.Errorf("invalid token file %s: %v", path, err)
+	}
+
+	cfg, err := GetOAuthConfig()
+	if err != nil {
+		return "", err
+	}
+	account, tok, err := gmailProfileAddress(ctx, cfg, tok)
 	if err != nil {
-		log.Fatalf("Unable to save OAuth token: %v", err)
+		return "", err
 	}
-	defer f.Close()
-	json.NewEncoder(f).Encode(token)
+	return account, SaveGmailToken(account, tok, "import:"+path)
 }
@@ -0,0 +1,110 @@
+package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// encryptedPrefix marks values produced by EncryptString so the format can evolve.
+const encryptedPrefix = "v1:"
+
+// secretKey derives the AES-256 key from SECRET_KEY.
+func secretKey() ([]byte, error) {
+	secret := os.Getenv("SECRET_KEY")
+	if secret == "" {
+		return nil, fmt.Errorf("SECRET_KEY is not set in environment variables")
+	}
+	sum := sha256.Sum256([]byte(secret))
+	return sum[:], nil
+}
+
+// EncryptString encrypts a value with AES-GCM for storage at rest.
+func EncryptString(plaintext string) (string, error) {
+	key, err := secretKey()
+	if err != nil {
+		return "", err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptString reverses EncryptString.
+func DecryptString(ciphertext string) (string, error) {
+	if !strings.HasPrefix(ciphertext, encryptedPrefix) {
+		return "", fmt.Errorf("value is not encrypted")
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(ciphertext, encryptedPrefix))
+	if err != nil {
+		return "", err
+	}
+
+	key, err := secretKey()
+	if err != nil {
+		return "", err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	if len(raw) < gcm.NonceSize() {
+		return "", fmt.Errorf("encrypted value is too short")
+	}
+
+	plaintext, err := gcm.Open(nil, raw[:gcm.NonceSize()], raw[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("error decrypting value: %v", err)
+	}
+	return string(plaintext), nil
+}
+
+// RandomHex returns n random bytes encoded as hex, for identifiers that must not be guessable.
+func RandomHex(n int) (string, error) {
+	return randomToken(n)
+}
+
+// SignValue returns an HMAC-SHA256 of the parts keyed by SECRET_KEY, used for signed URLs.
+func SignValue(parts ...string) (string, error) {
+	key, err := secretKey()
+	if err != nil {
+		return "", err
+	}
+	// Derive a separate signing key so the encryption key is never used for MACs.
+	signingKey := sha256.Sum256(append([]byte("signing:"), key...))
+	mac := hmac.New(sha256.New, signingKey[:])
+	mac.Write([]byte(strings.Join(parts, "\n")))
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// VerifySignedValue checks a signature produced by SignValue in constant time.
+func VerifySignedValue(signature string, parts ...string) bool {
+	expected, err := SignValue(parts...)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
@@ -0,0 +1,94 @@
+package utils
+
+import (
+	"database/sql"
+	"time"
+
+	"project/db"
+)
+
+// GetIdentityUsername returns the signupusers account linked to an external
+// identity, or "" if the identity has not been seen before.
+func GetIdentityUsername(provider, subject string) (string, error) {
+	var username string
+	query := "SELECT username FROM user_identities WHERE provider = ? AND subject = ?"
+	err := db.DB.QueryRow(query, provider, subject).Scan(&username)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return username, err
+}
+
+// LinkIdentity records that an external identity belongs to a signupusers account.
+func LinkIdentity(provider, subject, username, email string) error {
+	query := "INSERT INTO user_identities (provider, subject, username, email) VALUES (?, ?, ?, ?)"
+	_, err := db.DB.Exec(query, provider, subject, username, email)
+	return err
+}
+
+// CreateExternalUser creates an account for someone who signed in through an
+// identity provider. The random password cannot be used to log in, and the
+// email counts as verified because the provider vouched for it.
+func CreateExternalUser(email string) error {
+	password, err := randomToken(32)
+	if err != nil {
+		return err
+	}
+	hashedPassword, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO signupusers (username, password, dob, email_verified, email_verified_at, role) VALUES (?, ?, '', 1, ?, ?)`
+	_, err = db.DB.Exec(query, email, hashedPassword, time.Now(), DefaultRole)
+	return err
+}
+
+// ClaimAccountForIdentity prepares an existing account with the provider's
+// verified email for linking. If the address was never verified, whoever
+// registered it did not prove they own it, so its password, authenticator
+// and recovery codes are replaced and only the provider can sign in. The
+// email is then verified.
+func ClaimAccountForIdentity(username string) error {
+	password, err := randomToken(32)
+	if err != nil {
+		return err
+	}
+	hashedPassword, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var verified bool
+	if err := tx.QueryRow("SELECT email_verified FROM signupusers WHERE username = ? FOR UPDATE", username).Scan(&verified); err != nil {
+		return err
+	}
+	if !verified {
+		query := `UPDATE signupusers SET password = ?, totp_secret = NULL, totp_enabled = 0, totp_last_step = 0,
+			totp_failed_attempts = 0, totp_locked_until = NULL WHERE username = ?`
+		if _, err := tx.Exec(query, hashedPassword, username); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("DELETE FROM mfa_recovery_codes WHERE username = ?", username); err != nil {
+			return err
+		}
+	}
+	query := "UPDATE signupusers SET email_verified = 1, email_verified_at = COALESCE(email_verified_at, ?) WHERE username = ?"
+	if _, err := tx.Exec(query, time.Now(), username); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// MarkEmailVerified flags the account's email address as verified.
+func MarkEmailVerified(username string) error {
+	query := "UPDATE signupusers SET email_verified = 1, email_verified_at = COALESCE(email_verified_at, ?) WHERE username = ?"
+	_, err := db.DB.Exec(query, time.Now(), username)
+	return err
+}
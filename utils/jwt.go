@@ -8,8 +8,74 @@ import (
 	"github.com/golang-jwt/jwt/v4"
 )
 
-// GenerateJWT generates a JWT token for a given username.
-func GenerateJWT(username string) (string, error) {
+// PurposeMFA marks a short-lived token that only proves the password step of a two-step login.
+const PurposeMFA = "mfa"
+
+// mfaChallengeTTL is how long the user has to enter their second factor.
+const mfaChallengeTTL = 5 * time.Minute
+
+// GenerateJWT generates a JWT token for a given username. The role and
+// whether the session completed two-factor authentication travel as claims.
+func GenerateJWT(username, role string, mfa bool) (string, error) {
+	return signToken(jwt.MapClaims{
+		"username": username,
+		"role":     role,
+		"mfa":      mfa,
+		"exp":      time.Now().Add(24 * time.Hour).Unix(), // token expires in 24 hours
+	})
+}
+
+// GenerateMFAChallengeToken issues the token returned by the password step of
+// a login for accounts with two-factor authentication enabled.
+func GenerateMFAChallengeToken(username string) (string, error) {
+	return signToken(jwt.MapClaims{
+		"username": username,
+		"purpose":  PurposeMFA,
+		"exp":      time.Now().Add(mfaChallengeTTL).Unix(),
+	})
+}
+
+// ParseMFAChallengeToken validates an MFA challenge token and returns its username.
+func ParseMFAChallengeToken(tokenString string) (string, error) {
+	claims, err := ParseJWT(tokenString)
+	if err != nil {
+		return "", err
+	}
+	if purpose, _ := claims["purpose"].(string); purpose != PurposeMFA {
+		return "", fmt.Errorf("not an MFA challenge token")
+	}
+	username, ok := claims["username"].(string)
+	if !ok {
+		return "", fmt.Errorf("invalid token payload")
+	}
+	return username, nil
+}
+
+// ParseJWT validates a token signed with JWT_SECRET and returns its claims.
+func ParseJWT(tokenString string) (jwt.MapClaims, error) {
+	secretKey := os.Getenv("JWT_SECRET")
+	if secretKey == "" {
+		return nil, fmt.Errorf("JWT_SECRET is not set in environment variables")
+	}
+
+	claims := jwt.MapClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return []byte(secretKey), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, fmt.Errorf("invalid token")
+	}
+	return claims, nil
+}
+
+// signToken signs claims with JWT_SECRET using HS256.
+func signToken(claims jwt.MapClaims) (string, error) {
 	// Get the secret key from environment variables.
 	jwtSecret := os.Getenv("JWT_SECRET")
 	if jwtSecret == "" {
@@ -17,10 +83,7 @@ func GenerateJWT(username string) (string, error) {
 	}
 
 	// Create a new token object with signing method and claims.
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"username": username,
-		"exp":      time.Now().Add(24 * time.Hour).Unix(), // token expires in 24 hours
-	})
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
 	// Sign and get the complete encoded token as a string.
 	return token.SignedString([]byte(jwtSecret))
@@ -0,0 +1,97 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"project/masking"
+)
+
+// SettingMaskingPolicy stores the admin overrides of DefaultMaskingPolicies as JSON.
+const SettingMaskingPolicy = "masking_policy"
+
+// Pseudo-roles with their own masking policy.
+const (
+	MaskingRoleAPIKey    = "api_key"   // requests authenticated with an API key
+	MaskingRoleAnonymous = "anonymous" // unauthenticated endpoints
+)
+
+// DefaultMaskingPolicies apply until an admin changes them. Emails and phone
+// numbers are partially masked for everyone; unmasked values need
+// PermUnmaskPersonalData and an explicit unmask=true.
+var DefaultMaskingPolicies = map[string]masking.Policy{
+	RoleAdmin:            {"email": masking.ModePartial, "phone_no": masking.ModePartial},
+	RoleStaff:            {"email": masking.ModePartial, "phone_no": masking.ModePartial},
+	RoleViewer:           {"name": masking.ModePartial, "email": masking.ModePartial, "phone_no": masking.ModePartial},
+	MaskingRoleAPIKey:    {"email": masking.ModePartial, "phone_no": masking.ModePartial},
+	MaskingRoleAnonymous: {"name": masking.ModePartial, "email": masking.ModeFull, "phone_no": masking.ModeFull, "registration_no": masking.ModePartial},
+}
+
+// IsMaskingRole reports whether a masking policy can be set for the role.
+func IsMaskingRole(role string) bool {
+	_, ok := DefaultMaskingPolicies[role]
+	return ok
+}
+
+// MaskingPolicies returns the effective policy of every role: the stored
+// policy of a role replaces its default as a whole.
+func MaskingPolicies() (map[string]masking.Policy, error) {
+	policies := make(map[string]masking.Policy, len(DefaultMaskingPolicies))
+	for role, policy := range DefaultMaskingPolicies {
+		policies[role] = policy
+	}
+
+	value, ok, err := GetSetting(SettingMaskingPolicy)
+	if err != nil || !ok {
+		return policies, err
+	}
+	var stored map[string]masking.Policy
+	if err := json.Unmarshal([]byte(value), &stored); err != nil {
+		return nil, fmt.Errorf("invalid stored masking policy: %v", err)
+	}
+	for role, policy := range stored {
+		if IsMaskingRole(role) {
+			policies[role] = policy
+		}
+	}
+	return policies, nil
+}
+
+// MaskingPolicyFor returns the effective policy of a role or pseudo-role.
+// Unknown roles get the anonymous policy.
+func MaskingPolicyFor(role string) (masking.Policy, error) {
+	policies, err := MaskingPolicies()
+	if err != nil {
+		return nil, err
+	}
+	if policy, ok := policies[role]; ok {
+		return policy, nil
+	}
+	return policies[MaskingRoleAnonymous], nil
+}
+
+// SetMaskingPolicies validates and stores policies for some roles, keeping
+// the current policy of the roles that are not listed.
+func SetMaskingPolicies(changes map[string]masking.Policy, updatedBy string) error {
+	for role, policy := range changes {
+		if !IsMaskingRole(role) {
+			return fmt.Errorf("unknown role %q", role)
+		}
+		if err := policy.Validate(); err != nil {
+			return fmt.Errorf("%s: %v", role, err)
+		}
+	}
+
+	policies, err := MaskingPolicies()
+	if err != nil {
+		return err
+	}
+	for role, policy := range changes {
+		policies[role] = policy
+	}
+	value, err := json.Marshal(policies)
+	if err != nil {
+		return err
+	}
+	return SetSetting(SettingMaskingPolicy, string(value), updatedBy)
+}
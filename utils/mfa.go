@@ -0,0 +1,206 @@
+package utils
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"project/db"
+)
+
+// ErrMFALocked is returned after too many wrong codes until the lock expires.
+var ErrMFALocked = errors.New("two-factor authentication temporarily locked")
+
+const (
+	maxTOTPFailures   = 5
+	totpLockDuration  = 15 * time.Minute
+	recoveryCodeCount = 10
+)
+
+// MFAState is the two-factor configuration of a signupusers record.
+type MFAState struct {
+	Secret         string // decrypted base32 secret, empty if never enrolled
+	Enabled        bool
+	LastStep       int64
+	FailedAttempts int
+	LockedUntil    time.Time
+}
+
+// GetMFAState loads and decrypts the user's TOTP configuration.
+func GetMFAState(username string) (*MFAState, error) {
+	query := `SELECT totp_secret, totp_enabled, totp_last_step, totp_failed_attempts, totp_locked_until
+		FROM signupusers WHERE username = ?`
+	var secret sql.NullString
+	var locked sql.NullTime
+	state := &MFAState{}
+	err := db.DB.QueryRow(query, username).Scan(&secret, &state.Enabled, &state.LastStep, &state.FailedAttempts, &locked)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("user not found")
+	} else if err != nil {
+		return nil, err
+	}
+
+	state.LockedUntil = locked.Time
+	if secret.Valid && secret.String != "" {
+		if state.Secret, err = DecryptString(secret.String); err != nil {
+			return nil, err
+		}
+	}
+	return state, nil
+}
+
+// SetPendingTOTPSecret stores a new secret that becomes active once confirmed.
+func SetPendingTOTPSecret(username, secret string) error {
+	encrypted, err := EncryptString(secret)
+	if err != nil {
+		return err
+	}
+	query := `UPDATE signupusers SET totp_secret = ?, totp_enabled = 0, totp_last_step = 0 WHERE username = ?`
+	_, err = db.DB.Exec(query, encrypted, username)
+	return err
+}
+
+// EnableTOTP activates the pending secret.
+func EnableTOTP(username string) error {
+	_, err := db.DB.Exec("UPDATE signupusers SET totp_enabled = 1 WHERE username = ?", username)
+	return err
+}
+
+// DisableTOTP removes the secret and any recovery codes.
+func DisableTOTP(username string) error {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE signupusers SET totp_secret = NULL, totp_enabled = 0, totp_last_step = 0,
+		totp_failed_attempts = 0, totp_locked_until = NULL WHERE username = ?`
+	if _, err := tx.Exec(query, username); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM mfa_recovery_codes WHERE username = ?", username); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// VerifyTOTP checks a code for the user, enforcing replay protection and the
+// failed-attempt lock. It works for both pending and enabled secrets.
+func VerifyTOTP(username, code string) (bool, error) {
+	state, err := GetMFAState(username)
+	if err != nil {
+		return false, err
+	}
+	if state.Secret == "" {
+		return false, nil
+	}
+	if time.Now().Before(state.LockedUntil) {
+		return false, ErrMFALocked
+	}
+
+	// The step is claimed in the UPDATE itself, so of two requests with the
+	// same code only one succeeds.
+	step, ok := ValidateTOTP(state.Secret, code, time.Now())
+	if ok && step > state.LastStep {
+		query := `UPDATE signupusers SET totp_last_step = ?, totp_failed_attempts = 0, totp_locked_until = NULL
+			WHERE username = ? AND totp_last_step < ?`
+		res, err := db.DB.Exec(query, step, username, step)
+		if err != nil {
+			return false, err
+		}
+		if count, err := res.RowsAffected(); err != nil {
+			return false, err
+		} else if count == 1 {
+			return true, nil
+		}
+	}
+
+	return false, recordMFAFailure(username)
+}
+
+// recordMFAFailure counts a wrong TOTP or recovery code and locks the second
+// factor after too many. The count is incremented in the database so parallel
+// guesses all count, and the lock is decided from the stored count.
+func recordMFAFailure(username string) error {
+	query := "UPDATE signupusers SET totp_failed_attempts = totp_failed_attempts + 1 WHERE username = ?"
+	if _, err := db.DB.Exec(query, username); err != nil {
+		return err
+	}
+	query = `UPDATE signupusers SET totp_failed_attempts = 0, totp_locked_until = ?
+		WHERE username = ? AND totp_failed_attempts >= ?`
+	_, err := db.DB.Exec(query, time.Now().Add(totpLockDuration), username, maxTOTPFailures)
+	return err
+}
+
+// mfaLocked reports whether the second factor is locked after wrong codes.
+func mfaLocked(username string) (bool, error) {
+	var locked sql.NullTime
+	err := db.DB.QueryRow("SELECT totp_locked_until FROM signupusers WHERE username = ?", username).Scan(&locked)
+	if err != nil {
+		return false, err
+	}
+	return locked.Valid && time.Now().Before(locked.Time), nil
+}
+
+// GenerateRecoveryCodes replaces the user's recovery codes and returns the new plain codes.
+func GenerateRecoveryCodes(username string) ([]string, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM mfa_recovery_codes WHERE username = ?", username); err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw, err := randomToken(5)
+		if err != nil {
+			return nil, err
+		}
+		code := raw[:5] + "-" + raw[5:]
+		if _, err := tx.Exec("INSERT INTO mfa_recovery_codes (username, code_hash) VALUES (?, ?)", username, hashSecret(code)); err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, tx.Commit()
+}
+
+// ConsumeRecoveryCode marks a recovery code as used; each code works once.
+// Wrong codes count toward the same lock as wrong TOTP codes.
+func ConsumeRecoveryCode(username, code string) (bool, error) {
+	if locked, err := mfaLocked(username); err != nil {
+		return false, err
+	} else if locked {
+		return false, ErrMFALocked
+	}
+
+	code = strings.ToLower(strings.TrimSpace(code))
+	query := `UPDATE mfa_recovery_codes SET used_at = ? WHERE username = ? AND code_hash = ? AND used_at IS NULL`
+	res, err := db.DB.Exec(query, time.Now(), username, hashSecret(code))
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if n == 0 {
+		return false, recordMFAFailure(username)
+	}
+	return true, nil
+}
+
+// RemainingRecoveryCodes counts the user's unused recovery codes.
+func RemainingRecoveryCodes(username string) (int, error) {
+	var count int
+	query := "SELECT COUNT(*) FROM mfa_recovery_codes WHERE username = ? AND used_at IS NULL"
+	err := db.DB.QueryRow(query, username).Scan(&count)
+	return count, err
+}
@@ -0,0 +1,76 @@
+package utils
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"project/db"
+)
+
+// ErrInvalidOAuthState is returned for unknown, reused or expired state values.
+var ErrInvalidOAuthState = errors.New("invalid or expired OAuth state")
+
+// OAuthState is the server-side record of an authorization redirect in flight.
+type OAuthState struct {
+	State        string
+	Provider     string
+	Nonce        string
+	CodeVerifier string
+	Username     string // the logged-in user who started the flow, if any
+}
+
+// OAuthStateTTL bounds how long a user may take on the provider's consent screen.
+const OAuthStateTTL = 10 * time.Minute
+
+// NewOAuthState creates and stores a random state, nonce and PKCE verifier for the provider.
+func NewOAuthState(provider, codeVerifier string) (*OAuthState, error) {
+	return NewUserOAuthState(provider, codeVerifier, "")
+}
+
+// NewUserOAuthState is NewOAuthState for a flow started by a logged-in user,
+// such as connecting a mailbox; the callback learns who it was from the state.
+func NewUserOAuthState(provider, codeVerifier, username string) (*OAuthState, error) {
+	state, err := randomToken(24)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := randomToken(24)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `INSERT INTO oauth_states (state_hash, provider, nonce, code_verifier, username, expires_at) VALUES (?, ?, ?, ?, ?, ?)`
+	if _, err := db.DB.Exec(query, hashSecret(state), provider, nonce, codeVerifier, username, time.Now().Add(OAuthStateTTL)); err != nil {
+		return nil, err
+	}
+	return &OAuthState{State: state, Provider: provider, Nonce: nonce, CodeVerifier: codeVerifier, Username: username}, nil
+}
+
+// ConsumeOAuthState loads and deletes a state so each redirect can complete only once.
+func ConsumeOAuthState(provider, state string) (*OAuthState, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result := &OAuthState{State: state, Provider: provider}
+	query := `SELECT nonce, code_verifier, username FROM oauth_states
+		WHERE state_hash = ? AND provider = ? AND expires_at > ? FOR UPDATE`
+	err = tx.QueryRow(query, hashSecret(state), provider, time.Now()).Scan(&result.Nonce, &result.CodeVerifier, &result.Username)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidOAuthState
+	} else if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec("DELETE FROM oauth_states WHERE state_hash = ?", hashSecret(state)); err != nil {
+		return nil, err
+	}
+	// Opportunistically drop abandoned redirects.
+	if _, err := tx.Exec("DELETE FROM oauth_states WHERE expires_at < ?", time.Now()); err != nil {
+		return nil, err
+	}
+	return result, tx.Commit()
+}
@@ -0,0 +1,169 @@
+package utils
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"project/db"
+	"project/models"
+)
+
+// DOBLayout is the date format accepted for dates of birth.
+const DOBLayout = "2006-01-02"
+
+// ParseDOB validates a date of birth: a real calendar date, not in the future
+// and not before 1900.
+func ParseDOB(value string) (time.Time, error) {
+	dob, err := time.Parse(DOBLayout, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("dob must be a valid date in YYYY-MM-DD format")
+	}
+	if dob.After(time.Now()) {
+		return time.Time{}, fmt.Errorf("dob cannot be in the future")
+	}
+	if dob.Year() < 1900 {
+		return time.Time{}, fmt.Errorf("dob must be after 1900")
+	}
+	return dob, nil
+}
+
+// GetProfile loads the profile joined with the account flags from signupusers.
+// Accounts created before profiles existed fall back to signupusers.dob.
+func GetProfile(username string) (*models.Profile, error) {
+	query := `SELECT s.username, s.dob, s.role, s.email_verified, s.totp_enabled, s.deletion_scheduled_at,
+			p.display_name, p.dob, p.preferences
+		FROM signupusers s LEFT JOIN user_profiles p ON p.username = s.username
+		WHERE s.username = ?`
+
+	var profile models.Profile
+	var legacyDOB string
+	var displayName, preferences sql.NullString
+	var dob, deletion sql.NullTime
+	err := db.DB.QueryRow(query, username).Scan(&profile.Username, &legacyDOB, &profile.Role, &profile.EmailVerified,
+		&profile.TOTPEnabled, &deletion, &displayName, &dob, &preferences)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	profile.DisplayName = displayName.String
+	profile.DOB = legacyDOB
+	if dob.Valid {
+		profile.DOB = dob.Time.Format(DOBLayout)
+	}
+	if deletion.Valid {
+		profile.DeletionScheduledAt = &deletion.Time
+	}
+	profile.Preferences = map[string]interface{}{}
+	if preferences.Valid && preferences.String != "" {
+		if err := json.Unmarshal([]byte(preferences.String), &profile.Preferences); err != nil {
+			return nil, fmt.Errorf("error decoding preferences: %v", err)
+		}
+	}
+	return &profile, nil
+}
+
+// SaveProfile creates or replaces the user_profiles row.
+func SaveProfile(profile *models.Profile) error {
+	preferences, err := json.Marshal(profile.Preferences)
+	if err != nil {
+		return err
+	}
+
+	var dob interface{}
+	if profile.DOB != "" {
+		parsed, err := ParseDOB(profile.DOB)
+		if err != nil {
+			return err
+		}
+		dob = parsed
+	}
+
+	query := `INSERT INTO user_profiles (username, display_name, dob, preferences) VALUES (?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE display_name = VALUES(display_name), dob = VALUES(dob),
+			preferences = VALUES(preferences), updated_at = CURRENT_TIMESTAMP`
+	_, err = db.DB.Exec(query, profile.Username, profile.DisplayName, dob, string(preferences))
+	return err
+}
+
+// ScheduleAccountDeletion marks the account for deletion after the grace period.
+func ScheduleAccountDeletion(username string, grace time.Duration) (time.Time, error) {
+	at := time.Now().Add(grace)
+	_, err := db.DB.Exec("UPDATE signupusers SET deletion_scheduled_at = ? WHERE username = ?", at, username)
+	return at, err
+}
+
+// CancelAccountDeletion clears a pending deletion.
+func CancelAccountDeletion(username string) error {
+	_, err := db.DB.Exec("UPDATE signupusers SET deletion_scheduled_at = NULL WHERE username = ?", username)
+	return err
+}
+
+// accountTables lists the per-account tables removed with the account.
+var accountTables = []string{
+	"user_profiles",
+	"mfa_recovery_codes",
+	"email_verifications",
+	"user_identities",
+	"chat_messages",
+	"chat_conversations",
+	"signupusers",
+}
+
+// PurgeDeletedAccounts removes accounts whose deletion grace period has passed.
+func PurgeDeletedAccounts() (int, error) {
+	rows, err := db.DB.Query("SELECT username FROM signupusers WHERE deletion_scheduled_at IS NOT NULL AND deletion_scheduled_at <= ?", time.Now())
+	if err != nil {
+		return 0, err
+	}
+	var usernames []string
+	for rows.Next() {
+		var username string
+		if err := rows.Scan(&username); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		usernames = append(usernames, username)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for i, username := range usernames {
+		if err := deleteAccount(username); err != nil {
+			return i, fmt.Errorf("error deleting account %s: %v", username, err)
+		}
+	}
+	return len(usernames), nil
+}
+
+func deleteAccount(username string) error {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := DeleteAccountRows(tx, username); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DeleteAccountRows removes an account and its per-account rows within tx,
+// returning the number of deleted rows per table.
+func DeleteAccountRows(tx *sql.Tx, username string) (map[string]int64, error) {
+	counts := make(map[string]int64, len(accountTables))
+	for _, table := range accountTables {
+		res, err := tx.Exec("DELETE FROM "+table+" WHERE username = ?", username)
+		if err != nil {
+			return nil, err
+		}
+		counts[table], _ = res.RowsAffected()
+	}
+	return counts, nil
+}
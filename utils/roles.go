@@ -0,0 +1,86 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+
+	"project/config"
+	"project/db"
+)
+
+// Permissions checked by middleware.RequirePermission.
+const (
+	PermReadRegistrations  = "registrations:read"
+	PermWriteRegistrations = "registrations:write"
+	PermExportPersonalData = "personal_data:export"
+	PermUnmaskPersonalData = "personal_data:unmask"
+	PermAdmin              = "admin"
+)
+
+// Roles stored in signupusers.role.
+const (
+	RoleAdmin  = "admin"
+	RoleStaff  = "staff"
+	RoleViewer = "viewer"
+)
+
+// DefaultRole is assigned to new sign-ups, accounts created through an
+// identity provider and tokens without a role claim. It only grants read
+// access; staff and admins are granted through PUT /admin/users/:username/role.
+const DefaultRole = RoleViewer
+
+// RolePermissions maps each role to the permissions it grants.
+var RolePermissions = map[string][]string{
+	RoleAdmin:  {PermReadRegistrations, PermWriteRegistrations, PermExportPersonalData, PermUnmaskPersonalData, PermAdmin},
+	RoleStaff:  {PermReadRegistrations, PermWriteRegistrations, PermExportPersonalData},
+	RoleViewer: {PermReadRegistrations},
+}
+
+// RoleHasPermission reports whether the role grants the permission.
+func RoleHasPermission(role, permission string) bool {
+	for _, p := range RolePermissions[role] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// IsValidRole reports whether the role is known.
+func IsValidRole(role string) bool {
+	_, ok := RolePermissions[role]
+	return ok
+}
+
+// SetUserRole changes the role of a signupusers record.
+func SetUserRole(username, role string) error {
+	if !IsValidRole(role) {
+		return fmt.Errorf("unknown role %q", role)
+	}
+	res, err := db.DB.Exec("UPDATE signupusers SET role = ? WHERE username = ?", role, username)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		if exists, err := UserExists(username); err != nil || !exists {
+			return fmt.Errorf("user not found")
+		}
+	}
+	return nil
+}
+
+// EnsureAdmins promotes the accounts listed in ADMIN_USERNAMES so a fresh
+// deployment always has someone who can manage roles and policies.
+func EnsureAdmins() error {
+	admins := config.GetEnvList("ADMIN_USERNAMES")
+	if len(admins) == 0 {
+		return nil
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(admins)), ",")
+	args := []interface{}{RoleAdmin}
+	for _, a := range admins {
+		args = append(args, a)
+	}
+	_, err := db.DB.Exec("UPDATE signupusers SET role = ? WHERE username IN ("+placeholders+")", args...)
+	return err
+}
@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"database/sql"
+	"strconv"
+
+	"project/config"
+	"project/db"
+)
+
+// Setting names stored in app_settings.
+const (
+	SettingMFARequiredForPersonalData = "mfa_required_for_personal_data"
+)
+
+// GetSetting returns the stored value of a setting, or "" and false if unset.
+func GetSetting(name string) (string, bool, error) {
+	var value string
+	err := db.DB.QueryRow("SELECT value FROM app_settings WHERE name = ?", name).Scan(&value)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	} else if err != nil {
+		return "", false, err
+	}
+	return value, true, nil
+}
+
+// SetSetting stores a setting, recording who changed it.
+func SetSetting(name, value, updatedBy string) error {
+	query := `INSERT INTO app_settings (name, value, updated_by) VALUES (?, ?, ?)
+		ON DUPLICATE KEY UPDATE value = VALUES(value), updated_by = VALUES(updated_by), updated_at = CURRENT_TIMESTAMP`
+	_, err := db.DB.Exec(query, name, value, updatedBy)
+	return err
+}
+
+// MFARequiredForPersonalData reports whether roles that can export personal
+// data must complete two-factor authentication. The admin-managed setting wins
+// over the MFA_REQUIRED_FOR_PERSONAL_DATA environment default.
+func MFARequiredForPersonalData() (bool, error) {
+	value, ok, err := GetSetting(SettingMFARequiredForPersonalData)
+	if err != nil {
+		return false, err
+	}
+	if !ok {
+		return config.GetEnvBool("MFA_REQUIRED_FOR_PERSONAL_DATA", false), nil
+	}
+	return strconv.ParseBool(value)
+}
+
+// RoleRequiresMFA reports whether the current policy requires 2FA for the role.
+func RoleRequiresMFA(role string) (bool, error) {
+	if !RoleHasPermission(role, PermExportPersonalData) {
+		return false, nil
+	}
+	return MFARequiredForPersonalData()
+}
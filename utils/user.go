@@ -3,6 +3,7 @@ package utils
 import (
 	"database/sql"
 	"fmt"
+	"time"
 
 	"project/db" // Import your db package which initializes the DB connection
 
@@ -14,6 +15,11 @@ type User struct {
 	Username       string
 	HashedPassword string
 	DOB            string
+	EmailVerified  bool
+	Role           string
+	TOTPEnabled    bool
+	// DeletionScheduledAt is set while the account waits out its deletion grace period.
+	DeletionScheduledAt *time.Time
 }
 
 // HashPassword generates a bcrypt hash of the provided password.
@@ -30,23 +36,27 @@ func CheckPasswordHash(password, hash string) bool {
 
 // CreateUser inserts a new record into the signupusers table.
 func CreateUser(username, hashedPassword, dob string) error {
-	query := "INSERT INTO signupusers (username, password, dob) VALUES (?, ?, ?)"
-	_, err := db.DB.Exec(query, username, hashedPassword, dob)
+	query := "INSERT INTO signupusers (username, password, dob, role) VALUES (?, ?, ?, ?)"
+	_, err := db.DB.Exec(query, username, hashedPassword, dob, DefaultRole)
 	return err
 }
 
 // GetUserByUsername retrieves a record from the signupusers table by username.
 func GetUserByUsername(username string) (*User, error) {
-	query := "SELECT username, password, dob FROM signupusers WHERE username = ?"
+	query := "SELECT username, password, dob, email_verified, role, totp_enabled, deletion_scheduled_at FROM signupusers WHERE username = ?"
 	row := db.DB.QueryRow(query, username)
 
 	var user User
-	err := row.Scan(&user.Username, &user.HashedPassword, &user.DOB)
+	var deletion sql.NullTime
+	err := row.Scan(&user.Username, &user.HashedPassword, &user.DOB, &user.EmailVerified, &user.Role, &user.TOTPEnabled, &deletion)
 	if err == sql.ErrNoRows {
 		return nil, nil // No record found
 	} else if err != nil {
 		return nil, err
 	}
+	if deletion.Valid {
+		user.DeletionScheduledAt = &deletion.Time
+	}
 	return &user, nil
 }
 
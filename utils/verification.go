@@ -0,0 +1,126 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"project/db"
+)
+
+// ErrInvalidVerification is returned when a verification token or code is unknown, used or expired.
+var ErrInvalidVerification = errors.New("invalid or expired verification")
+
+// VerificationTTL is how long a verification link or code stays valid.
+const VerificationTTL = 24 * time.Hour
+
+// maxCodeAttempts caps wrong codes per verification so six digits cannot be brute forced.
+const maxCodeAttempts = 5
+
+// hashSecret returns the hex SHA-256 of a secret so raw tokens never reach the database.
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// randomToken returns n random bytes encoded as hex.
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// randomDigits returns a numeric code of the given length.
+func randomDigits(length int) (string, error) {
+	code := make([]byte, length)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, big.NewInt(10))
+		if err != nil {
+			return "", err
+		}
+		code[i] = byte('0' + n.Int64())
+	}
+	return string(code), nil
+}
+
+// CreateEmailVerification stores a new verification for the user and returns
+// the link token and the six-digit code to send to them.
+func CreateEmailVerification(username string) (token, code string, err error) {
+	if token, err = randomToken(32); err != nil {
+		return "", "", err
+	}
+	if code, err = randomDigits(6); err != nil {
+		return "", "", err
+	}
+
+	query := `INSERT INTO email_verifications (username, token_hash, code_hash, expires_at) VALUES (?, ?, ?, ?)`
+	_, err = db.DB.Exec(query, username, hashSecret(token), hashSecret(username+":"+code), time.Now().Add(VerificationTTL))
+	if err != nil {
+		return "", "", fmt.Errorf("error storing verification: %v", err)
+	}
+	return token, code, nil
+}
+
+// VerificationStats reports how many verifications were issued to the user
+// since the given time and when the latest one was issued.
+func VerificationStats(username string, since time.Time) (count int, last time.Time, err error) {
+	query := `SELECT COUNT(*), MAX(created_at) FROM email_verifications WHERE username = ? AND created_at >= ?`
+	var lastCreated sql.NullTime
+	if err = db.DB.QueryRow(query, username, since).Scan(&count, &lastCreated); err != nil {
+		return 0, time.Time{}, err
+	}
+	return count, lastCreated.Time, nil
+}
+
+// ConsumeVerificationToken marks the token as used and returns the username it belongs to.
+func ConsumeVerificationToken(token string) (string, error) {
+	return consumeVerification("token_hash = ?", hashSecret(token))
+}
+
+// ConsumeVerificationCode marks the user's code as used.
+func ConsumeVerificationCode(username, code string) error {
+	_, err := consumeVerification("username = ? AND code_hash = ?", username, hashSecret(username+":"+code))
+	if err == ErrInvalidVerification {
+		// Count the failed attempt against every open verification of this user.
+		query := `UPDATE email_verifications SET attempts = attempts + 1 WHERE username = ? AND used_at IS NULL`
+		if _, updateErr := db.DB.Exec(query, username); updateErr != nil {
+			return updateErr
+		}
+	}
+	return err
+}
+
+func consumeVerification(where string, args ...interface{}) (string, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var id int64
+	var username string
+	query := `SELECT id, username FROM email_verifications
+		WHERE ` + where + ` AND used_at IS NULL AND attempts < ? AND expires_at > ?
+		ORDER BY id DESC LIMIT 1 FOR UPDATE`
+	err = tx.QueryRow(query, append(args, maxCodeAttempts, time.Now())...).Scan(&id, &username)
+	if err == sql.ErrNoRows {
+		return "", ErrInvalidVerification
+	} else if err != nil {
+		return "", err
+	}
+
+	if _, err := tx.Exec(`UPDATE email_verifications SET used_at = ? WHERE id = ?`, time.Now(), id); err != nil {
+		return "", err
+	}
+	if _, err := tx.Exec(`UPDATE signupusers SET email_verified = 1, email_verified_at = ? WHERE username = ?`, time.Now(), username); err != nil {
+		return "", err
+	}
+	return username, tx.Commit()
+}
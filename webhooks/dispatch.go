@@ -0,0 +1,335 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"project/config"
+	"project/db"
+	"project/models"
+	"project/outbound"
+	"project/outbox"
+)
+
+// queue leases due deliveries for five minutes; if a dispatcher dies while
+// sending, the delivery becomes due again when the lease ends.
+var queue = outbox.Queue{
+	Table:   "webhook_deliveries",
+	Pending: models.WebhookPending,
+	Sending: models.WebhookSending,
+	Lease:   5 * time.Minute,
+	Batch:   100,
+}
+
+// responseLogBytes is how much of a response body the attempt log keeps.
+const responseLogBytes = 1024
+
+var (
+	clientOnce sync.Once
+	client     *http.Client
+)
+
+// httpClient sends deliveries with WEBHOOK_TIMEOUT (default 10s) and does not
+// follow redirects, so a delivery only ever reaches the subscribed URL. It
+// refuses private addresses and, when WEBHOOK_ALLOWED_HOSTS is set, any
+// other host.
+func httpClient() *http.Client {
+	clientOnce.Do(func() {
+		client = outbound.New(outbound.Options{
+			Name:             "webhooks",
+			Timeout:          config.GetEnvDuration("WEBHOOK_TIMEOUT", 10*time.Second),
+			MaxResponseBytes: 1 << 20,
+			AllowedHosts:     config.GetEnvList("WEBHOOK_ALLOWED_HOSTS"),
+		})
+	})
+	return client
+}
+
+// DeliverPending is the scheduled dispatcher job.
+func DeliverPending() {
+	delivered, failed, err := Dispatch(context.Background())
+	if err != nil {
+		log.Printf("❌ Error dispatching webhooks: %v", err)
+	}
+	if failed > 0 {
+		log.Printf("❌ %d webhook deliveries failed, %d delivered", failed, delivered)
+	}
+}
+
+// Dispatch sends the deliveries that are due and returns how many succeeded
+// and failed this attempt. Failed ones are retried after 30 seconds, doubling
+// up to 12 hours, until WEBHOOK_MAX_ATTEMPTS (default 10) is reached.
+func Dispatch(ctx context.Context) (delivered, failed int, err error) {
+	return outbox.Dispatch(queue, GetDelivery, func(d *models.WebhookDelivery) (bool, error) {
+		return send(ctx, d)
+	})
+}
+
+// send makes one attempt, logs it and updates the delivery. It reports
+// whether the receiver accepted it; errors are database failures only.
+func send(ctx context.Context, d *models.WebhookDelivery) (bool, error) {
+	secret, target, ok, err := subscriptionSecret(d.SubscriptionID)
+	if err != nil {
+		return false, err
+	}
+	if !ok {
+		_, err := db.DB.Exec("UPDATE webhook_deliveries SET status = ?, last_error = ? WHERE id = ?",
+			models.WebhookFailed, "subscription deleted or disabled", d.ID)
+		return false, err
+	}
+	event, err := getEvent(d.EventID)
+	if err != nil {
+		return false, err
+	}
+	if event == nil {
+		_, err := db.DB.Exec("UPDATE webhook_deliveries SET status = ?, last_error = ? WHERE id = ?",
+			models.WebhookFailed, "event no longer exists", d.ID)
+		return false, err
+	}
+	body, err := envelope(*event)
+	if err != nil {
+		return false, err
+	}
+
+	attempt := models.WebhookAttempt{Attempt: d.Attempts + 1, CreatedAt: time.Now()}
+	attempt.StatusCode, attempt.ResponseBody, err = post(ctx, target, secret, *event, body)
+	attempt.DurationMS = time.Since(attempt.CreatedAt).Milliseconds()
+	if err != nil {
+		attempt.Error = err.Error()
+	} else if attempt.StatusCode < 200 || attempt.StatusCode > 299 {
+		attempt.Error = "receiver answered " + strconv.Itoa(attempt.StatusCode)
+	}
+	success := attempt.Error == ""
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec(`INSERT INTO webhook_attempts (delivery_id, attempt, status_code, error, response_body, duration_ms, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		d.ID, attempt.Attempt, attempt.StatusCode, attempt.Error, attempt.ResponseBody, attempt.DurationMS, attempt.CreatedAt)
+	if err != nil {
+		return false, err
+	}
+	if success {
+		_, err = tx.Exec("UPDATE webhook_deliveries SET status = ?, attempts = ?, last_status_code = ?, last_error = NULL, delivered_at = ? WHERE id = ?",
+			models.WebhookDelivered, attempt.Attempt, attempt.StatusCode, time.Now(), d.ID)
+	} else {
+		status := models.WebhookPending
+		if attempt.Attempt >= config.GetEnvInt("WEBHOOK_MAX_ATTEMPTS", 10) {
+			status = models.WebhookFailed
+		}
+		_, err = tx.Exec("UPDATE webhook_deliveries SET status = ?, attempts = ?, last_status_code = ?, last_error = ?, next_attempt_at = ? WHERE id = ?",
+			status, attempt.Attempt, attempt.StatusCode, attempt.Error, time.Now().Add(outbox.Backoff(attempt.Attempt, 30*time.Second, 12*time.Hour)), d.ID)
+	}
+	if err != nil {
+		return false, err
+	}
+	return success, tx.Commit()
+}
+
+// post signs and sends the body, returning the status and the start of the response.
+func post(ctx context.Context, target, secret string, event models.WebhookEvent, body []byte) (int, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return 0, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "registrations-webhooks/1")
+	req.Header.Set(HeaderEventID, strconv.FormatInt(event.ID, 10))
+	req.Header.Set(HeaderEventType, event.Type)
+	req.Header.Set(HeaderSignature, Sign(secret, time.Now(), body))
+
+	resp, err := httpClient().Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	start, _ := io.ReadAll(io.LimitReader(resp.Body, responseLogBytes))
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	return resp.StatusCode, strings.ToValidUTF8(string(start), string(utf8.RuneError)), nil
+}
+
+// getEvent returns an event, or nil if it was purged or erased.
+func getEvent(id int64) (*models.WebhookEvent, error) {
+	var e models.WebhookEvent
+	var data string
+	err := db.DB.QueryRow("SELECT id, type, data, created_at FROM webhook_events WHERE id = ?", id).Scan(&e.ID, &e.Type, &data, &e.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	e.Data = json.RawMessage(data)
+	return &e, nil
+}
+
+// deliveryColumns is the select list scanDelivery expects.
+const deliveryColumns = `d.id, d.subscription_id, d.event_id, COALESCE(e.type, ''), d.status, d.attempts, d.next_attempt_at,
+	d.last_status_code, d.last_error, d.replay_of, d.created_at, d.delivered_at`
+
+// deliveryFrom joins deliveries to their events for deliveryColumns.
+const deliveryFrom = " FROM webhook_deliveries d LEFT JOIN webhook_events e ON e.id = d.event_id"
+
+// scanDelivery reads one delivery row.
+func scanDelivery(row interface{ Scan(...interface{}) error }) (*models.WebhookDelivery, error) {
+	var d models.WebhookDelivery
+	var lastError sql.NullString
+	var replayOf sql.NullInt64
+	var deliveredAt sql.NullTime
+	err := row.Scan(&d.ID, &d.SubscriptionID, &d.EventID, &d.EventType, &d.Status, &d.Attempts, &d.NextAttemptAt,
+		&d.LastStatusCode, &lastError, &replayOf, &d.CreatedAt, &deliveredAt)
+	if err != nil {
+		return nil, err
+	}
+	d.LastError = lastError.String
+	if replayOf.Valid {
+		d.ReplayOf = &replayOf.Int64
+	}
+	if deliveredAt.Valid {
+		d.DeliveredAt = &deliveredAt.Time
+	}
+	return &d, nil
+}
+
+// GetDelivery returns a delivery, or nil if it does not exist.
+func GetDelivery(id int64) (*models.WebhookDelivery, error) {
+	d, err := scanDelivery(db.DB.QueryRow("SELECT "+deliveryColumns+deliveryFrom+" WHERE d.id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return d, err
+}
+
+// ListDeliveries returns the newest deliveries of a subscription, optionally
+// only those with a status.
+func ListDeliveries(subscriptionID int64, status string, limit int) ([]models.WebhookDelivery, error) {
+	query := "SELECT " + deliveryColumns + deliveryFrom + " WHERE d.subscription_id = ?"
+	args := []interface{}{subscriptionID}
+	if status != "" {
+		query += " AND d.status = ?"
+		args = append(args, status)
+	}
+	query += " ORDER BY d.id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []models.WebhookDelivery{}
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, *d)
+	}
+	return deliveries, rows.Err()
+}
+
+// ListAttempts returns the logged requests of a delivery, oldest first.
+func ListAttempts(deliveryID int64) ([]models.WebhookAttempt, error) {
+	rows, err := db.DB.Query(`SELECT attempt, status_code, error, response_body, duration_ms, created_at
+		FROM webhook_attempts WHERE delivery_id = ? ORDER BY attempt, id`, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attempts := []models.WebhookAttempt{}
+	for rows.Next() {
+		var a models.WebhookAttempt
+		var attemptErr, body sql.NullString
+		if err := rows.Scan(&a.Attempt, &a.StatusCode, &attemptErr, &body, &a.DurationMS, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		a.Error, a.ResponseBody = attemptErr.String, body.String
+		attempts = append(attempts, a)
+	}
+	return attempts, rows.Err()
+}
+
+// Replay queues a delivery's event again for the same subscription as a new
+// delivery. The event id is unchanged so receivers can recognize repeats.
+func Replay(deliveryID int64) (*models.WebhookDelivery, error) {
+	original, err := GetDelivery(deliveryID)
+	if err != nil || original == nil {
+		return nil, err
+	}
+	event, err := getEvent(original.EventID)
+	if err != nil {
+		return nil, err
+	}
+	if event == nil {
+		return nil, fmt.Errorf("the event of delivery %d no longer exists", deliveryID)
+	}
+	if sub, err := GetSubscription(original.SubscriptionID); err != nil {
+		return nil, err
+	} else if sub == nil || !sub.Enabled {
+		return nil, fmt.Errorf("subscription %d is deleted or disabled", original.SubscriptionID)
+	}
+
+	res, err := db.DB.Exec("INSERT INTO webhook_deliveries (subscription_id, event_id, status, next_attempt_at, replay_of) VALUES (?, ?, ?, ?, ?)",
+		original.SubscriptionID, original.EventID, models.WebhookPending, time.Now(), original.ID)
+	if err != nil {
+		return nil, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	return GetDelivery(id)
+}
+
+// PurgeDelivered deletes finished deliveries, their attempts and events no
+// longer referenced once they are older than WEBHOOK_RETENTION (default 30
+// days); events carry personal data.
+func PurgeDelivered() {
+	cutoff := time.Now().Add(-config.GetEnvDuration("WEBHOOK_RETENTION", 30*24*time.Hour))
+	statements := []struct {
+		query string
+		args  []interface{}
+	}{
+		{`DELETE a FROM webhook_attempts a JOIN webhook_deliveries d ON d.id = a.delivery_id
+			WHERE d.status IN (?, ?) AND d.created_at < ?`, []interface{}{models.WebhookDelivered, models.WebhookFailed, cutoff}},
+		{"DELETE FROM webhook_deliveries WHERE status IN (?, ?) AND created_at < ?", []interface{}{models.WebhookDelivered, models.WebhookFailed, cutoff}},
+		{`DELETE FROM webhook_events WHERE created_at < ?
+			AND NOT EXISTS (SELECT 1 FROM webhook_deliveries d WHERE d.event_id = webhook_events.id)`, []interface{}{cutoff}},
+	}
+	for _, s := range statements {
+		if _, err := db.DB.Exec(s.query, s.args...); err != nil {
+			log.Printf("❌ Error purging webhook deliveries: %v", err)
+			return
+		}
+	}
+}
+
+// DeleteForEmail removes the events carrying an email address, for data
+// subject erasure. Their unsent deliveries fail when they come due.
+func DeleteForEmail(tx *sql.Tx, email string) (int64, error) {
+	quoted, err := json.Marshal(email)
+	if err != nil {
+		return 0, err
+	}
+	pattern := `%"email":` + db.EscapeLike(string(quoted)) + `%`
+	res, err := tx.Exec("DELETE FROM webhook_events WHERE data LIKE ?", pattern)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
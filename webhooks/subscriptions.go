@@ -0,0 +1,217 @@
+package webhooks
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"project/config"
+	"project/db"
+	"project/models"
+	"project/outbound"
+	"project/utils"
+)
+
+// querier is satisfied by *sql.DB and *sql.Tx.
+type querier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// subscriptionColumns is the select list scanSubscription expects.
+const subscriptionColumns = "id, url, events, description, enabled, created_by, created_at, updated_at"
+
+// scanSubscription reads one webhook_subscriptions row without its secret.
+func scanSubscription(row interface{ Scan(...interface{}) error }) (*models.WebhookSubscription, error) {
+	var sub models.WebhookSubscription
+	var events string
+	if err := row.Scan(&sub.ID, &sub.URL, &events, &sub.Description, &sub.Enabled, &sub.CreatedBy, &sub.CreatedAt, &sub.UpdatedAt); err != nil {
+		return nil, err
+	}
+	sub.Events = strings.Split(events, ",")
+	return &sub, nil
+}
+
+// listSubscriptions returns the subscriptions, only enabled ones if asked.
+func listSubscriptions(q querier, enabledOnly bool) ([]models.WebhookSubscription, error) {
+	query := "SELECT " + subscriptionColumns + " FROM webhook_subscriptions"
+	if enabledOnly {
+		query += " WHERE enabled = 1"
+	}
+	rows, err := q.Query(query + " ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subs := []models.WebhookSubscription{}
+	for rows.Next() {
+		sub, err := scanSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, *sub)
+	}
+	return subs, rows.Err()
+}
+
+// ListSubscriptions returns every subscription, without secrets.
+func ListSubscriptions() ([]models.WebhookSubscription, error) {
+	return listSubscriptions(db.DB, false)
+}
+
+// GetSubscription returns a subscription without its secret, or nil if it does not exist.
+func GetSubscription(id int64) (*models.WebhookSubscription, error) {
+	sub, err := scanSubscription(db.DB.QueryRow("SELECT "+subscriptionColumns+" FROM webhook_subscriptions WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return sub, err
+}
+
+// ValidateSubscription checks the URL and event types, normalizing the events.
+// The URL must be allowed by WEBHOOK_ALLOWED_HOSTS and must not name a
+// private address; deliveries check the resolved address again.
+func ValidateSubscription(sub *models.WebhookSubscription) error {
+	err := outbound.CheckURL(sub.URL, config.GetEnvList("WEBHOOK_ALLOWED_HOSTS"))
+	switch {
+	case errors.Is(err, outbound.ErrHostNotAllowed):
+		return fmt.Errorf("url host is not on the allowed list")
+	case errors.Is(err, outbound.ErrPrivateAddress):
+		return fmt.Errorf("url must not point to a private or local address")
+	case err != nil:
+		return err
+	}
+	if len(sub.URL) > 2048 {
+		return fmt.Errorf("url must be at most 2048 characters")
+	}
+	if len(sub.Description) > 255 {
+		return fmt.Errorf("description must be at most 255 characters")
+	}
+	if len(sub.Events) == 0 {
+		return fmt.Errorf("events is required, any of %s", strings.Join(models.WebhookEventTypes, ", "))
+	}
+	seen := map[string]bool{}
+	var events []string
+	for _, e := range sub.Events {
+		e = strings.TrimSpace(e)
+		known := false
+		for _, t := range models.WebhookEventTypes {
+			known = known || t == e
+		}
+		if !known {
+			return fmt.Errorf("unknown event %q, expected any of %s", e, strings.Join(models.WebhookEventTypes, ", "))
+		}
+		if !seen[e] {
+			seen[e] = true
+			events = append(events, e)
+		}
+	}
+	sub.Events = events
+	return nil
+}
+
+// newSecret generates a signing secret.
+func newSecret() (string, error) {
+	token, err := utils.RandomHex(24)
+	if err != nil {
+		return "", err
+	}
+	return "whsec_" + token, nil
+}
+
+// CreateSubscription stores a validated subscription. A secret is generated
+// unless one is given; either way it is returned in sub.Secret this once.
+func CreateSubscription(sub *models.WebhookSubscription) error {
+	if sub.Secret == "" {
+		secret, err := newSecret()
+		if err != nil {
+			return err
+		}
+		sub.Secret = secret
+	}
+	encrypted, err := utils.EncryptString(sub.Secret)
+	if err != nil {
+		return err
+	}
+
+	sub.CreatedAt = time.Now()
+	sub.UpdatedAt = sub.CreatedAt
+	res, err := db.DB.Exec(`INSERT INTO webhook_subscriptions (url, events, description, secret, enabled, created_by, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		sub.URL, strings.Join(sub.Events, ","), sub.Description, encrypted, sub.Enabled, sub.CreatedBy, sub.CreatedAt, sub.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	sub.ID, err = res.LastInsertId()
+	return err
+}
+
+// UpdateSubscription saves the URL, events, description and enabled flag.
+// With rotateSecret a new secret replaces the old one and is returned in sub.Secret.
+func UpdateSubscription(sub *models.WebhookSubscription, rotateSecret bool) error {
+	sub.UpdatedAt = time.Now()
+	query := "UPDATE webhook_subscriptions SET url = ?, events = ?, description = ?, enabled = ?, updated_at = ?"
+	args := []interface{}{sub.URL, strings.Join(sub.Events, ","), sub.Description, sub.Enabled, sub.UpdatedAt}
+	if rotateSecret {
+		secret, err := newSecret()
+		if err != nil {
+			return err
+		}
+		encrypted, err := utils.EncryptString(secret)
+		if err != nil {
+			return err
+		}
+		sub.Secret = secret
+		query += ", secret = ?"
+		args = append(args, encrypted)
+	}
+	_, err := db.DB.Exec(query+" WHERE id = ?", append(args, sub.ID)...)
+	return err
+}
+
+// DeleteSubscription removes a subscription and fails its pending deliveries,
+// keeping the delivery log. It reports false if the subscription did not exist.
+func DeleteSubscription(id int64) (bool, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("DELETE FROM webhook_subscriptions WHERE id = ?", id)
+	if err != nil {
+		return false, err
+	}
+	if count, _ := res.RowsAffected(); count == 0 {
+		return false, nil
+	}
+	_, err = tx.Exec("UPDATE webhook_deliveries SET status = ?, last_error = ? WHERE subscription_id = ? AND status IN (?, ?)",
+		models.WebhookFailed, "subscription deleted", id, models.WebhookPending, models.WebhookSending)
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// subscriptionSecret returns the decrypted signing secret and URL of an
+// enabled subscription, or ok=false if it was deleted or disabled.
+func subscriptionSecret(id int64) (secret, target string, ok bool, err error) {
+	var encrypted string
+	var enabled bool
+	err = db.DB.QueryRow("SELECT url, secret, enabled FROM webhook_subscriptions WHERE id = ?", id).Scan(&target, &encrypted, &enabled)
+	if err == sql.ErrNoRows {
+		return "", "", false, nil
+	} else if err != nil {
+		return "", "", false, err
+	}
+	if !enabled {
+		return "", "", false, nil
+	}
+	secret, err = utils.DecryptString(encrypted)
+	if err != nil {
+		return "", "", false, err
+	}
+	return secret, target, true, nil
+}
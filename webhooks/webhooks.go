@@ -0,0 +1,132 @@
+// Package webhooks sends registration events to partner systems. Events are
+// written to an outbox in the same transaction as the change they describe,
+// fanned out to every subscription selecting them, and delivered with
+// HMAC-SHA256 signatures, exponential backoff and a log of every attempt.
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"project/models"
+)
+
+// Headers sent with every delivery.
+const (
+	HeaderSignature = "X-Webhook-Signature" // t=<unix seconds>,v1=<hex HMAC-SHA256>
+	HeaderEventID   = "X-Webhook-Event-Id"  // the same for every retry and replay of an event
+	HeaderEventType = "X-Webhook-Event"
+)
+
+// Event is a change to notify subscriptions of.
+type Event struct {
+	Type string
+	Data interface{}
+}
+
+// RegistrationCreated reports a registration that reached the users table.
+func RegistrationCreated(u models.User) Event {
+	return Event{Type: models.WebhookRegistrationCreated, Data: u}
+}
+
+// RegistrationUpdated reports the new state of a changed registration.
+func RegistrationUpdated(u models.User) Event {
+	return Event{Type: models.WebhookRegistrationUpdated, Data: u}
+}
+
+// RegistrationDeleted reports a removed registration. Only the id is sent, so
+// erasing someone's data does not copy it to partners once more.
+func RegistrationDeleted(id int) Event {
+	return Event{Type: models.WebhookRegistrationDeleted, Data: map[string]int{"id": id}}
+}
+
+// Sign returns the signature header value for a body sent at time t. The
+// receiver recomputes HMAC-SHA256(secret, "<t>.<body>") and should reject
+// timestamps older than a few minutes to prevent replays by third parties.
+func Sign(secret string, t time.Time, body []byte) string {
+	timestamp := strconv.FormatInt(t.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "t=" + timestamp + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Enqueue records events within tx and creates a pending delivery for every
+// enabled subscription that selects them. Events nobody subscribes to are
+// not stored.
+func Enqueue(tx *sql.Tx, events ...Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+	subs, err := listSubscriptions(tx, true)
+	if err != nil {
+		return fmt.Errorf("error loading webhook subscriptions: %v", err)
+	}
+	if len(subs) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	for _, event := range events {
+		var targets []int64
+		for _, sub := range subs {
+			if selects(sub, event.Type) {
+				targets = append(targets, sub.ID)
+			}
+		}
+		if len(targets) == 0 {
+			continue
+		}
+
+		data, err := json.Marshal(event.Data)
+		if err != nil {
+			return err
+		}
+		res, err := tx.Exec("INSERT INTO webhook_events (type, data, created_at) VALUES (?, ?, ?)", event.Type, string(data), now)
+		if err != nil {
+			return fmt.Errorf("error recording webhook event: %v", err)
+		}
+		eventID, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+
+		placeholders := strings.TrimSuffix(strings.Repeat("(?, ?, ?, ?),", len(targets)), ",")
+		args := make([]interface{}, 0, 4*len(targets))
+		for _, subID := range targets {
+			args = append(args, subID, eventID, models.WebhookPending, now)
+		}
+		query := "INSERT INTO webhook_deliveries (subscription_id, event_id, status, next_attempt_at) VALUES " + placeholders
+		if _, err := tx.Exec(query, args...); err != nil {
+			return fmt.Errorf("error queueing webhook deliveries: %v", err)
+		}
+	}
+	return nil
+}
+
+// selects reports whether the subscription wants the event type.
+func selects(sub models.WebhookSubscription, eventType string) bool {
+	for _, e := range sub.Events {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// envelope is the body of a delivery.
+func envelope(event models.WebhookEvent) ([]byte, error) {
+	return json.Marshal(struct {
+		ID        string          `json:"id"`
+		Type      string          `json:"type"`
+		CreatedAt time.Time       `json:"created_at"`
+		Data      json.RawMessage `json:"data"`
+	}{strconv.FormatInt(event.ID, 10), event.Type, event.CreatedAt, event.Data})
+}